@@ -0,0 +1,398 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/compose-spec/compose-go/errdefs"
+	"github.com/compose-spec/compose-go/loader"
+	"github.com/compose-spec/compose-go/types"
+	"github.com/pkg/errors"
+)
+
+// Severity is the severity of a lint finding
+type Severity int
+
+const (
+	// SeverityOff disables a lint rule
+	SeverityOff Severity = iota
+	// SeverityInfo is for findings which are only informative
+	SeverityInfo
+	// SeverityWarning is for findings which are likely to be a mistake
+	SeverityWarning
+	// SeverityError is for findings which prevent the project from being used
+	SeverityError
+)
+
+var severityNames = map[Severity]string{
+	SeverityOff:     "off",
+	SeverityInfo:    "info",
+	SeverityWarning: "warning",
+	SeverityError:   "error",
+}
+
+func (s Severity) String() string {
+	if name, ok := severityNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("severity(%d)", int(s))
+}
+
+// MarshalJSON makes Severity implement json.Marshaler
+func (s Severity) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// LintRule is a check run against a loaded project
+type LintRule struct {
+	Name     string
+	Severity Severity
+	Check    func(project *types.Project) []Diagnostic
+}
+
+// LintLoadRule is the rule reporting a project which can't be loaded
+const LintLoadRule = "load"
+
+// LintRules are the lint rules run by Check, with their default severity
+var LintRules = []LintRule{
+	{Name: "image-latest-tag", Severity: SeverityWarning, Check: checkImageLatestTag},
+	{Name: "privileged", Severity: SeverityWarning, Check: checkPrivileged},
+	{Name: "missing-healthcheck", Severity: SeverityInfo, Check: checkMissingHealthcheck},
+	{Name: "unused-resource", Severity: SeverityInfo, Check: checkUnusedResources},
+}
+
+// LintConfig configures lint rules severities and the severity making Check fail
+type LintConfig struct {
+	// Severities overrides the default severity of lint rules, by rule name. SeverityOff disables a rule
+	Severities map[string]Severity
+	// FailOn is the minimum severity of a finding to fail the check. Defaults to SeverityError
+	FailOn Severity
+}
+
+// Diagnostic is a lint finding
+type Diagnostic struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	File     string   `json:"file,omitempty"`
+	Line     int      `json:"line,omitempty"`
+	Path     string   `json:"path,omitempty"`
+	Message  string   `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	var location string
+	switch {
+	case d.File != "" && d.Line > 0:
+		location = fmt.Sprintf("%s:%d: ", d.File, d.Line)
+	case d.File != "":
+		location = d.File + ": "
+	}
+	path := ""
+	if d.Path != "" {
+		path = d.Path + ": "
+	}
+	return fmt.Sprintf("%s%s [%s] %s%s", location, d.Severity, d.Rule, path, d.Message)
+}
+
+// CheckResult is the outcome of Check
+type CheckResult struct {
+	// Project is the loaded project, nil if it can't be loaded
+	Project     *types.Project
+	Diagnostics []Diagnostic
+	// ByRule groups Diagnostics by lint rule name
+	ByRule map[string][]Diagnostic
+	// ByFile groups Diagnostics by compose file, findings which can't be attributed to a file use an empty key
+	ByFile map[string][]Diagnostic
+	// Counts is the number of Diagnostics by severity
+	Counts map[Severity]int
+	failOn Severity
+	// dir is the directory the file names of Diagnostics are relative to
+	dir string
+}
+
+// Failed returns true if any finding has at least the configured failure severity
+func (r CheckResult) Failed() bool {
+	for severity, count := range r.Counts {
+		if severity >= r.failOn && count > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Text renders findings one per line, followed by a summary line
+func (r CheckResult) Text() string {
+	var b strings.Builder
+	for _, d := range r.Diagnostics {
+		b.WriteString(d.String())
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "%d finding(s): %d error(s), %d warning(s), %d info\n",
+		len(r.Diagnostics), r.Counts[SeverityError], r.Counts[SeverityWarning], r.Counts[SeverityInfo])
+	return b.String()
+}
+
+// JSON renders findings and the summary as JSON
+func (r CheckResult) JSON() ([]byte, error) {
+	counts := map[string]int{}
+	for _, severity := range []Severity{SeverityError, SeverityWarning, SeverityInfo} {
+		counts[severity.String()] = r.Counts[severity]
+	}
+	diagnostics := r.Diagnostics
+	if diagnostics == nil {
+		diagnostics = []Diagnostic{}
+	}
+	return json.MarshalIndent(struct {
+		Diagnostics []Diagnostic   `json:"diagnostics"`
+		Counts      map[string]int `json:"counts"`
+		Failed      bool           `json:"failed"`
+	}{
+		Diagnostics: diagnostics,
+		Counts:      counts,
+		Failed:      r.Failed(),
+	}, "", "  ")
+}
+
+// Check loads the project and runs all lint rules against it. A project which can't be loaded is reported as a
+// finding, and error is only returned for an invalid LintConfig
+func Check(options *ProjectOptions, lint LintConfig) (*CheckResult, error) {
+	for name := range lint.Severities {
+		if !isLintRule(name) {
+			return nil, errors.Wrapf(errdefs.ErrInvalid, "unknown lint rule %q", name)
+		}
+	}
+	failOn := lint.FailOn
+	if failOn == SeverityOff {
+		failOn = SeverityError
+	}
+	// findings are reported with file names relative to the directory config paths are resolved from, if any, the
+	// failure to resolve it being reported while loading the project
+	dir, _ := options.configDir()
+	result := &CheckResult{
+		ByRule: map[string][]Diagnostic{},
+		ByFile: map[string][]Diagnostic{},
+		Counts: map[Severity]int{},
+		failOn: failOn,
+		dir:    dir,
+	}
+
+	project, configs, err := projectFromOptions(options)
+	if err != nil {
+		diagnostic := Diagnostic{Rule: LintLoadRule, Severity: SeverityError, Message: err.Error()}
+		var located *loader.LocatedError
+		if errors.As(err, &located) {
+			diagnostic.File = located.Filename
+			diagnostic.Line = located.Line
+			diagnostic.Message = located.Err.Error()
+		}
+		result.add(diagnostic)
+		return result, nil
+	}
+	result.Project = project
+
+	file := ""
+	if len(project.ComposeFiles) == 1 {
+		file = project.ComposeFiles[0]
+	}
+	locate := newLocator(project.ComposeFiles, configs)
+	var diagnostics []Diagnostic
+	for _, rule := range LintRules {
+		severity := rule.Severity
+		if s, ok := lint.Severities[rule.Name]; ok {
+			severity = s
+		}
+		if severity == SeverityOff {
+			continue
+		}
+		for _, d := range rule.Check(project) {
+			d.Rule = rule.Name
+			d.Severity = severity
+			if d.File == "" && d.Line == 0 {
+				d.File, d.Line = locate(d.Path)
+			}
+			if d.File == "" {
+				d.File = file
+			}
+			diagnostics = append(diagnostics, d)
+		}
+	}
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i], diagnostics[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Path < b.Path
+	})
+	for _, d := range diagnostics {
+		result.add(d)
+	}
+	return result, nil
+}
+
+// newLocator returns a function telling the compose file, named after names, and the line declaring the value at a
+// dotted path or its closest parent, the last file declaring it winning as it overrides the previous ones. No file is
+// returned for a path none declares
+func newLocator(names []string, configs []types.ConfigFile) func(path string) (string, int) {
+	positions := make([][]map[string]types.Position, len(configs))
+	for i, config := range configs {
+		// the files have been loaded already, so they can be parsed again
+		positions[i], _ = loader.ParseYAMLPositions(config.Content)
+	}
+	return func(path string) (string, int) {
+		for path != "" {
+			for i := len(positions) - 1; i >= 0; i-- {
+				for j := len(positions[i]) - 1; j >= 0; j-- {
+					if position, ok := positions[i][j][path]; ok {
+						return names[i], position.Line
+					}
+				}
+			}
+			i := strings.LastIndex(path, ".")
+			if i < 0 {
+				break
+			}
+			path = path[:i]
+		}
+		return "", 0
+	}
+}
+
+func (r *CheckResult) add(d Diagnostic) {
+	d.File = relativeFile(r.dir, d.File)
+	r.Diagnostics = append(r.Diagnostics, d)
+	r.ByRule[d.Rule] = append(r.ByRule[d.Rule], d)
+	r.ByFile[d.File] = append(r.ByFile[d.File], d)
+	r.Counts[d.Severity]++
+}
+
+// relativeFile returns the name of file relative to dir, or its absolute path if not within dir. file is returned as
+// is when dir is not set
+func relativeFile(dir, file string) string {
+	if dir == "" || file == "" || file == "-" {
+		return file
+	}
+	path := resolvePath(dir, file)
+	if rel, err := filepath.Rel(dir, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return rel
+	}
+	return path
+}
+
+func isLintRule(name string) bool {
+	if name == LintLoadRule {
+		return true
+	}
+	for _, rule := range LintRules {
+		if rule.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func checkImageLatestTag(project *types.Project) []Diagnostic {
+	var diagnostics []Diagnostic
+	for _, s := range project.Services {
+		if s.Image == "" || strings.Contains(s.Image, "@") {
+			continue
+		}
+		name := s.Image[strings.LastIndex(s.Image, "/")+1:]
+		if i := strings.LastIndex(name, ":"); i < 0 || name[i+1:] == "latest" {
+			diagnostics = append(diagnostics, Diagnostic{
+				Path:    fmt.Sprintf("services.%s.image", s.Name),
+				Message: fmt.Sprintf("image %s doesn't use a pinned tag", s.Image),
+			})
+		}
+	}
+	return diagnostics
+}
+
+func checkPrivileged(project *types.Project) []Diagnostic {
+	var diagnostics []Diagnostic
+	for _, s := range project.Services {
+		if s.Privileged {
+			diagnostics = append(diagnostics, Diagnostic{
+				Path:    fmt.Sprintf("services.%s.privileged", s.Name),
+				Message: "service runs with extended privileges",
+			})
+		}
+	}
+	return diagnostics
+}
+
+func checkMissingHealthcheck(project *types.Project) []Diagnostic {
+	var diagnostics []Diagnostic
+	for _, s := range project.Services {
+		if s.HealthCheck == nil {
+			diagnostics = append(diagnostics, Diagnostic{
+				Path:    fmt.Sprintf("services.%s", s.Name),
+				Message: "service doesn't declare a healthcheck",
+			})
+		}
+	}
+	return diagnostics
+}
+
+func checkUnusedResources(project *types.Project) []Diagnostic {
+	networks, volumes, secrets, configs := map[string]bool{}, map[string]bool{}, map[string]bool{}, map[string]bool{}
+	for _, s := range project.Services {
+		for name := range s.Networks {
+			networks[name] = true
+		}
+		for _, volume := range s.Volumes {
+			if volume.Type == types.VolumeTypeVolume {
+				volumes[volume.Source] = true
+			}
+		}
+		for _, secret := range s.Secrets {
+			secrets[secret.Source] = true
+		}
+		if s.Build != nil {
+			for _, secret := range s.Build.Secrets {
+				secrets[secret.Source] = true
+			}
+		}
+		for _, config := range s.Configs {
+			configs[config.Source] = true
+		}
+	}
+
+	var diagnostics []Diagnostic
+	unused := func(section string, names []string, used map[string]bool) {
+		for _, name := range names {
+			if !used[name] && !(section == "networks" && name == "default") {
+				diagnostics = append(diagnostics, Diagnostic{
+					Path:    fmt.Sprintf("%s.%s", section, name),
+					Message: fmt.Sprintf("%s is not used by any service", name),
+				})
+			}
+		}
+	}
+	unused("networks", project.NetworkNames(), networks)
+	unused("volumes", project.VolumeNames(), volumes)
+	unused("secrets", project.SecretNames(), secrets)
+	unused("configs", project.ConfigNames(), configs)
+	return diagnostics
+}
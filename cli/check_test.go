@@ -0,0 +1,114 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cli
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestCheck(t *testing.T) {
+	opts, err := NewProjectOptions([]string{"testdata/lint/compose.yaml"}, WithName("lint"))
+	assert.NilError(t, err)
+
+	result, err := Check(opts, LintConfig{FailOn: SeverityWarning})
+	assert.NilError(t, err)
+	assert.Assert(t, result.Project != nil)
+	assert.Check(t, result.Failed())
+	assert.Equal(t, result.Text(), `testdata/lint/compose.yaml:3: warning [image-latest-tag] services.web.image: image nginx doesn't use a pinned tag
+testdata/lint/compose.yaml:4: warning [privileged] services.web.privileged: service runs with extended privileges
+testdata/lint/compose.yaml:7: info [missing-healthcheck] services.db: service doesn't declare a healthcheck
+testdata/lint/compose.yaml:13: info [unused-resource] volumes.cache: cache is not used by any service
+4 finding(s): 0 error(s), 2 warning(s), 2 info
+`)
+	assert.Equal(t, len(result.ByRule["privileged"]), 1)
+	assert.Equal(t, len(result.ByFile["testdata/lint/compose.yaml"]), 4)
+	assert.Equal(t, result.Counts[SeverityWarning], 2)
+
+	result, err = Check(opts, LintConfig{FailOn: SeverityError})
+	assert.NilError(t, err)
+	assert.Check(t, !result.Failed())
+
+	result, err = Check(opts, LintConfig{
+		Severities: map[string]Severity{
+			"privileged":          SeverityError,
+			"missing-healthcheck": SeverityOff,
+		},
+	})
+	assert.NilError(t, err)
+	assert.Check(t, result.Failed())
+	assert.Equal(t, len(result.Diagnostics), 3)
+
+	b, err := result.JSON()
+	assert.NilError(t, err)
+	var summary struct {
+		Counts map[string]int
+		Failed bool
+	}
+	assert.NilError(t, json.Unmarshal(b, &summary))
+	assert.DeepEqual(t, summary.Counts, map[string]int{"error": 1, "warning": 1, "info": 1})
+	assert.Check(t, summary.Failed)
+}
+
+func TestCheckInvalidProject(t *testing.T) {
+	opts, err := NewProjectOptions([]string{"testdata/lint/missing.yaml"})
+	assert.NilError(t, err)
+	result, err := Check(opts, LintConfig{})
+	assert.NilError(t, err)
+	assert.Assert(t, result.Project == nil)
+	assert.Check(t, result.Failed())
+	assert.Equal(t, result.Diagnostics[0].Rule, LintLoadRule)
+
+	_, err = Check(opts, LintConfig{Severities: map[string]Severity{"unknown": SeverityError}})
+	assert.ErrorContains(t, err, `unknown lint rule "unknown"`)
+}
+
+func TestCheckLocatesLoadErrors(t *testing.T) {
+	opts, err := NewProjectOptions([]string{"testdata/lint/invalid.yaml"}, WithName("lint"))
+	assert.NilError(t, err)
+	result, err := Check(opts, LintConfig{})
+	assert.NilError(t, err)
+	assert.Assert(t, result.Failed())
+	d := result.Diagnostics[0]
+	assert.Equal(t, d.Rule, LintLoadRule)
+	assert.Equal(t, d.File, filepath.Join("testdata", "lint", "invalid.yaml"))
+	assert.Equal(t, len(result.ByFile[d.File]), 1)
+	assert.Equal(t, d.Line, 5)
+	assert.Equal(t, d.Message, "services.web.ports.0.target must be a integer")
+}
+
+func TestCheckLocatesFindings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lint")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+	opts, err := NewProjectOptions(nil,
+		WithConfigFileContent("compose.yaml", []byte("services:\n  web:\n    image: nginx:1.25\n    privileged: false\n")),
+		WithConfigFileContent("override.yaml", []byte("services:\n  web:\n    privileged: true\n")),
+		WithWorkingDirectory(dir),
+		WithName("lint"))
+	assert.NilError(t, err)
+	result, err := Check(opts, LintConfig{Severities: map[string]Severity{"missing-healthcheck": SeverityOff}})
+	assert.NilError(t, err)
+	assert.Equal(t, result.Text(), `override.yaml:3: warning [privileged] services.web.privileged: service runs with extended privileges
+1 finding(s): 0 error(s), 1 warning(s), 0 info
+`)
+}
@@ -0,0 +1,82 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/compose-spec/compose-go/envfile"
+	"github.com/compose-spec/compose-go/template"
+	"github.com/pkg/errors"
+)
+
+// parseDotEnv reads a dotenv file and resolves variable references in its values with the compose interpolation
+// rules. References are resolved from environment, then from earlier lines in the same file, then from inherited
+// values set by previous env files. Single-quoted values are kept literal. Undefined references are replaced by an
+// empty string and reported to warn
+func parseDotEnv(r io.Reader, environment, inherited map[string]string, warn func(string)) (map[string]string, error) {
+	vars := map[string]string{}
+	lookup := func(key string) (string, bool) {
+		if v, ok := environment[key]; ok {
+			return v, true
+		}
+		if v, ok := vars[key]; ok {
+			return v, true
+		}
+		v, ok := inherited[key]
+		return v, ok
+	}
+
+	var warnUndefined template.SubstituteFunc = func(name string, mapping template.Mapping) (string, bool, error) {
+		if _, ok := mapping(name); !ok {
+			warn(fmt.Sprintf("The %q variable is not set. Defaulting to a blank string.", name))
+		}
+		return "", false, nil
+	}
+	substitute := append(append([]template.SubstituteFunc{}, template.DefaultSubstituteFuncs...), warnUndefined)
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		text = strings.TrimPrefix(text, "export ")
+
+		parts := strings.SplitN(text, "=", 2)
+		key := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || key == "" {
+			return nil, errors.Errorf("line %d: can't separate key from value", line)
+		}
+
+		value, literal := envfile.UnquoteValue(strings.TrimSpace(parts[1]))
+		if !literal {
+			resolved, err := template.SubstituteWith(value, lookup, nil, substitute...)
+			if err != nil {
+				return nil, errors.Wrapf(err, "line %d", line)
+			}
+			value = resolved
+		}
+		vars[key] = value
+	}
+	return vars, scanner.Err()
+}
@@ -0,0 +1,96 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestParseDotEnvOrdering(t *testing.T) {
+	var warnings []string
+	env, err := parseDotEnv(strings.NewReader(`
+# database
+HOST=db
+export PORT=5432
+URL=postgres://${HOST}:$PORT/app
+EARLY=${LATE}
+LATE=late
+DEFAULT=${MISSING:-fallback}
+ESCAPED=$$HOST
+LITERAL='${HOST}'
+QUOTED="${HOST} db" # comment
+`), nil, nil, func(message string) {
+		warnings = append(warnings, message)
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, env, map[string]string{
+		"HOST":    "db",
+		"PORT":    "5432",
+		"URL":     "postgres://db:5432/app",
+		"EARLY":   "",
+		"LATE":    "late",
+		"DEFAULT": "fallback",
+		"ESCAPED": "$HOST",
+		"LITERAL": "${HOST}",
+		"QUOTED":  "db db",
+	})
+	assert.DeepEqual(t, warnings, []string{`The "LATE" variable is not set. Defaulting to a blank string.`})
+}
+
+func TestParseDotEnvPrecedence(t *testing.T) {
+	env, err := parseDotEnv(strings.NewReader(`
+HOST=db
+URL=postgres://${HOST}:${PORT}
+`), map[string]string{"HOST": "from_os"}, map[string]string{"HOST": "inherited", "PORT": "1234"}, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, env["URL"], "postgres://from_os:1234")
+}
+
+func TestParseDotEnvInvalidLine(t *testing.T) {
+	_, err := parseDotEnv(strings.NewReader("FOO=bar\nBAZ\n"), nil, nil, nil)
+	assert.ErrorContains(t, err, "line 2: can't separate key from value")
+}
+
+func TestWithDotEnvResolvesReferences(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dotenv")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(filepath.Join(dir, ".env"), []byte("HOST=db\nURL=postgres://${HOST}:5432\n"), 0644)
+	assert.NilError(t, err)
+
+	opts, err := NewProjectOptions(nil, WithWorkingDirectory(dir), WithDotEnv)
+	assert.NilError(t, err)
+	assert.Equal(t, opts.Environment["URL"], "postgres://db:5432")
+
+	opts, err = NewProjectOptions(nil, WithWorkingDirectory(dir), WithEnv([]string{"HOST=from_os"}), WithDotEnv)
+	assert.NilError(t, err)
+	assert.Equal(t, opts.Environment["HOST"], "from_os")
+	assert.Equal(t, opts.Environment["URL"], "postgres://from_os:5432")
+
+	withFakeOsEnv(t, map[string]string{"HOST": "from_os"}, dir, func() {
+		opts, err := NewProjectOptions(nil, WithOsEnv, WithDotEnv)
+		assert.NilError(t, err)
+		assert.Equal(t, opts.Environment["HOST"], "from_os")
+		assert.Equal(t, opts.Environment["URL"], "postgres://from_os:5432")
+	})
+}
@@ -21,13 +21,13 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
-	"regexp"
+	"runtime"
 	"strings"
+	"sync"
 
 	"github.com/compose-spec/compose-go/errdefs"
 	"github.com/compose-spec/compose-go/loader"
 	"github.com/compose-spec/compose-go/types"
-	"github.com/joho/godotenv"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
@@ -38,7 +38,29 @@ type ProjectOptions struct {
 	WorkingDir  string
 	ConfigPaths []string
 	Environment map[string]string
-	loadOptions []func(*loader.Options)
+	// AppliedEnvFiles records the env files which have been found and applied to Environment, in order
+	AppliedEnvFiles []string
+	loadOptions     []func(*loader.Options)
+	// configContents are the config files set by WithConfigFileContent, loaded after the ones of ConfigPaths
+	configContents []types.ConfigFile
+	// forbidOsLookup prevents any fallback to the process environment or working directory
+	forbidOsLookup bool
+	// caseInsensitiveEnv matches the names of the variables of Environment regardless of their case
+	caseInsensitiveEnv bool
+	// metadataOnly loads the ConfigPaths entries also set by WithConfigFileContent from their content, without
+	// checking they exist nor reading them
+	metadataOnly bool
+	// defaultName is the project name used when neither the compose files nor COMPOSE_PROJECT_NAME set one
+	defaultName string
+	// dotEnvWarn receives warnings produced while resolving env files
+	dotEnvWarn func(message string)
+	// logger receives the warnings raised while loading the project
+	logger Logger
+}
+
+// Logger receives the user-facing warnings raised while loading a project. It is implemented by logrus loggers
+type Logger interface {
+	Warnf(format string, args ...interface{})
 }
 
 type ProjectOptionsFn func(*ProjectOptions) error
@@ -52,20 +74,45 @@ func NewProjectOptions(configs []string, opts ...ProjectOptionsFn) (*ProjectOpti
 	for _, o := range opts {
 		err := o(options)
 		if err != nil {
-			return nil, err
+			return nil, markError(err)
 		}
 	}
 	return options, nil
 }
 
-// WithName defines ProjectOptions' name
+// markError marks err with the matching errdefs kind, so that callers can tell a missing file from an invalid model
+func markError(err error) error {
+	if errors.Is(err, os.ErrNotExist) {
+		return errdefs.Mark(err, errdefs.ErrNotFound)
+	}
+	return errdefs.Mark(err, errdefs.ErrInvalid)
+}
+
+// WithName defines ProjectOptions' name, which takes precedence over COMPOSE_PROJECT_NAME and the top-level `name`
+// of the compose files
 func WithName(name string) ProjectOptionsFn {
 	return func(o *ProjectOptions) error {
+		if err := loader.ValidateProjectName(name); err != nil {
+			return err
+		}
 		o.Name = name
 		return nil
 	}
 }
 
+// WithDefaultProjectName defines the project name used when neither COMPOSE_PROJECT_NAME nor the top-level `name`
+// of the compose files set one, instead of the name of the working directory. It also allows loading a compose file
+// read from stdin without a working directory, relative paths being resolved from the current working directory
+func WithDefaultProjectName(name string) ProjectOptionsFn {
+	return func(o *ProjectOptions) error {
+		if err := loader.ValidateProjectName(name); err != nil {
+			return err
+		}
+		o.defaultName = name
+		return nil
+	}
+}
+
 // WithWorkingDirectory defines ProjectOptions' working directory
 func WithWorkingDirectory(wd string) ProjectOptionsFn {
 	return func(o *ProjectOptions) error {
@@ -74,16 +121,88 @@ func WithWorkingDirectory(wd string) ProjectOptionsFn {
 	}
 }
 
-// WithEnv defines a key=value set of variables used for compose file interpolation
+// WithEnv defines a key=value set of variables used for compose file interpolation. Like with the docker CLI, a
+// variable given as a bare `key` is passed through: it keeps the value Environment already has, or takes the one of
+// the process environment, unless WithoutOsEnvLookup was applied before, and is left unset otherwise
 func WithEnv(env []string) ProjectOptionsFn {
 	return func(o *ProjectOptions) error {
-		for k, v := range getAsEqualsMap(env) {
-			o.Environment[k] = v
+		for _, entry := range env {
+			key, value, ok, err := splitEnvEntry(entry)
+			if err != nil {
+				return err
+			}
+			if key == "" {
+				continue
+			}
+			if !ok {
+				if _, set := o.Environment[key]; set || o.forbidOsLookup {
+					continue
+				}
+				if value, ok = os.LookupEnv(key); !ok {
+					continue
+				}
+			}
+			o.Environment[key] = value
+		}
+		return nil
+	}
+}
+
+// WithLoadOptions appends loader options used by ProjectFromOptions to load the project. Those are applied in order,
+// after the project name has been derived from ProjectOptions, so they can override it
+func WithLoadOptions(loadOptions ...func(*loader.Options)) ProjectOptionsFn {
+	return func(o *ProjectOptions) error {
+		o.loadOptions = append(o.loadOptions, loadOptions...)
+		return nil
+	}
+}
+
+// WithConfigFileContent adds a config file given as content, loaded without touching the filesystem after the files
+// of ConfigPaths and the config files added before it. name identifies the file in errors and
+// types.Project.ComposeFiles. As there is no directory to resolve relative paths from, like the ones of `env_file`,
+// setting the working directory with WithWorkingDirectory is recommended
+func WithConfigFileContent(name string, content []byte) ProjectOptionsFn {
+	return func(o *ProjectOptions) error {
+		if name == "" {
+			return errors.Wrap(errdefs.ErrInvalid, "a name is required for config file content")
 		}
+		o.configContents = append(o.configContents, types.ConfigFile{Filename: name, Content: content})
 		return nil
 	}
 }
 
+// WithConfigFileEnv sets ConfigPaths from the COMPOSE_FILE variable set in Environment, unless already set or config
+// files are set by WithConfigFileContent
+func WithConfigFileEnv(o *ProjectOptions) error {
+	if len(o.ConfigPaths) > 0 || len(o.configContents) > 0 {
+		return nil
+	}
+	if f := o.Environment[ComposeFilePath]; f != "" {
+		o.ConfigPaths = strings.Split(f, o.PathSeparator())
+	}
+	return nil
+}
+
+// WithDefaultConfigPath sets ConfigPaths, unless already set, to the first config file with one of the
+// DefaultFileNames found from the working directory up to the root directory, paired with its override file, if
+// any. Nothing is looked for when config files are set by WithConfigFileContent. An error matching
+// errdefs.ErrNotFound is returned when none can be found
+func WithDefaultConfigPath(o *ProjectOptions) error {
+	if len(o.ConfigPaths) > 0 || len(o.configContents) > 0 {
+		return nil
+	}
+	pwd, err := o.GetWorkingDir()
+	if err != nil {
+		return err
+	}
+	paths, err := findDefaultConfigPaths(pwd, o.warn)
+	if err != nil {
+		return err
+	}
+	o.ConfigPaths = paths
+	return nil
+}
+
 // WithDiscardEnvFiles sets discards the `env_file` section after resolving to
 // the `environment` section
 func WithDiscardEnvFile(o *ProjectOptions) error {
@@ -93,52 +212,231 @@ func WithDiscardEnvFile(o *ProjectOptions) error {
 
 // WithOsEnv imports environment variables from OS
 func WithOsEnv(o *ProjectOptions) error {
-	for k, v := range getAsEqualsMap(os.Environ()) {
+	env, err := ToMap(os.Environ())
+	if err != nil {
+		return err
+	}
+	for k, v := range env {
 		o.Environment[k] = v
 	}
 	return nil
 }
 
+// WithCaseInsensitiveEnv matches the names of the variables of Environment regardless of their case when none
+// matches exactly, as Windows does. It is always the case on Windows
+func WithCaseInsensitiveEnv(o *ProjectOptions) error {
+	o.caseInsensitiveEnv = true
+	return nil
+}
+
+// WithoutOsEnvLookup makes loading hermetic: project is loaded only from Environment and an absolute WorkingDir,
+// and fails when a value would otherwise be looked up from the process environment or current working directory
+func WithoutOsEnvLookup(o *ProjectOptions) error {
+	o.forbidOsLookup = true
+	o.loadOptions = append(o.loadOptions, func(options *loader.Options) {
+		options.ForbidOsLookup = true
+	})
+	return nil
+}
+
+// WithStrict makes loading fail on keys which are not declared by the compose specification, instead of warning
+func WithStrict(o *ProjectOptions) error {
+	o.loadOptions = append(o.loadOptions, func(options *loader.Options) {
+		options.Strict = true
+	})
+	return nil
+}
+
+// WithMetadataOnly loads a best-effort project for tools only interested in its metadata, such as IDEs: values
+// failing to be interpolated are left empty and env_file files are not read, see loader.Options.SkeletonMode. The
+// entries of ConfigPaths set by WithConfigFileContent, like the unsaved files of an editor, are loaded from their
+// content without checking they exist on disk
+func WithMetadataOnly(o *ProjectOptions) error {
+	o.metadataOnly = true
+	o.loadOptions = append(o.loadOptions, func(options *loader.Options) {
+		options.SkeletonMode = true
+	})
+	return nil
+}
+
+// WithLogger sets the Logger receiving the warnings raised while loading the project, rather than the global
+// logrus logger. This includes warnings produced while resolving env files, unless set by WithDotEnvWarnings
+func WithLogger(logger Logger) ProjectOptionsFn {
+	return func(o *ProjectOptions) error {
+		o.logger = logger
+		return nil
+	}
+}
+
+// WithDotEnvWarnings sets the function receiving warnings produced while resolving env files, like references to
+// undefined variables. Defaults to logging them
+func WithDotEnvWarnings(fn func(message string)) ProjectOptionsFn {
+	return func(o *ProjectOptions) error {
+		o.dotEnvWarn = fn
+		return nil
+	}
+}
+
 // WithDotEnv imports environment variables from .env file
 func WithDotEnv(o *ProjectOptions) error {
+	return WithEnvFiles()(o)
+}
+
+// WithEnvFiles imports environment variables from the env files at paths, applied in order so that later files
+// override earlier ones, variables already set in Environment, like the ones of the OS environment, taking
+// precedence. Relative paths are resolved from the working directory and all files are required to exist.
+// Without any path, the files listed by COMPOSE_ENV_FILES are loaded, or else `.env` if it exists.
+func WithEnvFiles(paths ...string) ProjectOptionsFn {
+	return func(o *ProjectOptions) error {
+		if len(paths) == 0 {
+			return WithDotEnvOverlays()(o)
+		}
+		return o.applyEnvFiles(paths, false)
+	}
+}
+
+// WithDotEnvOverlays imports environment variables from the selected env files in the working directory, applied in
+// order so that later files override earlier ones. Defaults to just `.env`. Missing files are skipped, and
+// files which have been applied are recorded in ProjectOptions.AppliedEnvFiles.
+// When COMPOSE_ENV_FILES is set, the files it lists are loaded instead and all are required to exist.
+func WithDotEnvOverlays(names ...string) ProjectOptionsFn {
+	return func(o *ProjectOptions) error {
+		if explicit, ok := o.Environment[ComposeEnvFiles]; ok && explicit != "" {
+			var files []string
+			for _, f := range strings.Split(explicit, ",") {
+				if f = strings.TrimSpace(f); f != "" {
+					files = append(files, f)
+				}
+			}
+			return o.applyEnvFiles(files, false)
+		}
+		if len(names) == 0 {
+			names = []string{".env"}
+		}
+		return o.applyEnvFiles(names, true)
+	}
+}
+
+// applyEnvFiles merges the variables of the env files into Environment, later files overriding earlier ones but not
+// the variables Environment already sets. Missing files are skipped if optional, reported otherwise
+func (o *ProjectOptions) applyEnvFiles(files []string, optional bool) error {
 	dir, err := o.GetWorkingDir()
 	if err != nil {
 		return err
 	}
-	dotEnvFile := filepath.Join(dir, ".env")
-	if _, err := os.Stat(dotEnvFile); os.IsNotExist(err) {
-		return nil
+	env := map[string]string{}
+	warn := o.dotEnvWarn
+	if warn == nil {
+		warn = o.warn
 	}
-	file, err := os.Open(dotEnvFile)
+	for _, f := range files {
+		if !filepath.IsAbs(f) {
+			f = filepath.Join(dir, f)
+		}
+		vars, err := readEnvFile(f, o.Environment, env, warn)
+		if os.IsNotExist(errors.Cause(err)) && optional {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for k, v := range vars {
+			env[k] = v
+		}
+		o.AppliedEnvFiles = append(o.AppliedEnvFiles, f)
+	}
+	// like references resolved while reading the files, variables already set take precedence over the files
+	for k, v := range env {
+		if _, ok := o.Environment[k]; !ok {
+			o.Environment[k] = v
+		}
+	}
+	return nil
+}
+
+func readEnvFile(path string, environment, inherited map[string]string, warn func(string)) (map[string]string, error) {
+	file, err := os.Open(path)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer file.Close()
 
-	env, err := godotenv.Parse(file)
+	env, err := parseDotEnv(file, environment, inherited, warn)
 	if err != nil {
-		return err
+		return nil, errors.Wrapf(err, "failed to read %s", path)
 	}
-	for k, v := range env {
-		o.Environment[k] = v
-	}
-	return nil
+	return env, nil
 }
 
 // DefaultFileNames defines the Compose file names for auto-discovery (in order of preference)
 var DefaultFileNames = []string{"compose.yaml", "compose.yml", "docker-compose.yml", "docker-compose.yaml"}
 
+// DefaultOverrideFileNames defines the Compose override file names for auto-discovery (in order of preference)
+var DefaultOverrideFileNames = []string{"compose.override.yaml", "compose.override.yml", "docker-compose.override.yml", "docker-compose.override.yaml"}
+
 const (
 	ComposeProjectName   = "COMPOSE_PROJECT_NAME"
-	ComposeFileSeparator = "COMPOSE_FILE_SEPARATOR"
-	ComposeFilePath      = "COMPOSE_FILE"
+	ComposePathSeparator = "COMPOSE_PATH_SEPARATOR"
+	// Deprecated: use ComposePathSeparator
+	ComposeFileSeparator       = "COMPOSE_FILE_SEPARATOR"
+	ComposeFilePath            = "COMPOSE_FILE"
+	ComposeEnvFiles            = "COMPOSE_ENV_FILES"
+	ComposeIgnoreOrphans       = "COMPOSE_IGNORE_ORPHANS"
+	ComposeConvertWindowsPaths = "COMPOSE_CONVERT_WINDOWS_PATHS"
 )
 
+// GetBoolEnv returns true if the variable is set to `1`, `true` or `yes`, case insensitively
+func (o ProjectOptions) GetBoolEnv(key string) bool {
+	v, _ := o.lookupEnv(key)
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "1", "true", "yes":
+		return true
+	}
+	return false
+}
+
+// PathSeparator returns the separator of the COMPOSE_FILE list, set by COMPOSE_PATH_SEPARATOR or the deprecated
+// COMPOSE_FILE_SEPARATOR, and defaulting to the OS path list separator
+func (o ProjectOptions) PathSeparator() string {
+	if sep, _ := o.lookupEnv(ComposePathSeparator); sep != "" {
+		return sep
+	}
+	if sep, _ := o.lookupEnv(ComposeFileSeparator); sep != "" {
+		return sep
+	}
+	return string(os.PathListSeparator)
+}
+
+// IgnoreOrphans tells if COMPOSE_IGNORE_ORPHANS is set, so containers of services which are not declared by the
+// project anymore are not reported
+func (o ProjectOptions) IgnoreOrphans() bool {
+	return o.GetBoolEnv(ComposeIgnoreOrphans)
+}
+
+// ConvertWindowsPaths tells if COMPOSE_CONVERT_WINDOWS_PATHS is set, so Windows paths used as bind mount sources are
+// converted to Unix-style paths
+func (o ProjectOptions) ConvertWindowsPaths() bool {
+	return o.GetBoolEnv(ComposeConvertWindowsPaths)
+}
+
+// GetWorkingDir returns the working directory, defaulting to the directory of the first config file which isn't read
+// from stdin, then to the current working directory
 func (o ProjectOptions) GetWorkingDir() (string, error) {
+	return o.workingDirOf(o.ConfigPaths)
+}
+
+// workingDirOf returns the working directory of a project loaded from configPaths
+func (o ProjectOptions) workingDirOf(configPaths []string) (string, error) {
+	if o.forbidOsLookup {
+		if !filepath.IsAbs(o.WorkingDir) {
+			return "", errors.Wrapf(errdefs.ErrInvalid, "an absolute working directory is required when OS lookup is disabled, got %q", o.WorkingDir)
+		}
+		return o.WorkingDir, nil
+	}
 	if o.WorkingDir != "" {
 		return o.WorkingDir, nil
 	}
-	for _, path := range o.ConfigPaths {
+	for _, path := range configPaths {
 		if path != "-" {
 			absPath, err := filepath.Abs(path)
 			if err != nil {
@@ -150,153 +448,402 @@ func (o ProjectOptions) GetWorkingDir() (string, error) {
 	return os.Getwd()
 }
 
+// checkStdinWorkingDir rejects loading config files all read from stdin without a working directory nor a project
+// name, as the current working directory the project would be named after and resolve relative paths from is
+// usually unrelated to piped content
+func (o ProjectOptions) checkStdinWorkingDir(configPaths []string) error {
+	if len(configPaths) == 0 || o.WorkingDir != "" || o.Name != "" || o.defaultName != "" {
+		return nil
+	}
+	for _, path := range configPaths {
+		if path != "-" {
+			return nil
+		}
+	}
+	if name, _ := o.lookupEnv(ComposeProjectName); name != "" {
+		return nil
+	}
+	return errors.Wrap(errdefs.ErrInvalid, "config is read from stdin: set a working directory to resolve relative paths from, or a project name")
+}
+
+// inMemoryOnly tells if all the config files are set by WithConfigFileContent, so none needs to be read or looked for
+func (o ProjectOptions) inMemoryOnly() bool {
+	return len(o.configContents) > 0 && len(o.ConfigPaths) == 0
+}
+
+// warn reports a warning to the Logger, defaulting to the global logrus logger
+func (o ProjectOptions) warn(message string) {
+	if o.logger != nil {
+		o.logger.Warnf("%s", message)
+		return
+	}
+	logrus.Warn(message)
+}
+
+// lookupEnv looks up a variable from Environment, then from the process environment unless OS lookup is disabled
+func (o ProjectOptions) lookupEnv(key string) (string, bool) {
+	details := types.ConfigDetails{Environment: o.Environment, CaseInsensitive: o.caseInsensitiveEnv}
+	if v, ok := details.LookupEnv(key); ok {
+		return v, true
+	}
+	if o.forbidOsLookup {
+		return "", false
+	}
+	return os.LookupEnv(key)
+}
+
 // ProjectFromOptions load a compose project based on command line options
 func ProjectFromOptions(options *ProjectOptions) (*types.Project, error) {
-	configPaths, specifiedComposeFiles, err := getConfigPathsFromOptions(options)
+	project, _, err := projectFromOptions(options)
+	return project, err
+}
+
+// projectFromOptions loads a compose project like ProjectFromOptions does, also returning the config files it has
+// been loaded from, in the order of types.Project.ComposeFiles
+func projectFromOptions(options *ProjectOptions) (*types.Project, []types.ConfigFile, error) {
+	configPaths, specifiedComposeFiles, err := options.configPaths()
 	if err != nil {
-		return nil, err
+		return nil, nil, markError(err)
 	}
 
-	configs, err := parseConfigs(configPaths)
+	raw, err := options.rawContents()
 	if err != nil {
-		return nil, err
+		return nil, nil, markError(err)
 	}
-
-	workingDir, err := options.GetWorkingDir()
+	configs, err := parseConfigs(configPaths, raw)
 	if err != nil {
-		return nil, err
+		return nil, nil, markError(err)
 	}
-	absWorkingDir, err := filepath.Abs(workingDir)
+	// the contents loaded in place of config paths are not loaded again
+	loaded := map[string]bool{}
+	for _, path := range configPaths {
+		if _, ok := raw[path]; ok {
+			loaded[path] = true
+		}
+	}
+	for _, content := range options.configContents {
+		if len(loaded) > 0 {
+			pwd, err := options.configDir()
+			if err != nil {
+				return nil, nil, err
+			}
+			if loaded[resolvePath(pwd, content.Filename)] {
+				continue
+			}
+		}
+		configs = append(configs, content)
+		specifiedComposeFiles = append(specifiedComposeFiles, content.Filename)
+	}
+
+	if err := options.checkStdinWorkingDir(configPaths); err != nil {
+		return nil, nil, err
+	}
+	// the project directory is the one of the first config file, which may have been found in a parent directory
+	workingDir, err := options.workingDirOf(configPaths)
 	if err != nil {
-		return nil, err
+		return nil, nil, markError(err)
 	}
 
-	var nameLoadOpt = func(opts *loader.Options) {
+	var defaultLoadOpt = func(opts *loader.Options) {
+		opts.ConvertWindowsPaths = options.ConvertWindowsPaths()
+		opts.Warn = options.warn
+		// the name is resolved by loader.ResolveProjectName, WithName taking precedence over COMPOSE_PROJECT_NAME
+		// and WithDefaultProjectName only applying when the compose files don't set one
 		if options.Name != "" {
-			opts.Name = options.Name
-		} else if nameFromEnv, ok := os.LookupEnv(ComposeProjectName); ok {
-			opts.Name = nameFromEnv
+			opts.SetProjectName(options.Name, true)
 		} else {
-			opts.Name = regexp.MustCompile(`[^-_a-z0-9]+`).
-				ReplaceAllString(strings.ToLower(filepath.Base(absWorkingDir)), "")
+			opts.SetProjectName(options.defaultName, false)
 		}
+		opts.DeriveProjectName = true
 	}
-	options.loadOptions = append(options.loadOptions, nameLoadOpt)
+	// defaults derived from options are applied first, so that options set by WithLoadOptions can override them
+	loadOptions := append([]func(*loader.Options){defaultLoadOpt}, options.loadOptions...)
 
 	project, err := loader.Load(types.ConfigDetails{
-		ConfigFiles: configs,
-		WorkingDir:  workingDir,
-		Environment: options.Environment,
-	}, options.loadOptions...)
+		ConfigFiles:     configs,
+		WorkingDir:      workingDir,
+		Environment:     options.Environment,
+		CaseInsensitive: options.caseInsensitiveEnv,
+	}, loadOptions...)
 	if err != nil {
-		return nil, err
+		if errdefs.IsNotFoundError(err) && options.inMemoryOnly() && options.WorkingDir == "" {
+			return nil, nil, errors.Wrapf(err, "filesystem resolution is unavailable for in-memory configs, relative paths are resolved from %s: set a working directory", workingDir)
+		}
+		return nil, nil, err
 	}
 
 	project.ComposeFiles = specifiedComposeFiles
-	return project, nil
+	return project, configs, nil
 }
 
-// getConfigPathsFromOptions retrieves the config files for project based on project options
-func getConfigPathsFromOptions(options *ProjectOptions) ([]string, []string, error) {
+// GetConfigPaths returns the absolute paths of the config files to load, `-` standing for stdin: ConfigPaths if set,
+// otherwise the files listed by COMPOSE_FILE as set by Environment, otherwise the first config file with one of the
+// DefaultFileNames found from the working directory up to the root directory, paired with its override file, if any.
+// Relative paths are resolved from the working directory, defaulting to the current one
+func (o *ProjectOptions) GetConfigPaths() ([]string, error) {
+	paths, _, err := o.configPaths()
+	if err != nil {
+		return nil, markError(err)
+	}
+	return paths, nil
+}
+
+// configPaths resolves the config files like GetConfigPaths does, also returning the entries they have been
+// resolved from
+func (o *ProjectOptions) configPaths() ([]string, []string, error) {
 	paths := []string{}
-	pwd := options.WorkingDir
-	if pwd == "" {
-		wd, err := os.Getwd()
+	if o.inMemoryOnly() {
+		return paths, []string{}, nil
+	}
+	pwd, err := o.configDir()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(o.ConfigPaths) != 0 {
+		raw, err := o.rawContents()
 		if err != nil {
 			return nil, nil, err
 		}
-		pwd = wd
+		return resolveConfigPaths(pwd, o.ConfigPaths, raw)
 	}
 
-	if len(options.ConfigPaths) != 0 {
-		for _, f := range options.ConfigPaths {
-			if f == "-" {
-				paths = append(paths, f)
-				continue
-			}
-			if !filepath.IsAbs(f) {
-				f = filepath.Join(pwd, f)
-			}
-			if _, err := os.Stat(f); err != nil {
-				return nil, nil, err
-			}
-			paths = append(paths, f)
+	env := types.ConfigDetails{Environment: o.Environment, CaseInsensitive: o.caseInsensitiveEnv}
+	if f, _ := env.LookupEnv(ComposeFilePath); f != "" {
+		paths, specified, err := resolveConfigPaths(pwd, strings.Split(f, o.PathSeparator()), nil)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "invalid %s", ComposeFilePath)
+		}
+		if len(paths) > 0 {
+			return paths, specified, nil
 		}
-		return paths, options.ConfigPaths, nil
 	}
 
-	sep := os.Getenv(ComposeFileSeparator)
-	if sep == "" {
-		sep = string(os.PathListSeparator)
+	paths, err = findDefaultConfigPaths(pwd, o.warn)
+	if err != nil {
+		return nil, nil, err
+	}
+	return paths, paths, nil
+}
+
+// configDir returns the directory relative config paths are resolved from
+func (o *ProjectOptions) configDir() (string, error) {
+	if o.forbidOsLookup {
+		return o.GetWorkingDir()
 	}
-	f := os.Getenv(ComposeFilePath)
-	if f != "" {
-		return strings.Split(f, sep), strings.Split(f, sep), nil
+	if o.WorkingDir != "" {
+		return o.WorkingDir, nil
 	}
+	return os.Getwd()
+}
 
-	for {
-		candidates := []string{}
-		for _, n := range DefaultFileNames {
-			f := filepath.Join(pwd, n)
-			if _, err := os.Stat(f); err == nil {
-				candidates = append(candidates, f)
+// rawContents maps the resolved paths of the config files set by WithConfigFileContent to their content, in
+// metadata-only mode where they stand for the ConfigPaths entries with the same path
+func (o *ProjectOptions) rawContents() (map[string][]byte, error) {
+	if !o.metadataOnly || len(o.configContents) == 0 || len(o.ConfigPaths) == 0 {
+		return nil, nil
+	}
+	pwd, err := o.configDir()
+	if err != nil {
+		return nil, err
+	}
+	raw := map[string][]byte{}
+	for _, content := range o.configContents {
+		raw[resolvePath(pwd, content.Filename)] = content.Content
+	}
+	return raw, nil
+}
+
+// resolvePath resolves a config path relative to pwd, `-` standing for stdin
+func resolvePath(pwd string, path string) string {
+	if path != "-" && !filepath.IsAbs(path) {
+		return filepath.Join(pwd, path)
+	}
+	return path
+}
+
+// resolveConfigPaths resolves the config files relative to pwd, checking they exist unless their content is set by
+// raw. Empty entries are ignored, as well as the files already listed, so that they are not merged twice. It returns
+// the resolved paths along with the entries they have been resolved from
+func resolveConfigPaths(pwd string, files []string, raw map[string][]byte) ([]string, []string, error) {
+	paths, specified := []string{}, []string{}
+	seen := map[string]bool{}
+	for _, f := range files {
+		if f == "" {
+			continue
+		}
+		path := resolvePath(pwd, f)
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		if _, ok := raw[path]; !ok && path != "-" {
+			if _, err := os.Stat(path); err != nil {
+				return nil, nil, markError(errors.Wrapf(err, "config file %s", f))
 			}
 		}
+		paths = append(paths, path)
+		specified = append(specified, f)
+	}
+	return paths, specified, nil
+}
+
+// findDefaultConfigPaths looks for a config file with one of the DefaultFileNames from dir up to the root
+// directory, paired with its override file from the same directory, if any
+func findDefaultConfigPaths(dir string, warn func(message string)) ([]string, error) {
+	pwd := dir
+	for {
+		candidates := findFiles(DefaultFileNames, pwd)
 		if len(candidates) > 0 {
 			winner := candidates[0]
+			if err := checkAmbiguousExtension(winner, candidates); err != nil {
+				return nil, err
+			}
 			if len(candidates) > 1 {
-				logrus.Warnf("Found multiple config files with supported names: %s", strings.Join(candidates, ", "))
-				logrus.Warnf("Using %s", winner)
+				warn(fmt.Sprintf("Found multiple config files with supported names: %s", strings.Join(candidates, ", ")))
+				warn(fmt.Sprintf("Using %s", winner))
+			}
+			paths := []string{winner}
+			// the override file is paired with the base file, from the same directory
+			overrides := findFiles(overrideFileNames(filepath.Base(winner)), pwd)
+			if len(overrides) > 0 {
+				if err := checkAmbiguousExtension(overrides[0], overrides); err != nil {
+					return nil, err
+				}
+				paths = append(paths, overrides[0])
 			}
-			return []string{winner}, []string{winner}, nil
+			return paths, nil
 		}
 		parent := filepath.Dir(pwd)
 		if parent == pwd {
-			return nil, nil, errors.Wrap(errdefs.ErrNotFound, "can't find a suitable configuration file in this directory or any parent")
+			return nil, errors.Wrap(errdefs.ErrNotFound, "can't find a suitable configuration file in this directory or any parent")
 		}
 		pwd = parent
 	}
 }
 
-func parseConfigs(configPaths []string) ([]types.ConfigFile, error) {
-	files := []types.ConfigFile{}
+// findFiles returns the files within dir matching the given names, in the order of names
+func findFiles(names []string, dir string) []string {
+	candidates := []string{}
+	for _, n := range names {
+		f := filepath.Join(dir, n)
+		if _, err := os.Stat(f); err == nil {
+			candidates = append(candidates, f)
+		}
+	}
+	return candidates
+}
+
+// overrideFileNames returns the override file names matching a base config file name, like
+// `compose.override.yaml` and `compose.override.yml` for `compose.yaml`
+func overrideFileNames(base string) []string {
+	prefix := strings.TrimSuffix(base, filepath.Ext(base)) + ".override"
+	names := []string{}
+	for _, n := range DefaultOverrideFileNames {
+		if strings.HasPrefix(n, prefix+".") {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// checkAmbiguousExtension returns an error if candidates include both the `.yaml` and `.yml` variants of file
+func checkAmbiguousExtension(file string, candidates []string) error {
+	name := strings.TrimSuffix(file, filepath.Ext(file))
+	for _, c := range candidates {
+		if c != file && strings.TrimSuffix(c, filepath.Ext(c)) == name {
+			return errors.Wrapf(errdefs.ErrInvalid, "found both %s and %s, can't decide which one to use", file, c)
+		}
+	}
+	return nil
+}
+
+// maxConcurrentReads is the number of config files read concurrently
+var maxConcurrentReads = runtime.GOMAXPROCS(0)
+
+// parseConfigs reads the config files, maxConcurrentReads at a time, but the ones which content is set by raw. Stdin,
+// set as `-`, is read once
+func parseConfigs(configPaths []string, raw map[string][]byte) ([]types.ConfigFile, error) {
+	var stdin []byte
 	for _, f := range configPaths {
-		var (
-			b   []byte
-			err error
-		)
 		if f == "-" {
-			b, err = ioutil.ReadAll(os.Stdin)
-		} else {
-			b, err = ioutil.ReadFile(f)
+			b, err := ioutil.ReadAll(os.Stdin)
+			if err != nil {
+				return nil, err
+			}
+			stdin = b
+			break
 		}
+	}
+
+	// parsing is left to the loader, which keeps track of values positions
+	files := make([]types.ConfigFile, len(configPaths))
+	errs := make([]error, len(configPaths))
+	slots := make(chan struct{}, maxConcurrentReads)
+	var wg sync.WaitGroup
+	for i, f := range configPaths {
+		files[i].Filename = f
+		if f == "-" {
+			files[i].Content = stdin
+			continue
+		}
+		if content, ok := raw[f]; ok {
+			files[i].Content = content
+			continue
+		}
+		wg.Add(1)
+		go func(i int, f string) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			files[i].Content, errs[i] = ioutil.ReadFile(f)
+		}(i, f)
+	}
+	wg.Wait()
+	for _, err := range errs {
 		if err != nil {
 			return nil, err
 		}
-		config, err := loader.ParseYAML(b)
+	}
+	return files, nil
+}
+
+// ToMap splits `key=value` strings, like the ones of os.Environ, into a key : value map, keeping the case of the
+// keys. When a key is set more than once, its last value wins. Empty strings are ignored and keys without `=` are
+// mapped to an empty value. Windows sets per-drive variables like `=C:=C:\foo`, which name starts with `=`. An
+// error is returned for an entry without name, like `=` or `==value`
+func ToMap(env []string) (map[string]string, error) {
+	m := make(map[string]string, len(env))
+	for _, entry := range env {
+		key, value, _, err := splitEnvEntry(entry)
 		if err != nil {
 			return nil, err
 		}
-		files = append(files, types.ConfigFile{Filename: f, Config: config})
+		if key != "" {
+			m[key] = value
+		}
 	}
-	return files, nil
+	return m, nil
 }
 
-// getAsEqualsMap split key=value formatted strings into a key : value map
-func getAsEqualsMap(em []string) map[string]string {
-	m := make(map[string]string)
-	for _, v := range em {
-		kv := strings.SplitN(v, "=", 2)
-		m[kv[0]] = kv[1]
+// splitEnvEntry splits a `key=value` string, ok telling if it has a value. A leading `=` belongs to the key
+func splitEnvEntry(entry string) (key string, value string, ok bool, err error) {
+	if entry == "" {
+		return "", "", false, nil
 	}
-	return m
+	i := strings.Index(entry[1:], "=") + 1
+	if i == 0 {
+		key = entry
+	} else {
+		key, value, ok = entry[:i], entry[i+1:], true
+	}
+	if strings.TrimPrefix(key, "=") == "" {
+		return "", "", false, errors.Wrapf(errdefs.ErrInvalid, "invalid environment variable %q: no name", entry)
+	}
+	return key, value, ok, nil
 }
 
-// getAsEqualsMap format a key : value map into key=value strings
+// getAsStringList format a key : value map into key=value strings, sorted by key
 func getAsStringList(em map[string]string) []string {
-	m := make([]string, 0, len(em))
-	for k, v := range em {
-		m = append(m, fmt.Sprintf("%s=%s", k, v))
-	}
-	return m
+	return types.Labels(em).AsList()
 }
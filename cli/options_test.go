@@ -17,10 +17,17 @@
 package cli
 
 import (
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
 
+	"github.com/compose-spec/compose-go/errdefs"
+	"github.com/compose-spec/compose-go/loader"
+	"github.com/compose-spec/compose-go/types"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus/hooks/test"
 	"gotest.tools/v3/assert"
 )
 
@@ -93,7 +100,7 @@ func TestProjectWithDotEnv(t *testing.T) {
 	assert.NilError(t, err)
 	service, err := p.GetService("simple")
 	assert.NilError(t, err)
-	assert.Equal(t, service.Ports[0].Published, uint32(8000))
+	assert.Equal(t, service.Ports[0].Published, "8000")
 }
 
 func TestProjectWithDiscardEnvFile(t *testing.T) {
@@ -110,6 +117,34 @@ func TestProjectWithDiscardEnvFile(t *testing.T) {
 	assert.Assert(t, service.EnvFile == nil)
 }
 
+func TestProjectWithEnvFileExpansion(t *testing.T) {
+	load := func(options ...func(*loader.Options)) types.MappingWithEquals {
+		opts, err := NewProjectOptions([]string{"testdata/env-file-expansion/compose.yaml"},
+			WithName("my_project"), WithDotEnv, WithLoadOptions(options...))
+		assert.NilError(t, err)
+		p, err := ProjectFromOptions(opts)
+		assert.NilError(t, err)
+		service, err := p.GetService("app")
+		assert.NilError(t, err)
+		return service.Environment
+	}
+
+	assert.DeepEqual(t, load(), types.MappingWithEquals{
+		"DATABASE_URL": strPtr("postgres://db.internal:5432/app"),
+		"REPLICA_URL":  strPtr("postgres://db.internal:5432/app?replica=true"),
+		"LITERAL":      strPtr("${DB_HOST}"),
+		"ESCAPED":      strPtr("$DB_HOST"),
+		"APP_PORT":     strPtr("8080"),
+		"DB_HOST":      strPtr("db.internal"),
+	})
+
+	raw := load(func(options *loader.Options) {
+		options.ExpandEnvFiles = false
+	})
+	assert.Equal(t, *raw["DATABASE_URL"], "postgres://${DB_HOST}:5432/app")
+	assert.Equal(t, *raw["LITERAL"], "'${DB_HOST}'")
+}
+
 func TestProjectNameFromWorkingDir(t *testing.T) {
 	opts, err := NewProjectOptions([]string{
 		"testdata/env-file/compose-with-env-file.yaml",
@@ -125,6 +160,800 @@ func TestEnvMap(t *testing.T) {
 	m["foo"] = "bar"
 	l := getAsStringList(m)
 	assert.Equal(t, l[0], "foo=bar")
-	m = getAsEqualsMap(l)
+	m, err := ToMap(l)
+	assert.NilError(t, err)
 	assert.Equal(t, m["foo"], "bar")
 }
+
+func TestDotEnvOverlays(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []ProjectOptionsFn
+		expected map[string]string
+		applied  []string
+	}{
+		{
+			name:     "default",
+			opts:     []ProjectOptionsFn{WithDotEnvOverlays()},
+			expected: map[string]string{"FOO": "from_env", "BAR": "from_env"},
+			applied:  []string{".env"},
+		},
+		{
+			name:     "overlay",
+			opts:     []ProjectOptionsFn{WithDotEnvOverlays(".env", ".env.local")},
+			expected: map[string]string{"FOO": "from_local", "BAR": "from_env"},
+			applied:  []string{".env", ".env.local"},
+		},
+		{
+			name:     "reversed overlay",
+			opts:     []ProjectOptionsFn{WithDotEnvOverlays(".env.local", ".env")},
+			expected: map[string]string{"FOO": "from_env", "BAR": "from_env"},
+			applied:  []string{".env.local", ".env"},
+		},
+		{
+			name:     "missing overlay",
+			opts:     []ProjectOptionsFn{WithDotEnvOverlays(".env", ".env.missing", ".env.local")},
+			expected: map[string]string{"FOO": "from_local", "BAR": "from_env"},
+			applied:  []string{".env", ".env.local"},
+		},
+		{
+			name:     "environment overrides overlays",
+			opts:     []ProjectOptionsFn{WithEnv([]string{"FOO=from_os", "QIX=from_os"}), WithDotEnvOverlays(".env", ".env.local")},
+			expected: map[string]string{"FOO": "from_os", "BAR": "from_env", "QIX": "from_os"},
+			applied:  []string{".env", ".env.local"},
+		},
+		{
+			name:     "explicit env files win",
+			opts:     []ProjectOptionsFn{WithEnv([]string{"COMPOSE_ENV_FILES=explicit.env"}), WithDotEnvOverlays(".env", ".env.local")},
+			expected: map[string]string{"FOO": "from_explicit", "COMPOSE_ENV_FILES": "explicit.env"},
+			applied:  []string{"explicit.env"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts, err := NewProjectOptions(nil, append([]ProjectOptionsFn{WithWorkingDirectory("testdata/overlays")}, test.opts...)...)
+			assert.NilError(t, err)
+			assert.DeepEqual(t, opts.Environment, test.expected)
+			applied := []string{}
+			for _, f := range test.applied {
+				applied = append(applied, filepath.Join("testdata", "overlays", f))
+			}
+			assert.DeepEqual(t, opts.AppliedEnvFiles, applied)
+		})
+	}
+}
+
+func TestDotEnvOverlaysErrors(t *testing.T) {
+	_, err := NewProjectOptions(nil, WithWorkingDirectory("testdata/overlays"),
+		WithEnv([]string{"COMPOSE_ENV_FILES=missing.env"}), WithDotEnvOverlays())
+	assert.Assert(t, errors.Is(err, os.ErrNotExist))
+	assert.Assert(t, errdefs.IsNotFoundError(err))
+
+	dir, err := ioutil.TempDir("", "overlays")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NilError(t, os.Mkdir(filepath.Join(dir, ".env.local"), 0755))
+	_, err = NewProjectOptions(nil, WithWorkingDirectory(dir), WithDotEnvOverlays(".env", ".env.local"))
+	assert.ErrorContains(t, err, "failed to read")
+}
+
+func TestEnvFiles(t *testing.T) {
+	opts, err := NewProjectOptions(nil, WithWorkingDirectory("testdata/overlays"), WithEnvFiles(".env", ".env.local"))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, opts.Environment, map[string]string{"FOO": "from_local", "BAR": "from_env"})
+
+	opts, err = NewProjectOptions(nil, WithWorkingDirectory("testdata/overlays"),
+		WithEnv([]string{"COMPOSE_ENV_FILES=.env.local, explicit.env"}), WithEnvFiles())
+	assert.NilError(t, err)
+	assert.Equal(t, opts.Environment["FOO"], "from_explicit")
+	assert.DeepEqual(t, opts.AppliedEnvFiles, []string{
+		filepath.Join("testdata", "overlays", ".env.local"),
+		filepath.Join("testdata", "overlays", "explicit.env"),
+	})
+
+	// files named by the caller take precedence over COMPOSE_ENV_FILES
+	opts, err = NewProjectOptions(nil, WithWorkingDirectory("testdata/overlays"),
+		WithEnv([]string{"COMPOSE_ENV_FILES=explicit.env"}), WithEnvFiles(".env"))
+	assert.NilError(t, err)
+	assert.Equal(t, opts.Environment["FOO"], "from_env")
+
+	dir, err := ioutil.TempDir("", "envfiles")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+	opts, err = NewProjectOptions(nil, WithWorkingDirectory(dir), WithEnvFiles())
+	assert.NilError(t, err)
+	assert.Equal(t, len(opts.AppliedEnvFiles), 0)
+
+	_, err = NewProjectOptions(nil, WithWorkingDirectory("testdata/overlays"), WithEnvFiles(".env", ".env.missing"))
+	assert.Assert(t, errdefs.IsNotFoundError(err))
+}
+
+func TestEnvFilesInterpolation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "envfiles")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(dir, "compose.yaml"), []byte("services:\n  web:\n    image: nginx:${TAG}\n"), 0644))
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(dir, ".env"), []byte("TAG=stable\nCOMPOSE_PROJECT_NAME=base\n"), 0644))
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(dir, ".env.production"), []byte("TAG=1.25\nCOMPOSE_PROJECT_NAME=production\n"), 0644))
+
+	opts, err := NewProjectOptions(nil, WithWorkingDirectory(dir), WithEnvFiles(".env", ".env.production"), WithDefaultConfigPath)
+	assert.NilError(t, err)
+	p, err := ProjectFromOptions(opts)
+	assert.NilError(t, err)
+	assert.Equal(t, p.Name, "production")
+	assert.Equal(t, p.Services[0].Image, "nginx:1.25")
+}
+
+func TestToMap(t *testing.T) {
+	m, err := ToMap([]string{"", "FOO=1", "=C:=C:\\", "=::=::\\", "FOO=2", "BAR", "URL=a=b"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, m, map[string]string{"FOO": "2", "=C:": "C:\\", "=::": "::\\", "BAR": "", "URL": "a=b"})
+
+	for _, entry := range []string{"=", "==value"} {
+		_, err = ToMap([]string{entry})
+		assert.Check(t, errdefs.IsInvalidError(err), entry)
+	}
+	_, err = NewProjectOptions(nil, WithEnv([]string{"=value=", "="}))
+	assert.Check(t, errdefs.IsInvalidError(err))
+}
+
+func TestWithEnvPassthrough(t *testing.T) {
+	withFakeOsEnv(t, map[string]string{"FROM_OS": "os", "SET": "os"}, os.TempDir(), func() {
+		opts, err := NewProjectOptions(nil,
+			WithEnv([]string{"SET=options"}),
+			WithEnv([]string{"FROM_OS", "SET", "MISSING"}))
+		assert.NilError(t, err)
+		assert.DeepEqual(t, opts.Environment, map[string]string{"FROM_OS": "os", "SET": "options"})
+
+		opts, err = NewProjectOptions(nil, WithoutOsEnvLookup, WithEnv([]string{"FROM_OS"}))
+		assert.NilError(t, err)
+		assert.Equal(t, len(opts.Environment), 0)
+	})
+}
+
+// withFakeOsEnv runs fn with the process environment and working directory replaced
+func withFakeOsEnv(t *testing.T, env map[string]string, wd string, fn func()) {
+	original := os.Environ()
+	cwd, err := os.Getwd()
+	assert.NilError(t, err)
+	defer func() {
+		os.Clearenv()
+		env, _ := ToMap(original)
+		for k, v := range env {
+			os.Setenv(k, v)
+		}
+		assert.NilError(t, os.Chdir(cwd))
+	}()
+
+	os.Clearenv()
+	for k, v := range env {
+		os.Setenv(k, v)
+	}
+	assert.NilError(t, os.Chdir(wd))
+	fn()
+}
+
+func TestProjectWithoutOsEnvLookup(t *testing.T) {
+	workingDir, err := filepath.Abs(filepath.Join("testdata", "hermetic"))
+	assert.NilError(t, err)
+	load := func() *types.Project {
+		opts, err := NewProjectOptions(nil,
+			WithWorkingDirectory(workingDir),
+			WithEnv([]string{"HOME=/home/hermetic"}),
+			WithoutOsEnvLookup,
+			WithDotEnv)
+		assert.NilError(t, err)
+		project, err := ProjectFromOptions(opts)
+		assert.NilError(t, err)
+		return project
+	}
+
+	var first, second *types.Project
+	withFakeOsEnv(t, map[string]string{
+		"HOME":               "/home/first",
+		"IMAGE":              "first",
+		"PORT":               "1111",
+		"UNSET_VAR":          "first",
+		ComposeProjectName:   "first",
+		ComposeFilePath:      "first.yml",
+		ComposeFileSeparator: ";",
+	}, os.TempDir(), func() {
+		first = load()
+	})
+	withFakeOsEnv(t, map[string]string{
+		"HOME":             "C:\\Users\\second",
+		"USERPROFILE":      "C:\\Users\\second",
+		"TAG":              "second",
+		"FROM_DOTENV":      "second",
+		ComposeProjectName: "second",
+		ComposeFilePath:    "second.yml:third.yml",
+		"PATH":             "",
+	}, filepath.Join("testdata", "simple"), func() {
+		second = load()
+	})
+
+	assert.DeepEqual(t, first, second)
+	assert.Equal(t, first.Name, "hermetic")
+	foo, err := first.GetService("foo")
+	assert.NilError(t, err)
+	assert.Equal(t, foo.Image, "foo:v1")
+	assert.Equal(t, foo.Ports[0].Published, "8080")
+	assert.Equal(t, foo.Volumes[0].Source, "/home/hermetic/data")
+	assert.Equal(t, foo.Volumes[1].Source, filepath.Join(workingDir, "relative"))
+	assert.DeepEqual(t, foo.Environment, types.MappingWithEquals{
+		"FOO_ENV":     strPtr("from_env_file"),
+		"HOME":        strPtr("/home/hermetic"),
+		"FROM_DOTENV": strPtr("dotenv"),
+		"UNSET_VAR":   nil,
+	})
+}
+
+func TestProjectWithoutOsEnvLookupFailsLoudly(t *testing.T) {
+	_, err := NewProjectOptions(nil, WithoutOsEnvLookup, WithDotEnv)
+	assert.ErrorContains(t, err, "an absolute working directory is required")
+
+	opts, err := NewProjectOptions([]string{"testdata/simple/compose.yaml"}, WithWorkingDirectory("."), WithoutOsEnvLookup)
+	assert.NilError(t, err)
+	_, err = ProjectFromOptions(opts)
+	assert.ErrorContains(t, err, "an absolute working directory is required")
+
+	dir, err := ioutil.TempDir("", "hermetic")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(filepath.Join(dir, "compose.yaml"), []byte(`
+services:
+  foo:
+    image: foo
+    volumes:
+      - ~/data:/data
+`), 0644)
+	assert.NilError(t, err)
+	opts, err = NewProjectOptions(nil, WithWorkingDirectory(dir), WithoutOsEnvLookup)
+	assert.NilError(t, err)
+	_, err = ProjectFromOptions(opts)
+	assert.ErrorContains(t, err, "cannot expand '~' in ~/data, because the environment lacks HOME")
+}
+
+func strPtr(val string) *string {
+	return &val
+}
+
+func TestProjectWithLoadOptions(t *testing.T) {
+	opts, err := NewProjectOptions([]string{"testdata/load-options/compose.yaml"},
+		WithName("my_project"),
+		WithLoadOptions(func(options *loader.Options) {
+			options.SkipInterpolation = true
+			options.SkipValidation = true
+			options.Name = "overridden"
+		}))
+	assert.NilError(t, err)
+	p, err := ProjectFromOptions(opts)
+	assert.NilError(t, err)
+	assert.Equal(t, p.Name, "overridden")
+	service, err := p.GetService("simple")
+	assert.NilError(t, err)
+	assert.Equal(t, service.Image, "${IMAGE:-haproxy}")
+}
+
+func TestProjectWithStrict(t *testing.T) {
+	opts, err := NewProjectOptions([]string{"testdata/strict/compose.yaml"}, WithName("my_project"), WithStrict)
+	assert.NilError(t, err)
+	_, err = ProjectFromOptions(opts)
+	assert.ErrorContains(t, err, `unknown key "resart" in services.simple, did you mean "restart"?`)
+}
+
+func TestGetBoolEnv(t *testing.T) {
+	for value, expected := range map[string]bool{
+		"1": true, "true": true, "TRUE": true, "yes": true, "Yes": true,
+		"0": false, "false": false, "no": false, "": false, "foo": false,
+	} {
+		opts, err := NewProjectOptions(nil, WithEnv([]string{ComposeIgnoreOrphans + "=" + value}))
+		assert.NilError(t, err)
+		assert.Equal(t, opts.GetBoolEnv(ComposeIgnoreOrphans), expected, value)
+		assert.Equal(t, opts.IgnoreOrphans(), expected, value)
+	}
+}
+
+func TestPathSeparator(t *testing.T) {
+	opts, err := NewProjectOptions(nil, WithoutOsEnvLookup)
+	assert.NilError(t, err)
+	assert.Equal(t, opts.PathSeparator(), string(os.PathListSeparator))
+
+	opts, err = NewProjectOptions(nil, WithEnv([]string{ComposeFileSeparator + "=;"}))
+	assert.NilError(t, err)
+	assert.Equal(t, opts.PathSeparator(), ";")
+
+	opts, err = NewProjectOptions(nil, WithEnv([]string{ComposeFileSeparator + "=;", ComposePathSeparator + "=,"}))
+	assert.NilError(t, err)
+	assert.Equal(t, opts.PathSeparator(), ",")
+}
+
+func TestProjectWithConvertWindowsPaths(t *testing.T) {
+	opts, err := NewProjectOptions([]string{"testdata/windows-paths/compose.yaml"},
+		WithName("my_project"), WithEnv([]string{ComposeConvertWindowsPaths + "=1"}))
+	assert.NilError(t, err)
+	p, err := ProjectFromOptions(opts)
+	assert.NilError(t, err)
+	service, err := p.GetService("simple")
+	assert.NilError(t, err)
+	assert.Equal(t, service.Volumes[0].Source, "/c/data")
+	assert.Equal(t, service.Volumes[0].Target, "/data")
+
+	opts, err = NewProjectOptions([]string{"testdata/windows-paths/compose.yaml"}, WithName("my_project"))
+	assert.NilError(t, err)
+	p, err = ProjectFromOptions(opts)
+	assert.NilError(t, err)
+	service, err = p.GetService("simple")
+	assert.NilError(t, err)
+	assert.Equal(t, service.Volumes[0].Source, `C:\data`)
+}
+
+func TestProjectDiscoveryWithOverride(t *testing.T) {
+	dir, err := ioutil.TempDir("", "discovery")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(filepath.Join(dir, "compose.yaml"), []byte(`
+services:
+  simple:
+    image: nginx
+`), 0644)
+	assert.NilError(t, err)
+	err = ioutil.WriteFile(filepath.Join(dir, "compose.override.yml"), []byte(`
+services:
+  simple:
+    image: haproxy
+`), 0644)
+	assert.NilError(t, err)
+	nested := filepath.Join(dir, "sub", "nested")
+	assert.NilError(t, os.MkdirAll(nested, 0755))
+	// an override file without base file in the working directory must be ignored
+	err = ioutil.WriteFile(filepath.Join(nested, "docker-compose.override.yml"), []byte(`
+services:
+  simple:
+    image: busybox
+`), 0644)
+	assert.NilError(t, err)
+
+	opts, err := NewProjectOptions(nil, WithWorkingDirectory(nested), WithName("my_project"))
+	assert.NilError(t, err)
+	p, err := ProjectFromOptions(opts)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, p.ComposeFiles, []string{filepath.Join(dir, "compose.yaml"), filepath.Join(dir, "compose.override.yml")})
+	service, err := p.GetService("simple")
+	assert.NilError(t, err)
+	assert.Equal(t, service.Image, "haproxy")
+
+	err = ioutil.WriteFile(filepath.Join(dir, "compose.override.yaml"), []byte("services: {}"), 0644)
+	assert.NilError(t, err)
+	_, err = ProjectFromOptions(opts)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, "found both "+filepath.Join(dir, "compose.override.yaml")+" and "+filepath.Join(dir, "compose.override.yml"))
+}
+
+func TestProjectDiscoveryAmbiguousExtension(t *testing.T) {
+	dir, err := ioutil.TempDir("", "discovery")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"compose.yaml", "compose.yml"} {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte("services: {}"), 0644)
+		assert.NilError(t, err)
+	}
+	opts, err := NewProjectOptions(nil, WithWorkingDirectory(dir), WithName("my_project"))
+	assert.NilError(t, err)
+	_, err = ProjectFromOptions(opts)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, "can't decide which one to use")
+}
+
+func TestWithConfigFileEnv(t *testing.T) {
+	opts, err := NewProjectOptions(nil,
+		WithEnv([]string{
+			"COMPOSE_FILE=testdata/simple/compose.yaml:testdata/simple/compose-with-overrides.yaml",
+			"COMPOSE_PATH_SEPARATOR=:",
+		}),
+		WithConfigFileEnv, WithDefaultConfigPath)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, opts.ConfigPaths, []string{"testdata/simple/compose.yaml", "testdata/simple/compose-with-overrides.yaml"})
+
+	opts, err = NewProjectOptions([]string{"testdata/strict/compose.yaml"},
+		WithEnv([]string{"COMPOSE_FILE=testdata/simple/compose.yaml"}),
+		WithConfigFileEnv)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, opts.ConfigPaths, []string{"testdata/strict/compose.yaml"})
+}
+
+func TestWithDefaultConfigPath(t *testing.T) {
+	opts, err := NewProjectOptions(nil, WithWorkingDirectory("testdata/simple/"), WithDefaultConfigPath)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, opts.ConfigPaths, []string{filepath.Join("testdata", "simple", "compose.yaml")})
+
+	dir, err := ioutil.TempDir("", "discovery")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+	_, err = NewProjectOptions(nil, WithWorkingDirectory(dir), WithDefaultConfigPath)
+	assert.Check(t, errdefs.IsNotFoundError(err))
+}
+
+type recordingLogger struct {
+	warnings []string
+}
+
+func (l *recordingLogger) Warnf(format string, args ...interface{}) {
+	l.warnings = append(l.warnings, fmt.Sprintf(format, args...))
+}
+
+func TestProjectWithLogger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logger")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"compose.yaml", "docker-compose.yml"} {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte(`
+services:
+  simple:
+    image: nginx:${TAG}
+    networks: [front]
+networks:
+  front:
+    external:
+      name: outside
+`), 0644)
+		assert.NilError(t, err)
+	}
+
+	hook := test.NewGlobal()
+	defer hook.Reset()
+	logger := &recordingLogger{}
+	opts, err := NewProjectOptions(nil, WithWorkingDirectory(dir), WithName("my_project"), WithoutOsEnvLookup, WithLogger(logger))
+	assert.NilError(t, err)
+	_, err = ProjectFromOptions(opts)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, logger.warnings, []string{
+		"Found multiple config files with supported names: " + filepath.Join(dir, "compose.yaml") + ", " + filepath.Join(dir, "docker-compose.yml"),
+		"Using " + filepath.Join(dir, "compose.yaml"),
+		`The "TAG" variable is not set. Defaulting to a blank string.`,
+		"network front: network.external.name is deprecated in favor of network.name",
+	})
+	assert.Equal(t, len(hook.AllEntries()), 0)
+}
+
+func TestProjectFromOptionsErrorKinds(t *testing.T) {
+	opts, err := NewProjectOptions([]string{"testdata/simple/missing.yaml"})
+	assert.NilError(t, err)
+	_, err = ProjectFromOptions(opts)
+	assert.Assert(t, errdefs.IsNotFoundError(err))
+	assert.Assert(t, errors.Is(err, os.ErrNotExist))
+
+	dir, err := ioutil.TempDir("", "kinds")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+	for name, content := range map[string]string{
+		"bad-yaml.yaml": "services:\n  web:\n    image: [nginx\n",
+		"schema.yaml":   "services:\n  web:\n    image: nginx\n    ports: 80\n",
+		"env-file.yaml": "services:\n  web:\n    image: nginx\n    env_file: missing.env\n",
+	} {
+		assert.NilError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	for name, check := range map[string]func(error) bool{
+		"bad-yaml.yaml": errdefs.IsInvalidError,
+		"schema.yaml":   errdefs.IsInvalidError,
+		"env-file.yaml": errdefs.IsNotFoundError,
+	} {
+		opts, err := NewProjectOptions([]string{filepath.Join(dir, name)}, WithName("kinds"))
+		assert.NilError(t, err)
+		_, err = ProjectFromOptions(opts)
+		assert.Assert(t, err != nil, name)
+		assert.Assert(t, check(err), "%s: %v", name, err)
+	}
+}
+
+func TestProjectNamePrecedence(t *testing.T) {
+	testCases := []struct {
+		name     string
+		configs  []string
+		options  []ProjectOptionsFn
+		expected string
+	}{
+		{
+			name:     "top-level name",
+			configs:  []string{"testdata/name/compose.yaml"},
+			expected: "demo",
+		},
+		{
+			name:     "interpolated top-level name",
+			configs:  []string{"testdata/name/compose.yaml"},
+			options:  []ProjectOptionsFn{WithEnv([]string{"PROJECT=from_variable"})},
+			expected: "from_variable",
+		},
+		{
+			name:     "last top-level name",
+			configs:  []string{"testdata/name/compose.yaml", "testdata/name/compose.override.yaml"},
+			expected: "override",
+		},
+		{
+			name:     "environment over top-level name",
+			configs:  []string{"testdata/name/compose.yaml"},
+			options:  []ProjectOptionsFn{WithEnv([]string{ComposeProjectName + "=from_env"})},
+			expected: "from_env",
+		},
+		{
+			name:    "option over environment",
+			configs: []string{"testdata/name/compose.yaml"},
+			options: []ProjectOptionsFn{
+				WithEnv([]string{ComposeProjectName + "=from_env"}),
+				WithName("from_option"),
+			},
+			expected: "from_option",
+		},
+		{
+			name:     "working directory",
+			configs:  []string{"testdata/simple/compose.yaml"},
+			expected: "simple",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			configs := make([]string, len(tc.configs))
+			for i, config := range tc.configs {
+				abs, err := filepath.Abs(config)
+				assert.NilError(t, err)
+				configs[i] = abs
+			}
+			options := append([]ProjectOptionsFn{WithWorkingDirectory(filepath.Dir(configs[0])), WithoutOsEnvLookup}, tc.options...)
+			opts, err := NewProjectOptions(configs, options...)
+			assert.NilError(t, err)
+			p, err := ProjectFromOptions(opts)
+			assert.NilError(t, err)
+			assert.Equal(t, p.Name, tc.expected)
+		})
+	}
+}
+
+func TestInvalidProjectName(t *testing.T) {
+	_, err := NewProjectOptions([]string{"testdata/simple/compose.yaml"}, WithName("My Project"))
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `invalid project name "My Project"`)
+
+	dir, err := filepath.Abs("testdata/name")
+	assert.NilError(t, err)
+	opts, err := NewProjectOptions([]string{"compose.yaml"}, WithWorkingDirectory(dir), WithoutOsEnvLookup,
+		WithEnv([]string{ComposeProjectName + "=-project"}))
+	assert.NilError(t, err)
+	_, err = ProjectFromOptions(opts)
+	assert.Check(t, errdefs.IsInvalidError(err))
+
+	opts, err = NewProjectOptions([]string{"compose.yaml"}, WithWorkingDirectory(dir), WithoutOsEnvLookup,
+		WithEnv([]string{"PROJECT=Demo"}))
+	assert.NilError(t, err)
+	_, err = ProjectFromOptions(opts)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `invalid project name "Demo"`)
+}
+
+func TestProjectWithMetadataOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metadata")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(filepath.Join(dir, "compose.yaml"), []byte(`
+services:
+  simple:
+    image: nginx:${TAG?}
+    env_file: missing.env
+`), 0644)
+	assert.NilError(t, err)
+
+	opts, err := NewProjectOptions(nil, WithWorkingDirectory(dir), WithName("my_project"), WithoutOsEnvLookup, WithMetadataOnly)
+	assert.NilError(t, err)
+	p, err := ProjectFromOptions(opts)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, p.ServiceNames(), []string{"simple"})
+	assert.Equal(t, len(p.LoadWarnings), 2)
+
+	// an unsaved file is loaded from its content, in place of the config path
+	unsaved := WithConfigFileContent("unsaved.yaml", []byte("services:\n  draft:\n    image: nginx:${TAG?}\n"))
+	paths := []string{"compose.yaml", "unsaved.yaml"}
+	opts, err = NewProjectOptions(paths, WithWorkingDirectory(dir), WithName("my_project"), WithoutOsEnvLookup, unsaved)
+	assert.NilError(t, err)
+	_, err = ProjectFromOptions(opts)
+	assert.Check(t, errdefs.IsNotFoundError(err))
+
+	opts, err = NewProjectOptions(paths, WithWorkingDirectory(dir), WithName("my_project"), WithoutOsEnvLookup, unsaved, WithMetadataOnly)
+	assert.NilError(t, err)
+	p, err = ProjectFromOptions(opts)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, p.ServiceNames(), []string{"draft", "simple"})
+	assert.DeepEqual(t, p.ComposeFiles, paths)
+	assert.Equal(t, len(p.LoadWarnings), 3)
+}
+
+func TestProjectWithConfigFileContent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "content")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	opts, err := NewProjectOptions(nil,
+		WithEnv([]string{ComposeFilePath + "=missing.yaml"}),
+		WithConfigFileContent("compose.yaml", []byte("services:\n  web:\n    image: nginx\n")),
+		WithConfigFileContent("override.yaml", []byte("services:\n  web:\n    image: httpd\n  db:\n    image: postgres\n")),
+		WithConfigFileEnv,
+		WithDefaultConfigPath,
+		WithWorkingDirectory(dir),
+		WithName("content"))
+	assert.NilError(t, err)
+	p, err := ProjectFromOptions(opts)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, p.ServiceNames(), []string{"db", "web"})
+	web, err := p.GetService("web")
+	assert.NilError(t, err)
+	assert.Equal(t, web.Image, "httpd")
+	assert.DeepEqual(t, p.ComposeFiles, []string{"compose.yaml", "override.yaml"})
+	assert.Equal(t, p.WorkingDir, dir)
+
+	opts, err = NewProjectOptions(nil,
+		WithConfigFileContent("compose.yaml", []byte("services:\n  web:\n    image: nginx\n    env_file: missing.env\n")),
+		WithName("content"))
+	assert.NilError(t, err)
+	_, err = ProjectFromOptions(opts)
+	assert.ErrorContains(t, err, "filesystem resolution is unavailable for in-memory configs")
+	assert.Check(t, errdefs.IsNotFoundError(err))
+
+	_, err = NewProjectOptions(nil, WithConfigFileContent("", nil))
+	assert.Check(t, errdefs.IsInvalidError(err))
+}
+
+func TestProjectWithComposeFileEnv(t *testing.T) {
+	workingDir, err := filepath.Abs(filepath.Join("testdata", "simple"))
+	assert.NilError(t, err)
+	opts, err := NewProjectOptions(nil,
+		WithWorkingDirectory(workingDir),
+		WithEnv([]string{
+			ComposeFilePath + "=compose.yaml:./compose.yaml:" + filepath.Join(workingDir, "compose-with-overrides.yaml") + ":",
+			ComposeFileSeparator + "=:",
+		}),
+		WithName("compose-file"))
+	assert.NilError(t, err)
+	p, err := ProjectFromOptions(opts)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, p.ComposeFiles, []string{"compose.yaml", filepath.Join(workingDir, "compose-with-overrides.yaml")})
+
+	opts, err = NewProjectOptions(nil,
+		WithWorkingDirectory(workingDir),
+		WithEnv([]string{ComposeFilePath + "=compose.yaml:missing.yaml", ComposeFileSeparator + "=:"}),
+		WithName("compose-file"))
+	assert.NilError(t, err)
+	_, err = ProjectFromOptions(opts)
+	assert.Check(t, errdefs.IsNotFoundError(err))
+	assert.ErrorContains(t, err, "config file missing.yaml")
+}
+
+func TestProjectWithCaseInsensitiveEnv(t *testing.T) {
+	m, err := ToMap([]string{"Path=C:\\Windows", "=C:=C:\\code", "EMPTY=", "NOVALUE"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, m, map[string]string{"Path": "C:\\Windows", "=C:": "C:\\code", "EMPTY": "", "NOVALUE": ""})
+
+	dir, err := ioutil.TempDir("", "case")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+	opts, err := NewProjectOptions(nil,
+		WithConfigFileContent("compose.yaml", []byte("services:\n  web:\n    image: nginx\n    environment:\n      SEARCH: ${PATH}\n")),
+		WithWorkingDirectory(dir),
+		WithEnv([]string{"Path=C:\\Windows", "Compose_Project_Name=windows"}),
+		WithoutOsEnvLookup,
+		WithCaseInsensitiveEnv)
+	assert.NilError(t, err)
+	p, err := ProjectFromOptions(opts)
+	assert.NilError(t, err)
+	assert.Equal(t, p.Name, "windows")
+	assert.Equal(t, *p.Services[0].Environment["SEARCH"], "C:\\Windows")
+}
+
+// pipe sets content as os.Stdin, returning a function restoring it
+func pipe(t *testing.T, content string) func() {
+	f, err := ioutil.TempFile("", "stdin")
+	assert.NilError(t, err)
+	_, err = f.WriteString(content)
+	assert.NilError(t, err)
+	_, err = f.Seek(0, 0)
+	assert.NilError(t, err)
+	stdin := os.Stdin
+	os.Stdin = f
+	return func() {
+		os.Stdin = stdin
+		f.Close()
+		os.Remove(f.Name())
+	}
+}
+
+func TestProjectFromStdin(t *testing.T) {
+	const compose = "services:\n  web:\n    image: nginx\n"
+	load := func(content string, opts ...ProjectOptionsFn) (*types.Project, error) {
+		defer pipe(t, content)()
+		options, err := NewProjectOptions([]string{"-"}, opts...)
+		assert.NilError(t, err)
+		return ProjectFromOptions(options)
+	}
+
+	_, err := load(compose)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, "config is read from stdin: set a working directory to resolve relative paths from, or a project name")
+
+	dir, err := ioutil.TempDir("", "piped")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+	p, err := load(compose, WithWorkingDirectory(filepath.Join(dir, "my-app")))
+	assert.NilError(t, err)
+	assert.Equal(t, p.Name, "my-app")
+	assert.Equal(t, p.WorkingDir, filepath.Join(dir, "my-app"))
+
+	p, err = load(compose, WithName("named"))
+	assert.NilError(t, err)
+	assert.Equal(t, p.Name, "named")
+
+	p, err = load(compose, WithEnv([]string{ComposeProjectName + "=from-env"}))
+	assert.NilError(t, err)
+	assert.Equal(t, p.Name, "from-env")
+
+	p, err = load(compose, WithDefaultProjectName("piped"))
+	assert.NilError(t, err)
+	assert.Equal(t, p.Name, "piped")
+	wd, err := os.Getwd()
+	assert.NilError(t, err)
+	assert.Equal(t, p.WorkingDir, wd)
+
+	p, err = load("name: declared\n"+compose, WithDefaultProjectName("piped"))
+	assert.NilError(t, err)
+	assert.Equal(t, p.Name, "declared")
+
+	_, err = NewProjectOptions([]string{"-"}, WithDefaultProjectName("Not Valid"))
+	assert.Check(t, errdefs.IsInvalidError(err))
+}
+
+func TestGetConfigPaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config-paths")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+	dir, err = filepath.EvalSymlinks(dir)
+	assert.NilError(t, err)
+	nested := filepath.Join(dir, "a", "b", "c")
+	assert.NilError(t, os.MkdirAll(nested, 0755))
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(dir, "compose.yaml"), []byte("services:\n  web:\n    image: nginx\n    env_file: web.env\n"), 0644))
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(dir, "compose.override.yaml"), []byte("services:\n  web:\n    image: nginx:alpine\n"), 0644))
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(dir, "web.env"), []byte("FOO=bar\n"), 0644))
+
+	opts, err := NewProjectOptions(nil, WithWorkingDirectory(nested))
+	assert.NilError(t, err)
+	paths, err := opts.GetConfigPaths()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, paths, []string{filepath.Join(dir, "compose.yaml"), filepath.Join(dir, "compose.override.yaml")})
+
+	opts, err = NewProjectOptions(nil, WithWorkingDirectory(dir), WithEnv([]string{ComposeFilePath + "=compose.override.yaml"}))
+	assert.NilError(t, err)
+	paths, err = opts.GetConfigPaths()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, paths, []string{filepath.Join(dir, "compose.override.yaml")})
+
+	opts, err = NewProjectOptions([]string{"../../../compose.yaml", "-"}, WithWorkingDirectory(nested))
+	assert.NilError(t, err)
+	paths, err = opts.GetConfigPaths()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, paths, []string{filepath.Join(dir, "compose.yaml"), "-"})
+
+	empty, err := ioutil.TempDir("", "config-paths")
+	assert.NilError(t, err)
+	defer os.RemoveAll(empty)
+	opts, err = NewProjectOptions(nil, WithWorkingDirectory(empty))
+	assert.NilError(t, err)
+	_, err = opts.GetConfigPaths()
+	assert.Check(t, errdefs.IsNotFoundError(err))
+
+	// the project directory is the one the compose file has been found in
+	withFakeOsEnv(t, map[string]string{}, nested, func() {
+		opts, err := NewProjectOptions(nil, WithName("discovered"))
+		assert.NilError(t, err)
+		p, err := ProjectFromOptions(opts)
+		assert.NilError(t, err)
+		assert.Equal(t, p.WorkingDir, dir)
+		assert.Equal(t, p.Services[0].Image, "nginx:alpine")
+		assert.Equal(t, *p.Services[0].Environment["FOO"], "bar")
+	})
+}
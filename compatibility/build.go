@@ -75,3 +75,66 @@ func (c *AllowList) CheckBuildTarget(build *types.BuildConfig) {
 		c.Unsupported("services.build.target")
 	}
 }
+
+func (c *AllowList) CheckBuildCacheTo(build *types.BuildConfig) {
+	if !c.supported("services.build.cache_to") && len(build.CacheTo) != 0 {
+		build.CacheTo = nil
+		c.Unsupported("services.build.cache_to")
+	}
+}
+
+func (c *AllowList) CheckBuildNoCache(build *types.BuildConfig) {
+	if !c.supported("services.build.no_cache") && build.NoCache {
+		build.NoCache = false
+		c.Unsupported("services.build.no_cache")
+	}
+}
+
+func (c *AllowList) CheckBuildPull(build *types.BuildConfig) {
+	if !c.supported("services.build.pull") && build.Pull {
+		build.Pull = false
+		c.Unsupported("services.build.pull")
+	}
+}
+
+func (c *AllowList) CheckBuildSSH(build *types.BuildConfig) {
+	if !c.supported("services.build.ssh") && len(build.SSH) != 0 {
+		build.SSH = nil
+		c.Unsupported("services.build.ssh")
+	}
+}
+
+func (c *AllowList) CheckBuildSecrets(build *types.BuildConfig) {
+	if !c.supported("services.build.secrets") && len(build.Secrets) != 0 {
+		build.Secrets = nil
+		c.Unsupported("services.build.secrets")
+	}
+}
+
+func (c *AllowList) CheckBuildTags(build *types.BuildConfig) {
+	if !c.supported("services.build.tags") && len(build.Tags) != 0 {
+		build.Tags = nil
+		c.Unsupported("services.build.tags")
+	}
+}
+
+func (c *AllowList) CheckBuildPlatforms(build *types.BuildConfig) {
+	if !c.supported("services.build.platforms") && len(build.Platforms) != 0 {
+		build.Platforms = nil
+		c.Unsupported("services.build.platforms")
+	}
+}
+
+func (c *AllowList) CheckBuildAdditionalContexts(build *types.BuildConfig) {
+	if !c.supported("services.build.additional_contexts") && len(build.AdditionalContexts) != 0 {
+		build.AdditionalContexts = nil
+		c.Unsupported("services.build.additional_contexts")
+	}
+}
+
+func (c *AllowList) CheckBuildUlimits(build *types.BuildConfig) {
+	if !c.supported("services.build.ulimits") && len(build.Ulimits) != 0 {
+		build.Ulimits = nil
+		c.Unsupported("services.build.ulimits")
+	}
+}
@@ -32,8 +32,18 @@ type Checker interface {
 	CheckBuildIsolation(build *types.BuildConfig)
 	CheckBuildNetwork(build *types.BuildConfig)
 	CheckBuildTarget(build *types.BuildConfig)
+	CheckBuildCacheTo(build *types.BuildConfig)
+	CheckBuildNoCache(build *types.BuildConfig)
+	CheckBuildPull(build *types.BuildConfig)
+	CheckBuildSSH(build *types.BuildConfig)
+	CheckBuildSecrets(build *types.BuildConfig)
+	CheckBuildTags(build *types.BuildConfig)
+	CheckBuildPlatforms(build *types.BuildConfig)
+	CheckBuildAdditionalContexts(build *types.BuildConfig)
+	CheckBuildUlimits(build *types.BuildConfig)
 	CheckCapAdd(service *types.ServiceConfig)
 	CheckCapDrop(service *types.ServiceConfig)
+	CheckCgroup(service *types.ServiceConfig)
 	CheckCgroupParent(service *types.ServiceConfig)
 	CheckCPUCount(service *types.ServiceConfig)
 	CheckCPUPercent(service *types.ServiceConfig)
@@ -49,7 +59,9 @@ type Checker interface {
 	CheckContainerName(service *types.ServiceConfig)
 	CheckCredentialSpec(service *types.ServiceConfig)
 	CheckDependsOn(service *types.ServiceConfig)
+	CheckDevelop(service *types.ServiceConfig)
 	CheckDevices(service *types.ServiceConfig)
+	CheckDeviceCgroupRules(service *types.ServiceConfig)
 	CheckDNS(service *types.ServiceConfig)
 	CheckDNSOpts(service *types.ServiceConfig)
 	CheckDNSSearch(service *types.ServiceConfig)
@@ -86,6 +98,8 @@ type Checker interface {
 	CheckNetworkAliases(n *types.ServiceNetworkConfig)
 	CheckNetworkIpv4Address(n *types.ServiceNetworkConfig)
 	CheckNetworkIpv6Address(n *types.ServiceNetworkConfig)
+	CheckNetworkLinkLocalIPs(n *types.ServiceNetworkConfig)
+	CheckNetworkPriority(n *types.ServiceNetworkConfig)
 	CheckOomKillDisable(service *types.ServiceConfig)
 	CheckOomScoreAdj(service *types.ServiceConfig)
 	CheckPid(service *types.ServiceConfig)
@@ -112,6 +126,7 @@ type Checker interface {
 	CheckStdinOpen(service *types.ServiceConfig)
 	CheckStopGracePeriod(service *types.ServiceConfig)
 	CheckStopSignal(service *types.ServiceConfig)
+	CheckStorageOpt(service *types.ServiceConfig)
 	CheckSysctls(service *types.ServiceConfig)
 	CheckTmpfs(service *types.ServiceConfig)
 	CheckTty(service *types.ServiceConfig)
@@ -184,6 +199,7 @@ type Checker interface {
 	CheckNetworkConfigDriverOpts(network *types.NetworkConfig)
 	CheckNetworkConfigExternal(network *types.NetworkConfig)
 	CheckNetworkConfigInternal(network *types.NetworkConfig)
+	CheckNetworkConfigEnableIPv6(network *types.NetworkConfig)
 	CheckNetworkConfigAttachable(network *types.NetworkConfig)
 	CheckNetworkConfigLabels(network *types.NetworkConfig)
 }
@@ -233,9 +249,19 @@ func CheckServiceConfig(service *types.ServiceConfig, c Checker) {
 		c.CheckBuildCacheFrom(service.Build)
 		c.CheckBuildNetwork(service.Build)
 		c.CheckBuildTarget(service.Build)
+		c.CheckBuildCacheTo(service.Build)
+		c.CheckBuildNoCache(service.Build)
+		c.CheckBuildPull(service.Build)
+		c.CheckBuildSSH(service.Build)
+		c.CheckBuildSecrets(service.Build)
+		c.CheckBuildTags(service.Build)
+		c.CheckBuildPlatforms(service.Build)
+		c.CheckBuildAdditionalContexts(service.Build)
+		c.CheckBuildUlimits(service.Build)
 	}
 	c.CheckCapAdd(service)
 	c.CheckCapDrop(service)
+	c.CheckCgroup(service)
 	c.CheckCgroupParent(service)
 	c.CheckCPUCount(service)
 	c.CheckCPUPercent(service)
@@ -293,7 +319,9 @@ func CheckServiceConfig(service *types.ServiceConfig, c Checker) {
 			c.CheckUpdateConfigParallelism(UpdateConfigRollback, service.Deploy.RollbackConfig)
 		}
 	}
+	c.CheckDevelop(service)
 	c.CheckDevices(service)
+	c.CheckDeviceCgroupRules(service)
 	c.CheckDNS(service)
 	c.CheckDNSOpts(service)
 	c.CheckDNSSearch(service)
@@ -337,6 +365,8 @@ func CheckServiceConfig(service *types.ServiceConfig, c Checker) {
 				c.CheckNetworkAliases(n)
 				c.CheckNetworkIpv4Address(n)
 				c.CheckNetworkIpv6Address(n)
+				c.CheckNetworkLinkLocalIPs(n)
+				c.CheckNetworkPriority(n)
 			}
 		}
 	}
@@ -366,6 +396,7 @@ func CheckServiceConfig(service *types.ServiceConfig, c Checker) {
 	c.CheckStdinOpen(service)
 	c.CheckStopGracePeriod(service)
 	c.CheckStopSignal(service)
+	c.CheckStorageOpt(service)
 	c.CheckSysctls(service)
 	c.CheckTmpfs(service)
 	c.CheckTty(service)
@@ -400,6 +431,7 @@ func CheckNetworkConfig(network *types.NetworkConfig, c Checker) {
 	c.CheckNetworkConfigIpam(network)
 	c.CheckNetworkConfigExternal(network)
 	c.CheckNetworkConfigInternal(network)
+	c.CheckNetworkConfigEnableIPv6(network)
 	c.CheckNetworkConfigAttachable(network)
 	c.CheckNetworkConfigLabels(network)
 }
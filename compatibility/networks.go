@@ -107,6 +107,13 @@ func (c *AllowList) CheckNetworkConfigInternal(config *types.NetworkConfig) {
 	}
 }
 
+func (c *AllowList) CheckNetworkConfigEnableIPv6(config *types.NetworkConfig) {
+	if !c.supported("networks.enable_ipv6") && config.EnableIPv6 {
+		config.EnableIPv6 = false
+		c.Unsupported("networks.enable_ipv6")
+	}
+}
+
 func (c *AllowList) CheckNetworkConfigAttachable(config *types.NetworkConfig) {
 	if !c.supported("networks.attachable") && config.Attachable {
 		config.Attachable = false
@@ -23,8 +23,8 @@ import (
 )
 
 func (c *AllowList) CheckBlkioConfig(service *types.ServiceConfig) {
-	if !c.supported("services.blkio_config") && service.BlkioConfig != "" {
-		service.BlkioConfig = ""
+	if !c.supported("services.blkio_config") && service.BlkioConfig != nil {
+		service.BlkioConfig = nil
 		c.Unsupported("services.blkio_config")
 	}
 }
@@ -43,6 +43,13 @@ func (c *AllowList) CheckCapDrop(service *types.ServiceConfig) {
 	}
 }
 
+func (c *AllowList) CheckCgroup(service *types.ServiceConfig) {
+	if !c.supported("services.cgroup") && service.Cgroup != "" {
+		service.Cgroup = ""
+		c.Unsupported("services.cgroup")
+	}
+}
+
 func (c *AllowList) CheckCgroupParent(service *types.ServiceConfig) {
 	if !c.supported("services.cgroup_parent") && service.CgroupParent != "" {
 		service.CgroupParent = ""
@@ -156,6 +163,13 @@ func (c *AllowList) CheckDependsOn(service *types.ServiceConfig) {
 	}
 }
 
+func (c *AllowList) CheckDevelop(service *types.ServiceConfig) {
+	if !c.supported("services.develop") && service.Develop != nil {
+		service.Develop = nil
+		c.Unsupported("services.develop")
+	}
+}
+
 func (c *AllowList) CheckDevices(service *types.ServiceConfig) {
 	if !c.supported("services.devices") && len(service.Devices) != 0 {
 		service.Devices = nil
@@ -163,6 +177,13 @@ func (c *AllowList) CheckDevices(service *types.ServiceConfig) {
 	}
 }
 
+func (c *AllowList) CheckDeviceCgroupRules(service *types.ServiceConfig) {
+	if !c.supported("services.device_cgroup_rules") && len(service.DeviceCgroupRules) != 0 {
+		service.DeviceCgroupRules = nil
+		c.Unsupported("services.device_cgroup_rules")
+	}
+}
+
 func (c *AllowList) CheckDNS(service *types.ServiceConfig) {
 	if !c.supported("services.dns") && service.DNS != nil {
 		service.DNS = nil
@@ -241,9 +262,9 @@ func (c *AllowList) CheckExtraHosts(service *types.ServiceConfig) {
 }
 
 func (c *AllowList) CheckGroupAdd(service *types.ServiceConfig) {
-	if !c.supported("services.group_app") && len(service.GroupAdd) != 0 {
+	if !c.supported("services.group_add") && len(service.GroupAdd) != 0 {
 		service.GroupAdd = nil
-		c.Unsupported("services.group_app")
+		c.Unsupported("services.group_add")
 	}
 }
 
@@ -442,9 +463,23 @@ func (c *AllowList) CheckNetworkIpv6Address(n *types.ServiceNetworkConfig) {
 	}
 }
 
+func (c *AllowList) CheckNetworkLinkLocalIPs(n *types.ServiceNetworkConfig) {
+	if !c.supported("services.networks.link_local_ips") && len(n.LinkLocalIPs) != 0 {
+		n.LinkLocalIPs = nil
+		c.Unsupported("services.networks.link_local_ips")
+	}
+}
+
+func (c *AllowList) CheckNetworkPriority(n *types.ServiceNetworkConfig) {
+	if !c.supported("services.networks.priority") && n.Priority != 0 {
+		n.Priority = 0
+		c.Unsupported("services.networks.priority")
+	}
+}
+
 func (c *AllowList) CheckOomKillDisable(service *types.ServiceConfig) {
-	if !c.supported("services.oom_kill_disable") && service.OomKillDisable {
-		service.OomKillDisable = false
+	if !c.supported("services.oom_kill_disable") && service.OomKillDisable != nil {
+		service.OomKillDisable = nil
 		c.Unsupported("services.oom_kill_disable")
 	}
 }
@@ -464,9 +499,9 @@ func (c *AllowList) CheckPid(service *types.ServiceConfig) {
 }
 
 func (c *AllowList) CheckPidLimit(service *types.ServiceConfig) {
-	if !c.supported("services.pid_limit") && service.PidLimit != 0 {
-		service.PidLimit = 0
-		c.Unsupported("services.pid_limit")
+	if !c.supported("services.pids_limit") && service.PidsLimit != 0 {
+		service.PidsLimit = 0
+		c.Unsupported("services.pids_limit")
 	}
 }
 
@@ -501,8 +536,8 @@ func (c *AllowList) CheckPortsTarget(p *types.ServicePortConfig) {
 }
 
 func (c *AllowList) CheckPortsPublished(p *types.ServicePortConfig) {
-	if !c.supported("services.ports.published") && p.Published != 0 {
-		p.Published = 0
+	if !c.supported("services.ports.published") && p.Published != "" {
+		p.Published = ""
 		c.Unsupported("services.ports.published")
 	}
 }
@@ -536,8 +571,8 @@ func (c *AllowList) CheckReadOnly(service *types.ServiceConfig) {
 }
 
 func (c *AllowList) CheckRestart(service *types.ServiceConfig) {
-	if !c.supported("services.restart") && service.Restart != "" {
-		service.Restart = ""
+	if !c.supported("services.restart") && service.Restart != nil {
+		service.Restart = nil
 		c.Unsupported("services.restart")
 	}
 }
@@ -626,15 +661,15 @@ func (c *AllowList) CheckSecurityOpt(service *types.ServiceConfig) {
 }
 
 func (c *AllowList) CheckShmSize(service *types.ServiceConfig) {
-	if !c.supported("services.shm_size") && service.ShmSize != "" {
-		service.ShmSize = ""
+	if !c.supported("services.shm_size") && service.ShmSize != 0 {
+		service.ShmSize = 0
 		c.Unsupported("services.shm_size")
 	}
 }
 
 func (c *AllowList) CheckStdinOpen(service *types.ServiceConfig) {
-	if !c.supported("services.stdin_open") && service.StdinOpen {
-		service.StdinOpen = true
+	if !c.supported("services.stdin_open") && service.StdinOpen != nil {
+		service.StdinOpen = nil
 		c.Unsupported("services.stdin_open")
 	}
 }
@@ -653,6 +688,13 @@ func (c *AllowList) CheckStopSignal(service *types.ServiceConfig) {
 	}
 }
 
+func (c *AllowList) CheckStorageOpt(service *types.ServiceConfig) {
+	if !c.supported("services.storage_opt") && len(service.StorageOpt) != 0 {
+		service.StorageOpt = nil
+		c.Unsupported("services.storage_opt")
+	}
+}
+
 func (c *AllowList) CheckSysctls(service *types.ServiceConfig) {
 	if !c.supported("services.sysctls") && len(service.Sysctls) != 0 {
 		service.Sysctls = nil
@@ -668,8 +710,8 @@ func (c *AllowList) CheckTmpfs(service *types.ServiceConfig) {
 }
 
 func (c *AllowList) CheckTty(service *types.ServiceConfig) {
-	if !c.supported("services.tty") && service.Tty {
-		service.Tty = false
+	if !c.supported("services.tty") && service.Tty != nil {
+		service.Tty = nil
 		c.Unsupported("services.tty")
 	}
 }
@@ -696,7 +738,7 @@ func (c *AllowList) CheckUserNSMode(service *types.ServiceConfig) {
 }
 
 func (c *AllowList) CheckUts(service *types.ServiceConfig) {
-	if !c.supported("services.build") && service.Uts != "" {
+	if !c.supported("services.uts") && service.Uts != "" {
 		service.Uts = ""
 		c.Unsupported("services.uts")
 	}
@@ -754,6 +796,14 @@ func (c *AllowList) CheckVolumesBind(config *types.ServiceVolumeBind) {
 		config.Propagation = ""
 		c.Unsupported("services.volumes.bind.propagation")
 	}
+	if !c.supported("services.volumes.bind.create_host_path") && config.CreateHostPath {
+		config.CreateHostPath = false
+		c.Unsupported("services.volumes.bind.create_host_path")
+	}
+	if !c.supported("services.volumes.bind.selinux") && config.SELinux != "" {
+		config.SELinux = ""
+		c.Unsupported("services.volumes.bind.selinux")
+	}
 }
 
 func (c *AllowList) CheckVolumesVolume(config *types.ServiceVolumeVolume) {
@@ -774,6 +824,10 @@ func (c *AllowList) CheckVolumesTmpfs(config *types.ServiceVolumeTmpfs) {
 		config.Size = 0
 		c.Unsupported("services.volumes.tmpfs.size")
 	}
+	if !c.supported("services.volumes.tmpfs.mode") && config.Mode != 0 {
+		config.Mode = 0
+		c.Unsupported("services.volumes.tmpfs.mode")
+	}
 }
 
 func (c *AllowList) CheckVolumesFrom(service *types.ServiceConfig) {
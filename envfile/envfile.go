@@ -25,6 +25,7 @@ import (
 	"unicode"
 	"unicode/utf8"
 
+	"github.com/compose-spec/compose-go/template"
 	"github.com/compose-spec/compose-go/types"
 )
 
@@ -57,9 +58,71 @@ func (e ErrBadKey) Error() string {
 // where the latter case just means FOO was mentioned but not given a value
 func Parse(filename string) (types.MappingWithEquals, error) {
 	vars := types.MappingWithEquals{}
+	err := parse(filename, func(variable string, value *string, _ int) error {
+		vars[variable] = value
+		return nil
+	})
+	return vars, err
+}
+
+// ParseWithLookup reads an env file like Parse does, then resolves variable references in values with the compose
+// interpolation rules, `$$` escaping a `$`. References are resolved from the variables set by the previous lines,
+// then from lookup. Quotes are removed from values: single-quoted values are kept literal, double-quoted values
+// support `\n`, `\"` and `\\` escapes
+func ParseWithLookup(filename string, lookup template.Mapping) (types.MappingWithEquals, error) {
+	vars := types.MappingWithEquals{}
+	mapping := func(name string) (string, bool) {
+		if value, ok := vars[name]; ok && value != nil {
+			return *value, true
+		}
+		if lookup == nil {
+			return "", false
+		}
+		return lookup(name)
+	}
+	err := parse(filename, func(variable string, value *string, line int) error {
+		if value != nil {
+			unquoted, literal := UnquoteValue(strings.TrimSpace(*value))
+			if !literal {
+				resolved, err := template.Substitute(unquoted, mapping)
+				if err != nil {
+					return fmt.Errorf("env file %s line %d: %w", filename, line, err)
+				}
+				unquoted = resolved
+			}
+			value = &unquoted
+		}
+		vars[variable] = value
+		return nil
+	})
+	return vars, err
+}
+
+// UnquoteValue removes quotes and trailing comments from a raw env file value, and tells if the value is literal
+func UnquoteValue(value string) (string, bool) {
+	if len(value) > 1 && (value[0] == '\'' || value[0] == '"') {
+		if end := strings.LastIndexByte(value, value[0]); end > 0 {
+			rest := strings.TrimSpace(value[end+1:])
+			if rest == "" || strings.HasPrefix(rest, "#") {
+				if value[0] == '\'' {
+					return value[1:end], true
+				}
+				return strings.NewReplacer(`\n`, "\n", `\"`, `"`, `\\`, `\`).Replace(value[1:end]), false
+			}
+		}
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value, false
+}
+
+// parse reads the variables of an env file, calling set for each in order with the variable value, nil if the
+// variable is declared without a value, and the line number
+func parse(filename string, set func(variable string, value *string, line int) error) error {
 	fh, err := os.Open(filename)
 	if err != nil {
-		return vars, err
+		return err
 	}
 	defer fh.Close()
 
@@ -69,7 +132,7 @@ func Parse(filename string) (types.MappingWithEquals, error) {
 	for scanner.Scan() {
 		scannedBytes := scanner.Bytes()
 		if !utf8.Valid(scannedBytes) {
-			return vars, fmt.Errorf("env file %s contains invalid utf8 bytes at line %d: %v", filename, currentLine+1, scannedBytes)
+			return fmt.Errorf("env file %s contains invalid utf8 bytes at line %d: %v", filename, currentLine+1, scannedBytes)
 		}
 		// We trim UTF8 BOM
 		if currentLine == 0 {
@@ -85,20 +148,24 @@ func Parse(filename string) (types.MappingWithEquals, error) {
 			// trim the front of a variable, but nothing else
 			variable := strings.TrimLeft(data[0], whiteSpaces)
 			if strings.ContainsAny(variable, whiteSpaces) {
-				return vars, ErrBadKey{fmt.Sprintf("variable '%s' contains whitespaces", variable)}
+				return ErrBadKey{fmt.Sprintf("variable '%s' contains whitespaces", variable)}
 			}
 			if len(variable) == 0 {
-				return vars, ErrBadKey{fmt.Sprintf("no variable name on line '%s'", line)}
+				return ErrBadKey{fmt.Sprintf("no variable name on line '%s'", line)}
 			}
 
+			var err error
 			if len(data) > 1 {
 				// pass the value through, no trimming
-				vars[variable] = &data[1]
+				err = set(variable, &data[1], currentLine)
 			} else {
 				// variable was not given a value but declared
-				vars[strings.TrimSpace(line)] = nil
+				err = set(strings.TrimSpace(line), nil, currentLine)
+			}
+			if err != nil {
+				return err
 			}
 		}
 	}
-	return vars, scanner.Err()
+	return scanner.Err()
 }
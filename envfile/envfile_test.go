@@ -201,3 +201,36 @@ func TestParseEnvVariableWithNoNameFile(t *testing.T) {
 		t.Fatal("if a variable has no name parsing an environment file must fail")
 	}
 }
+
+func TestParseWithLookup(t *testing.T) {
+	content := `HOST=db
+URL=postgres://${HOST}:${PORT:-5432}/app
+SINGLE='${HOST}' # literal
+DOUBLE="${HOST}\n${MISSING}"
+ESCAPED=$$HOST
+INHERITED
+`
+	tmpFile := tmpFileWithContent(content, t)
+	defer os.Remove(tmpFile)
+
+	variables, err := ParseWithLookup(tmpFile, func(key string) (string, bool) {
+		if key == "HOST" {
+			return "ignored", true
+		}
+		return "", false
+	})
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(types.MappingWithEquals{
+		"HOST":      strPtr("db"),
+		"URL":       strPtr("postgres://db:5432/app"),
+		"SINGLE":    strPtr("${HOST}"),
+		"DOUBLE":    strPtr("db\n"),
+		"ESCAPED":   strPtr("$HOST"),
+		"INHERITED": nil,
+	}, variables))
+
+	tmpFile = tmpFileWithContent("BAD=${HOST\n", t)
+	defer os.Remove(tmpFile)
+	_, err = ParseWithLookup(tmpFile, nil)
+	assert.ErrorContains(t, err, "line 1")
+}
@@ -47,7 +47,40 @@ func IsUnsupportedError(err error) bool {
 	return errors.Is(err, ErrUnsupported)
 }
 
-// IsUnsupportedError returns true if the unwrapped error is ErrIncompatible
+// IsIncompatibleError returns true if the unwrapped error is ErrIncompatible
 func IsIncompatibleError(err error) bool {
 	return errors.Is(err, ErrIncompatible)
 }
+
+// Mark returns err marked as matching kind, one of the errors defined by this package, so that it can be tested with
+// errors.Is or the IsXxxError functions. The message of err and the errors it wraps are preserved. err is returned
+// as is when nil or already matching one of the errors defined by this package
+func Mark(err error, kind error) error {
+	if err == nil || errors.Is(err, ErrNotFound) || errors.Is(err, ErrInvalid) ||
+		errors.Is(err, ErrUnsupported) || errors.Is(err, ErrIncompatible) {
+		return err
+	}
+	return &markedError{err: err, kind: kind}
+}
+
+type markedError struct {
+	err  error
+	kind error
+}
+
+func (e *markedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *markedError) Unwrap() error {
+	return e.err
+}
+
+// Cause returns the underlying error, for compatibility with github.com/pkg/errors
+func (e *markedError) Cause() error {
+	return e.err
+}
+
+func (e *markedError) Is(target error) bool {
+	return target == e.kind
+}
@@ -7,7 +7,6 @@ require (
 	github.com/docker/go-units v0.4.0
 	github.com/google/go-cmp v0.5.4
 	github.com/imdario/mergo v0.3.11
-	github.com/joho/godotenv v1.3.0
 	github.com/mattn/go-shellwords v1.0.10
 	github.com/mitchellh/mapstructure v1.4.0
 	github.com/pkg/errors v0.9.1
@@ -15,5 +14,6 @@ require (
 	github.com/xeipuuv/gojsonschema v1.2.0
 	golang.org/x/sys v0.0.0-20200323222414-85ca7c5b95cd // indirect
 	gopkg.in/yaml.v2 v2.4.0
+	gopkg.in/yaml.v3 v3.0.1
 	gotest.tools/v3 v3.0.3
 )
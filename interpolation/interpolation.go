@@ -17,9 +17,11 @@
 package interpolation
 
 import (
+	"fmt"
 	"os"
 	"strings"
 
+	"github.com/compose-spec/compose-go/errdefs"
 	"github.com/compose-spec/compose-go/template"
 	"github.com/pkg/errors"
 )
@@ -32,6 +34,47 @@ type Options struct {
 	TypeCastMapping map[Path]Cast
 	// Substitution function to use
 	Substitute func(string, template.Mapping) (string, error)
+	// SkipExtensions leaves the values of extensions, declared by `x-` keys, as is
+	SkipExtensions bool
+	// OnError is called, if set, with the error interpolating or casting a value. The value is replaced by an empty
+	// string if it returns nil, so that the rest of the config can still be interpolated
+	OnError func(err error) error
+}
+
+// ConversionError is returned by a Cast which can't convert Value to Type
+type ConversionError struct {
+	Value string
+	Type  string
+}
+
+func (e *ConversionError) Error() string {
+	return fmt.Sprintf("cannot convert %q to %s", e.Value, e.Type)
+}
+
+// PathError is an error interpolating or casting the value at Path
+type PathError struct {
+	Path Path
+	Err  error
+}
+
+func (e *PathError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *PathError) Unwrap() error {
+	return e.Err
+}
+
+// handleError returns the result of interpolating a value which failed with err
+func (o Options) handleError(value interface{}, err error) (interface{}, error) {
+	if err == nil || o.OnError == nil {
+		return value, err
+	}
+	if err := o.OnError(err); err != nil {
+		return nil, err
+	}
+	return "", nil
 }
 
 // LookupValue is a function which maps from variable names to values.
@@ -58,6 +101,10 @@ func Interpolate(config map[string]interface{}, opts Options) (map[string]interf
 	out := map[string]interface{}{}
 
 	for key, value := range config {
+		if opts.SkipExtensions && strings.HasPrefix(key, "x-") {
+			out[key] = value
+			continue
+		}
 		interpolatedValue, err := recursiveInterpolate(value, NewPath(key), opts)
 		if err != nil {
 			return out, err
@@ -71,20 +118,35 @@ func Interpolate(config map[string]interface{}, opts Options) (map[string]interf
 func recursiveInterpolate(value interface{}, path Path, opts Options) (interface{}, error) {
 	switch value := value.(type) {
 	case string:
-		newValue, err := opts.Substitute(value, template.Mapping(opts.LookupValue))
+		var unset []string
+		lookup := func(key string) (string, bool) {
+			value, ok := opts.LookupValue(key)
+			if !ok {
+				unset = appendMissing(unset, key)
+			}
+			return value, ok
+		}
+		newValue, err := opts.Substitute(value, lookup)
 		if err != nil || newValue == value {
-			return value, newPathError(path, err)
+			return opts.handleError(value, newPathError(path, err))
 		}
 		caster, ok := opts.getCasterForPath(path)
 		if !ok {
 			return newValue, nil
 		}
 		casted, err := caster(newValue)
-		return casted, newPathError(path, errors.Wrap(err, "failed to cast to expected type"))
+		if err != nil {
+			return opts.handleError(casted, newCastError(path, unset, err))
+		}
+		return casted, nil
 
 	case map[string]interface{}:
 		out := map[string]interface{}{}
 		for key, elem := range value {
+			if opts.SkipExtensions && strings.HasPrefix(key, "x-") {
+				out[key] = elem
+				continue
+			}
 			interpolatedElem, err := recursiveInterpolate(elem, path.Next(key), opts)
 			if err != nil {
 				return nil, err
@@ -94,13 +156,13 @@ func recursiveInterpolate(value interface{}, path Path, opts Options) (interface
 		return out, nil
 
 	case []interface{}:
-		out := make([]interface{}, len(value))
-		for i, elem := range value {
+		out := make([]interface{}, 0, len(value))
+		for _, elem := range value {
 			interpolatedElem, err := recursiveInterpolate(elem, path.Next(PathMatchList), opts)
 			if err != nil {
 				return nil, err
 			}
-			out[i] = interpolatedElem
+			out = append(out, interpolatedElem)
 		}
 		return out, nil
 
@@ -109,16 +171,47 @@ func recursiveInterpolate(value interface{}, path Path, opts Options) (interface
 	}
 }
 
+func appendMissing(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+// newCastError returns the error casting the value at path, which references the unset variables
+func newCastError(path Path, unset []string, err error) error {
+	var conversion *ConversionError
+	if !errors.As(err, &conversion) {
+		return newPathError(path, errors.Wrap(err, "failed to cast to expected type"))
+	}
+	return &PathError{Path: path, Err: castError(path, unset, conversion)}
+}
+
+// castError describes the conversion error of the value at path, which references the unset variables
+func castError(path Path, unset []string, conversion *ConversionError) error {
+	provenance := ""
+	switch len(unset) {
+	case 0:
+	case 1:
+		provenance = fmt.Sprintf(" (from unset variable %s)", unset[0])
+	default:
+		provenance = fmt.Sprintf(" (from unset variables %s)", strings.Join(unset, ", "))
+	}
+	return errors.Wrapf(errdefs.ErrInvalid, "%s: cannot convert %q%s to %s", path, conversion.Value, provenance, conversion.Type)
+}
+
 func newPathError(path Path, err error) error {
 	switch err := err.(type) {
 	case nil:
 		return nil
 	case *template.InvalidTemplateError:
-		return errors.Errorf(
+		return &PathError{Path: path, Err: errdefs.Mark(errors.Errorf(
 			"invalid interpolation format for %s: %#v. You may need to escape any $ with another $.",
-			path, err.Template)
+			path, err.Template), errdefs.ErrInvalid)}
 	default:
-		return errors.Wrapf(err, "error while interpolating %s", path)
+		return &PathError{Path: path, Err: errdefs.Mark(errors.Wrapf(err, "error while interpolating %s", path), errdefs.ErrInvalid)}
 	}
 }
 
@@ -21,6 +21,7 @@ import (
 
 	"strconv"
 
+	"github.com/compose-spec/compose-go/errdefs"
 	"gotest.tools/v3/assert"
 	is "gotest.tools/v3/assert/cmp"
 	"gotest.tools/v3/env"
@@ -75,6 +76,7 @@ func TestInvalidInterpolation(t *testing.T) {
 	}
 	_, err := Interpolate(services, Options{LookupValue: defaultMapping})
 	assert.Error(t, err, `invalid interpolation format for servicea.image: "${". You may need to escape any $ with another $.`)
+	assert.Check(t, errdefs.IsInvalidError(err))
 }
 
 func TestInterpolateWithDefaults(t *testing.T) {
@@ -117,6 +119,26 @@ func TestInterpolateWithCast(t *testing.T) {
 	assert.Check(t, is.DeepEqual(expected, result))
 }
 
+func TestInterpolateSkipExtensions(t *testing.T) {
+	config := map[string]interface{}{
+		"foo": map[string]interface{}{
+			"user":  "$USER",
+			"x-foo": "$FOO",
+		},
+		"x-bar": map[string]interface{}{"user": "$USER"},
+	}
+	result, err := Interpolate(config, Options{LookupValue: defaultMapping, SkipExtensions: true})
+	assert.NilError(t, err)
+	expected := map[string]interface{}{
+		"foo": map[string]interface{}{
+			"user":  "jenny",
+			"x-foo": "$FOO",
+		},
+		"x-bar": map[string]interface{}{"user": "$USER"},
+	}
+	assert.Check(t, is.DeepEqual(expected, result))
+}
+
 func TestPathMatches(t *testing.T) {
 	var testcases = []struct {
 		doc      string
@@ -161,3 +183,79 @@ func TestPathMatches(t *testing.T) {
 		assert.Check(t, is.Equal(testcase.expected, testcase.path.matches(testcase.pattern)))
 	}
 }
+
+func TestInterpolateOnError(t *testing.T) {
+	config := map[string]interface{}{
+		"foo": map[string]interface{}{
+			"image":    "${",
+			"user":     "$USER",
+			"volumes":  []interface{}{"${:/target", "$FOO:/target"},
+			"replicas": "$USER",
+		},
+	}
+	toInt := func(value string) (interface{}, error) {
+		return strconv.Atoi(value)
+	}
+	var errs []string
+	result, err := Interpolate(config, Options{
+		LookupValue:     defaultMapping,
+		TypeCastMapping: map[Path]Cast{NewPath(PathMatchAll, "replicas"): toInt},
+		OnError: func(err error) error {
+			errs = append(errs, err.Error())
+			return nil
+		},
+	})
+	assert.NilError(t, err)
+	expected := map[string]interface{}{
+		"foo": map[string]interface{}{
+			"image":    "",
+			"user":     "jenny",
+			"volumes":  []interface{}{"", "bar:/target"},
+			"replicas": "",
+		},
+	}
+	assert.Check(t, is.DeepEqual(expected, result))
+	assert.Check(t, is.Len(errs, 3))
+
+	_, err = Interpolate(config, Options{
+		LookupValue: defaultMapping,
+		OnError: func(err error) error {
+			return err
+		},
+	})
+	assert.Check(t, errdefs.IsInvalidError(err))
+}
+
+func TestInterpolateCastErrorProvenance(t *testing.T) {
+	config := map[string]interface{}{
+		"foo": map[string]interface{}{
+			"image":    "myapp:${TAG}",
+			"user":     "$USER",
+			"volumes":  []interface{}{"${SRC}:/target", "${DST:-/data}:/data"},
+			"replicas": "${N}",
+		},
+	}
+	toInt := func(value string) (interface{}, error) {
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, &ConversionError{Value: value, Type: "integer"}
+		}
+		return i, nil
+	}
+	_, err := Interpolate(config, Options{
+		LookupValue:     defaultMapping,
+		TypeCastMapping: map[Path]Cast{NewPath(PathMatchAll, "replicas"): toInt},
+		OnError: func(err error) error {
+			assert.Check(t, is.Error(err, `foo.replicas: cannot convert "" (from unset variable N) to integer: invalid compose project`))
+			return nil
+		},
+	})
+	assert.NilError(t, err)
+
+	_, err = Interpolate(config, Options{
+		LookupValue:     defaultMapping,
+		TypeCastMapping: map[Path]Cast{NewPath(PathMatchAll, "replicas"): toInt},
+	})
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `foo.replicas: cannot convert "" (from unset variable N) to integer`)
+}
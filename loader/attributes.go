@@ -0,0 +1,246 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loader
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/compose-spec/compose-go/errdefs"
+	"github.com/pkg/errors"
+)
+
+// topLevelAttributes are the attributes of the top-level sections supported by all platforms
+var topLevelAttributes = []string{
+	"name",
+	"version",
+	"include",
+	"networks.*",
+	"volumes.*",
+	"configs.*",
+}
+
+// EngineAttributes are the attributes supported when running containers with a container engine, to be used as
+// Options.SupportedAttributes
+var EngineAttributes = append(append([]string{}, topLevelAttributes...),
+	"secrets.*.name",
+	"secrets.*.file",
+	"secrets.*.environment",
+	"secrets.*.external",
+	"secrets.*.labels",
+	"services.*.annotations",
+	"services.*.attach",
+	"services.*.blkio_config",
+	"services.*.build",
+	"services.*.cap_add",
+	"services.*.cap_drop",
+	"services.*.cgroup",
+	"services.*.cgroup_parent",
+	"services.*.command",
+	"services.*.configs",
+	"services.*.container_name",
+	"services.*.cpu_count",
+	"services.*.cpu_percent",
+	"services.*.cpu_period",
+	"services.*.cpu_quota",
+	"services.*.cpu_rt_period",
+	"services.*.cpu_rt_runtime",
+	"services.*.cpu_shares",
+	"services.*.cpus",
+	"services.*.cpuset",
+	"services.*.credential_spec",
+	"services.*.depends_on",
+	"services.*.deploy.labels",
+	"services.*.deploy.mode",
+	"services.*.deploy.replicas",
+	"services.*.deploy.resources",
+	"services.*.deploy.restart_policy",
+	"services.*.develop",
+	"services.*.device_cgroup_rules",
+	"services.*.devices",
+	"services.*.dns",
+	"services.*.dns_opt",
+	"services.*.dns_search",
+	"services.*.domainname",
+	"services.*.entrypoint",
+	"services.*.env_file",
+	"services.*.environment",
+	"services.*.expose",
+	"services.*.extends",
+	"services.*.external_links",
+	"services.*.extra_hosts",
+	"services.*.group_add",
+	"services.*.healthcheck",
+	"services.*.hostname",
+	"services.*.image",
+	"services.*.init",
+	"services.*.ipc",
+	"services.*.isolation",
+	"services.*.labels",
+	"services.*.links",
+	"services.*.logging",
+	"services.*.mac_address",
+	"services.*.mem_limit",
+	"services.*.mem_reservation",
+	"services.*.mem_swappiness",
+	"services.*.memswap_limit",
+	"services.*.network_mode",
+	"services.*.networks",
+	"services.*.oom_kill_disable",
+	"services.*.oom_score_adj",
+	"services.*.pid",
+	"services.*.pids_limit",
+	"services.*.platform",
+	"services.*.ports",
+	"services.*.privileged",
+	"services.*.profiles",
+	"services.*.pull_policy",
+	"services.*.read_only",
+	"services.*.restart",
+	"services.*.runtime",
+	"services.*.scale",
+	"services.*.secrets",
+	"services.*.security_opt",
+	"services.*.shm_size",
+	"services.*.stdin_open",
+	"services.*.stop_grace_period",
+	"services.*.stop_signal",
+	"services.*.storage_opt",
+	"services.*.sysctls",
+	"services.*.tmpfs",
+	"services.*.tty",
+	"services.*.ulimits",
+	"services.*.user",
+	"services.*.userns_mode",
+	"services.*.uts",
+	"services.*.volumes",
+	"services.*.volumes_from",
+	"services.*.working_dir",
+)
+
+// SwarmAttributes are the attributes supported when deploying services to a Swarm cluster, to be used as
+// Options.SupportedAttributes
+var SwarmAttributes = append(append([]string{}, topLevelAttributes...),
+	"secrets.*",
+	"services.*.cap_add",
+	"services.*.cap_drop",
+	"services.*.command",
+	"services.*.configs",
+	"services.*.credential_spec",
+	"services.*.deploy",
+	"services.*.dns",
+	"services.*.dns_search",
+	"services.*.entrypoint",
+	"services.*.env_file",
+	"services.*.environment",
+	"services.*.expose",
+	"services.*.extra_hosts",
+	"services.*.group_add",
+	"services.*.healthcheck",
+	"services.*.hostname",
+	"services.*.image",
+	"services.*.init",
+	"services.*.isolation",
+	"services.*.labels",
+	"services.*.logging",
+	"services.*.networks",
+	"services.*.ports",
+	"services.*.profiles",
+	"services.*.read_only",
+	"services.*.secrets",
+	"services.*.stdin_open",
+	"services.*.stop_grace_period",
+	"services.*.stop_signal",
+	"services.*.sysctls",
+	"services.*.tmpfs",
+	"services.*.tty",
+	"services.*.ulimits",
+	"services.*.user",
+	"services.*.volumes",
+	"services.*.working_dir",
+)
+
+// checkSupportedAttributes reports the attributes set by configDict which don't match opts.SupportedAttributes,
+// either as warnings or as an error if opts.FailOnUnsupportedAttributes is set
+func checkSupportedAttributes(configDict map[string]interface{}, opts *Options) error {
+	if opts.SupportedAttributes == nil {
+		return nil
+	}
+	globs := make([][]string, len(opts.SupportedAttributes))
+	for i, glob := range opts.SupportedAttributes {
+		globs[i] = strings.Split(glob, ".")
+	}
+	var unsupported [][]string
+	collectUnsupportedAttributes(configDict, nil, globs, &unsupported)
+	sort.Slice(unsupported, func(i, j int) bool {
+		return strings.Join(unsupported[i], ".") < strings.Join(unsupported[j], ".")
+	})
+
+	for _, path := range unsupported {
+		dotted := strings.Join(path, ".")
+		message := dotted + " is not supported"
+		if path[0] == "services" && len(path) > 2 {
+			message = fmt.Sprintf("service %q: %s", path[1], message)
+		}
+		if opts.FailOnUnsupportedAttributes {
+			return errorAt(dotted, errors.Wrap(errdefs.ErrUnsupported, message))
+		}
+		opts.warn(message)
+	}
+	return nil
+}
+
+// collectUnsupportedAttributes collects the paths of the attributes of dict matching none of the globs. Attributes
+// for which a glob only matches nested attributes are looked into
+func collectUnsupportedAttributes(dict map[string]interface{}, path []string, globs [][]string, unsupported *[][]string) {
+	for key, value := range dict {
+		if strings.HasPrefix(key, "x-") {
+			continue
+		}
+		attribute := append(path[:len(path):len(path)], key)
+		if matchAttribute(attribute, globs, false) {
+			continue
+		}
+		if nested, ok := value.(map[string]interface{}); ok && matchAttribute(attribute, globs, true) {
+			collectUnsupportedAttributes(nested, attribute, globs, unsupported)
+			continue
+		}
+		*unsupported = append(*unsupported, attribute)
+	}
+}
+
+// matchAttribute tells if one of globs, made of attribute names or `*` to match any, matches path. If prefix is
+// set, globs are matched against an attribute nested into path
+func matchAttribute(path []string, globs [][]string, prefix bool) bool {
+	for _, glob := range globs {
+		if len(glob) < len(path) || (prefix && len(glob) == len(path)) || (!prefix && len(glob) != len(path)) {
+			continue
+		}
+		matches := true
+		for i, segment := range path {
+			if glob[i] != "*" && glob[i] != segment {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
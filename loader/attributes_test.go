@@ -0,0 +1,116 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loader
+
+import (
+	"testing"
+
+	"github.com/compose-spec/compose-go/errdefs"
+	"gotest.tools/v3/assert"
+	is "gotest.tools/v3/assert/cmp"
+)
+
+const attributesYAML = `
+name: attributes
+services:
+  web:
+    image: nginx
+    build: .
+    privileged: true
+    x-custom: value
+    deploy:
+      replicas: 2
+      placement:
+        constraints: [node.role==manager]
+networks:
+  front:
+    attachable: true
+secrets:
+  token:
+    file: ./token
+    template_driver: golang
+`
+
+func TestSupportedAttributes(t *testing.T) {
+	dict, err := ParseYAML([]byte(attributesYAML))
+	assert.NilError(t, err)
+
+	var warnings []string
+	project, err := loadCached(buildConfigDetails(dict, nil), func(options *Options) {
+		options.SupportedAttributes = []string{"services.*.image", "services.*.deploy.replicas", "networks.*", "secrets.*.file"}
+		options.Warn = func(message string) {
+			warnings = append(warnings, message)
+		}
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, warnings, []string{
+		`name is not supported`,
+		`secrets.token.template_driver is not supported`,
+		`service "web": services.web.build is not supported`,
+		`service "web": services.web.deploy.placement is not supported`,
+		`service "web": services.web.privileged is not supported`,
+	})
+	// unsupported attributes are still loaded
+	assert.Check(t, project.Services[0].Privileged)
+}
+
+func TestPredefinedSupportedAttributes(t *testing.T) {
+	dict, err := ParseYAML([]byte(attributesYAML))
+	assert.NilError(t, err)
+
+	for _, tc := range []struct {
+		attributes []string
+		expected   []string
+	}{
+		{
+			attributes: EngineAttributes,
+			expected: []string{
+				`secrets.token.template_driver is not supported`,
+				`service "web": services.web.deploy.placement is not supported`,
+			},
+		},
+		{
+			attributes: SwarmAttributes,
+			expected: []string{
+				`service "web": services.web.build is not supported`,
+				`service "web": services.web.privileged is not supported`,
+			},
+		},
+	} {
+		var warnings []string
+		_, err := loadCached(buildConfigDetails(dict, nil), func(options *Options) {
+			options.SupportedAttributes = tc.attributes
+			options.Warn = func(message string) {
+				warnings = append(warnings, message)
+			}
+		})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, warnings, tc.expected)
+	}
+}
+
+func TestFailOnUnsupportedAttributes(t *testing.T) {
+	dict, err := ParseYAML([]byte(attributesYAML))
+	assert.NilError(t, err)
+
+	_, err = loadCached(buildConfigDetails(dict, nil), func(options *Options) {
+		options.SupportedAttributes = EngineAttributes
+		options.FailOnUnsupportedAttributes = true
+	})
+	assert.Check(t, errdefs.IsUnsupportedError(err))
+	assert.Check(t, is.ErrorContains(err, `secrets.token.template_driver is not supported`))
+}
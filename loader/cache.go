@@ -0,0 +1,257 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loader
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/compose-spec/compose-go/schema"
+	"github.com/compose-spec/compose-go/types"
+)
+
+// DefaultCacheSize is the number of entries of a Cache created with a size of 0
+const DefaultCacheSize = 256
+
+// Cache remembers the compose files parsed, validated and converted by previous loads, so that loading the same content
+// again, like a language server does on every change of a document, skips these steps. Parsed files are keyed by the
+// hash of their raw content, validated and converted models by the hash of the interpolated model, so that a change
+// of the environment is taken into account. Least recently used entries are evicted first. A Cache can be shared by
+// concurrent loads
+type Cache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[cacheKey]*list.Element
+	lru     *list.List
+}
+
+// NewCache returns a Cache holding up to size entries, DefaultCacheSize if size is 0
+func NewCache(size int) *Cache {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+	return &Cache{
+		size:    size,
+		entries: map[cacheKey]*list.Element{},
+		lru:     list.New(),
+	}
+}
+
+const (
+	parsedEntry byte = iota
+	validatedEntry
+	convertedEntry
+)
+
+type cacheKey struct {
+	kind byte
+	sum  [sha256.Size]byte
+}
+
+type cacheEntry struct {
+	key   cacheKey
+	value interface{}
+}
+
+// Len returns the number of entries of the cache
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+func (c *Cache) get(key cacheKey) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	return element.Value.(*cacheEntry).value, true
+}
+
+func (c *Cache) add(key cacheKey, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*cacheEntry).value = value
+		c.lru.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, value: value})
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// parseConfigFileCached parses file like parseConfigFile, reusing the documents parsed from the same content by a
+// previous load. The documents are copied as they are modified while being loaded
+func parseConfigFileCached(file types.ConfigFile, limits yamlLimits, cache *Cache) ([]types.ConfigFile, error) {
+	if cache == nil || file.Content == nil {
+		return parseConfigFile(file, limits)
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%d\x00%d\x00%d\x00", file.Filename, limits.maxInputSize, limits.maxAliasExpansion, limits.maxNestingDepth)
+	h.Write(file.Content)
+	key := cacheKey{kind: parsedEntry}
+	copy(key.sum[:], h.Sum(nil))
+
+	if cached, ok := cache.get(key); ok {
+		return copyDocuments(cached.([]types.ConfigFile)), nil
+	}
+	documents, err := parseConfigFile(file, limits)
+	if err != nil {
+		return nil, err
+	}
+	cache.add(key, copyDocuments(documents))
+	return documents, nil
+}
+
+// copyDocuments copies the models of documents, their positions, tags and nodes being only read
+func copyDocuments(documents []types.ConfigFile) []types.ConfigFile {
+	copied := make([]types.ConfigFile, len(documents))
+	for i, document := range documents {
+		document.Config = copyValue(document.Config).(map[string]interface{})
+		copied[i] = document
+	}
+	return copied
+}
+
+// copyValue deep copies the mappings and sequences of a parsed model
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			copied[key] = copyValue(item)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = copyValue(item)
+		}
+		return copied
+	}
+	return value
+}
+
+// validateSchema validates configDict against the compose-spec schema, unless opts.Cache knows the same model is
+// valid
+func validateSchema(configDict map[string]interface{}, opts *Options) error {
+	if opts.Cache == nil {
+		return schema.Validate(configDict)
+	}
+	key := modelKey(validatedEntry, configDict)
+	if _, ok := opts.Cache.get(key); ok {
+		return nil
+	}
+	if err := schema.Validate(configDict); err != nil {
+		return err
+	}
+	opts.Cache.add(key, nil)
+	return nil
+}
+
+// transformService converts serviceDict into a ServiceConfig, reusing the conversion of the same model by a previous
+// load when opts.Cache is set. Conversions are copied as services are modified while being loaded
+func transformService(name string, serviceDict map[string]interface{}, opts *Options) (*types.ServiceConfig, error) {
+	var key cacheKey
+	if opts.Cache != nil {
+		key = modelKey(convertedEntry, serviceDict)
+		if cached, ok := opts.Cache.get(key); ok {
+			return cached.(*types.ServiceConfig).DeepCopy(), nil
+		}
+	}
+	serviceConfig := &types.ServiceConfig{}
+	if err := Transform(serviceDict, serviceConfig); err != nil {
+		return nil, transformError(err, "services."+name, serviceDict)
+	}
+	if opts.Cache != nil {
+		opts.Cache.add(key, serviceConfig.DeepCopy())
+	}
+	return serviceConfig, nil
+}
+
+// modelKey returns the key of a parsed model for the kind of cache entries
+func modelKey(kind byte, model interface{}) cacheKey {
+	h := sha256.New()
+	hashValue(h, model)
+	key := cacheKey{kind: kind}
+	copy(key.sum[:], h.Sum(nil))
+	return key
+}
+
+// hashValue writes to h an unambiguous encoding of a parsed model, mappings being written by key order
+func hashValue(h hash.Hash, value interface{}) {
+	var buf [8]byte
+	writeLen := func(tag byte, n int) {
+		binary.LittleEndian.PutUint64(buf[:], uint64(n))
+		h.Write([]byte{tag})
+		h.Write(buf[:])
+	}
+	switch v := value.(type) {
+	case nil:
+		h.Write([]byte{'n'})
+	case string:
+		writeLen('s', len(v))
+		h.Write([]byte(v))
+	case bool:
+		if v {
+			h.Write([]byte{'t'})
+		} else {
+			h.Write([]byte{'f'})
+		}
+	case int:
+		writeLen('i', v)
+	case int64:
+		writeLen('i', int(v))
+	case uint64:
+		writeLen('u', int(v))
+	case float64:
+		writeLen('d', int(math.Float64bits(v)))
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		writeLen('m', len(keys))
+		for _, key := range keys {
+			hashValue(h, key)
+			hashValue(h, v[key])
+		}
+	case []interface{}:
+		writeLen('l', len(v))
+		for _, item := range v {
+			hashValue(h, item)
+		}
+	default:
+		encoded := fmt.Sprintf("%T:%#v", v, v)
+		writeLen('o', len(encoded))
+		h.Write([]byte(encoded))
+	}
+}
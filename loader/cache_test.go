@@ -0,0 +1,146 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loader
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/compose-spec/compose-go/types"
+	"github.com/google/go-cmp/cmp"
+	"gotest.tools/v3/assert"
+)
+
+// suiteCache is shared by all the loads of the test suite made through loadCached
+var suiteCache = NewCache(0)
+
+// equateErrorMessages compares errors, like the load errors of a project, by their message
+var equateErrorMessages = cmp.Comparer(func(x, y error) bool {
+	return fmt.Sprint(x) == fmt.Sprint(y)
+})
+
+// loadCached loads configDetails as Load does, then loads it again through suiteCache, which the previous tests
+// have filled, and returns an error if both loads don't give the same result. Warnings are only reported by the
+// uncached load.
+func loadCached(configDetails types.ConfigDetails, options ...func(*Options)) (*types.Project, error) {
+	project, err := Load(configDetails, options...)
+	cachedOptions := append(append([]func(*Options){}, options...), func(options *Options) {
+		options.Cache = suiteCache
+		options.Warn = func(string) {}
+	})
+	cached, cachedErr := Load(configDetails, cachedOptions...)
+	if fmt.Sprint(err) != fmt.Sprint(cachedErr) {
+		return nil, fmt.Errorf("cached load failed with %v, uncached load with %v", cachedErr, err)
+	}
+	if diff := cmp.Diff(project, cached, equateErrorMessages); diff != "" {
+		return nil, fmt.Errorf("cached load differs from uncached load (-uncached +cached):\n%s", diff)
+	}
+	return project, err
+}
+
+func loadRepeated(content []byte, cache *Cache) (*types.Project, error) {
+	return Load(types.ConfigDetails{
+		WorkingDir:  "/code",
+		ConfigFiles: []types.ConfigFile{{Filename: "compose.yaml", Content: content}},
+	}, func(options *Options) {
+		options.Name = "repeated"
+		options.Cache = cache
+		options.Warn = func(string) {}
+	})
+}
+
+func TestCacheEviction(t *testing.T) {
+	cache := NewCache(2)
+	keys := []cacheKey{modelKey(parsedEntry, "a"), modelKey(parsedEntry, "b"), modelKey(parsedEntry, "c")}
+	cache.add(keys[0], "a")
+	cache.add(keys[1], "b")
+	_, ok := cache.get(keys[0])
+	assert.Assert(t, ok)
+	cache.add(keys[2], "c")
+	assert.Equal(t, cache.Len(), 2)
+	_, ok = cache.get(keys[1])
+	assert.Assert(t, !ok, "least recently used entry should have been evicted")
+	value, ok := cache.get(keys[0])
+	assert.Assert(t, ok)
+	assert.Equal(t, value, "a")
+}
+
+func TestLoadWithCache(t *testing.T) {
+	cache := NewCache(0)
+	content := []byte(`
+services:
+  web:
+    image: nginx:${TAG:-latest}
+    environment:
+      MODE: production
+    ports:
+      - "8080:80"
+`)
+	load := func(env map[string]string) (*types.Project, error) {
+		return Load(types.ConfigDetails{
+			WorkingDir:  "/code",
+			ConfigFiles: []types.ConfigFile{{Filename: "compose.yaml", Content: content}},
+			Environment: env,
+		}, func(options *Options) {
+			options.Name = "cached"
+			options.Cache = cache
+		})
+	}
+
+	expected, err := loadRepeated(content, nil)
+	assert.NilError(t, err)
+	first, err := load(nil)
+	assert.NilError(t, err)
+	assert.Assert(t, cache.Len() > 0)
+	first.Services[0].Environment["MODE"] = nil
+	first.Services[0].Ports[0].Target = 81
+
+	second, err := load(nil)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, second.Services, expected.Services)
+
+	// the environment is taken into account on a cache hit of the parsed content
+	third, err := load(map[string]string{"TAG": "1.25"})
+	assert.NilError(t, err)
+	assert.Equal(t, third.Services[0].Image, "nginx:1.25")
+
+	invalid := []byte("services:\n  web:\n    image: nginx\n    ports: [\"80:80:80:80\"]\n")
+	for i := 0; i < 2; i++ {
+		_, err = loadRepeated(invalid, cache)
+		assert.ErrorContains(t, err, "ports")
+	}
+}
+
+func BenchmarkLoadRepeated(b *testing.B) {
+	for _, services := range []int{20, 100} {
+		content := generateServices(services)
+		for _, cached := range []bool{false, true} {
+			b.Run(fmt.Sprintf("services=%d/cache=%t", services, cached), func(b *testing.B) {
+				var cache *Cache
+				if cached {
+					cache = NewCache(0)
+				}
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if _, err := loadRepeated(content, cache); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,170 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loader
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/compose-spec/compose-go/errdefs"
+	"github.com/pkg/errors"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// ModifyYAML sets the value at path, made of mapping keys and sequence indexes like `services`, `web`, `image`, in
+// the YAML source. The content is kept byte-for-byte but for the replaced scalar, which keeps its quoting style when
+// value is a string. Only single line scalars can be replaced, by a scalar value
+func ModifyYAML(source []byte, path []string, value interface{}) ([]byte, error) {
+	document, err := ParseYAMLNode(source)
+	if err != nil {
+		return nil, err
+	}
+	node, err := lookupNode(document.Content[0], path)
+	if err != nil {
+		return nil, err
+	}
+	dotted := strings.Join(path, ".")
+	if node.Kind != yamlv3.ScalarNode || node.Style&(yamlv3.LiteralStyle|yamlv3.FoldedStyle) != 0 {
+		return nil, errors.Errorf("%s can't be modified as it is not a single line scalar", dotted)
+	}
+
+	start, ok := nodeOffset(source, node)
+	if !ok {
+		return nil, errors.Errorf("%s can't be modified as its position can't be resolved", dotted)
+	}
+	end, ok := scalarEnd(source, start, node)
+	if !ok {
+		return nil, errors.Errorf("%s can't be modified as it is not a single line scalar", dotted)
+	}
+	rendered, err := renderScalar(value, node.Style)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't set %s", dotted)
+	}
+
+	modified := make([]byte, 0, len(source)-(end-start)+len(rendered))
+	modified = append(modified, source[:start]...)
+	modified = append(modified, rendered...)
+	return append(modified, source[end:]...), nil
+}
+
+// lookupNode returns the node at path, not following aliases nor merge keys as modifying those would modify all the
+// values sharing them
+func lookupNode(node *yamlv3.Node, path []string) (*yamlv3.Node, error) {
+	for i, segment := range path {
+		var child *yamlv3.Node
+		switch node.Kind {
+		case yamlv3.MappingNode:
+			for j := 0; j+1 < len(node.Content); j += 2 {
+				if key := node.Content[j]; key.Tag != "!!merge" && key.Value == segment {
+					child = node.Content[j+1]
+				}
+			}
+		case yamlv3.SequenceNode:
+			if index, err := strconv.Atoi(segment); err == nil && index >= 0 && index < len(node.Content) {
+				child = node.Content[index]
+			}
+		}
+		if child == nil {
+			return nil, errors.Wrapf(errdefs.ErrNotFound, "%s", strings.Join(path[:i+1], "."))
+		}
+		if child.Kind == yamlv3.AliasNode {
+			return nil, errors.Errorf("%s can't be modified as it is an alias", strings.Join(path[:i+1], "."))
+		}
+		node = child
+	}
+	return node, nil
+}
+
+// nodeOffset returns the offset in source of the node, which position is set as a line and a column in characters
+func nodeOffset(source []byte, node *yamlv3.Node) (int, bool) {
+	offset := 0
+	for line := 1; line < node.Line; line++ {
+		next := bytes.IndexByte(source[offset:], '\n')
+		if next < 0 {
+			return 0, false
+		}
+		offset += next + 1
+	}
+	for column := 1; column < node.Column; column++ {
+		if offset >= len(source) || source[offset] == '\n' {
+			return 0, false
+		}
+		_, size := utf8.DecodeRune(source[offset:])
+		offset += size
+	}
+	return offset, true
+}
+
+// scalarEnd returns the offset in source following the single line scalar node starting at start
+func scalarEnd(source []byte, start int, node *yamlv3.Node) (int, bool) {
+	switch {
+	case node.Style&yamlv3.SingleQuotedStyle != 0:
+		return quotedEnd(source, start, '\'', '\'')
+	case node.Style&yamlv3.DoubleQuotedStyle != 0:
+		return quotedEnd(source, start, '"', '\\')
+	}
+	end := start + len(node.Value)
+	if end > len(source) || string(source[start:end]) != node.Value {
+		// tagged, anchored or multi-line plain scalar
+		return 0, false
+	}
+	return end, true
+}
+
+func quotedEnd(source []byte, start int, quote, escape byte) (int, bool) {
+	if start >= len(source) || source[start] != quote {
+		return 0, false
+	}
+	for i := start + 1; i < len(source); i++ {
+		switch {
+		case source[i] == '\n':
+			return 0, false
+		case source[i] == escape && escape != quote:
+			i++
+		case source[i] == quote && escape == quote && i+1 < len(source) && source[i+1] == quote:
+			i++
+		case source[i] == quote:
+			return i + 1, true
+		}
+	}
+	return 0, false
+}
+
+// renderScalar renders value as a single line YAML scalar, using style for strings if quoted
+func renderScalar(value interface{}, style yamlv3.Style) ([]byte, error) {
+	var node yamlv3.Node
+	if err := node.Encode(value); err != nil {
+		return nil, err
+	}
+	if node.Kind != yamlv3.ScalarNode {
+		return nil, errors.Errorf("%v is not a scalar value", value)
+	}
+	if quoted := style & (yamlv3.SingleQuotedStyle | yamlv3.DoubleQuotedStyle); quoted != 0 && node.Tag == "!!str" {
+		node.Style = quoted
+	}
+	rendered, err := yamlv3.Marshal(&node)
+	if err != nil {
+		return nil, err
+	}
+	rendered = bytes.TrimSuffix(rendered, []byte("\n"))
+	if bytes.ContainsRune(rendered, '\n') {
+		return nil, errors.Errorf("%q can't be rendered as a single line scalar", value)
+	}
+	return rendered, nil
+}
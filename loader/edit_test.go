@@ -0,0 +1,147 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loader
+
+import (
+	"testing"
+
+	"github.com/compose-spec/compose-go/errdefs"
+	"github.com/compose-spec/compose-go/types"
+	"gotest.tools/v3/assert"
+	is "gotest.tools/v3/assert/cmp"
+)
+
+const editSource = `# application
+services:
+  web:
+    image: nginx:1.24 # pinned
+    ports:
+      - "8080:80"
+    environment:
+      GREETING: 'héllo, it''s me'
+      COUNT: 1
+  db:
+    image: "postgres:15"   # database
+    command: |
+      run
+      --fast
+`
+
+func TestModifyYAML(t *testing.T) {
+	testCases := []struct {
+		path     []string
+		value    interface{}
+		expected string
+	}{
+		{
+			path:     []string{"services", "web", "image"},
+			value:    "nginx:1.25",
+			expected: "    image: nginx:1.25 # pinned\n",
+		},
+		{
+			path:     []string{"services", "db", "image"},
+			value:    "postgres:16",
+			expected: "    image: \"postgres:16\"   # database\n",
+		},
+		{
+			path:     []string{"services", "web", "ports", "0"},
+			value:    "9090:80",
+			expected: "      - \"9090:80\"\n",
+		},
+		{
+			path:     []string{"services", "web", "environment", "GREETING"},
+			value:    "it's you",
+			expected: "      GREETING: 'it''s you'\n",
+		},
+		{
+			path:     []string{"services", "web", "environment", "COUNT"},
+			value:    2,
+			expected: "      COUNT: 2\n",
+		},
+		{
+			path:     []string{"services", "web", "environment", "COUNT"},
+			value:    "yes",
+			expected: "      COUNT: \"yes\"\n",
+		},
+	}
+	for _, tc := range testCases {
+		modified, err := ModifyYAML([]byte(editSource), tc.path, tc.value)
+		assert.NilError(t, err)
+		original, _ := ParseYAMLNode([]byte(editSource))
+		node, err := lookupNode(original.Content[0], tc.path)
+		assert.NilError(t, err)
+		start, _ := nodeOffset([]byte(editSource), node)
+		lineStart := start - node.Column + 1
+		// everything but the modified line is kept as is
+		expected := editSource[:lineStart] + tc.expected + editSource[lineStart+len(lineAt(editSource, lineStart)):]
+		assert.Check(t, is.Equal(expected, string(modified)))
+	}
+
+	// columns are counted in characters
+	modified, err := ModifyYAML([]byte("services:\n  wéb: {image: nginx}\n"), []string{"services", "wéb", "image"}, "httpd")
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal("services:\n  wéb: {image: httpd}\n", string(modified)))
+}
+
+func lineAt(s string, offset int) string {
+	for i := offset; i < len(s); i++ {
+		if s[i] == '\n' {
+			return s[offset : i+1]
+		}
+	}
+	return s[offset:]
+}
+
+func TestModifyYAMLErrors(t *testing.T) {
+	_, err := ModifyYAML([]byte(editSource), []string{"services", "web", "user"}, "root")
+	assert.Check(t, errdefs.IsNotFoundError(err))
+	assert.ErrorContains(t, err, "services.web.user")
+
+	_, err = ModifyYAML([]byte(editSource), []string{"services", "db", "command"}, "run")
+	assert.ErrorContains(t, err, "services.db.command can't be modified as it is not a single line scalar")
+
+	_, err = ModifyYAML([]byte(editSource), []string{"services", "web", "ports"}, "run")
+	assert.ErrorContains(t, err, "not a single line scalar")
+
+	_, err = ModifyYAML([]byte(editSource), []string{"services", "web", "image"}, []string{"a"})
+	assert.ErrorContains(t, err, "is not a scalar value")
+
+	_, err = ModifyYAML([]byte("x-image: &image nginx\nservices:\n  web:\n    image: *image\n"), []string{"services", "web", "image"}, "httpd")
+	assert.ErrorContains(t, err, "services.web.image can't be modified as it is an alias")
+
+	_, err = ModifyYAML([]byte("services: [\n"), []string{"services"}, "foo")
+	assert.Check(t, errdefs.IsInvalidError(err))
+}
+
+func TestLoadConfigFileNode(t *testing.T) {
+	node, err := ParseYAMLNode([]byte(editSource))
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal("# application", node.Content[0].Content[0].HeadComment))
+
+	project, err := loadCached(types.ConfigDetails{
+		WorkingDir:  "/code",
+		ConfigFiles: []types.ConfigFile{{Filename: "compose.yaml", Node: node}},
+	})
+	assert.NilError(t, err)
+	web, err := project.GetService("web")
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal("nginx:1.24", web.Image))
+	assert.Check(t, is.Equal("héllo, it's me", *web.Environment["GREETING"]))
+
+	_, err = ParseYAMLNode([]byte("services: {}\n---\nservices: {}\n"))
+	assert.ErrorContains(t, err, "expected a single YAML document")
+}
@@ -0,0 +1,189 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loader
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/compose-spec/compose-go/types"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+// LocatedError is an error caused by a value of a compose file, reported with the position of this value
+type LocatedError struct {
+	Filename string
+	Line     int
+	Column   int
+	Err      error
+}
+
+func (e *LocatedError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.Filename, e.Line, e.Column, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *LocatedError) Unwrap() error {
+	return e.Err
+}
+
+// Cause returns the underlying error
+func (e *LocatedError) Cause() error {
+	return e.Err
+}
+
+// pathError is an error caused by the value at a dotted path of the configuration
+type pathError struct {
+	path string
+	err  error
+}
+
+func (e *pathError) Error() string {
+	return e.err.Error()
+}
+
+func (e *pathError) Unwrap() error {
+	return e.err
+}
+
+func (e *pathError) Cause() error {
+	return e.err
+}
+
+// errorAt marks err as caused by the value at path, so that it can be located in the loaded files
+func errorAt(path string, err error) error {
+	return &pathError{path: path, err: err}
+}
+
+// locateError reports err at the position of the offending value, looking for the last of sources declaring it as
+// later files override earlier ones. err is returned as is when this value can't be located.
+func locateError(err error, sources []types.ConfigFile) error {
+	var located *LocatedError
+	if errors.As(err, &located) {
+		return err
+	}
+	path := errorPath(err)
+	for path != "" {
+		for i := len(sources) - 1; i >= 0; i-- {
+			if position, ok := sources[i].Positions[path]; ok {
+				return &LocatedError{
+					Filename: sources[i].Filename,
+					Line:     position.Line,
+					Column:   position.Column,
+					Err:      err,
+				}
+			}
+		}
+		// fallback to the closest parent value
+		if i := strings.LastIndex(path, "."); i > 0 {
+			path = path[:i]
+		} else {
+			path = ""
+		}
+	}
+	return err
+}
+
+func errorPath(err error) string {
+	var pathErr *pathError
+	if errors.As(err, &pathErr) {
+		return pathErr.path
+	}
+	// schema validation errors
+	var fieldErr interface{ Field() string }
+	if errors.As(err, &fieldErr) {
+		return fieldErr.Field()
+	}
+	return ""
+}
+
+var decodingError = regexp.MustCompile(`(?s)^error decoding '([^']*)': (.*)$`)
+
+// transformError rewrites an error raised while transforming dict, located at path, to tell which attribute caused
+// it, like `services.web.ports: invalid port "eighty"`
+func transformError(err error, path string, dict map[string]interface{}) error {
+	var decodeErr *mapstructure.Error
+	if !errors.As(err, &decodeErr) || len(decodeErr.Errors) != 1 {
+		return errorAt(path, errors.Wrap(err, path))
+	}
+	match := decodingError.FindStringSubmatch(decodeErr.Errors[0])
+	if match == nil {
+		return errorAt(path, errors.Wrap(err, path))
+	}
+	if field := resolveField(dict, match[1]); field != "" {
+		path = path + "." + field
+	}
+	return errorAt(path, errors.Errorf("%s: %s", path, match[2]))
+}
+
+var fieldIndex = regexp.MustCompile(`\[(\d+)\]`)
+
+// resolveField converts a field name reported by mapstructure, like `Deploy.Resources.Limits`, to the matching
+// dotted path in dict, as far as it can be resolved
+func resolveField(dict map[string]interface{}, field string) string {
+	var (
+		resolved []string
+		current  interface{} = dict
+	)
+	for _, segment := range strings.Split(field, ".") {
+		name := segment
+		if i := strings.Index(segment, "["); i >= 0 {
+			name = segment[:i]
+		}
+		mapping, ok := current.(map[string]interface{})
+		if !ok {
+			break
+		}
+		key, ok := lookupKey(mapping, name)
+		if !ok {
+			break
+		}
+		resolved = append(resolved, key)
+		current = mapping[key]
+		for _, index := range fieldIndex.FindAllStringSubmatch(segment, -1) {
+			n, _ := strconv.Atoi(index[1])
+			list, ok := current.([]interface{})
+			if !ok || n >= len(list) {
+				return strings.Join(resolved, ".")
+			}
+			resolved = append(resolved, index[1])
+			current = list[n]
+		}
+	}
+	return strings.Join(resolved, ".")
+}
+
+// lookupKey finds the key of mapping matching a field name, ignoring case and separators
+func lookupKey(mapping map[string]interface{}, name string) (string, bool) {
+	if _, ok := mapping[name]; ok {
+		return name, true
+	}
+	normalized := normalizeKey(name)
+	for key := range mapping {
+		if normalizeKey(key) == normalized {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+func normalizeKey(key string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(key))
+}
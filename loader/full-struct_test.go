@@ -56,9 +56,21 @@ func services(workingDir, homeDir string) []types.ServiceConfig {
 				Network:    "foo",
 				CacheFrom:  []string{"foo", "bar"},
 				Labels:     map[string]string{"FOO": "BAR"},
+				SSH: types.SSHConfig{
+					{ID: "default"},
+					{ID: "key", Path: "~/.ssh/id_rsa"},
+				},
+				CacheTo:            []string{"type=local,dest=/tmp/cache"},
+				NoCache:            true,
+				Pull:               true,
+				AdditionalContexts: map[string]string{"base": "docker-image://alpine:3.14"},
+				Secrets:            []types.ServiceSecretConfig{{Source: "secret1"}},
+				Tags:               []string{"foo:v1.0.0"},
+				Platforms:          []string{"linux/amd64", "linux/arm64"},
 			},
 			CapAdd:       []string{"ALL"},
 			CapDrop:      []string{"NET_ADMIN", "SYS_ADMIN"},
+			Cgroup:       "private",
 			CgroupParent: "m-executor-abcd",
 			Command:      []string{"bundle", "exec", "thin", "-p", "3000"},
 			Configs: []types.ServiceConfigObjConfig{
@@ -139,7 +151,11 @@ func services(workingDir, homeDir string) []types.ServiceConfig {
 				},
 				EndpointMode: "dnsrr",
 			},
-			Devices:    []string{"/dev/ttyUSB0:/dev/ttyUSB0"},
+			DeviceCgroupRules: []string{"c 1:3 mr", "a 7:* rmw"},
+			Devices: []types.ServiceDeviceConfig{
+				{Source: "/dev/ttyUSB0", Target: "/dev/ttyUSB0", Permissions: "rwm"},
+				{Source: "/dev/sda", Target: "/dev/xvda", Permissions: "rw"},
+			},
 			DNS:        []string{"8.8.8.8", "9.9.9.9"},
 			DNSSearch:  []string{"dc1.example.com", "dc2.example.com"},
 			DomainName: "foo.com",
@@ -155,15 +171,16 @@ func services(workingDir, homeDir string) []types.ServiceConfig {
 				"./example2.env",
 			},
 			Expose: []string{"3000", "8000"},
-			ExternalLinks: []string{
-				"redis_1",
-				"project_db_1:mysql",
-				"project_db_1:postgresql",
+			ExternalLinks: []types.ServiceLink{
+				{Service: "redis_1"},
+				{Service: "project_db_1", Alias: "mysql"},
+				{Service: "project_db_1", Alias: "postgresql"},
 			},
 			ExtraHosts: []string{
 				"somehost:162.242.195.82",
 				"otherhost:50.31.209.229",
 			},
+			GroupAdd: []string{"mail", "1000"},
 			Extensions: map[string]interface{}{
 				"x-bar": "baz",
 				"x-foo": "bar",
@@ -183,10 +200,10 @@ func services(workingDir, homeDir string) []types.ServiceConfig {
 				"com.example.number":      "42",
 				"com.example.empty-label": "",
 			},
-			Links: []string{
-				"db",
-				"db:database",
-				"redis",
+			Links: []types.ServiceLink{
+				{Service: "db"},
+				{Service: "db", Alias: "database"},
+				{Service: "redis"},
 			},
 			Logging: &types.LoggingConfig{
 				Driver: "syslog",
@@ -203,8 +220,10 @@ func services(workingDir, homeDir string) []types.ServiceConfig {
 					Ipv6Address: "",
 				},
 				"other-network": {
-					Ipv4Address: "172.16.238.10",
-					Ipv6Address: "2001:3984:3989::10",
+					Ipv4Address:  "172.16.238.10",
+					Ipv6Address:  "2001:3984:3989::10",
+					LinkLocalIPs: []string{"57.123.22.11", "57.123.22.13"},
+					Priority:     100,
 				},
 				"other-other-network": nil,
 			},
@@ -245,27 +264,27 @@ func services(workingDir, homeDir string) []types.ServiceConfig {
 				{
 					Mode:      "ingress",
 					Target:    8000,
-					Published: 8000,
+					Published: "8000",
 					Protocol:  "tcp",
 				},
 				//"9090-9091:8080-8081",
 				{
 					Mode:      "ingress",
 					Target:    8080,
-					Published: 9090,
+					Published: "9090",
 					Protocol:  "tcp",
 				},
 				{
 					Mode:      "ingress",
 					Target:    8081,
-					Published: 9091,
+					Published: "9091",
 					Protocol:  "tcp",
 				},
 				//"49100:22",
 				{
 					Mode:      "ingress",
 					Target:    22,
-					Published: 49100,
+					Published: "49100",
 					Protocol:  "tcp",
 				},
 				//"127.0.0.1:8001:8001",
@@ -273,7 +292,7 @@ func services(workingDir, homeDir string) []types.ServiceConfig {
 					Mode:      "ingress",
 					HostIP:    "127.0.0.1",
 					Target:    8001,
-					Published: 8001,
+					Published: "8001",
 					Protocol:  "tcp",
 				},
 				//"127.0.0.1:5000-5010:5000-5010",
@@ -281,83 +300,83 @@ func services(workingDir, homeDir string) []types.ServiceConfig {
 					Mode:      "ingress",
 					HostIP:    "127.0.0.1",
 					Target:    5000,
-					Published: 5000,
+					Published: "5000",
 					Protocol:  "tcp",
 				},
 				{
 					Mode:      "ingress",
 					HostIP:    "127.0.0.1",
 					Target:    5001,
-					Published: 5001,
+					Published: "5001",
 					Protocol:  "tcp",
 				},
 				{
 					Mode:      "ingress",
 					HostIP:    "127.0.0.1",
 					Target:    5002,
-					Published: 5002,
+					Published: "5002",
 					Protocol:  "tcp",
 				},
 				{
 					Mode:      "ingress",
 					HostIP:    "127.0.0.1",
 					Target:    5003,
-					Published: 5003,
+					Published: "5003",
 					Protocol:  "tcp",
 				},
 				{
 					Mode:      "ingress",
 					HostIP:    "127.0.0.1",
 					Target:    5004,
-					Published: 5004,
+					Published: "5004",
 					Protocol:  "tcp",
 				},
 				{
 					Mode:      "ingress",
 					HostIP:    "127.0.0.1",
 					Target:    5005,
-					Published: 5005,
+					Published: "5005",
 					Protocol:  "tcp",
 				},
 				{
 					Mode:      "ingress",
 					HostIP:    "127.0.0.1",
 					Target:    5006,
-					Published: 5006,
+					Published: "5006",
 					Protocol:  "tcp",
 				},
 				{
 					Mode:      "ingress",
 					HostIP:    "127.0.0.1",
 					Target:    5007,
-					Published: 5007,
+					Published: "5007",
 					Protocol:  "tcp",
 				},
 				{
 					Mode:      "ingress",
 					HostIP:    "127.0.0.1",
 					Target:    5008,
-					Published: 5008,
+					Published: "5008",
 					Protocol:  "tcp",
 				},
 				{
 					Mode:      "ingress",
 					HostIP:    "127.0.0.1",
 					Target:    5009,
-					Published: 5009,
+					Published: "5009",
 					Protocol:  "tcp",
 				},
 				{
 					Mode:      "ingress",
 					HostIP:    "127.0.0.1",
 					Target:    5010,
-					Published: 5010,
+					Published: "5010",
 					Protocol:  "tcp",
 				},
 			},
 			Privileged: true,
 			ReadOnly:   true,
-			Restart:    "always",
+			Restart:    &types.ServiceRestart{Condition: types.RestartAlways},
 			Secrets: []types.ServiceSecretConfig{
 				{
 					Source: "secret1",
@@ -374,15 +393,16 @@ func services(workingDir, homeDir string) []types.ServiceConfig {
 				"label=level:s0:c100,c200",
 				"label=type:svirt_apache_t",
 			},
-			StdinOpen:       true,
+			StdinOpen:       boolPtr(true),
 			StopSignal:      "SIGUSR1",
 			StopGracePeriod: durationPtr(20 * time.Second),
+			StorageOpt:      map[string]string{"size": "20G"},
 			Sysctls: map[string]string{
 				"net.core.somaxconn":      "1024",
 				"net.ipv4.tcp_syncookies": "0",
 			},
 			Tmpfs: []string{"/run", "/tmp"},
-			Tty:   true,
+			Tty:   boolPtr(true),
 			Ulimits: map[string]*types.UlimitsConfig{
 				"nproc": {
 					Single: 65535,
@@ -439,6 +459,7 @@ func networks() map[string]types.NetworkConfig {
 					},
 				},
 			},
+			EnableIPv6: true,
 			Labels: map[string]string{
 				"foo": "bar",
 			},
@@ -562,18 +583,35 @@ func fullExampleYAML(workingDir, homeDir string) string {
       dockerfile: Dockerfile
       args:
         foo: bar
+      ssh:
+      - default
+      - key=~/.ssh/id_rsa
       labels:
         FOO: BAR
       cache_from:
       - foo
       - bar
+      cache_to:
+      - type=local,dest=/tmp/cache
+      no_cache: true
+      additional_contexts:
+        base: docker-image://alpine:3.14
+      pull: true
       network: foo
       target: foo
+      secrets:
+      - source: secret1
+      tags:
+      - foo:v1.0.0
+      platforms:
+      - linux/amd64
+      - linux/arm64
     cap_add:
     - ALL
     cap_drop:
     - NET_ADMIN
     - SYS_ADMIN
+    cgroup: private
     cgroup_parent: m-executor-abcd
     command:
     - bundle
@@ -639,8 +677,16 @@ func fullExampleYAML(workingDir, homeDir string) string {
         - spread: node.labels.az
         max_replicas_per_node: 5
       endpoint_mode: dnsrr
+    device_cgroup_rules:
+    - c 1:3 mr
+    - a 7:* rmw
     devices:
-    - /dev/ttyUSB0:/dev/ttyUSB0
+    - source: /dev/ttyUSB0
+      target: /dev/ttyUSB0
+      permissions: rwm
+    - source: /dev/sda
+      target: /dev/xvda
+      permissions: rw
     dns:
     - 8.8.8.8
     - 9.9.9.9
@@ -670,6 +716,9 @@ func fullExampleYAML(workingDir, homeDir string) string {
     extra_hosts:
     - somehost:162.242.195.82
     - otherhost:50.31.209.229
+    group_add:
+    - mail
+    - "1000"
     hostname: foo
     healthcheck:
       test:
@@ -697,8 +746,12 @@ func fullExampleYAML(workingDir, homeDir string) string {
     network_mode: container:0cfeab0f748b9a743dc3da582046357c6ef497631c1a016d28d2bf9b4f899f7b
     networks:
       other-network:
+        priority: 100
         ipv4_address: 172.16.238.10
         ipv6_address: 2001:3984:3989::10
+        link_local_ips:
+        - 57.123.22.11
+        - 57.123.22.13
       other-other-network: null
       some-network:
         aliases:
@@ -741,50 +794,62 @@ func fullExampleYAML(workingDir, homeDir string) string {
       published: 49100
       protocol: tcp
     - mode: ingress
+      host_ip: 127.0.0.1
       target: 8001
       published: 8001
       protocol: tcp
     - mode: ingress
+      host_ip: 127.0.0.1
       target: 5000
       published: 5000
       protocol: tcp
     - mode: ingress
+      host_ip: 127.0.0.1
       target: 5001
       published: 5001
       protocol: tcp
     - mode: ingress
+      host_ip: 127.0.0.1
       target: 5002
       published: 5002
       protocol: tcp
     - mode: ingress
+      host_ip: 127.0.0.1
       target: 5003
       published: 5003
       protocol: tcp
     - mode: ingress
+      host_ip: 127.0.0.1
       target: 5004
       published: 5004
       protocol: tcp
     - mode: ingress
+      host_ip: 127.0.0.1
       target: 5005
       published: 5005
       protocol: tcp
     - mode: ingress
+      host_ip: 127.0.0.1
       target: 5006
       published: 5006
       protocol: tcp
     - mode: ingress
+      host_ip: 127.0.0.1
       target: 5007
       published: 5007
       protocol: tcp
     - mode: ingress
+      host_ip: 127.0.0.1
       target: 5008
       published: 5008
       protocol: tcp
     - mode: ingress
+      host_ip: 127.0.0.1
       target: 5009
       published: 5009
       protocol: tcp
     - mode: ingress
+      host_ip: 127.0.0.1
       target: 5010
       published: 5010
       protocol: tcp
@@ -804,6 +869,8 @@ func fullExampleYAML(workingDir, homeDir string) string {
     stdin_open: true
     stop_grace_period: 20s
     stop_signal: SIGUSR1
+    storage_opt:
+      size: 20G
     sysctls:
       net.core.somaxconn: "1024"
       net.ipv4.tcp_syncookies: "0"
@@ -873,6 +940,7 @@ networks:
           host3: 172.28.1.7
       - subnet: 2001:3984:3989::/64
         gateway: 2001:3984:3989::1
+    enable_ipv6: true
     labels:
       foo: bar
   some-network: {}
@@ -1011,6 +1079,7 @@ func fullExampleJSON(workingDir, homeDir string) string {
         ]
       },
       "external": false,
+      "enable_ipv6": true,
       "labels": {
         "foo": "bar"
       }
@@ -1050,6 +1119,10 @@ func fullExampleJSON(workingDir, homeDir string) string {
         "args": {
           "foo": "bar"
         },
+        "ssh": [
+          "default",
+          "key=~/.ssh/id_rsa"
+        ],
         "labels": {
           "FOO": "BAR"
         },
@@ -1057,8 +1130,28 @@ func fullExampleJSON(workingDir, homeDir string) string {
           "foo",
           "bar"
         ],
+        "cache_to": [
+          "type=local,dest=/tmp/cache"
+        ],
+        "no_cache": true,
+        "additional_contexts": {
+          "base": "docker-image://alpine:3.14"
+        },
+        "pull": true,
         "network": "foo",
-        "target": "foo"
+        "target": "foo",
+        "secrets": [
+          {
+            "source": "secret1"
+          }
+        ],
+        "tags": [
+          "foo:v1.0.0"
+        ],
+        "platforms": [
+          "linux/amd64",
+          "linux/arm64"
+        ]
       },
       "cap_add": [
         "ALL"
@@ -1067,6 +1160,7 @@ func fullExampleJSON(workingDir, homeDir string) string {
         "NET_ADMIN",
         "SYS_ADMIN"
       ],
+      "cgroup": "private",
       "cgroup_parent": "m-executor-abcd",
       "command": [
         "bundle",
@@ -1161,8 +1255,21 @@ func fullExampleJSON(workingDir, homeDir string) string {
         },
         "endpoint_mode": "dnsrr"
       },
+      "device_cgroup_rules": [
+        "c 1:3 mr",
+        "a 7:* rmw"
+      ],
       "devices": [
-        "/dev/ttyUSB0:/dev/ttyUSB0"
+        {
+          "source": "/dev/ttyUSB0",
+          "target": "/dev/ttyUSB0",
+          "permissions": "rwm"
+        },
+        {
+          "source": "/dev/sda",
+          "target": "/dev/xvda",
+          "permissions": "rw"
+        }
       ],
       "dns": [
         "8.8.8.8",
@@ -1201,6 +1308,10 @@ func fullExampleJSON(workingDir, homeDir string) string {
         "somehost:162.242.195.82",
         "otherhost:50.31.209.229"
       ],
+      "group_add": [
+        "mail",
+        "1000"
+      ],
       "hostname": "foo",
       "healthcheck": {
         "test": [
@@ -1234,8 +1345,13 @@ func fullExampleJSON(workingDir, homeDir string) string {
       "network_mode": "container:0cfeab0f748b9a743dc3da582046357c6ef497631c1a016d28d2bf9b4f899f7b",
       "networks": {
         "other-network": {
+          "priority": 100,
           "ipv4_address": "172.16.238.10",
-          "ipv6_address": "2001:3984:3989::10"
+          "ipv6_address": "2001:3984:3989::10",
+          "link_local_ips": [
+            "57.123.22.11",
+            "57.123.22.13"
+          ]
         },
         "other-other-network": null,
         "some-network": {
@@ -1303,72 +1419,84 @@ func fullExampleJSON(workingDir, homeDir string) string {
         },
         {
           "mode": "ingress",
+          "host_ip": "127.0.0.1",
           "target": 8001,
           "published": 8001,
           "protocol": "tcp"
         },
         {
           "mode": "ingress",
+          "host_ip": "127.0.0.1",
           "target": 5000,
           "published": 5000,
           "protocol": "tcp"
         },
         {
           "mode": "ingress",
+          "host_ip": "127.0.0.1",
           "target": 5001,
           "published": 5001,
           "protocol": "tcp"
         },
         {
           "mode": "ingress",
+          "host_ip": "127.0.0.1",
           "target": 5002,
           "published": 5002,
           "protocol": "tcp"
         },
         {
           "mode": "ingress",
+          "host_ip": "127.0.0.1",
           "target": 5003,
           "published": 5003,
           "protocol": "tcp"
         },
         {
           "mode": "ingress",
+          "host_ip": "127.0.0.1",
           "target": 5004,
           "published": 5004,
           "protocol": "tcp"
         },
         {
           "mode": "ingress",
+          "host_ip": "127.0.0.1",
           "target": 5005,
           "published": 5005,
           "protocol": "tcp"
         },
         {
           "mode": "ingress",
+          "host_ip": "127.0.0.1",
           "target": 5006,
           "published": 5006,
           "protocol": "tcp"
         },
         {
           "mode": "ingress",
+          "host_ip": "127.0.0.1",
           "target": 5007,
           "published": 5007,
           "protocol": "tcp"
         },
         {
           "mode": "ingress",
+          "host_ip": "127.0.0.1",
           "target": 5008,
           "published": 5008,
           "protocol": "tcp"
         },
         {
           "mode": "ingress",
+          "host_ip": "127.0.0.1",
           "target": 5009,
           "published": 5009,
           "protocol": "tcp"
         },
         {
           "mode": "ingress",
+          "host_ip": "127.0.0.1",
           "target": 5010,
           "published": 5010,
           "protocol": "tcp"
@@ -1396,6 +1524,9 @@ func fullExampleJSON(workingDir, homeDir string) string {
       "stdin_open": true,
       "stop_grace_period": "20s",
       "stop_signal": "SIGUSR1",
+      "storage_opt": {
+        "size": "20G"
+      },
       "sysctls": {
         "net.core.somaxconn": "1024",
         "net.ipv4.tcp_syncookies": "0"
@@ -0,0 +1,255 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loader
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/compose-spec/compose-go/envfile"
+	"github.com/compose-spec/compose-go/errdefs"
+	"github.com/compose-spec/compose-go/types"
+	"github.com/pkg/errors"
+)
+
+var transformIncludeConfig TransformerFunc = func(data interface{}) (interface{}, error) {
+	switch value := data.(type) {
+	case string:
+		return map[string]interface{}{"path": value}, nil
+	case map[string]interface{}:
+		return value, nil
+	default:
+		return data, errors.Errorf("invalid type %T for include", value)
+	}
+}
+
+// loadIncludes loads the compose applications listed by the `include` section of filename, and imports their
+// resources into cfg. Relative paths are resolved from the directory of filename
+func loadIncludes(filename string, source interface{}, cfg *types.Config, configDetails types.ConfigDetails, opts *Options) error {
+	var includes []types.IncludeConfig
+	if err := Transform(source, &includes); err != nil {
+		return transformError(err, "include", map[string]interface{}{})
+	}
+
+	dir, err := filepath.Abs(configDetails.WorkingDir)
+	if err != nil {
+		return err
+	}
+	stack := opts.included
+	if filename != "" && filename != "-" {
+		current := absPath(dir, filename)
+		dir = filepath.Dir(current)
+		stack = append(append([]string{}, stack...), current)
+	}
+
+	for i, include := range includes {
+		path := fmt.Sprintf("include.%d", i)
+		project, err := loadInclude(include, dir, stack, configDetails, opts)
+		if err != nil {
+			return errorAt(path, err)
+		}
+		if err := importResources(cfg, project, absPath(dir, include.Path[0]), opts.importedServices); err != nil {
+			return errorAt(path, err)
+		}
+	}
+	return nil
+}
+
+// loadInclude loads an included compose application, without normalizing nor checking it as this is done once
+// imported into the including project
+func loadInclude(include types.IncludeConfig, dir string, stack []string, configDetails types.ConfigDetails, opts *Options) (*types.Project, error) {
+	if len(include.Path) == 0 {
+		return nil, errors.Wrap(errdefs.ErrInvalid, "include requires a path")
+	}
+	paths := make([]string, len(include.Path))
+	for i, p := range include.Path {
+		paths[i] = absPath(dir, p)
+		for _, f := range stack {
+			if f == paths[i] {
+				return nil, errors.Wrapf(errdefs.ErrInvalid, "include cycle detected: %s -> %s", strings.Join(stack, " -> "), paths[i])
+			}
+		}
+	}
+
+	projectDir := filepath.Dir(paths[0])
+	if include.ProjectDirectory != "" {
+		projectDir = absPath(dir, include.ProjectDirectory)
+	}
+
+	lookup := opts.Interpolate.LookupValue
+	if lookup == nil {
+		lookup = configDetails.LookupEnv
+	}
+	defaults, err := includeEnvironment(include, dir, projectDir, lookup)
+	if err != nil {
+		return nil, err
+	}
+	// variables set by the including project take precedence over the ones set by env files
+	environment := map[string]string{}
+	for k, v := range defaults {
+		environment[k] = v
+	}
+	for k, v := range configDetails.Environment {
+		environment[k] = v
+	}
+
+	files := make([]types.ConfigFile, len(paths))
+	for i, p := range paths {
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return nil, errors.Wrap(errdefs.ErrNotFound, err.Error())
+		}
+		files[i] = types.ConfigFile{Filename: p, Content: b}
+	}
+
+	interpolate := *opts.Interpolate
+	interpolate.LookupValue = func(key string) (string, bool) {
+		if v, ok := lookup(key); ok {
+			return v, true
+		}
+		v, ok := defaults[key]
+		return v, ok
+	}
+	included := *opts
+	included.Interpolate = &interpolate
+	included.SkipNormalization = true
+	included.SkipConsistencyCheck = true
+	included.SecretExistenceChecker = nil
+	included.included = stack
+	project, err := load(types.ConfigDetails{
+		Version:     configDetails.Version,
+		WorkingDir:  projectDir,
+		ConfigFiles: files,
+		Environment: environment,
+	}, &included)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, service := range project.Services {
+		if service.Build != nil && !filepath.IsAbs(service.Build.Context) && !isRemoteContext(service.Build.Context) {
+			// build contexts are relative to the project directory of the included application, while the
+			// including project would resolve them from its own
+			service.Build.Context = filepath.Join(projectDir, service.Build.Context)
+			project.Services[i] = service
+		}
+	}
+	return project, nil
+}
+
+// isRemoteContext tells if a build context is a remote git repository or tarball rather than a local path
+func isRemoteContext(context string) bool {
+	for _, prefix := range []string{"http://", "https://", "git://", "git@", "github.com/"} {
+		if strings.HasPrefix(context, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// includeEnvironment reads the env files of an include entry, defaulting to the optional `.env` file of its project
+// directory
+func includeEnvironment(include types.IncludeConfig, dir, projectDir string, lookup func(string) (string, bool)) (map[string]string, error) {
+	files := make([]string, len(include.EnvFile))
+	for i, f := range include.EnvFile {
+		files[i] = absPath(dir, f)
+	}
+	optional := false
+	if len(files) == 0 {
+		files = []string{filepath.Join(projectDir, ".env")}
+		optional = true
+	}
+
+	environment := map[string]string{}
+	for _, f := range files {
+		vars, err := envfile.Parse(f)
+		if os.IsNotExist(err) && optional {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range vars.Resolve(lookup).RemoveEmpty() {
+			environment[k] = *v
+		}
+	}
+	return environment, nil
+}
+
+// importResources adds the resources of an included project to cfg, recording the imported services in imported. An
+// included service can't use the name of a service declared by cfg or already imported, and other resources can
+// only be declared by both if identical
+func importResources(cfg *types.Config, project *types.Project, source string, imported map[string]string) error {
+	for _, service := range project.Services {
+		_, conflicting := imported[service.Name]
+		for _, s := range cfg.Services {
+			conflicting = conflicting || s.Name == service.Name
+		}
+		if conflicting {
+			return errors.Wrapf(errdefs.ErrInvalid, "service %q declared by included file %s is already declared", service.Name, source)
+		}
+		cfg.Services = append(cfg.Services, service)
+		imported[service.Name] = source
+	}
+	conflict := func(kind, name string) error {
+		return errors.Wrapf(errdefs.ErrInvalid, "%s %q declared by included file %s conflicts with the one already declared", kind, name, source)
+	}
+	for name, network := range project.Networks {
+		if existing, ok := cfg.Networks[name]; ok && !reflect.DeepEqual(existing, network) {
+			return conflict("network", name)
+		}
+		cfg.Networks[name] = network
+	}
+	for name, volume := range project.Volumes {
+		if existing, ok := cfg.Volumes[name]; ok && !reflect.DeepEqual(existing, volume) {
+			return conflict("volume", name)
+		}
+		cfg.Volumes[name] = volume
+	}
+	for name, secret := range project.Secrets {
+		if existing, ok := cfg.Secrets[name]; ok && !reflect.DeepEqual(existing, secret) {
+			return conflict("secret", name)
+		}
+		cfg.Secrets[name] = secret
+	}
+	for name, config := range project.Configs {
+		if existing, ok := cfg.Configs[name]; ok && !reflect.DeepEqual(existing, config) {
+			return conflict("config", name)
+		}
+		cfg.Configs[name] = config
+	}
+	return nil
+}
+
+// checkImportedServices rejects the services imported by a document, at the index set by importedBy, which another
+// document declares as well, as they would otherwise be merged silently. imported maps them to the included file
+// declaring them
+func checkImportedServices(configs []*types.Config, sources []types.ConfigFile, importedBy map[string]int, imported map[string]string) error {
+	for i, cfg := range configs {
+		for _, s := range cfg.Services {
+			if j, ok := importedBy[s.Name]; ok && j != i {
+				err := errorAt("services."+s.Name, errors.Wrapf(errdefs.ErrInvalid, "service %q declared by included file %s is already declared", s.Name, imported[s.Name]))
+				return locateError(err, sources[i:i+1])
+			}
+		}
+	}
+	return nil
+}
@@ -17,42 +17,56 @@
 package loader
 
 import (
+	"sort"
 	"strconv"
 	"strings"
 
 	interp "github.com/compose-spec/compose-go/interpolation"
+	"github.com/compose-spec/compose-go/template"
 	"github.com/pkg/errors"
 )
 
 var interpolateTypeCastMapping = map[interp.Path]interp.Cast{
-	servicePath("configs", interp.PathMatchList, "mode"):             toInt,
-	servicePath("secrets", interp.PathMatchList, "mode"):             toInt,
-	servicePath("healthcheck", "retries"):                            toInt,
-	servicePath("healthcheck", "disable"):                            toBoolean,
-	servicePath("deploy", "replicas"):                                toInt,
-	servicePath("deploy", "update_config", "parallelism"):            toInt,
-	servicePath("deploy", "update_config", "max_failure_ratio"):      toFloat,
-	servicePath("deploy", "rollback_config", "parallelism"):          toInt,
-	servicePath("deploy", "rollback_config", "max_failure_ratio"):    toFloat,
-	servicePath("deploy", "restart_policy", "max_attempts"):          toInt,
-	servicePath("deploy", "placement", "max_replicas_per_node"):      toInt,
-	servicePath("ports", interp.PathMatchList, "target"):             toInt,
-	servicePath("ports", interp.PathMatchList, "published"):          toInt,
-	servicePath("ulimits", interp.PathMatchAll):                      toInt,
-	servicePath("ulimits", interp.PathMatchAll, "hard"):              toInt,
-	servicePath("ulimits", interp.PathMatchAll, "soft"):              toInt,
+	servicePath("configs", interp.PathMatchList, "mode"):          toInt,
+	servicePath("secrets", interp.PathMatchList, "mode"):          toInt,
+	servicePath("healthcheck", "retries"):                         toInt,
+	servicePath("healthcheck", "disable"):                         toBoolean,
+	servicePath("deploy", "replicas"):                             toInt,
+	servicePath("deploy", "update_config", "parallelism"):         toInt,
+	servicePath("deploy", "update_config", "max_failure_ratio"):   toFloat,
+	servicePath("deploy", "rollback_config", "parallelism"):       toInt,
+	servicePath("deploy", "rollback_config", "max_failure_ratio"): toFloat,
+	servicePath("deploy", "restart_policy", "max_attempts"):       toInt,
+	servicePath("deploy", "placement", "max_replicas_per_node"):   toInt,
+	servicePath("ports", interp.PathMatchList, "target"):          toInt,
+	servicePath("ulimits", interp.PathMatchAll):                   toInt,
+	servicePath("ulimits", interp.PathMatchAll, "hard"):           toInt,
+	servicePath("ulimits", interp.PathMatchAll, "soft"):           toInt,
+	servicePath("build", "ulimits", interp.PathMatchAll):          toInt,
+	servicePath("build", "ulimits", interp.PathMatchAll, "hard"):  toInt,
+	servicePath("build", "ulimits", interp.PathMatchAll, "soft"):  toInt,
+	servicePath("scale"):                                             toInt,
+	servicePath("oom_score_adj"):                                     toInt,
+	servicePath("pids_limit"):                                        toInt,
+	servicePath("init"):                                              toBoolean,
+	servicePath("oom_kill_disable"):                                  toBoolean,
 	servicePath("privileged"):                                        toBoolean,
 	servicePath("read_only"):                                         toBoolean,
 	servicePath("stdin_open"):                                        toBoolean,
 	servicePath("tty"):                                               toBoolean,
 	servicePath("volumes", interp.PathMatchList, "read_only"):        toBoolean,
 	servicePath("volumes", interp.PathMatchList, "volume", "nocopy"): toBoolean,
+	servicePath("attach"):                                            toBoolean,
 	iPath("networks", interp.PathMatchAll, "external"):               toBoolean,
 	iPath("networks", interp.PathMatchAll, "internal"):               toBoolean,
 	iPath("networks", interp.PathMatchAll, "attachable"):             toBoolean,
+	iPath("networks", interp.PathMatchAll, "enable_ipv6"):            toBoolean,
 	iPath("volumes", interp.PathMatchAll, "external"):                toBoolean,
 	iPath("secrets", interp.PathMatchAll, "external"):                toBoolean,
 	iPath("configs", interp.PathMatchAll, "external"):                toBoolean,
+
+	servicePath("blkio_config", "weight"):                                        toInt,
+	servicePath("blkio_config", "weight_device", interp.PathMatchList, "weight"): toInt,
 }
 
 func iPath(parts ...string) interp.Path {
@@ -64,11 +78,19 @@ func servicePath(parts ...string) interp.Path {
 }
 
 func toInt(value string) (interface{}, error) {
-	return strconv.Atoi(value)
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, &interp.ConversionError{Value: value, Type: "integer"}
+	}
+	return i, nil
 }
 
 func toFloat(value string) (interface{}, error) {
-	return strconv.ParseFloat(value, 64)
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, &interp.ConversionError{Value: value, Type: "float"}
+	}
+	return f, nil
 }
 
 // should match http://yaml.org/type/bool.html
@@ -79,10 +101,73 @@ func toBoolean(value string) (interface{}, error) {
 	case "n", "no", "false", "off":
 		return false, nil
 	default:
-		return nil, errors.Errorf("invalid boolean: %s", value)
+		return nil, &interp.ConversionError{Value: value, Type: "boolean"}
+	}
+}
+
+func interpolateConfig(configDict map[string]interface{}, opts *Options) (map[string]interface{}, error) {
+	interpolateOpts := *opts.Interpolate
+	interpolateOpts.SkipExtensions = interpolateOpts.SkipExtensions || !opts.InterpolateExtensions
+	if opts.SkeletonMode {
+		interpolateOpts.OnError = func(err error) error {
+			opts.flag(err.Error())
+			return nil
+		}
 	}
+	interpolated, err := interp.Interpolate(configDict, interpolateOpts)
+	var pathErr *interp.PathError
+	if errors.As(err, &pathErr) {
+		return nil, errorAt(string(pathErr.Path), err)
+	}
+	return interpolated, err
+}
+
+// VariableInfo describes a variable referenced by a compose file
+type VariableInfo struct {
+	Name string
+	// DefaultValue is the value used when the variable is not set, as declared by the first location setting one
+	DefaultValue string
+	// Required is true if at least one location fails when the variable is not set, using `${NAME?}` or `${NAME:?}`
+	Required bool
+	// Locations are the dotted paths of the values referencing the variable
+	Locations []string
 }
 
-func interpolateConfig(configDict map[string]interface{}, opts interp.Options) (map[string]interface{}, error) {
-	return interp.Interpolate(configDict, opts)
+// ExtractVariables returns all the variables referenced by a compose file (dict representation), indexed by name.
+// Unlike interpolation this never fails, so it can be used to report which variables a project expects.
+func ExtractVariables(config map[string]interface{}) map[string]VariableInfo {
+	variables := map[string]VariableInfo{}
+	extractVariables(config, "", variables)
+	return variables
+}
+
+func extractVariables(value interface{}, path string, variables map[string]VariableInfo) {
+	switch value := value.(type) {
+	case string:
+		for _, variable := range template.ExtractStringVariables(value, nil) {
+			info := variables[variable.Name]
+			info.Name = variable.Name
+			if info.DefaultValue == "" {
+				info.DefaultValue = variable.DefaultValue
+			}
+			info.Required = info.Required || variable.Required
+			if len(info.Locations) == 0 || info.Locations[len(info.Locations)-1] != path {
+				info.Locations = append(info.Locations, path)
+			}
+			variables[variable.Name] = info
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			extractVariables(value[key], joinPath(path, key), variables)
+		}
+	case []interface{}:
+		for i, item := range value {
+			extractVariables(item, joinPath(path, strconv.Itoa(i)), variables)
+		}
+	}
 }
@@ -0,0 +1,124 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loader
+
+import (
+	"github.com/compose-spec/compose-go/errdefs"
+	"github.com/pkg/errors"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+const (
+	// DefaultMaxInputSize is the default maximum size in bytes of a compose file
+	DefaultMaxInputSize = 10 * 1024 * 1024
+	// DefaultMaxAliasExpansion is the default maximum ratio between the number of values a compose file holds once
+	// its aliases are expanded and the number of values it declares
+	DefaultMaxAliasExpansion = 100
+	// DefaultMaxNestingDepth is the default maximum nesting depth of the values of a compose file
+	DefaultMaxNestingDepth = 200
+)
+
+// yamlLimits bound the resources parsing a compose file can use, zero or negative values disabling a limit
+type yamlLimits struct {
+	maxInputSize      int
+	maxAliasExpansion int
+	maxNestingDepth   int
+}
+
+var defaultYAMLLimits = yamlLimits{
+	maxInputSize:      DefaultMaxInputSize,
+	maxAliasExpansion: DefaultMaxAliasExpansion,
+	maxNestingDepth:   DefaultMaxNestingDepth,
+}
+
+func (o *Options) yamlLimits() yamlLimits {
+	return yamlLimits{
+		maxInputSize:      o.MaxInputSize,
+		maxAliasExpansion: o.MaxAliasExpansion,
+		maxNestingDepth:   o.MaxNestingDepth,
+	}
+}
+
+// checkInputSize rejects sources larger than the maximum input size, before they get parsed
+func (l yamlLimits) checkInputSize(source []byte) error {
+	if l.maxInputSize > 0 && len(source) > l.maxInputSize {
+		return errors.Wrapf(errdefs.ErrInvalid, "compose file is %d bytes, exceeding the maximum input size of %d bytes", len(source), l.maxInputSize)
+	}
+	return nil
+}
+
+// checkDocument rejects documents nesting values deeper than the maximum depth, or which aliases expand to more
+// values than allowed, before they get decoded as decoding expands aliases
+func (l yamlLimits) checkDocument(document *yamlv3.Node) error {
+	if l.maxAliasExpansion <= 0 && l.maxNestingDepth <= 0 {
+		return nil
+	}
+	measure := &nodeMeasure{expanded: map[*yamlv3.Node]nodeSize{}}
+	size := measure.size(document)
+	if l.maxNestingDepth > 0 && size.depth > l.maxNestingDepth {
+		return errors.Wrapf(errdefs.ErrInvalid, "compose file nests values %d levels deep, exceeding the maximum nesting depth of %d", size.depth, l.maxNestingDepth)
+	}
+	if l.maxAliasExpansion > 0 && size.values > measure.declared*l.maxAliasExpansion {
+		return errors.Wrapf(errdefs.ErrInvalid, "compose file aliases expand %d values to %d, exceeding the maximum alias expansion of %d times", measure.declared, size.values, l.maxAliasExpansion)
+	}
+	return nil
+}
+
+// nodeSize is the number of values of a node and its nesting depth, once its aliases are expanded
+type nodeSize struct {
+	values int
+	depth  int
+}
+
+// maxMeasuredValues caps the number of values measured, as nested aliases can expand to more than an int holds
+const maxMeasuredValues = 1 << 40
+
+type nodeMeasure struct {
+	// declared is the number of nodes of the document, aliases not being expanded
+	declared int
+	// expanded memoizes the size of the nodes already measured, so that aliases are measured once
+	expanded map[*yamlv3.Node]nodeSize
+}
+
+func (m *nodeMeasure) size(node *yamlv3.Node) nodeSize {
+	if size, ok := m.expanded[node]; ok {
+		return size
+	}
+	m.declared++
+	size := nodeSize{values: 1, depth: 1}
+	if node.Kind == yamlv3.AliasNode {
+		if node.Alias != nil {
+			size = m.size(node.Alias)
+		}
+		m.expanded[node] = size
+		return size
+	}
+	// the node is recorded while measured, so that an alias nested into its anchored node doesn't loop
+	m.expanded[node] = size
+	for _, child := range node.Content {
+		childSize := m.size(child)
+		size.values += childSize.values
+		if size.values > maxMeasuredValues {
+			size.values = maxMeasuredValues
+		}
+		if childSize.depth+1 > size.depth {
+			size.depth = childSize.depth + 1
+		}
+	}
+	m.expanded[node] = size
+	return size
+}
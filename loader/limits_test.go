@@ -0,0 +1,113 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loader
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/compose-spec/compose-go/errdefs"
+	"github.com/compose-spec/compose-go/types"
+	"gotest.tools/v3/assert"
+)
+
+const billionLaughs = `
+x-a: &a ["lol", "lol", "lol", "lol", "lol", "lol", "lol", "lol", "lol"]
+x-b: &b [*a, *a, *a, *a, *a, *a, *a, *a, *a]
+x-c: &c [*b, *b, *b, *b, *b, *b, *b, *b, *b]
+x-d: &d [*c, *c, *c, *c, *c, *c, *c, *c, *c]
+x-e: &e [*d, *d, *d, *d, *d, *d, *d, *d, *d]
+x-f: &f [*e, *e, *e, *e, *e, *e, *e, *e, *e]
+x-g: &g [*f, *f, *f, *f, *f, *f, *f, *f, *f]
+x-h: &h [*g, *g, *g, *g, *g, *g, *g, *g, *g]
+x-i: &i [*h, *h, *h, *h, *h, *h, *h, *h, *h]
+services:
+  web:
+    image: nginx
+    labels:
+      lol: *i
+`
+
+// nested returns a compose file which service declares an extension nesting depth flow mappings
+func nested(depth int) string {
+	return "services:\n  web:\n    image: nginx\n    x-nested: " + strings.Repeat("{a: ", depth) + "b" + strings.Repeat("}", depth) + "\n"
+}
+
+func loadWithLimits(content string, options ...func(*Options)) (*types.Project, error) {
+	return loadCached(types.ConfigDetails{
+		WorkingDir:  "/code",
+		ConfigFiles: []types.ConfigFile{{Filename: "compose.yaml", Content: []byte(content)}},
+	}, append([]func(*Options){func(options *Options) {
+		options.Name = "limits"
+	}}, options...)...)
+}
+
+func TestYAMLAliasExpansionLimit(t *testing.T) {
+	_, err := loadWithLimits(billionLaughs)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, "exceeding the maximum alias expansion of 100 times")
+
+	_, err = ParseYAML([]byte(billionLaughs))
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, "maximum alias expansion")
+
+	// anchors reused by a few services are fine
+	_, err = loadWithLimits(`
+x-common: &common
+  image: nginx
+  labels: {team: web}
+services:
+  a: *common
+  b: *common
+  c: *common
+`)
+	assert.NilError(t, err)
+}
+
+func TestYAMLNestingDepthLimit(t *testing.T) {
+	_, err := loadWithLimits(nested(500))
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, "exceeding the maximum nesting depth of 200")
+
+	_, err = loadWithLimits(nested(100))
+	assert.NilError(t, err)
+
+	_, err = loadWithLimits(nested(100), func(options *Options) {
+		options.MaxNestingDepth = 50
+	})
+	assert.ErrorContains(t, err, "exceeding the maximum nesting depth of 50")
+
+	_, err = loadWithLimits(nested(500), func(options *Options) {
+		options.MaxNestingDepth = 0
+	})
+	assert.NilError(t, err)
+}
+
+func TestYAMLInputSizeLimit(t *testing.T) {
+	content := "services:\n  web:\n    image: nginx\n    labels:\n      padding: " + strings.Repeat("a", 2048) + "\n"
+	_, err := loadWithLimits(content, func(options *Options) {
+		options.MaxInputSize = 1024
+	})
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, "exceeding the maximum input size of 1024 bytes")
+
+	_, err = loadWithLimits(content)
+	assert.NilError(t, err)
+
+	_, err = ParseYAML([]byte("services: {}\n" + strings.Repeat("#", DefaultMaxInputSize)))
+	assert.ErrorContains(t, err, "maximum input size")
+}
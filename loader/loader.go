@@ -17,21 +17,27 @@
 package loader
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
 	"reflect"
+	"regexp"
+	"runtime"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/imdario/mergo"
 
 	"github.com/compose-spec/compose-go/envfile"
+	"github.com/compose-spec/compose-go/errdefs"
 	interp "github.com/compose-spec/compose-go/interpolation"
-	"github.com/compose-spec/compose-go/schema"
 	"github.com/compose-spec/compose-go/template"
 	"github.com/compose-spec/compose-go/types"
 	units "github.com/docker/go-units"
@@ -40,6 +46,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	yaml "gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
 )
 
 // Options supported by Load
@@ -56,10 +63,166 @@ type Options struct {
 	SkipExtends bool
 	// Interpolation options
 	Interpolate *interp.Options
+	// Interpolate the values of extensions, declared by `x-` keys, like any other value. Enabled by default
+	InterpolateExtensions bool
 	// Discard 'env_file' entries after resolving to 'environment' section
 	discardEnvFiles bool
-	// Set project name
+	// Resolve variable references in the values of `env_file` files, like `.env` does. Enabled by default
+	ExpandEnvFiles bool
+	// Set project name, used unless the compose files set one. Use SetProjectName for this name to take precedence
 	Name string
+	// projectNameImperativelySet is true if Name takes precedence over the name set by the compose files
+	projectNameImperativelySet bool
+	// Maximum size in bytes of a compose file, DefaultMaxInputSize by default. Zero or negative disables the limit
+	MaxInputSize int
+	// Maximum ratio between the number of values of a compose file once its YAML aliases are expanded and the number
+	// of values it declares, DefaultMaxAliasExpansion by default. Zero or negative disables the limit
+	MaxAliasExpansion int
+	// Maximum nesting depth of the values of a compose file, DefaultMaxNestingDepth by default. Zero or negative
+	// disables the limit
+	MaxNestingDepth int
+	// Resolve the project name from COMPOSE_PROJECT_NAME and the working directory as well, see ResolveProjectName
+	DeriveProjectName bool
+	// Convert Windows paths used as bind mount sources, like `C:\foo`, to the Unix-style `/c/foo`
+	ConvertWindowsPaths bool
+	// Copy `cpus`, `mem_limit` and `mem_reservation` into `deploy.resources` during normalization, enabled by default
+	ConvertLegacyResourceFields bool
+	// Set the image of the services which build one without setting it to its default name during normalization, see
+	// types.ServiceConfig.ImageName
+	ResolveImageNames bool
+	// ImageNameSeparator separates the project and service names of default image names, defaults to
+	// types.DefaultImageNameSeparator
+	ImageNameSeparator string
+	// Fail instead of falling back to the process environment when a value is missing from ConfigDetails.Environment
+	ForbidOsLookup bool
+	// Check secrets and configs referenced by services will be resolvable when deployed
+	SecretExistenceChecker func(name string, source SecretSource) error
+	// Fail on keys which are not declared by the compose specification, rather than emitting warnings
+	Strict bool
+	// SupportedAttributes are the attributes supported by the implementation, as dotted paths like `services.*.image`
+	// where `*` matches any name. Attributes matching none are reported as warnings. All attributes are supported if
+	// nil. See EngineAttributes and SwarmAttributes
+	SupportedAttributes []string
+	// Fail on attributes not matching SupportedAttributes, rather than emitting warnings
+	FailOnUnsupportedAttributes bool
+	// Warn about logging options unknown to the json-file, local and syslog drivers
+	CheckLoggingOptions bool
+	// Fail on attributes introduced after the legacy file format version set by the top-level `version`, which is
+	// otherwise informational
+	EnforceVersionCompatibility bool
+	// Warn is called with warnings raised while loading, defaults to logging them
+	Warn func(message string)
+	// SkeletonMode loads a best-effort project for tools only interested in its metadata: values failing to be
+	// interpolated are replaced by an empty string, service attributes failing to be converted are left unset,
+	// env_file files are not read and consistency checks are skipped. The attributes which couldn't be resolved are
+	// listed by Project.LoadWarnings
+	SkeletonMode bool
+	// SkipInvalidServices removes from the project the services which fail to be validated or converted, instead of
+	// failing to load the whole project. The errors are listed by Project.LoadErrors, and references other services
+	// make to the removed ones are ignored with a warning
+	SkipInvalidServices bool
+	// Cache reuses the compose files parsed and validated by previous loads sharing it, for the ones with the same
+	// content
+	Cache *Cache
+	// loadWarnings collects the attributes which couldn't be resolved in SkeletonMode, shared with included files
+	loadWarnings *[]string
+	// skippedServices collects the services removed in SkipInvalidServices mode, shared with included files
+	skippedServices *[]types.ServiceLoadError
+	// included are the files being loaded through the `include` section, used to detect cycles
+	included []string
+	// importedServices maps the services imported through the `include` section by the file being loaded to the
+	// included file declaring them
+	importedServices map[string]string
+}
+
+// SetProjectName sets the project name. When imperativelySet, like for a name set by the user, it takes precedence
+// over the top-level `name` of the compose files, otherwise it is only used if the compose files don't set one
+func (o *Options) SetProjectName(name string, imperativelySet bool) {
+	o.Name = name
+	o.projectNameImperativelySet = imperativelySet
+}
+
+var projectNameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// composeProjectName is the environment variable setting the project name
+const composeProjectName = "COMPOSE_PROJECT_NAME"
+
+// ResolveProjectName returns the name of the project which compose files set declared as top-level `name`. By order
+// of precedence, it is the name set by SetProjectName as imperatively set, COMPOSE_PROJECT_NAME if
+// Options.DeriveProjectName is set, the declared name, Options.Name, or the name of the working directory stripped of
+// the characters a project name can't hold if Options.DeriveProjectName is set
+func ResolveProjectName(opts *Options, details types.ConfigDetails, declared string) (string, error) {
+	if opts.projectNameImperativelySet && opts.Name != "" {
+		return opts.Name, nil
+	}
+	if opts.DeriveProjectName {
+		nameFromEnv, ok := details.LookupEnv(composeProjectName)
+		if !ok && !opts.ForbidOsLookup {
+			nameFromEnv = os.Getenv(composeProjectName)
+		}
+		if nameFromEnv != "" {
+			if err := ValidateProjectName(nameFromEnv); err != nil {
+				return "", errors.Wrapf(err, "invalid %s", composeProjectName)
+			}
+			return nameFromEnv, nil
+		}
+	}
+	if declared != "" {
+		return declared, nil
+	}
+	if opts.Name != "" || !opts.DeriveProjectName || details.WorkingDir == "" {
+		return opts.Name, nil
+	}
+	workingDir, err := filepath.Abs(details.WorkingDir)
+	if err != nil {
+		return "", err
+	}
+	return invalidProjectNameChars.ReplaceAllString(strings.ToLower(filepath.Base(workingDir)), ""), nil
+}
+
+var invalidProjectNameChars = regexp.MustCompile(`[^-_a-z0-9]+`)
+
+// ValidateProjectName checks name is a valid project name, made of lowercase letters, digits, dashes and
+// underscores, starting with a letter or digit
+func ValidateProjectName(name string) error {
+	if !projectNameRegexp.MatchString(name) {
+		return errors.Wrapf(errdefs.ErrInvalid, "invalid project name %q: must consist only of lowercase alphanumeric characters, hyphens, and underscores as well as start with a letter or number", name)
+	}
+	return nil
+}
+
+// flag records an attribute which couldn't be resolved in SkeletonMode
+func (o *Options) flag(message string) {
+	if o.loadWarnings == nil {
+		o.loadWarnings = &[]string{}
+	}
+	*o.loadWarnings = append(*o.loadWarnings, message)
+}
+
+func (o *Options) warn(message string) {
+	if o.Warn != nil {
+		o.Warn(message)
+		return
+	}
+	logrus.Warn(message)
+}
+
+// substituteWarningUnset returns a substitution function behaving like template.Substitute, which also warns once
+// about each variable used without a default value while it is not set
+func (o *Options) substituteWarningUnset() func(string, template.Mapping) (string, error) {
+	warned := map[string]bool{}
+	warnUnset := func(substitution string, mapping template.Mapping) (string, bool, error) {
+		value, ok := mapping(substitution)
+		if !ok && !warned[substitution] {
+			warned[substitution] = true
+			o.warn(fmt.Sprintf("The %q variable is not set. Defaulting to a blank string.", substitution))
+		}
+		return value, true, nil
+	}
+	funcs := append(append([]template.SubstituteFunc{}, template.DefaultSubstituteFuncs...), warnUnset)
+	return func(value string, mapping template.Mapping) (string, error) {
+		return template.SubstituteWith(value, mapping, nil, funcs...)
+	}
 }
 
 // serviceRef identifies a reference to a service. It's used to detect cyclic
@@ -107,105 +270,425 @@ func WithDiscardEnvFiles(opts *Options) {
 // ParseYAML reads the bytes from a file, parses the bytes into a mapping
 // structure, and returns it.
 func ParseYAML(source []byte) (map[string]interface{}, error) {
-	var cfg interface{}
-	if err := yaml.Unmarshal(source, &cfg); err != nil {
+	return parseYAML(source, defaultYAMLLimits)
+}
+
+func parseYAML(source []byte, limits yamlLimits) (map[string]interface{}, error) {
+	documents, err := parseYAMLDocuments(source, limits)
+	if err != nil {
 		return nil, err
 	}
-	cfgMap, ok := cfg.(map[interface{}]interface{})
-	if !ok {
-		return nil, errors.Errorf("Top-level object must be a mapping")
+	if len(documents) > 1 {
+		return nil, errdefs.Mark(errors.Errorf("expected a single YAML document, got %d", len(documents)), errdefs.ErrInvalid)
 	}
-	converted, err := convertToStringKeysRecursive(cfgMap, "")
+	return documents[0], nil
+}
+
+// ParseYAMLNode parses the bytes from a file into a YAML document node, keeping the comments, ordering and styles
+// of the content for tooling editing compose files
+func ParseYAMLNode(source []byte) (*yamlv3.Node, error) {
+	var document yamlv3.Node
+	decoder := yamlv3.NewDecoder(bytes.NewReader(source))
+	if err := decoder.Decode(&document); err != nil {
+		if err == io.EOF {
+			return nil, errdefs.Mark(errors.Errorf("Top-level object must be a mapping"), errdefs.ErrInvalid)
+		}
+		return nil, markError(err)
+	}
+	var next yamlv3.Node
+	if err := decoder.Decode(&next); err != io.EOF {
+		return nil, errdefs.Mark(errors.Errorf("expected a single YAML document"), errdefs.ErrInvalid)
+	}
+	if len(document.Content) == 0 || document.Content[0].Kind != yamlv3.MappingNode {
+		return nil, errdefs.Mark(errors.Errorf("Top-level object must be a mapping"), errdefs.ErrInvalid)
+	}
+	if err := checkDuplicateKeys(&document); err != nil {
+		return nil, markError(err)
+	}
+	return &document, nil
+}
+
+// ParseYAMLDocuments parses the bytes from a file, which may contain multiple YAML documents separated by `---`,
+// into one mapping structure per document. Merge keys are expanded, and duplicated keys within a mapping are
+// reported as errors.
+func ParseYAMLDocuments(source []byte) ([]map[string]interface{}, error) {
+	return parseYAMLDocuments(source, defaultYAMLLimits)
+}
+
+func parseYAMLDocuments(source []byte, limits yamlLimits) ([]map[string]interface{}, error) {
+	files, err := parseConfigFiles("", source, limits)
 	if err != nil {
+		return nil, markError(err)
+	}
+	documents := make([]map[string]interface{}, len(files))
+	for i, file := range files {
+		documents[i] = file.Config
+	}
+	return documents, nil
+}
+
+// ParseYAMLPositions parses the bytes from a file like ParseYAMLDocuments does, returning the position of the values
+// of each document, indexed by their dotted path like `services.web.ports.0`
+func ParseYAMLPositions(source []byte) ([]map[string]types.Position, error) {
+	files, err := parseConfigFiles("", source, defaultYAMLLimits)
+	if err != nil {
+		return nil, markError(err)
+	}
+	positions := make([]map[string]types.Position, len(files))
+	for i, file := range files {
+		positions[i] = file.Positions
+	}
+	return positions, nil
+}
+
+// maxConcurrentParsing is the number of config files parsed concurrently
+var maxConcurrentParsing = runtime.GOMAXPROCS(0)
+
+// parseAll parses the config files which Config isn't set, maxConcurrentParsing at a time, and returns the documents
+// of each file in order. When several files fail to be parsed, the error of the first one is returned
+func parseAll(files []types.ConfigFile, limits yamlLimits, cache *Cache) ([][]types.ConfigFile, error) {
+	documents := make([][]types.ConfigFile, len(files))
+	errs := make([]error, len(files))
+	slots := make(chan struct{}, maxConcurrentParsing)
+	var wg sync.WaitGroup
+	for i, file := range files {
+		if file.Config != nil {
+			documents[i] = []types.ConfigFile{file}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, file types.ConfigFile) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			documents[i], errs[i] = parseConfigFileCached(file, limits, cache)
+		}(i, file)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil && files[i].Filename != "" {
+			return nil, errors.Wrapf(err, "failed to parse %s", files[i].Filename)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return documents, nil
+}
+
+// parseConfigFile parses the Content of file, or its Node if Content isn't set
+func parseConfigFile(file types.ConfigFile, limits yamlLimits) ([]types.ConfigFile, error) {
+	content := file.Content
+	if content == nil && file.Node != nil {
+		var err error
+		content, err = yamlv3.Marshal(file.Node)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return parseConfigFiles(file.Filename, content, limits)
+}
+
+// parseConfigFiles parses the YAML documents of a file into distinct ConfigFiles, with the position of their values.
+// Files exceeding limits are rejected before their aliases get expanded
+func parseConfigFiles(filename string, source []byte, limits yamlLimits) ([]types.ConfigFile, error) {
+	if err := limits.checkInputSize(source); err != nil {
 		return nil, err
 	}
-	return converted.(map[string]interface{}), nil
+	nodes := parseNodes(source)
+	for _, node := range nodes {
+		if err := limits.checkDocument(node); err != nil {
+			return nil, err
+		}
+		if err := checkDuplicateKeys(node); err != nil {
+			return nil, err
+		}
+	}
+
+	var files []types.ConfigFile
+	decoder := yaml.NewDecoder(bytes.NewReader(source))
+	for {
+		var cfg interface{}
+		err := decoder.Decode(&cfg)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if cfg == nil {
+			// empty document
+			continue
+		}
+		cfgMap, ok := cfg.(map[interface{}]interface{})
+		if !ok {
+			return nil, errors.Errorf("Top-level object must be a mapping")
+		}
+		converted, err := convertToStringKeysRecursive(cfgMap, "")
+		if err != nil {
+			return nil, err
+		}
+		file := types.ConfigFile{Filename: filename, Config: converted.(map[string]interface{})}
+		if len(nodes) > len(files) {
+			preserveStringMappings(file.Config, nodes[len(files)])
+			file.MergeTags = collectMergeTags(file.Config, nodes[len(files)])
+			file.Positions = nodePositions(nodes[len(files)])
+			file.Node = nodes[len(files)]
+		}
+		files = append(files, file)
+	}
+	if len(files) == 0 {
+		return nil, errors.Errorf("Top-level object must be a mapping")
+	}
+	return files, nil
 }
 
 // Load reads a ConfigDetails and returns a fully loaded configuration
 func Load(configDetails types.ConfigDetails, options ...func(*Options)) (*types.Project, error) {
 	if len(configDetails.ConfigFiles) < 1 {
-		return nil, errors.Errorf("No files specified")
+		return nil, errdefs.Mark(errors.Errorf("No files specified"), errdefs.ErrInvalid)
 	}
 
-	opts := &Options{
-		Interpolate: &interp.Options{
-			Substitute:      template.Substitute,
-			LookupValue:     configDetails.LookupEnv,
-			TypeCastMapping: interpolateTypeCastMapping,
-		},
+	opts := toOptions(configDetails, options)
+	project, err := load(configDetails, opts)
+	if err != nil {
+		return nil, markError(err)
 	}
+	return project, nil
+}
 
-	for _, op := range options {
-		op(opts)
+// LoadFromModel loads a project from a model built in memory with the structure of a parsed compose file, such as
+// the one ParseYAML returns, for tools generating projects to skip rendering then parsing YAML. The model goes
+// through the same interpolation, validation, normalization and consistency checks a compose file does, and may be
+// modified in the process. configDetails.ConfigFiles is ignored
+func LoadFromModel(configDetails types.ConfigDetails, model map[string]interface{}, options ...func(*Options)) (*types.Project, error) {
+	configDetails.ConfigFiles = []types.ConfigFile{{Config: model}}
+	return Load(configDetails, options...)
+}
+
+// Normalize applies to project the defaults and conversions Load applies, for a project loaded with
+// SkipNormalization or built in memory
+func Normalize(project *types.Project, options ...func(*Options)) error {
+	opts := toOptions(types.ConfigDetails{WorkingDir: project.WorkingDir}, options)
+	return markError(normalize(project, opts))
+}
+
+// CheckConsistency checks project the way Load does, for a project loaded with SkipConsistencyCheck or built in
+// memory
+func CheckConsistency(project *types.Project) error {
+	return markError(checkConsistency(project))
+}
+
+// markError marks err with the matching errdefs kind, so that callers can tell a missing file from an invalid model
+func markError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return errdefs.Mark(err, errdefs.ErrNotFound)
 	}
+	return errdefs.Mark(err, errdefs.ErrInvalid)
+}
 
-	configs := []*types.Config{}
-	for _, file := range configDetails.ConfigFiles {
-		configDict := file.Config
+func load(configDetails types.ConfigDetails, opts *Options) (*types.Project, error) {
+	parsed, err := parseAll(configDetails.ConfigFiles, opts.yamlLimits(), opts.Cache)
+	if err != nil {
+		return nil, err
+	}
 
-		if !opts.SkipInterpolation {
-			var err error
-			configDict, err = interpolateConfig(configDict, *opts.Interpolate)
+	configs := []*types.Config{}
+	sources := []types.ConfigFile{}
+	// importedBy is the index of the document importing each included service
+	importedBy := map[string]int{}
+	opts.importedServices = map[string]string{}
+	for i, file := range configDetails.ConfigFiles {
+		// documents of a multi-document file are loaded as if they were distinct files
+		for _, document := range parsed[i] {
+			skipped := len(*opts.skippedServices)
+			cfg, err := loadConfigDict(file.Filename, document.Config, configDetails, opts)
 			if err != nil {
-				return nil, err
+				return nil, locateError(err, []types.ConfigFile{document})
 			}
-		}
-
-		if !opts.SkipValidation {
-			if err := schema.Validate(configDict); err != nil {
-				return nil, err
+			for j := skipped; j < len(*opts.skippedServices); j++ {
+				(*opts.skippedServices)[j].Err = locateError((*opts.skippedServices)[j].Err, []types.ConfigFile{document})
 			}
+			for name := range opts.importedServices {
+				if _, ok := importedBy[name]; !ok {
+					importedBy[name] = len(configs)
+				}
+			}
+			configs = append(configs, cfg)
+			sources = append(sources, document)
 		}
+	}
+	if err := checkImportedServices(configs, sources, importedBy, opts.importedServices); err != nil {
+		return nil, err
+	}
 
-		configDict = groupXFieldsIntoExtensions(configDict)
+	return loadProject(configs, sources, configDetails, opts)
+}
 
-		cfg, err := loadSections(file.Filename, configDict, configDetails, opts)
+func loadConfigDict(filename string, configDict map[string]interface{}, configDetails types.ConfigDetails, opts *Options) (*types.Config, error) {
+	if !opts.SkipInterpolation {
+		var err error
+		configDict, err = interpolateConfig(configDict, opts)
 		if err != nil {
 			return nil, err
 		}
-		if opts.discardEnvFiles {
-			for i := range cfg.Services {
-				cfg.Services[i].EnvFile = nil
-			}
+	}
+
+	if err := checkUnknownKeys(configDict, opts); err != nil {
+		return nil, err
+	}
+
+	if !opts.SkipValidation {
+		if opts.SkipInvalidServices {
+			skipInvalidServiceDicts(configDict, opts)
+		}
+		if err := validateSchema(configDict, opts); err != nil {
+			return nil, err
 		}
+	}
+
+	if err := checkSupportedAttributes(configDict, opts); err != nil {
+		return nil, err
+	}
 
-		configs = append(configs, cfg)
+	if opts.EnforceVersionCompatibility {
+		if err := checkVersionCompatibility(configDict); err != nil {
+			return nil, err
+		}
+	}
+
+	configDict = groupXFieldsIntoExtensions(configDict)
+
+	cfg, err := loadSections(filename, configDict, configDetails, opts)
+	if err != nil {
+		return nil, err
 	}
+	if includes, ok := configDict["include"]; ok {
+		if err := loadIncludes(filename, includes, cfg, configDetails, opts); err != nil {
+			return nil, err
+		}
+	}
+	if opts.discardEnvFiles {
+		for i := range cfg.Services {
+			cfg.Services[i].EnvFile = nil
+		}
+	}
+	return cfg, nil
+}
 
-	model, err := merge(configs)
+// loadProject merges the loaded configs and turns the resulting model into a normalized and checked Project. sources
+// are the parsed files configs have been loaded from, if known, used to locate errors
+func loadProject(configs []*types.Config, sources []types.ConfigFile, configDetails types.ConfigDetails, opts *Options) (*types.Project, error) {
+	tags := make([]map[string]string, len(configs))
+	if len(sources) == len(configs) {
+		for i, source := range sources {
+			tags[i] = source.MergeTags
+		}
+	}
+	for _, path := range sortedKeys(tags[0]) {
+		opts.warn(fmt.Sprintf("%s: `%s` tag has no effect as there is no previous file to merge with", path, tags[0][path]))
+	}
+	for _, cfg := range configs {
+		if cfg.Version != "" {
+			opts.warn(fmt.Sprintf("%s: `version` is obsolete and ignored, it can be removed", cfg.Filename))
+		}
+	}
+	model, err := merge(configs, tags)
 	if err != nil {
 		return nil, err
 	}
 
+	name, err := ResolveProjectName(opts, configDetails, model.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	model.Services.Sort()
 	project := &types.Project{
-		Name:       opts.Name,
-		WorkingDir: configDetails.WorkingDir,
-		Services:   model.Services,
-		Networks:   model.Networks,
-		Volumes:    model.Volumes,
-		Secrets:    model.Secrets,
-		Configs:    model.Configs,
-		Extensions: model.Extensions,
+		Name:        name,
+		Version:     model.Version,
+		WorkingDir:  configDetails.WorkingDir,
+		Services:    model.Services,
+		Networks:    model.Networks,
+		Volumes:     model.Volumes,
+		Secrets:     model.Secrets,
+		Configs:     model.Configs,
+		Extensions:  model.Extensions,
+		Environment: configDetails.Environment,
+	}
+	if opts.loadWarnings != nil && len(*opts.loadWarnings) > 0 {
+		project.LoadWarnings = append([]string{}, *opts.loadWarnings...)
+		sort.Strings(project.LoadWarnings)
+	}
+
+	if opts.SkipInvalidServices {
+		removeSkippedServices(project, opts)
+	}
+
+	warnExternalResources(project, opts)
+	warnReservedLabels(project, opts)
+	warnIgnoredCapabilities(project, opts)
+	warnLegacyLinks(project, opts)
+	warnVolumesFrom(project, opts)
+	warnUnknownSecurityOptions(project, opts)
+	if opts.CheckLoggingOptions {
+		warnUnknownLoggingOptions(project, opts)
 	}
 
 	if !opts.SkipNormalization {
-		err = normalize(project)
+		err = normalize(project, opts)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	if !opts.SkipConsistencyCheck {
-		err = checkConsistency(project)
+	if !opts.SkipConsistencyCheck && !opts.SkeletonMode {
+		if opts.SkipInvalidServices {
+			err = checkConsistencySkippingInvalid(project, sources, opts)
+		} else {
+			err = checkConsistency(project)
+		}
 		if err != nil {
-			return nil, err
+			return nil, locateError(err, sources)
+		}
+		if opts.SecretExistenceChecker != nil {
+			err = checkSecretsExistence(project, opts.SecretExistenceChecker)
+			if err != nil {
+				return nil, locateError(err, sources)
+			}
 		}
 	}
 
+	project.LoadErrors = opts.loadErrors()
 	return project, nil
 }
 
+func toOptions(configDetails types.ConfigDetails, options []func(*Options)) *Options {
+	opts := &Options{
+		ConvertLegacyResourceFields: true,
+		InterpolateExtensions:       true,
+		ExpandEnvFiles:              true,
+		MaxInputSize:                DefaultMaxInputSize,
+		MaxAliasExpansion:           DefaultMaxAliasExpansion,
+		MaxNestingDepth:             DefaultMaxNestingDepth,
+		loadWarnings:                &[]string{},
+		skippedServices:             &[]types.ServiceLoadError{},
+	}
+	opts.Interpolate = &interp.Options{
+		Substitute:      opts.substituteWarningUnset(),
+		LookupValue:     configDetails.LookupEnv,
+		TypeCastMapping: interpolateTypeCastMapping,
+	}
+
+	for _, op := range options {
+		op(opts)
+	}
+	return opts
+}
+
 func groupXFieldsIntoExtensions(dict map[string]interface{}) map[string]interface{} {
 	extras := map[string]interface{}{}
 	for key, value := range dict {
@@ -229,24 +712,34 @@ func loadSections(filename string, config map[string]interface{}, configDetails
 		Filename: filename,
 	}
 
+	if name, ok := config["name"].(string); ok {
+		if err := ValidateProjectName(name); err != nil {
+			return nil, errorAt("name", err)
+		}
+		cfg.Name = name
+	}
+	if version, ok := config["version"].(string); ok {
+		cfg.Version = version
+	}
+
 	cfg.Services, err = LoadServices(filename, getSection(config, "services"), configDetails.WorkingDir, configDetails.LookupEnv, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	cfg.Networks, err = LoadNetworks(getSection(config, "networks"), configDetails.Version)
+	cfg.Networks, err = loadNetworks(getSection(config, "networks"), opts)
 	if err != nil {
 		return nil, err
 	}
-	cfg.Volumes, err = LoadVolumes(getSection(config, "volumes"))
+	cfg.Volumes, err = loadVolumes(getSection(config, "volumes"), opts)
 	if err != nil {
 		return nil, err
 	}
-	cfg.Secrets, err = LoadSecrets(getSection(config, "secrets"), configDetails)
+	cfg.Secrets, err = loadSecrets(getSection(config, "secrets"), configDetails, opts)
 	if err != nil {
 		return nil, err
 	}
-	cfg.Configs, err = LoadConfigObjs(getSection(config, "configs"), configDetails)
+	cfg.Configs, err = loadConfigObjs(getSection(config, "configs"), configDetails, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -309,6 +802,7 @@ type Transformer struct {
 func createTransformHook(additionalTransformers ...Transformer) mapstructure.DecodeHookFuncType {
 	transforms := map[reflect.Type]func(interface{}) (interface{}, error){
 		reflect.TypeOf(types.External{}):                         transformExternal,
+		reflect.TypeOf(types.IncludeConfig{}):                    transformIncludeConfig,
 		reflect.TypeOf(types.HealthCheckTest{}):                  transformHealthCheckTest,
 		reflect.TypeOf(types.ShellCommand{}):                     transformShellCommand,
 		reflect.TypeOf(types.StringList{}):                       transformStringList,
@@ -324,13 +818,20 @@ func createTransformHook(additionalTransformers ...Transformer) mapstructure.Dec
 		reflect.TypeOf(types.MappingWithEquals{}):                transformMappingOrListFunc("=", true),
 		reflect.TypeOf(types.Labels{}):                           transformMappingOrListFunc("=", false),
 		reflect.TypeOf(types.MappingWithColon{}):                 transformMappingOrListFunc(":", false),
-		reflect.TypeOf(types.HostsList{}):                        transformListOrMappingFunc(":", false),
+		reflect.TypeOf(types.HostsList{}):                        transformHostsList,
 		reflect.TypeOf(types.ServiceVolumeConfig{}):              transformServiceVolumeConfig,
 		reflect.TypeOf(types.BuildConfig{}):                      transformBuildConfig,
+		reflect.TypeOf(types.SSHConfig{}):                        transformSSHConfig,
 		reflect.TypeOf(types.Duration(0)):                        transformStringToDuration,
+		reflect.TypeOf(types.Microseconds(0)):                    transformMicroseconds,
 		reflect.TypeOf(types.DependsOnConfig{}):                  transformDependsOnConfig,
 		reflect.TypeOf(types.ExtendsConfig{}):                    transformExtendsConfig,
 		reflect.TypeOf(types.DeviceRequest{}):                    transformServiceDeviceRequest,
+		reflect.TypeOf(types.ServiceDeviceConfig{}):              transformServiceDevice,
+		reflect.TypeOf(types.ServiceRestart{}):                   transformServiceRestart,
+		reflect.TypeOf(types.PullPolicy("")):                     transformPullPolicy,
+		reflect.TypeOf(types.ServiceLink{}):                      transformServiceLink,
+		reflect.TypeOf(types.VolumesFromSource{}):                transformVolumesFrom,
 	}
 
 	for _, transformer := range additionalTransformers {
@@ -369,6 +870,20 @@ func convertToStringKeysRecursive(value interface{}, keyPrefix string) (interfac
 		}
 		return dict, nil
 	}
+	if mapping, ok := value.(map[string]interface{}); ok {
+		for key, entry := range mapping {
+			newKeyPrefix := key
+			if keyPrefix != "" {
+				newKeyPrefix = fmt.Sprintf("%s.%s", keyPrefix, key)
+			}
+			convertedEntry, err := convertToStringKeysRecursive(entry, newKeyPrefix)
+			if err != nil {
+				return nil, err
+			}
+			mapping[key] = convertedEntry
+		}
+		return mapping, nil
+	}
 	if list, ok := value.([]interface{}); ok {
 		var convertedList []interface{}
 		for index, entry := range list {
@@ -399,8 +914,12 @@ func formatInvalidKeyError(keyPrefix string, key interface{}) error {
 func LoadServices(filename string, servicesDict map[string]interface{}, workingDir string, lookupEnv template.Mapping, opts *Options) ([]types.ServiceConfig, error) {
 	var services []types.ServiceConfig
 
-	for name := range servicesDict {
+	for _, name := range sortedKeys(servicesDict) {
 		serviceConfig, err := loadServiceWithExtends(filename, name, servicesDict, workingDir, lookupEnv, opts, &cycleTracker{})
+		if err != nil && opts.SkipInvalidServices {
+			opts.skipService(name, err)
+			continue
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -416,7 +935,7 @@ func loadServiceWithExtends(filename, name string, servicesDict map[string]inter
 		return nil, err
 	}
 
-	serviceConfig, err := LoadService(name, servicesDict[name].(map[string]interface{}), workingDir, lookupEnv)
+	serviceConfig, err := loadService(name, servicesDict[name].(map[string]interface{}), workingDir, lookupEnv, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -440,13 +959,13 @@ func loadServiceWithExtends(filename, name string, servicesDict map[string]inter
 			if err != nil {
 				return nil, err
 			}
-			baseFile, err := ParseYAML(bytes)
+			baseFile, err := parseYAML(bytes, opts.yamlLimits())
 			if err != nil {
 				return nil, err
 			}
 
 			if !opts.SkipInterpolation {
-				baseFile, err = interpolateConfig(baseFile, *opts.Interpolate)
+				baseFile, err = interpolateConfig(baseFile, opts)
 				if err != nil {
 					return nil, err
 				}
@@ -483,6 +1002,7 @@ func loadServiceWithExtends(filename, name string, servicesDict map[string]inter
 		if err := mergo.Merge(baseService, serviceConfig, mergo.WithAppendSlice, mergo.WithOverride, mergo.WithTransformers(serviceSpecials)); err != nil {
 			return nil, errors.Wrapf(err, "cannot merge service %s", name)
 		}
+		mergeCapabilities(baseService)
 		serviceConfig = baseService
 	}
 
@@ -492,30 +1012,78 @@ func loadServiceWithExtends(filename, name string, servicesDict map[string]inter
 // LoadService produces a single ServiceConfig from a compose file Dict
 // the serviceDict is not validated if directly used. Use Load() to enable validation
 func LoadService(name string, serviceDict map[string]interface{}, workingDir string, lookupEnv template.Mapping) (*types.ServiceConfig, error) {
-	serviceConfig := &types.ServiceConfig{}
-	if err := Transform(serviceDict, serviceConfig); err != nil {
+	return loadService(name, serviceDict, workingDir, lookupEnv, &Options{ExpandEnvFiles: true})
+}
+
+func loadService(name string, serviceDict map[string]interface{}, workingDir string, lookupEnv template.Mapping, opts *Options) (*types.ServiceConfig, error) {
+	serviceConfig, err := transformService(name, serviceDict, opts)
+	for err != nil && opts.SkeletonMode {
+		// values left empty by interpolation may not be converted to the attribute type, which is then left unset
+		attribute := failingAttribute(name, err)
+		if _, ok := serviceDict[attribute]; !ok {
+			break
+		}
+		opts.flag(err.Error())
+		serviceDict = withoutKey(serviceDict, attribute)
+		serviceConfig, err = transformService(name, serviceDict, opts)
+	}
+	if err != nil {
 		return nil, err
 	}
 	serviceConfig.Name = name
+	serviceConfig.CapAdd = types.NormalizeCapabilities(serviceConfig.CapAdd)
+	serviceConfig.CapDrop = types.NormalizeCapabilities(serviceConfig.CapDrop)
 
-	if err := resolveEnvironment(serviceConfig, workingDir, lookupEnv); err != nil {
+	if err := resolveEnvironment(serviceConfig, workingDir, lookupEnv, opts); err != nil {
 		return nil, err
 	}
 
-	if err := resolveVolumePaths(serviceConfig.Volumes, workingDir, lookupEnv); err != nil {
+	if err := resolveVolumePaths(serviceConfig.Volumes, workingDir, lookupEnv, opts); err != nil {
 		return nil, err
 	}
 
+	resolveDevelopPaths(serviceConfig.Develop, workingDir)
+
 	return serviceConfig, nil
 }
 
-func resolveEnvironment(serviceConfig *types.ServiceConfig, workingDir string, lookupEnv template.Mapping) error {
+// failingAttribute returns the attribute of service name which err has been raised converting
+func failingAttribute(name string, err error) string {
+	path := strings.TrimPrefix(errorPath(err), "services."+name+".")
+	return strings.SplitN(path, ".", 2)[0]
+}
+
+// withoutKey returns a shallow copy of dict without key
+func withoutKey(dict map[string]interface{}, key string) map[string]interface{} {
+	out := make(map[string]interface{}, len(dict))
+	for k, v := range dict {
+		if k != key {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// resolveEnvironment merges the variables of the env files into the environment of the service. The compose file has
+// already been interpolated, and env file values are only expanded once, while being read when
+// Options.ExpandEnvFiles is set: the merged environment is never substituted again, so a `$` they contain is literal
+func resolveEnvironment(serviceConfig *types.ServiceConfig, workingDir string, lookupEnv template.Mapping, opts *Options) error {
 	environment := types.MappingWithEquals{}
 
 	if len(serviceConfig.EnvFile) > 0 {
 		for _, file := range serviceConfig.EnvFile {
+			if opts.SkeletonMode {
+				opts.flag(fmt.Sprintf("services.%s.env_file: %s not read", serviceConfig.Name, file))
+				continue
+			}
 			filePath := absPath(workingDir, file)
-			fileVars, err := envfile.Parse(filePath)
+			var fileVars types.MappingWithEquals
+			var err error
+			if opts.ExpandEnvFiles {
+				fileVars, err = envfile.ParseWithLookup(filePath, lookupEnv)
+			} else {
+				fileVars, err = envfile.Parse(filePath)
+			}
 			if err != nil {
 				return err
 			}
@@ -523,12 +1091,38 @@ func resolveEnvironment(serviceConfig *types.ServiceConfig, workingDir string, l
 		}
 	}
 
-	environment.OverrideBy(serviceConfig.Environment.Resolve(lookupEnv))
+	// variables declared without a value are resolved from the environment, then from the env files
+	environment.OverrideBy(serviceConfig.Environment.Resolve(func(name string) (string, bool) {
+		if value, ok := lookupEnv(name); ok {
+			return value, true
+		}
+		if value := environment[name]; value != nil {
+			return *value, true
+		}
+		return "", false
+	}))
 	serviceConfig.Environment = environment
+
+	if serviceConfig.Build != nil {
+		// build args declared without a value are left unset for the builder when missing from the environment
+		serviceConfig.Build.Args.Resolve(lookupEnv)
+	}
 	return nil
 }
 
-func resolveVolumePaths(volumes []types.ServiceVolumeConfig, workingDir string, lookupEnv template.Mapping) error {
+// resolveDevelopPaths makes watched paths relative to the compose file absolute
+func resolveDevelopPaths(develop *types.DevelopConfig, workingDir string) {
+	if develop == nil {
+		return
+	}
+	for i, trigger := range develop.Watch {
+		if trigger.Path != "" {
+			develop.Watch[i].Path = absPath(workingDir, trigger.Path)
+		}
+	}
+}
+
+func resolveVolumePaths(volumes []types.ServiceVolumeConfig, workingDir string, lookupEnv template.Mapping, opts *Options) error {
 	for i, volume := range volumes {
 		if volume.Type != "bind" {
 			continue
@@ -538,7 +1132,10 @@ func resolveVolumePaths(volumes []types.ServiceVolumeConfig, workingDir string,
 			return errors.New(`invalid mount config for type "bind": field Source must not be empty`)
 		}
 
-		filePath := expandUser(volume.Source, lookupEnv)
+		filePath, err := expandUser(volume.Source, lookupEnv, opts)
+		if err != nil {
+			return err
+		}
 		// Check if source is an absolute path (either Unix or Windows), to
 		// handle a Windows client with a Unix daemon or vice-versa.
 		//
@@ -548,23 +1145,41 @@ func resolveVolumePaths(volumes []types.ServiceVolumeConfig, workingDir string,
 		if !path.IsAbs(filePath) && !isAbs(filePath) {
 			filePath = absPath(workingDir, filePath)
 		}
+		if opts.ConvertWindowsPaths {
+			filePath = convertWindowsPath(filePath)
+		}
 		volume.Source = filePath
 		volumes[i] = volume
 	}
 	return nil
 }
 
+// convertWindowsPath converts a Windows absolute path with a drive letter, like `C:\foo\bar`, to the `/c/foo/bar`
+// form expected by a Docker engine running in a Linux VM. Other paths are returned unchanged
+func convertWindowsPath(p string) string {
+	if !isAbs(p) || volumeNameLen(p) != 2 {
+		return p
+	}
+	return "/" + strings.ToLower(p[:1]) + strings.ReplaceAll(p[2:], "\\", "/")
+}
+
 // TODO: make this more robust
-func expandUser(path string, lookupEnv template.Mapping) string {
+func expandUser(path string, lookupEnv template.Mapping, opts *Options) (string, error) {
 	if strings.HasPrefix(path, "~") {
+		if home, ok := lookupEnv("HOME"); ok && home != "" {
+			return filepath.Join(home, path[1:]), nil
+		}
+		if opts.ForbidOsLookup {
+			return "", errors.Wrapf(errdefs.ErrInvalid, "cannot expand '~' in %s, because the environment lacks HOME", path)
+		}
 		home, err := os.UserHomeDir()
 		if err != nil {
-			logrus.Warn("cannot expand '~', because the environment lacks HOME")
-			return path
+			opts.warn("cannot expand '~', because the environment lacks HOME")
+			return path, nil
 		}
-		return filepath.Join(home, path[1:])
+		return filepath.Join(home, path[1:]), nil
 	}
-	return path
+	return path, nil
 }
 
 func transformUlimits(data interface{}) (interface{}, error) {
@@ -573,11 +1188,16 @@ func transformUlimits(data interface{}) (interface{}, error) {
 		return types.UlimitsConfig{Single: value}, nil
 	case map[string]interface{}:
 		ulimit := types.UlimitsConfig{}
-		if v, ok := value["soft"]; ok {
-			ulimit.Soft = v.(int)
-		}
-		if v, ok := value["hard"]; ok {
-			ulimit.Hard = v.(int)
+		for key, target := range map[string]*int{"soft": &ulimit.Soft, "hard": &ulimit.Hard} {
+			v, ok := value[key]
+			if !ok {
+				continue
+			}
+			limit, ok := v.(int)
+			if !ok {
+				return data, errors.Errorf("invalid type %T for ulimits %s", v, key)
+			}
+			*target = limit
 		}
 		return ulimit, nil
 	default:
@@ -588,6 +1208,10 @@ func transformUlimits(data interface{}) (interface{}, error) {
 // LoadNetworks produces a NetworkConfig map from a compose file Dict
 // the source Dict is not validated if directly used. Use Load() to enable validation
 func LoadNetworks(source map[string]interface{}, version string) (map[string]types.NetworkConfig, error) {
+	return loadNetworks(source, &Options{})
+}
+
+func loadNetworks(source map[string]interface{}, opts *Options) (map[string]types.NetworkConfig, error) {
 	networks := make(map[string]types.NetworkConfig)
 	err := Transform(source, &networks)
 	if err != nil {
@@ -602,7 +1226,7 @@ func LoadNetworks(source map[string]interface{}, version string) (map[string]typ
 			if network.Name != "" {
 				return nil, errors.Errorf("network %s: network.external.name and network.name conflict; only use network.name", name)
 			}
-			logrus.Warnf("network %s: network.external.name is deprecated in favor of network.name", name)
+			opts.warn(fmt.Sprintf("network %s: network.external.name is deprecated in favor of network.name", name))
 			network.Name = network.External.Name
 			network.External.Name = ""
 		case network.Name == "":
@@ -622,6 +1246,10 @@ func externalVolumeError(volume, key string) error {
 // LoadVolumes produces a VolumeConfig map from a compose file Dict
 // the source Dict is not validated if directly used. Use Load() to enable validation
 func LoadVolumes(source map[string]interface{}) (map[string]types.VolumeConfig, error) {
+	return loadVolumes(source, &Options{})
+}
+
+func loadVolumes(source map[string]interface{}, opts *Options) (map[string]types.VolumeConfig, error) {
 	volumes := make(map[string]types.VolumeConfig)
 	if err := Transform(source, &volumes); err != nil {
 		return volumes, err
@@ -642,7 +1270,7 @@ func LoadVolumes(source map[string]interface{}) (map[string]types.VolumeConfig,
 			if volume.Name != "" {
 				return nil, errors.Errorf("volume %s: volume.external.name and volume.name conflict; only use volume.name", name)
 			}
-			logrus.Warnf("volume %s: volume.external.name is deprecated in favor of volume.name", name)
+			opts.warn(fmt.Sprintf("volume %s: volume.external.name is deprecated in favor of volume.name", name))
 			volume.Name = volume.External.Name
 			volume.External.Name = ""
 		case volume.Name == "":
@@ -656,12 +1284,16 @@ func LoadVolumes(source map[string]interface{}) (map[string]types.VolumeConfig,
 // LoadSecrets produces a SecretConfig map from a compose file Dict
 // the source Dict is not validated if directly used. Use Load() to enable validation
 func LoadSecrets(source map[string]interface{}, details types.ConfigDetails) (map[string]types.SecretConfig, error) {
+	return loadSecrets(source, details, &Options{})
+}
+
+func loadSecrets(source map[string]interface{}, details types.ConfigDetails, opts *Options) (map[string]types.SecretConfig, error) {
 	secrets := make(map[string]types.SecretConfig)
 	if err := Transform(source, &secrets); err != nil {
 		return secrets, err
 	}
 	for name, secret := range secrets {
-		obj, err := loadFileObjectConfig(name, "secret", types.FileObjectConfig(secret), details)
+		obj, err := loadFileObjectConfig(name, "secret", types.FileObjectConfig(secret), details, opts)
 		if err != nil {
 			return nil, err
 		}
@@ -674,12 +1306,16 @@ func LoadSecrets(source map[string]interface{}, details types.ConfigDetails) (ma
 // LoadConfigObjs produces a ConfigObjConfig map from a compose file Dict
 // the source Dict is not validated if directly used. Use Load() to enable validation
 func LoadConfigObjs(source map[string]interface{}, details types.ConfigDetails) (map[string]types.ConfigObjConfig, error) {
+	return loadConfigObjs(source, details, &Options{})
+}
+
+func loadConfigObjs(source map[string]interface{}, details types.ConfigDetails, opts *Options) (map[string]types.ConfigObjConfig, error) {
 	configs := make(map[string]types.ConfigObjConfig)
 	if err := Transform(source, &configs); err != nil {
 		return configs, err
 	}
 	for name, config := range configs {
-		obj, err := loadFileObjectConfig(name, "config", types.FileObjectConfig(config), details)
+		obj, err := loadFileObjectConfig(name, "config", types.FileObjectConfig(config), details, opts)
 		if err != nil {
 			return nil, err
 		}
@@ -689,7 +1325,24 @@ func LoadConfigObjs(source map[string]interface{}, details types.ConfigDetails)
 	return configs, nil
 }
 
-func loadFileObjectConfig(name string, objType string, obj types.FileObjectConfig, details types.ConfigDetails) (types.FileObjectConfig, error) {
+func loadFileObjectConfig(name string, objType string, obj types.FileObjectConfig, details types.ConfigDetails, opts *Options) (types.FileObjectConfig, error) {
+	var sources []string
+	for _, source := range []struct {
+		attribute string
+		set       bool
+	}{
+		{"file", obj.File != ""},
+		{"environment", obj.Environment != ""},
+		{"external", obj.External.External},
+	} {
+		if source.set {
+			sources = append(sources, source.attribute)
+		}
+	}
+	if len(sources) > 1 {
+		return obj, errorAt(objType+"s."+name, errors.Wrapf(errdefs.ErrInvalid, "%s %q: %s are mutually exclusive, only set one of them", objType, name, strings.Join(sources, " and ")))
+	}
+
 	// if "external: true"
 	switch {
 	case obj.External.External:
@@ -698,7 +1351,7 @@ func loadFileObjectConfig(name string, objType string, obj types.FileObjectConfi
 			if obj.Name != "" {
 				return obj, errors.Errorf("%[1]s %[2]s: %[1]s.external.name and %[1]s.name conflict; only use %[1]s.name", objType, name)
 			}
-			logrus.Warnf("%[1]s %[2]s: %[1]s.external.name is deprecated in favor of %[1]s.name", objType, name)
+			opts.warn(fmt.Sprintf("%[1]s %[2]s: %[1]s.external.name is deprecated in favor of %[1]s.name", objType, name))
 			obj.Name = obj.External.Name
 			obj.External.Name = ""
 		} else {
@@ -711,6 +1364,7 @@ func loadFileObjectConfig(name string, objType string, obj types.FileObjectConfi
 		if obj.File != "" {
 			return obj, errors.Errorf("%[1]s %[2]s: %[1]s.driver and %[1]s.file conflict; only use %[1]s.driver", objType, name)
 		}
+	case obj.Environment != "":
 	default:
 		obj.File = absPath(details.WorkingDir, obj.File)
 	}
@@ -773,6 +1427,10 @@ var transformServicePort TransformerFunc = func(data interface{}) (interface{},
 					ports = append(ports, v)
 				}
 			case map[string]interface{}:
+				if published, ok := value["published"]; ok {
+					// published can be set as a number, or as a string for a range
+					value["published"] = fmt.Sprint(published)
+				}
 				ports = append(ports, groupXFieldsIntoExtensions(value))
 			default:
 				return data, errors.Errorf("invalid type %T for port", value)
@@ -808,6 +1466,65 @@ var transformServiceDeviceRequest TransformerFunc = func(data interface{}) (inte
 	}
 }
 
+var transformServiceDevice TransformerFunc = func(data interface{}) (interface{}, error) {
+	switch value := data.(type) {
+	case string:
+		return types.ParseDevice(value)
+	case map[string]interface{}:
+		if _, ok := value["target"]; !ok {
+			value["target"] = value["source"]
+		}
+		if _, ok := value["permissions"]; !ok {
+			value["permissions"] = types.DefaultDevicePermissions
+		}
+		return groupXFieldsIntoExtensions(value), nil
+	default:
+		return data, errors.Errorf("invalid type %T for device", value)
+	}
+}
+
+var transformServiceRestart TransformerFunc = func(data interface{}) (interface{}, error) {
+	switch value := data.(type) {
+	case string:
+		return types.ParseRestart(value)
+	case bool:
+		// YAML 1.1 resolves an unquoted `no` to false
+		if !value {
+			return types.ParseRestart(string(types.RestartNo))
+		}
+		return data, errors.Errorf("invalid restart policy %v", value)
+	default:
+		return data, errors.Errorf("invalid type %T for restart", value)
+	}
+}
+
+var transformPullPolicy TransformerFunc = func(data interface{}) (interface{}, error) {
+	switch value := data.(type) {
+	case string:
+		return types.ParsePullPolicy(value)
+	default:
+		return data, errors.Errorf("invalid type %T for pull_policy", value)
+	}
+}
+
+var transformServiceLink TransformerFunc = func(data interface{}) (interface{}, error) {
+	switch value := data.(type) {
+	case string:
+		return types.ParseServiceLink(value)
+	default:
+		return data, errors.Errorf("invalid type %T for link", value)
+	}
+}
+
+var transformVolumesFrom TransformerFunc = func(data interface{}) (interface{}, error) {
+	switch value := data.(type) {
+	case string:
+		return types.ParseVolumesFrom(value)
+	default:
+		return data, errors.Errorf("invalid type %T for volumes_from", value)
+	}
+}
+
 var transformStringSourceMap TransformerFunc = func(data interface{}) (interface{}, error) {
 	switch value := data.(type) {
 	case string:
@@ -830,6 +1547,56 @@ var transformBuildConfig TransformerFunc = func(data interface{}) (interface{},
 	}
 }
 
+var transformSSHConfig TransformerFunc = func(data interface{}) (interface{}, error) {
+	var keys []interface{}
+	switch value := data.(type) {
+	case []interface{}:
+		for _, entry := range value {
+			str, ok := entry.(string)
+			if !ok {
+				return data, errors.Errorf("invalid type %T for build ssh element. Expected string.", entry)
+			}
+			key, err := parseSSHKey(str)
+			if err != nil {
+				return data, err
+			}
+			keys = append(keys, key)
+		}
+	case map[string]interface{}:
+		ids := make([]string, 0, len(value))
+		for id := range value {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			str := id
+			if path := value[id]; path != nil && path != "" {
+				str = fmt.Sprintf("%s=%v", id, path)
+			}
+			key, err := parseSSHKey(str)
+			if err != nil {
+				return data, err
+			}
+			keys = append(keys, key)
+		}
+	default:
+		return data, errors.Errorf("invalid type %T for build ssh", value)
+	}
+	return keys, nil
+}
+
+// parseSSHKey parses a build ssh entry, which is either `default` or `id=path`
+func parseSSHKey(value string) (map[string]interface{}, error) {
+	parts := strings.SplitN(value, "=", 2)
+	switch {
+	case len(parts) == 1 && parts[0] == "default":
+		return map[string]interface{}{"id": parts[0]}, nil
+	case len(parts) == 2 && parts[0] != "" && parts[1] != "":
+		return map[string]interface{}{"id": parts[0], "path": parts[1]}, nil
+	}
+	return nil, errors.Wrapf(errdefs.ErrInvalid, "invalid build ssh entry %q, expected `default` or `id=path`", value)
+}
+
 var transformDependsOnConfig TransformerFunc = func(data interface{}) (interface{}, error) {
 	switch value := data.(type) {
 	case []interface{}:
@@ -843,6 +1610,13 @@ var transformDependsOnConfig TransformerFunc = func(data interface{}) (interface
 		}
 		return transformed, nil
 	case map[string]interface{}:
+		for _, dependency := range value {
+			if d, ok := dependency.(map[string]interface{}); ok {
+				if _, ok := d["condition"]; !ok {
+					d["condition"] = types.ServiceConditionStarted
+				}
+			}
+		}
 		return groupXFieldsIntoExtensions(data.(map[string]interface{})), nil
 	default:
 		return data, errors.Errorf("invalid type %T for service depends_on", value)
@@ -885,6 +1659,11 @@ var transformStringOrNumberList TransformerFunc = func(value interface{}) (inter
 	list := value.([]interface{})
 	result := make([]string, len(list))
 	for i, item := range list {
+		if number, ok := item.(float64); ok {
+			// numbers decoded from JSON are floats, which fmt would render like `3e+06`
+			result[i] = strconv.FormatFloat(number, 'f', -1, 64)
+			continue
+		}
 		result[i] = fmt.Sprint(item)
 	}
 	return result, nil
@@ -901,26 +1680,36 @@ var transformStringList TransformerFunc = func(data interface{}) (interface{}, e
 	}
 }
 
-func transformMappingOrListFunc(sep string, allowNil bool) TransformerFunc {
-	return func(data interface{}) (interface{}, error) {
-		return transformMappingOrList(data, sep, allowNil), nil
+var transformHostsList TransformerFunc = func(data interface{}) (interface{}, error) {
+	var hosts []string
+	switch value := data.(type) {
+	case map[string]interface{}:
+		for _, host := range sortedKeys(value) {
+			ips, ok := value[host].([]interface{})
+			if !ok {
+				ips = []interface{}{value[host]}
+			}
+			for _, ip := range ips {
+				if ip == nil {
+					return nil, errors.Wrapf(errdefs.ErrInvalid, "extra host %q has no IP address", host)
+				}
+				hosts = append(hosts, fmt.Sprintf("%s:%v", host, ip))
+			}
+		}
+	case []interface{}:
+		for _, host := range value {
+			hosts = append(hosts, fmt.Sprint(host))
+		}
+	default:
+		return data, errors.Errorf("invalid type %T for extra hosts", value)
 	}
+	return types.NewHostsList(hosts)
 }
 
-func transformListOrMappingFunc(sep string, allowNil bool) TransformerFunc {
+func transformMappingOrListFunc(sep string, allowNil bool) TransformerFunc {
 	return func(data interface{}) (interface{}, error) {
-		return transformListOrMapping(data, sep, allowNil), nil
-	}
-}
-
-func transformListOrMapping(listOrMapping interface{}, sep string, allowNil bool) interface{} {
-	switch value := listOrMapping.(type) {
-	case map[string]interface{}:
-		return toStringList(value, sep, allowNil)
-	case []interface{}:
-		return listOrMapping
+		return transformMappingOrList(data, sep, allowNil), nil
 	}
-	panic(errors.Errorf("expected a map or a list, got %T: %#v", listOrMapping, listOrMapping))
 }
 
 func transformMappingOrList(mappingOrList interface{}, sep string, allowNil bool) interface{} {
@@ -948,7 +1737,15 @@ func transformMappingOrList(mappingOrList interface{}, sep string, allowNil bool
 
 var transformShellCommand TransformerFunc = func(value interface{}) (interface{}, error) {
 	if str, ok := value.(string); ok {
-		return shellwords.Parse(str)
+		args, err := shellwords.Parse(str)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid command %q", str)
+		}
+		if args == nil {
+			// an empty command is explicitly set, unlike a missing one
+			args = []string{}
+		}
+		return args, nil
 	}
 	return value, nil
 }
@@ -956,7 +1753,7 @@ var transformShellCommand TransformerFunc = func(value interface{}) (interface{}
 var transformHealthCheckTest TransformerFunc = func(data interface{}) (interface{}, error) {
 	switch value := data.(type) {
 	case string:
-		return append([]string{"CMD-SHELL"}, value), nil
+		return types.NewShellTest(value), nil
 	case []interface{}:
 		return value, nil
 	default:
@@ -987,6 +1784,26 @@ var transformStringToDuration TransformerFunc = func(value interface{}) (interfa
 	}
 }
 
+var transformMicroseconds TransformerFunc = func(value interface{}) (interface{}, error) {
+	switch value := value.(type) {
+	case int:
+		return int64(value), nil
+	case float64:
+		return int64(value), nil
+	case string:
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return i, nil
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return value, errors.Wrapf(errdefs.ErrInvalid, "invalid duration %q", value)
+		}
+		return int64(d / time.Microsecond), nil
+	default:
+		return value, errors.Errorf("invalid type %T for duration", value)
+	}
+}
+
 func toMapStringString(value map[string]interface{}, allowNil bool) map[string]interface{} {
 	output := make(map[string]interface{})
 	for key, value := range value {
@@ -1005,15 +1822,3 @@ func toString(value interface{}, allowNil bool) interface{} {
 		return ""
 	}
 }
-
-func toStringList(value map[string]interface{}, separator string, allowNil bool) []string {
-	output := []string{}
-	for key, value := range value {
-		if value == nil && !allowNil {
-			continue
-		}
-		output = append(output, fmt.Sprintf("%s%s%s", key, separator, value))
-	}
-	sort.Strings(output)
-	return output
-}
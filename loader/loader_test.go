@@ -18,16 +18,21 @@ package loader
 
 import (
 	"bytes"
+	"encoding/json"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/compose-spec/compose-go/errdefs"
 	"github.com/compose-spec/compose-go/types"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
 	"gotest.tools/v3/assert"
 	is "gotest.tools/v3/assert/cmp"
 )
@@ -57,7 +62,7 @@ func loadYAMLWithEnv(yaml string, env map[string]string) (*types.Project, error)
 		return nil, err
 	}
 
-	return Load(buildConfigDetails(dict, env), func(options *Options) {
+	return loadCached(buildConfigDetails(dict, env), func(options *Options) {
 		options.SkipConsistencyCheck = true
 		options.SkipNormalization = true
 	})
@@ -136,60 +141,60 @@ var samplePortsConfig = []types.ServicePortConfig{
 	{
 		Mode:      "ingress",
 		Target:    8080,
-		Published: 80,
+		Published: "80",
 		Protocol:  "tcp",
 	},
 	{
 		Mode:      "ingress",
 		Target:    8081,
-		Published: 81,
+		Published: "81",
 		Protocol:  "tcp",
 	},
 	{
 		Mode:      "ingress",
 		Target:    8082,
-		Published: 82,
+		Published: "82",
 		Protocol:  "tcp",
 	},
 	{
 		Mode:      "ingress",
 		Target:    8090,
-		Published: 90,
+		Published: "90",
 		Protocol:  "udp",
 	},
 	{
 		Mode:      "ingress",
 		Target:    8091,
-		Published: 91,
+		Published: "91",
 		Protocol:  "udp",
 	},
 	{
 		Mode:      "ingress",
 		Target:    8092,
-		Published: 92,
+		Published: "92",
 		Protocol:  "udp",
 	},
 	{
 		Mode:      "ingress",
 		Target:    8500,
-		Published: 85,
+		Published: "85",
 		Protocol:  "tcp",
 	},
 	{
 		Mode:      "ingress",
 		Target:    8600,
-		Published: 0,
+		Published: "",
 		Protocol:  "tcp",
 	},
 	{
 		Target:    53,
-		Published: 10053,
+		Published: "10053",
 		Protocol:  "udp",
 	},
 	{
 		Mode:      "host",
 		Target:    22,
-		Published: 10022,
+		Published: "10022",
 	},
 }
 
@@ -251,7 +256,7 @@ func TestParseYAML(t *testing.T) {
 }
 
 func TestLoad(t *testing.T) {
-	actual, err := Load(buildConfigDetails(sampleDict, nil), func(options *Options) {
+	actual, err := loadCached(buildConfigDetails(sampleDict, nil), func(options *Options) {
 		options.SkipNormalization = true
 		options.SkipConsistencyCheck = true
 	})
@@ -441,7 +446,7 @@ services:
       - FOO=1
       - BAR=2
       - BAZ=2.5
-      - QUX=
+      - QUX
       - QUUX
 `, map[string]string{"QUX": "qux"})
 	assert.NilError(t, err)
@@ -588,7 +593,7 @@ networks:
 		"thebool":  "true",
 	}
 
-	config, err := Load(buildConfigDetails(dict, env), func(options *Options) {
+	config, err := loadCached(buildConfigDetails(dict, env), func(options *Options) {
 		options.SkipNormalization = true
 		options.SkipConsistencyCheck = true
 	})
@@ -597,8 +602,9 @@ networks:
 	workingDir, err := os.Getwd()
 	assert.NilError(t, err)
 	expected := &types.Project{
-		Name:       "",
-		WorkingDir: workingDir,
+		Name:        "",
+		WorkingDir:  workingDir,
+		Environment: env,
 		Services: []types.ServiceConfig{
 			{
 				Name: "web",
@@ -638,7 +644,7 @@ networks:
 				Ports: []types.ServicePortConfig{
 					{Target: 555, Mode: "ingress", Protocol: "tcp"},
 					{Target: 34567, Mode: "ingress", Protocol: "tcp"},
-					{Target: 555, Published: 555, Extensions: map[string]interface{}{"x-foo-bar": true}},
+					{Target: 555, Published: "555", Extensions: map[string]interface{}{"x-foo-bar": true}},
 				},
 				Ulimits: map[string]*types.UlimitsConfig{
 					"nproc":  {Single: 555},
@@ -646,8 +652,8 @@ networks:
 				},
 				Privileged: true,
 				ReadOnly:   true,
-				StdinOpen:  true,
-				Tty:        true,
+				StdinOpen:  boolPtr(true),
+				Tty:        boolPtr(true),
 				Volumes: []types.ServiceVolumeConfig{
 					{
 						Source:   "data",
@@ -679,80 +685,2072 @@ networks:
 		},
 	}
 
-	assert.Check(t, is.DeepEqual(expected, config))
+	assert.Check(t, is.DeepEqual(expected, config))
+}
+
+func TestUnsupportedProperties(t *testing.T) {
+	dict, err := ParseYAML([]byte(`
+services:
+  web:
+    image: web
+    build:
+     context: ./web
+    links:
+      - db
+    pid: host
+  db:
+    image: db
+    build:
+     context: ./db
+`))
+	assert.NilError(t, err)
+
+	configDetails := buildConfigDetails(dict, nil)
+
+	_, err = loadCached(configDetails)
+	assert.NilError(t, err)
+}
+
+func TestDiscardEnvFileOption(t *testing.T) {
+	dict, err := ParseYAML([]byte(`services:
+  web:
+    image: nginx
+    env_file:
+     - example1.env
+     - example2.env
+`))
+	expectedEnvironmentMap := types.MappingWithEquals{
+		"FOO": strPtr("foo_from_env_file"),
+		"BAZ": strPtr("baz_from_env_file"),
+		"BAR": strPtr("bar_from_env_file_2"), // Original value is overwritten by example2.env
+		"QUX": strPtr("quz_from_env_file_2"),
+	}
+	assert.NilError(t, err)
+	configDetails := buildConfigDetails(dict, nil)
+
+	// Default behavior keeps the `env_file` entries
+	configWithEnvFiles, err := loadCached(configDetails)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, configWithEnvFiles.Services[0].EnvFile, types.StringList{"example1.env",
+		"example2.env"})
+	assert.DeepEqual(t, configWithEnvFiles.Services[0].Environment, expectedEnvironmentMap)
+
+	// Custom behavior removes the `env_file` entries
+	configWithoutEnvFiles, err := loadCached(configDetails, WithDiscardEnvFiles)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, configWithoutEnvFiles.Services[0].EnvFile, types.StringList(nil))
+	assert.DeepEqual(t, configWithoutEnvFiles.Services[0].Environment, expectedEnvironmentMap)
+}
+
+func TestEnvFileValuesAreLiteral(t *testing.T) {
+	dict, err := ParseYAML([]byte(`services:
+  web:
+    image: nginx
+    env_file: testdata/literal.env
+    environment:
+      GREETING: hello ${NAME}
+      ESCAPED: $$NAME
+      PASSWORD:
+`))
+	assert.NilError(t, err)
+	named := func(options *Options) {
+		options.SetProjectName("literal", true)
+	}
+	project, err := loadCached(buildConfigDetails(dict, map[string]string{"NAME": "world", "word": "ignored", "HOME": "/root"}), named)
+	assert.NilError(t, err)
+	expected := types.MappingWithEquals{
+		"GREETING": strPtr("hello world"),
+		"ESCAPED":  strPtr("$NAME"),
+		"PASSWORD": strPtr("pa$word"),
+		"HOME_DIR": strPtr("$HOME"),
+		"TEMPLATE": strPtr("${NAME:-default}"),
+		"BIN_DIR":  strPtr("$HOME/bin"),
+	}
+	assert.DeepEqual(t, project.Services[0].Environment, expected)
+
+	// loading the project again doesn't substitute env file values a second time
+	details, err := project.ToConfigDetails()
+	assert.NilError(t, err)
+	reloaded, err := loadCached(details, named)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, reloaded.Services[0].Environment, expected)
+}
+
+func TestBuildProperties(t *testing.T) {
+	dict, err := ParseYAML([]byte(`
+services:
+  web:
+    image: web
+    build: .
+    links:
+      - db
+  db:
+    image: db
+    build:
+     context: ./db
+`))
+	assert.NilError(t, err)
+	configDetails := buildConfigDetails(dict, nil)
+	_, err = loadCached(configDetails)
+	assert.NilError(t, err)
+}
+
+func TestLoadBuildSSH(t *testing.T) {
+	dict, err := ParseYAML([]byte(`
+services:
+  list:
+    build:
+      context: .
+      ssh:
+        - default
+        - key=/path/to/key
+  map:
+    build:
+      context: .
+      ssh:
+        other: /path/to/other
+        default:
+`))
+	assert.NilError(t, err)
+	project, err := loadCached(buildConfigDetails(dict, nil))
+	assert.NilError(t, err)
+
+	list, err := project.GetService("list")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, list.Build.SSH, types.SSHConfig{{ID: "default"}, {ID: "key", Path: "/path/to/key"}})
+	m, err := project.GetService("map")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, m.Build.SSH, types.SSHConfig{{ID: "default"}, {ID: "other", Path: "/path/to/other"}})
+}
+
+func TestLoadBuildInvalidSSH(t *testing.T) {
+	dict, err := ParseYAML([]byte(`
+services:
+  foo:
+    build:
+      context: .
+      ssh:
+        - key
+`))
+	assert.NilError(t, err)
+	_, err = loadCached(buildConfigDetails(dict, nil))
+	assert.ErrorContains(t, err, "invalid build ssh entry \"key\"")
+}
+
+func TestLoadBuildEmptyAdditionalContext(t *testing.T) {
+	dict, err := ParseYAML([]byte(`
+services:
+  foo:
+    build:
+      context: .
+      additional_contexts:
+        - base
+`))
+	assert.NilError(t, err)
+	_, err = loadCached(buildConfigDetails(dict, nil))
+	assert.ErrorContains(t, err, "service \"foo\" declares additional build context \"base\" with an empty value")
+}
+
+func TestLoadBuildUndefinedSecret(t *testing.T) {
+	dict, err := ParseYAML([]byte(`
+services:
+  foo:
+    build:
+      context: .
+      secrets:
+        - token
+`))
+	assert.NilError(t, err)
+	_, err = loadCached(buildConfigDetails(dict, nil))
+	assert.ErrorContains(t, err, "service \"foo\" build refers to undefined secret token")
+}
+
+func TestLoadDependsOn(t *testing.T) {
+	dict, err := ParseYAML([]byte(`
+services:
+  short:
+    image: short
+    depends_on:
+      - db
+  long:
+    image: long
+    depends_on:
+      db:
+        condition: service_healthy
+        restart: true
+      init:
+        condition: service_completed_successfully
+  db:
+    image: db
+  init:
+    image: init
+`))
+	assert.NilError(t, err)
+	project, err := loadCached(buildConfigDetails(dict, nil))
+	assert.NilError(t, err)
+
+	short, err := project.GetService("short")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, short.DependsOn, types.DependsOnConfig{
+		"db": {Condition: types.ServiceConditionStarted},
+	})
+	long, err := project.GetService("long")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, long.DependsOn, types.DependsOnConfig{
+		"db":   {Condition: types.ServiceConditionHealthy, Restart: true},
+		"init": {Condition: types.ServiceConditionCompletedSuccessfully},
+	})
+}
+
+func TestLoadDependsOnInvalidCondition(t *testing.T) {
+	dict, err := ParseYAML([]byte(`
+services:
+  foo:
+    image: foo
+    depends_on:
+      db:
+        condition: service_ready
+  db:
+    image: db
+`))
+	assert.NilError(t, err)
+	_, err = loadCached(buildConfigDetails(dict, nil))
+	assert.ErrorContains(t, err, "services.foo.depends_on.db.condition must be one of the following")
+
+	_, err = loadCached(buildConfigDetails(dict, nil), func(options *Options) {
+		options.SkipValidation = true
+	})
+	assert.ErrorContains(t, err, `service "foo" depends on "db" with unknown condition "service_ready"`)
+}
+
+func TestLoadStrictUnknownKeys(t *testing.T) {
+	dict, err := ParseYAML([]byte(`
+services:
+  web:
+    image: nginx
+    enviroment:
+      FOO: bar
+    x-custom: ok
+`))
+	assert.NilError(t, err)
+
+	_, err = loadCached(buildConfigDetails(dict, nil), func(options *Options) {
+		options.Strict = true
+	})
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `unknown key "enviroment" in services.web, did you mean "environment"?`)
+
+	_, err = loadCached(buildConfigDetails(map[string]interface{}{
+		"servces": map[string]interface{}{},
+		"x-foo":   "bar",
+	}, nil), func(options *Options) {
+		options.Strict = true
+	})
+	assert.ErrorContains(t, err, `unknown key "servces" at top-level, did you mean "services"?`)
+}
+
+func TestLoadUnknownKeysWarnings(t *testing.T) {
+	dict, err := ParseYAML([]byte(`
+services:
+  web:
+    image: nginx
+    helicopters: 2
+    enviroment:
+      FOO: bar
+networks:
+  front:
+    dirver: overlay
+`))
+	assert.NilError(t, err)
+
+	var warnings []string
+	_, err = loadCached(buildConfigDetails(dict, nil), func(options *Options) {
+		options.SkipValidation = true
+		options.SkipConsistencyCheck = true
+		options.Warn = func(message string) {
+			warnings = append(warnings, message)
+		}
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, warnings, []string{
+		`unknown key "dirver" in networks.front, did you mean "driver"?`,
+		`unknown key "enviroment" in services.web, did you mean "environment"?`,
+		`unknown key "helicopters" in services.web`,
+	})
+}
+
+func TestLoadWithAnchors(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/compose-test-anchors.yaml")
+	assert.NilError(t, err)
+
+	actual, err := loadCached(types.ConfigDetails{
+		WorkingDir: "testdata",
+		ConfigFiles: []types.ConfigFile{
+			{Filename: "testdata/compose-test-anchors.yaml", Content: b},
+		},
+	})
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(actual.Services, 3))
+
+	for _, name := range []string{"front", "back", "worker"} {
+		service, err := actual.GetService(name)
+		assert.NilError(t, err)
+		assert.Check(t, is.DeepEqual(service.Labels, types.Labels{"com.example.team": "platform"}))
+	}
+
+	front, err := actual.GetService("front")
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(front.Image, "busybox"))
+	assert.Check(t, is.Equal(front.Restart.String(), "always"))
+	assert.Check(t, is.Equal(*front.Environment["LOG_LEVEL"], "info"))
+	assert.Check(t, is.Len(front.Ports, 1))
+
+	back, err := actual.GetService("back")
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(back.Image, "busybox:1.33"))
+	assert.Check(t, is.Equal(*back.Environment["LOG_LEVEL"], "debug"))
+
+	worker, err := actual.GetService("worker")
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(worker.Restart.String(), "on-failure"))
+}
+
+func TestLoadMultipleDocuments(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/compose-test-multi-documents.yaml")
+	assert.NilError(t, err)
+
+	actual, err := loadCached(types.ConfigDetails{
+		WorkingDir: "testdata",
+		ConfigFiles: []types.ConfigFile{
+			{Filename: "testdata/compose-test-multi-documents.yaml", Content: b},
+		},
+	})
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(actual.ServiceNames(), []string{"back", "front"}))
+
+	front, err := actual.GetService("front")
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(front.Image, "nginx"))
+	assert.Check(t, is.Equal(*front.Environment["LOG_LEVEL"], "debug"))
+
+	_, err = ParseYAML(b)
+	assert.ErrorContains(t, err, "expected a single YAML document, got 2")
+}
+
+func TestParseYAMLDuplicateKeys(t *testing.T) {
+	_, err := ParseYAML([]byte(`
+services:
+  foo:
+    image: busybox
+    environment:
+      FOO: bar
+    image: nginx
+`))
+	assert.ErrorContains(t, err, `line 7: key "image" is already defined at line 4`)
+
+	_, err = ParseYAMLDocuments([]byte(`
+services:
+  foo:
+    image: busybox
+---
+services:
+  foo:
+    image: busybox
+  foo:
+    image: nginx
+`))
+	assert.ErrorContains(t, err, `line 9: key "foo" is already defined at line 7`)
+}
+
+func TestLoadErrorPositions(t *testing.T) {
+	load := func(files ...types.ConfigFile) error {
+		_, err := loadCached(types.ConfigDetails{WorkingDir: ".", ConfigFiles: files})
+		return err
+	}
+
+	err := load(types.ConfigFile{Filename: "compose.yaml", Content: []byte(`
+services:
+  web:
+    image: nginx
+    ports:
+      - "eighty:80"
+`)})
+	assert.Error(t, err, `compose.yaml:5:5: services.web.ports: Invalid hostPort: eighty`)
+
+	err = load(types.ConfigFile{Filename: "compose.yaml", Content: []byte(`
+services:
+  web:
+    image: nginx
+    ports:
+      - target: eighty
+`)})
+	assert.Error(t, err, `compose.yaml:6:9: services.web.ports.0.target must be a integer`)
+	var located *LocatedError
+	assert.Assert(t, errors.As(err, &located))
+	assert.Check(t, is.Equal(located.Line, 6))
+
+	err = load(
+		types.ConfigFile{Filename: "compose.yaml", Content: []byte(`
+services:
+  web:
+    image: nginx
+`)},
+		types.ConfigFile{Filename: "compose.override.yaml", Content: []byte(`
+services:
+  web:
+    environment:
+      FOO: bar
+    networks:
+      - front
+`)})
+	assert.Error(t, err, `compose.override.yaml:6:5: service "web" refers to undefined network front: invalid compose project`)
+	assert.Check(t, errdefs.IsInvalidError(err))
+
+	err = load(types.ConfigFile{Filename: "compose.yaml", Content: []byte(`
+services:
+  web:
+    image: nginx
+    deploy:
+      replicas: ${N}
+`)})
+	assert.ErrorContains(t, err, `compose.yaml:6:7: services.web.deploy.replicas: cannot convert "" (from unset variable N) to integer`)
+	assert.Check(t, errdefs.IsInvalidError(err))
+
+	err = load(types.ConfigFile{Filename: "compose.yaml", Content: []byte(`
+services:
+  web:
+    image: nginx
+    ports:
+      - ${PORT?}:80
+`)})
+	assert.ErrorContains(t, err, `compose.yaml:5:5: invalid interpolation format for services.web.ports.[]`)
+}
+
+func TestLoadErrorPositionsWithAnchors(t *testing.T) {
+	_, err := loadCached(types.ConfigDetails{WorkingDir: ".", ConfigFiles: []types.ConfigFile{
+		{Filename: "compose.yaml", Content: []byte(`
+x-common: &common
+  image: nginx
+  ports:
+    - "eighty:80"
+services:
+  web:
+    <<: *common
+`)},
+	}})
+	assert.Error(t, err, `compose.yaml:4:3: services.web.ports: Invalid hostPort: eighty`)
+}
+
+func TestExtractVariables(t *testing.T) {
+	dict, err := ParseYAML([]byte(`
+services:
+  web:
+    image: ${REGISTRY:-docker.io}/web:${TAG}
+    environment:
+      TOKEN: ${TOKEN:?token is required}
+      PRICE: $$5
+    command: ["serve", "--registry", "$REGISTRY"]
+networks:
+  front:
+    driver: ${DRIVER-bridge}
+`))
+	assert.NilError(t, err)
+
+	variables := ExtractVariables(dict)
+	assert.DeepEqual(t, variables, map[string]VariableInfo{
+		"REGISTRY": {Name: "REGISTRY", DefaultValue: "docker.io", Locations: []string{"services.web.command.2", "services.web.image"}},
+		"TAG":      {Name: "TAG", Locations: []string{"services.web.image"}},
+		"TOKEN":    {Name: "TOKEN", Required: true, Locations: []string{"services.web.environment.TOKEN"}},
+		"DRIVER":   {Name: "DRIVER", DefaultValue: "bridge", Locations: []string{"networks.front.driver"}},
+	})
+}
+
+func TestLoadWithInterpolationLookup(t *testing.T) {
+	dict, err := ParseYAML([]byte(`
+services:
+  web:
+    image: nginx:${TAG}
+`))
+	assert.NilError(t, err)
+
+	var looked []string
+	// loadCached would run the lookup once more for the cached load
+	project, err := Load(buildConfigDetails(dict, nil), func(options *Options) {
+		options.Interpolate.LookupValue = func(key string) (string, bool) {
+			looked = append(looked, key)
+			return "from-store", true
+		}
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, project.Services[0].Image, "nginx:from-store")
+	assert.DeepEqual(t, looked, []string{"TAG"})
+}
+
+func TestLoadBuildUlimits(t *testing.T) {
+	project, err := loadYAML(`
+services:
+  web:
+    build:
+      context: .
+      ulimits:
+        nproc: 65535
+        nofile:
+          soft: 20000
+          hard: 40000
+    ulimits:
+      nofile: 1024
+`)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.Services[0].Build.Ulimits, map[string]*types.UlimitsConfig{
+		"nproc":  {Single: 65535},
+		"nofile": {Soft: 20000, Hard: 40000},
+	})
+	assert.DeepEqual(t, project.Services[0].Ulimits, map[string]*types.UlimitsConfig{
+		"nofile": {Single: 1024},
+	})
+}
+
+func TestLoadShellCommandMalformedQuoting(t *testing.T) {
+	_, err := loadYAML(`
+services:
+  web:
+    image: foo
+    command: echo "hello world
+`)
+	assert.ErrorContains(t, err, `services.web.command`)
+	assert.ErrorContains(t, err, `invalid command "echo \"hello world"`)
+}
+
+func TestLoadShellCommandEmpty(t *testing.T) {
+	project, err := loadYAML(`
+services:
+  web:
+    image: foo
+    command: []
+    entrypoint: ""
+  other:
+    image: foo
+`)
+	assert.NilError(t, err)
+	web, err := project.GetService("web")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, web.Command, types.ShellCommand{})
+	assert.DeepEqual(t, web.Entrypoint, types.ShellCommand{})
+	other, err := project.GetService("other")
+	assert.NilError(t, err)
+	assert.Check(t, other.Command == nil)
+	assert.Check(t, other.Entrypoint == nil)
+}
+
+func TestLoadResourceNames(t *testing.T) {
+	dict, err := ParseYAML([]byte(`
+services:
+  web:
+    image: foo
+    networks: [front]
+networks:
+  front: {}
+  back:
+    name: my_back
+  outside:
+    external: true
+    driver: overlay
+    labels:
+      foo: bar
+volumes:
+  data: {}
+  shared:
+    external: true
+    name: shared_data
+secrets:
+  token:
+    external: true
+configs:
+  settings:
+    file: ./settings.conf
+`))
+	assert.NilError(t, err)
+
+	var warnings []string
+	project, err := loadCached(buildConfigDetails(dict, nil), func(options *Options) {
+		options.Name = "myproject"
+		options.Warn = func(message string) {
+			warnings = append(warnings, message)
+		}
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, warnings, []string{`network "outside" is external, ignoring driver, labels`})
+
+	assert.Equal(t, project.Networks["front"].Name, "myproject_front")
+	assert.Equal(t, project.Networks["back"].Name, "my_back")
+	assert.Equal(t, project.Networks["outside"].Name, "outside")
+	assert.Equal(t, project.Volumes["data"].Name, "myproject_data")
+	assert.Equal(t, project.Volumes["shared"].Name, "shared_data")
+	assert.Equal(t, project.Secrets["token"].Name, "token")
+	assert.Equal(t, project.Configs["settings"].Name, "myproject_settings")
+}
+
+func TestLoadWarnsUnsetVariables(t *testing.T) {
+	dict, err := ParseYAML([]byte(`
+services:
+  web:
+    image: ${IMAGE}:${TAG:-latest}
+    command: echo $$ESCAPED $FOO
+    environment:
+      REQUIRED: ${REQUIRED?}
+      EMPTY: ${EMPTY-}
+      AGAIN: ${IMAGE}
+`))
+	assert.NilError(t, err)
+
+	var warnings []string
+	_, err = loadCached(buildConfigDetails(dict, map[string]string{"REQUIRED": "set"}), func(options *Options) {
+		options.SkipConsistencyCheck = true
+		options.Warn = func(message string) {
+			warnings = append(warnings, message)
+		}
+	})
+	assert.NilError(t, err)
+	sort.Strings(warnings)
+	assert.DeepEqual(t, warnings, []string{
+		`The "FOO" variable is not set. Defaulting to a blank string.`,
+		`The "IMAGE" variable is not set. Defaulting to a blank string.`,
+	})
+}
+
+func loadIncludeTestProject(filename string, env map[string]string) (*types.Project, error) {
+	workingDir, err := filepath.Abs(filepath.Join("testdata", "include"))
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(workingDir, filename)
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return loadCached(types.ConfigDetails{
+		WorkingDir:  workingDir,
+		ConfigFiles: []types.ConfigFile{{Filename: path, Content: b}},
+		Environment: env,
+	}, func(options *Options) {
+		options.Name = "include"
+	})
+}
+
+func TestLoadInclude(t *testing.T) {
+	project, err := loadIncludeTestProject("compose.yaml", map[string]string{"MODE": "from_parent"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.ServiceNames(), []string{"backend", "frontend", "worker"})
+
+	workingDir, err := filepath.Abs(filepath.Join("testdata", "include"))
+	assert.NilError(t, err)
+	backend, err := project.GetService("backend")
+	assert.NilError(t, err)
+	assert.Equal(t, backend.Image, "backend:from_backend_env")
+	assert.Equal(t, backend.Build.Context, filepath.Join(workingDir, "app", "backend"))
+	assert.Equal(t, backend.Volumes[0].Source, filepath.Join(workingDir, "app", "backend", "data"))
+	assert.Equal(t, project.Networks["private"].Name, "include_private")
+
+	worker, err := project.GetService("worker")
+	assert.NilError(t, err)
+	assert.Equal(t, worker.Image, "worker:from_custom_env")
+	assert.Equal(t, *worker.Environment["MODE"], "from_parent")
+}
+
+func TestLoadIncludeConflictingService(t *testing.T) {
+	_, err := loadIncludeTestProject("conflict.yaml", nil)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `conflict.yaml:2:5: service "worker" declared by included file`)
+	assert.ErrorContains(t, err, `app/compose.yaml is already declared`)
+}
+
+func TestLoadIncludeServiceRedeclaredByOverride(t *testing.T) {
+	workingDir, err := filepath.Abs(filepath.Join("testdata", "include"))
+	assert.NilError(t, err)
+	var files []types.ConfigFile
+	for _, name := range []string{"compose.yaml", "override.yaml"} {
+		path := filepath.Join(workingDir, name)
+		b, err := ioutil.ReadFile(path)
+		assert.NilError(t, err)
+		files = append(files, types.ConfigFile{Filename: path, Content: b})
+	}
+	_, err = loadCached(types.ConfigDetails{
+		WorkingDir:  workingDir,
+		ConfigFiles: files,
+		Environment: map[string]string{"MODE": "from_parent"},
+	}, func(options *Options) {
+		options.Name = "include"
+	})
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `override.yaml:2:3: service "backend" declared by included file`)
+	assert.ErrorContains(t, err, `app/backend/compose.yaml is already declared`)
+}
+
+func TestLoadIncludeRemoteBuildContext(t *testing.T) {
+	project, err := loadIncludeTestProject("remote.yaml", nil)
+	assert.NilError(t, err)
+	workingDir, err := filepath.Abs(filepath.Join("testdata", "include"))
+	assert.NilError(t, err)
+	for name, context := range map[string]string{
+		"git":   "https://github.com/docker/compose.git#main",
+		"ssh":   "git@github.com:docker/compose.git",
+		"local": filepath.Join(workingDir, "app", "remote", "local"),
+	} {
+		service, err := project.GetService(name)
+		assert.NilError(t, err)
+		assert.Check(t, is.Equal(service.Build.Context, context), name)
+	}
+}
+
+func TestLoadIncludeCycle(t *testing.T) {
+	_, err := loadIncludeTestProject(filepath.Join("cycle", "compose.yaml"), nil)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, "include cycle detected")
+	assert.ErrorContains(t, err, filepath.Join("cycle", "other.yaml")+" -> ")
+}
+
+func TestLoadScale(t *testing.T) {
+	dict, err := ParseYAML([]byte(`
+services:
+  legacy:
+    image: foo
+    scale: 3
+  replicated:
+    image: foo
+    deploy:
+      replicas: 2
+  single:
+    image: foo
+`))
+	assert.NilError(t, err)
+
+	var warnings []string
+	project, err := loadCached(buildConfigDetails(dict, nil), func(options *Options) {
+		options.Warn = func(message string) {
+			warnings = append(warnings, message)
+		}
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, warnings, []string{"`scale` is deprecated. Use the `deploy.replicas` element"})
+
+	legacy, err := project.GetService("legacy")
+	assert.NilError(t, err)
+	assert.Equal(t, *legacy.Deploy.Replicas, uint64(3))
+	assert.Equal(t, legacy.GetScale(), 3)
+	replicated, err := project.GetService("replicated")
+	assert.NilError(t, err)
+	assert.Equal(t, replicated.Scale, 2)
+	assert.Equal(t, replicated.GetScale(), 2)
+	single, err := project.GetService("single")
+	assert.NilError(t, err)
+	assert.Equal(t, single.GetScale(), 1)
+}
+
+func TestLoadErrorKinds(t *testing.T) {
+	_, err := loadCached(types.ConfigDetails{})
+	assert.Check(t, errdefs.IsInvalidError(err))
+
+	_, err = ParseYAML([]byte("services: [web"))
+	assert.Check(t, errdefs.IsInvalidError(err))
+
+	_, err = loadCached(types.ConfigDetails{WorkingDir: ".", ConfigFiles: []types.ConfigFile{{Filename: "compose.yaml", Content: []byte(`
+services:
+  web:
+    image: nginx
+    ports: 80
+`)}}})
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, "services.web.ports must be a list")
+	var located *LocatedError
+	assert.Check(t, errors.As(err, &located))
+
+	_, err = loadYAML(`
+services:
+  web:
+    image: ${
+`)
+	assert.Check(t, errdefs.IsInvalidError(err))
+
+	_, err = loadYAML(`
+services:
+  web:
+    image: nginx
+    env_file: missing.env
+`)
+	assert.Check(t, errdefs.IsNotFoundError(err))
+	assert.Check(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestLoadDevelopWatch(t *testing.T) {
+	project, err := loadYAML(`
+services:
+  web:
+    image: nginx
+    develop:
+      x-debounce: 500ms
+      watch:
+        - path: ./web
+          action: sync
+          target: /usr/share/nginx/html
+          ignore:
+            - node_modules/
+        - path: /etc/nginx/nginx.conf
+          action: sync+restart
+          target: /etc/nginx/nginx.conf
+        - path: Dockerfile
+          action: rebuild
+`)
+	assert.NilError(t, err)
+	wd, err := os.Getwd()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.Services[0].Develop, &types.DevelopConfig{
+		Watch: []types.Trigger{
+			{Path: filepath.Join(wd, "web"), Action: types.WatchActionSync, Target: "/usr/share/nginx/html", Ignore: []string{"node_modules/"}},
+			{Path: "/etc/nginx/nginx.conf", Action: types.WatchActionSyncRestart, Target: "/etc/nginx/nginx.conf"},
+			{Path: filepath.Join(wd, "Dockerfile"), Action: types.WatchActionRebuild},
+		},
+		Extensions: map[string]interface{}{"x-debounce": "500ms"},
+	})
+
+	_, err = loadYAML(`
+services:
+  web:
+    image: nginx
+    develop:
+      watch:
+        - path: ./web
+          action: copy
+`)
+	assert.ErrorContains(t, err, "services.web.develop.watch.0.action must be one of the following")
+}
+
+func TestLoadNetworkModeService(t *testing.T) {
+	project, err := loadCached(buildConfigDetails(map[string]interface{}{
+		"services": map[string]interface{}{
+			"app": map[string]interface{}{"image": "app", "network_mode": "service:vpn"},
+			"vpn": map[string]interface{}{"image": "vpn"},
+		},
+	}, nil))
+	assert.NilError(t, err)
+	app, err := project.GetService("app")
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(app.Networks, 0))
+	vpn, err := project.GetService("vpn")
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(vpn.Networks, 1))
+}
+
+func TestLoadEnvironmentUnsetAndEmpty(t *testing.T) {
+	config, err := loadYAMLWithEnv(`
+services:
+  dict-env:
+    image: busybox
+    environment:
+      FOO: ""
+      BAR:
+      BAZ:
+  list-env:
+    image: busybox
+    environment:
+      - FOO=
+      - BAR
+      - BAZ
+`, map[string]string{"FOO": "foo", "BAR": "bar"})
+	assert.NilError(t, err)
+
+	expected := types.MappingWithEquals{
+		"FOO": strPtr(""),
+		"BAR": strPtr("bar"),
+		"BAZ": nil,
+	}
+	for _, service := range config.Services {
+		assert.Check(t, is.DeepEqual(expected, service.Environment), service.Name)
+	}
+}
+
+func TestLoadPublishedPortRange(t *testing.T) {
+	project, err := loadCached(buildConfigDetails(map[string]interface{}{
+		"services": map[string]interface{}{
+			"web": map[string]interface{}{
+				"image": "nginx",
+				"ports": []interface{}{
+					"8080-8090:80",
+					map[string]interface{}{"target": 81, "published": "9000-9010"},
+					map[string]interface{}{"target": 82, "published": 9090},
+					map[string]interface{}{"target": 83, "published": "0"},
+				},
+			},
+		},
+	}, nil))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.Services[0].Ports, []types.ServicePortConfig{
+		{Mode: "ingress", Target: 80, Published: "8080-8090", Protocol: "tcp"},
+		{Target: 81, Published: "9000-9010"},
+		{Target: 82, Published: "9090"},
+		{Target: 83, Published: "0"},
+	})
+
+	_, err = loadCached(buildConfigDetails(map[string]interface{}{
+		"services": map[string]interface{}{
+			"web": map[string]interface{}{
+				"image": "nginx",
+				"ports": []interface{}{map[string]interface{}{"target": 80, "published": "http"}},
+			},
+		},
+	}, nil))
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `service "web": invalid published port "http"`)
+}
+
+func TestLoadStringMappingsAsWritten(t *testing.T) {
+	b := []byte(`
+x-env: &env
+  DEBUG: off
+services:
+  web:
+    image: nginx
+    environment:
+      <<: *env
+      TZ: NO
+      ENABLED: on
+      VERSION: 3.10
+      MODE: 0777
+      QUOTED: "yes"
+      COUNT: 5
+      UNSET:
+    labels:
+      com.example.enabled: "true"
+      com.example.flag: Yes
+    sysctls:
+      net.core.somaxconn: 01024
+    build:
+      context: .
+      args:
+        PYTHON: 3.10
+networks:
+  front:
+    driver_opts:
+      encrypted: y
+volumes:
+  data:
+    labels:
+      backup: false
+`)
+	project, err := loadCached(types.ConfigDetails{
+		WorkingDir:  ".",
+		ConfigFiles: []types.ConfigFile{{Filename: "compose.yaml", Content: b}},
+	}, func(options *Options) {
+		options.SkipConsistencyCheck = true
+	})
+	assert.NilError(t, err)
+	web := project.Services[0]
+	assert.DeepEqual(t, web.Environment, types.MappingWithEquals{
+		"DEBUG":   strPtr("off"),
+		"TZ":      strPtr("NO"),
+		"ENABLED": strPtr("on"),
+		"VERSION": strPtr("3.10"),
+		"MODE":    strPtr("0777"),
+		"QUOTED":  strPtr("yes"),
+		"COUNT":   strPtr("5"),
+		"UNSET":   nil,
+	})
+	assert.DeepEqual(t, web.Labels, types.Labels{"com.example.enabled": "true", "com.example.flag": "Yes"})
+	assert.DeepEqual(t, web.Sysctls, types.Mapping{"net.core.somaxconn": "01024"})
+	assert.DeepEqual(t, web.Build.Args, types.MappingWithEquals{"PYTHON": strPtr("3.10")})
+	assert.DeepEqual(t, project.Networks["front"].DriverOpts, map[string]string{"encrypted": "y"})
+	assert.DeepEqual(t, project.Volumes["data"].Labels, types.Labels{"backup": "false"})
+
+	// values which YAML would resolve to another type are quoted when marshaled, so that those can be loaded back
+	marshaled, err := yaml.Marshal(map[string]interface{}{"services": project.Services})
+	assert.NilError(t, err)
+	reloaded, err := loadCached(types.ConfigDetails{
+		WorkingDir:  ".",
+		ConfigFiles: []types.ConfigFile{{Filename: "compose.yaml", Content: marshaled}},
+	}, func(options *Options) {
+		options.SkipConsistencyCheck = true
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, reloaded.Services[0].Environment, web.Environment)
+	assert.DeepEqual(t, reloaded.Services[0].Labels, web.Labels)
+}
+
+func TestLoadTopLevelName(t *testing.T) {
+	details := func() types.ConfigDetails {
+		return types.ConfigDetails{
+			WorkingDir: ".",
+			ConfigFiles: []types.ConfigFile{
+				{Filename: "base.yml", Config: map[string]interface{}{
+					"name":     "${PROJECT:-base}",
+					"services": map[string]interface{}{"foo": map[string]interface{}{"image": "foo"}},
+				}},
+			},
+			Environment: map[string]string{},
+		}
+	}
+	project, err := loadCached(details(), func(options *Options) {
+		options.SetProjectName("fallback", false)
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, project.Name, "base")
+
+	project, err = loadCached(details(), func(options *Options) {
+		options.SetProjectName("explicit", true)
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, project.Name, "explicit")
+
+	withOverride := details()
+	withOverride.Environment["PROJECT"] = "interpolated"
+	withOverride.ConfigFiles = append(withOverride.ConfigFiles,
+		types.ConfigFile{Filename: "override.yml", Config: map[string]interface{}{"name": "override"}},
+		types.ConfigFile{Filename: "other.yml", Config: map[string]interface{}{}})
+	project, err = loadCached(withOverride)
+	assert.NilError(t, err)
+	assert.Equal(t, project.Name, "override")
+
+	withOverride.ConfigFiles = withOverride.ConfigFiles[:1]
+	project, err = loadCached(withOverride)
+	assert.NilError(t, err)
+	assert.Equal(t, project.Name, "interpolated")
+
+	invalid := details()
+	invalid.Environment["PROJECT"] = "Base"
+	_, err = loadCached(invalid)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `invalid project name "Base"`)
+}
+
+func loadNormalizedYAML(t *testing.T, yaml string, options ...func(*Options)) (*types.Project, error) {
+	t.Helper()
+	dict, err := ParseYAML([]byte(yaml))
+	assert.NilError(t, err)
+	return loadCached(buildConfigDetails(dict, nil), options...)
+}
+
+func TestConvertLegacyResourceFields(t *testing.T) {
+	legacyYAML := `
+services:
+  foo:
+    image: busybox
+    cpus: 0.5
+    mem_limit: 512m
+    mem_reservation: 128m
+`
+	legacy, err := loadNormalizedYAML(t, legacyYAML)
+	assert.NilError(t, err)
+	deploy, err := loadNormalizedYAML(t, `
+services:
+  foo:
+    image: busybox
+    deploy:
+      resources:
+        limits:
+          cpus: "0.5"
+          memory: 512m
+        reservations:
+          memory: 128m
+`)
+	assert.NilError(t, err)
+
+	expected := &types.DeployConfig{
+		Resources: types.Resources{
+			Limits:       &types.Resource{NanoCPUs: "0.5", MemoryBytes: 512 * 1024 * 1024},
+			Reservations: &types.Resource{MemoryBytes: 128 * 1024 * 1024},
+		},
+	}
+	assert.Check(t, is.DeepEqual(expected, legacy.Services[0].Deploy))
+	assert.Check(t, is.DeepEqual(expected, deploy.Services[0].Deploy))
+
+	disabled, err := loadNormalizedYAML(t, legacyYAML, func(options *Options) {
+		options.ConvertLegacyResourceFields = false
+	})
+	assert.NilError(t, err)
+	assert.Check(t, disabled.Services[0].Deploy == nil)
+	assert.Check(t, is.Equal(types.UnitBytes(512*1024*1024), disabled.Services[0].MemLimit))
+}
+
+func TestLegacyResourceFieldsConflict(t *testing.T) {
+	_, err := loadNormalizedYAML(t, `
+services:
+  foo:
+    image: busybox
+    mem_limit: 512m
+    deploy:
+      resources:
+        limits:
+          memory: 256m
+`)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, "can't set distinct values on 'mem_limit'")
+
+	_, err = loadNormalizedYAML(t, `
+services:
+  foo:
+    image: busybox
+    cpus: 1.5
+    deploy:
+      resources:
+        limits:
+          cpus: "2"
+`)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, "can't set distinct values on 'cpus'")
+}
+
+func TestWarnReservedLabels(t *testing.T) {
+	var warnings []string
+	_, err := loadNormalizedYAML(t, `
+services:
+  foo:
+    image: busybox
+    labels:
+      - com.docker.compose.project=other
+      - com.example.foo=bar
+volumes:
+  data:
+    labels:
+      com.docker.compose.volume: data
+`, func(options *Options) {
+		options.Warn = func(message string) {
+			warnings = append(warnings, message)
+		}
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, warnings, []string{
+		`service "foo": label "com.docker.compose.project" uses the reserved prefix "com.docker.compose." and will be overwritten`,
+		`volume "data": label "com.docker.compose.volume" uses the reserved prefix "com.docker.compose." and will be overwritten`,
+	})
+}
+
+func TestLoadContainerModes(t *testing.T) {
+	project, err := loadNormalizedYAML(t, `
+services:
+  foo:
+    image: busybox
+    cgroup: private
+    cgroup_parent: m-executor-abcd
+    ipc: shareable
+    uts: host
+    userns_mode: host
+    runtime: runc
+    isolation: process
+    shm_size: 64m
+    build:
+      context: .
+      shm_size: 128m
+`)
+	assert.NilError(t, err)
+	foo := project.Services[0]
+	assert.Check(t, is.Equal(types.CgroupPrivate, foo.Cgroup))
+	assert.Check(t, is.Equal("m-executor-abcd", foo.CgroupParent))
+	assert.Check(t, is.Equal("shareable", foo.Ipc))
+	assert.Check(t, is.Equal("host", foo.Uts))
+	assert.Check(t, is.Equal("host", foo.UserNSMode))
+	assert.Check(t, is.Equal("runc", foo.Runtime))
+	assert.Check(t, is.Equal("process", foo.Isolation))
+	assert.Check(t, is.Equal(types.UnitBytes(64*1024*1024), foo.ShmSize))
+	assert.Check(t, is.Equal(types.UnitBytes(128*1024*1024), foo.Build.ShmSize))
+
+	_, err = loadNormalizedYAML(t, `
+services:
+  foo:
+    image: busybox
+    cgroup: x
+`)
+	assert.ErrorContains(t, err, `services.foo.cgroup: invalid value "x", must be one of host, private`)
+	assert.Check(t, errdefs.IsInvalidError(err))
+}
+
+func TestInterpolateWholeDocument(t *testing.T) {
+	env := map[string]string{
+		"PROJECT":  "demo",
+		"SUBNET":   "10.5.0.0/16",
+		"NFS_PATH": ":/exports/data",
+		"PORT":     "8080",
+		"REPLICAS": "3",
+		"IPV6":     "true",
+		"LABEL":    "from-env",
+	}
+	project, err := loadYAMLWithEnv(`
+name: ${PROJECT}
+services:
+  web:
+    image: nginx
+    ports:
+      - ${PORT}:80
+      - target: ${PORT}
+        published: ${PORT}
+    deploy:
+      replicas: ${REPLICAS}
+    x-label: ${LABEL}
+networks:
+  default:
+    enable_ipv6: ${IPV6}
+    ipam:
+      config:
+        - subnet: ${SUBNET}
+volumes:
+  data:
+    driver_opts:
+      device: ${NFS_PATH}
+secrets:
+  token:
+    file: ./${LABEL}.txt
+configs:
+  settings:
+    file: ./${LABEL}.conf
+x-top: ${LABEL}
+`, env)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal("demo", project.Name))
+	web := project.Services[0]
+	assert.Check(t, is.DeepEqual([]types.ServicePortConfig{
+		{Mode: "ingress", Target: 80, Published: "8080", Protocol: "tcp"},
+		{Target: 8080, Published: "8080"},
+	}, web.Ports))
+	assert.Check(t, is.Equal(uint64(3), *web.Deploy.Replicas))
+	assert.Check(t, is.Equal("from-env", web.Extensions["x-label"]))
+	assert.Check(t, project.Networks["default"].EnableIPv6)
+	assert.Check(t, is.Equal("10.5.0.0/16", project.Networks["default"].Ipam.Config[0].Subnet))
+	assert.Check(t, is.Equal(":/exports/data", project.Volumes["data"].DriverOpts["device"]))
+	assert.Check(t, strings.HasSuffix(project.Secrets["token"].File, "from-env.txt"))
+	assert.Check(t, strings.HasSuffix(project.Configs["settings"].File, "from-env.conf"))
+	assert.Check(t, is.Equal("from-env", project.Extensions["x-top"]))
+}
+
+func TestInterpolateExtensionsDisabled(t *testing.T) {
+	dict, err := ParseYAML([]byte(`
+services:
+  web:
+    image: nginx:${TAG}
+    x-label: ${LABEL}
+x-top: ${LABEL}
+`))
+	assert.NilError(t, err)
+	project, err := loadCached(buildConfigDetails(dict, map[string]string{"TAG": "1.25", "LABEL": "from-env"}), func(options *Options) {
+		options.InterpolateExtensions = false
+	})
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal("nginx:1.25", project.Services[0].Image))
+	assert.Check(t, is.Equal("${LABEL}", project.Services[0].Extensions["x-label"]))
+	assert.Check(t, is.Equal("${LABEL}", project.Extensions["x-top"]))
+}
+
+func TestLoadDevicesSysctlsAndGroups(t *testing.T) {
+	project, err := loadNormalizedYAML(t, `
+services:
+  foo:
+    image: busybox
+    devices:
+      - /dev/ttyUSB0:/dev/ttyUSB0:rw
+      - source: /dev/sda
+    device_cgroup_rules:
+      - "c 1:3 mr"
+      - "b *:* rwm"
+    group_add:
+      - mail
+      - 1000
+    sysctls:
+      net.core.somaxconn: 1024
+      net.ipv4.tcp_rmem: 4096 87380 6291456
+      vm.max_map_count: 262144.0
+      kernel.shmmax: 68719476736
+  bar:
+    image: busybox
+    sysctls:
+      - net.core.somaxconn=1024
+      - net.ipv4.tcp_syncookies=0
+`)
+	assert.NilError(t, err)
+	foo, err := project.GetService("foo")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, foo.Devices, []types.ServiceDeviceConfig{
+		{Source: "/dev/ttyUSB0", Target: "/dev/ttyUSB0", Permissions: "rw"},
+		{Source: "/dev/sda", Target: "/dev/sda", Permissions: "rwm"},
+	})
+	assert.DeepEqual(t, foo.DeviceCgroupRules, []string{"c 1:3 mr", "b *:* rwm"})
+	assert.DeepEqual(t, foo.GroupAdd, types.StringOrNumberList{"mail", "1000"})
+	assert.DeepEqual(t, foo.Sysctls, types.Mapping{
+		"net.core.somaxconn": "1024",
+		"net.ipv4.tcp_rmem":  "4096 87380 6291456",
+		"vm.max_map_count":   "262144.0",
+		"kernel.shmmax":      "68719476736",
+	})
+	bar, err := project.GetService("bar")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, bar.Sysctls, types.Mapping{"net.core.somaxconn": "1024", "net.ipv4.tcp_syncookies": "0"})
+}
+
+func TestInvalidDevices(t *testing.T) {
+	_, err := loadNormalizedYAML(t, `
+services:
+  foo:
+    image: busybox
+    device_cgroup_rules:
+      - "c 1:3 mr"
+      - "c 1-3 mr"
+`)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `services.foo.device_cgroup_rules.1: invalid rule "c 1-3 mr"`)
+
+	_, err = loadNormalizedYAML(t, `
+services:
+  foo:
+    image: busybox
+    device_cgroup_rules:
+      - "c 1:3 rrr"
+`)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `services.foo.device_cgroup_rules.0: invalid rule "c 1:3 rrr"`)
+
+	_, err = loadNormalizedYAML(t, `
+services:
+  foo:
+    image: busybox
+    devices:
+      - source: /dev/sda
+        permissions: rx
+`)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `services.foo.devices.0: invalid permissions "rx" for device /dev/sda`)
+
+	_, err = loadNormalizedYAML(t, `
+services:
+  foo:
+    image: busybox
+    devices:
+      - /dev/a:/dev/b:rw:m
+`)
+	assert.ErrorContains(t, err, "invalid device specification: /dev/a:/dev/b:rw:m")
+}
+
+func TestLoadServicesSorted(t *testing.T) {
+	yaml := `
+services:
+  web:
+    image: nginx
+  db:
+    image: postgres
+  cache:
+    image: redis
+  api:
+    image: api
+`
+	for i := 0; i < 10; i++ {
+		project, err := loadNormalizedYAML(t, yaml)
+		assert.NilError(t, err)
+		var names []string
+		for _, service := range project.Services {
+			names = append(names, service.Name)
+		}
+		assert.DeepEqual(t, names, []string{"api", "cache", "db", "web"})
+	}
+}
+
+func TestLoadFromModel(t *testing.T) {
+	b, err := ioutil.ReadFile("full-example.yml")
+	assert.NilError(t, err)
+	homeDir, err := os.UserHomeDir()
+	assert.NilError(t, err)
+	workingDir, err := os.Getwd()
+	assert.NilError(t, err)
+	details := types.ConfigDetails{
+		WorkingDir:  workingDir,
+		ConfigFiles: []types.ConfigFile{{Filename: "full-example.yml", Content: b}},
+		Environment: map[string]string{"HOME": homeDir, "QUX": "qux_from_environment"},
+	}
+
+	fromYAML, err := loadCached(details, func(options *Options) {
+		options.SkipConsistencyCheck = true
+	})
+	assert.NilError(t, err)
+
+	model, err := ParseYAML(b)
+	assert.NilError(t, err)
+	fromModel, err := LoadFromModel(details, model, func(options *Options) {
+		options.SkipNormalization = true
+		options.SkipConsistencyCheck = true
+	})
+	assert.NilError(t, err)
+	assert.NilError(t, Normalize(fromModel))
+	assert.DeepEqual(t, fromYAML, fromModel)
+}
+
+func TestCheckConsistency(t *testing.T) {
+	project, err := LoadFromModel(types.ConfigDetails{WorkingDir: "/code"}, map[string]interface{}{
+		"services": map[string]interface{}{
+			"web": map[string]interface{}{"image": "nginx"},
+		},
+	})
+	assert.NilError(t, err)
+	assert.NilError(t, CheckConsistency(project))
+
+	project.Services[0].Networks = map[string]*types.ServiceNetworkConfig{"front": nil}
+	err = CheckConsistency(project)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `service "web" refers to undefined network front`)
+}
+
+func TestLoadSecurityOptions(t *testing.T) {
+	var warnings []string
+	project, err := loadNormalizedYAML(t, `
+services:
+  foo:
+    image: busybox
+    privileged: true
+    cap_drop: [net_raw]
+    security_opt:
+      - no-new-privileges
+      - no-new-privileges:true
+      - seccomp=unconfined
+      - apparmor:docker-default
+      - label=user:USER
+      - writable-cgroups=true
+      - mask=/proc/kcore
+      - unmask=/proc/acpi
+      - selinux=enforcing
+    credential_spec:
+      config: spec
+configs:
+  spec:
+    file: ./spec.json
+`, func(options *Options) {
+		options.Warn = func(message string) {
+			warnings = append(warnings, message)
+		}
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.Services[0].CapDrop, []string{"NET_RAW"})
+	assert.DeepEqual(t, warnings, []string{
+		`service "foo": cap_drop is ignored as the service is privileged`,
+		`service "foo": unknown security option "selinux=enforcing"`,
+	})
+
+	for _, tc := range []struct {
+		service  string
+		expected string
+	}{
+		{
+			service:  "security_opt: [seccomp]",
+			expected: `services.foo.security_opt.0: invalid security option "seccomp"`,
+		},
+		{
+			service:  "security_opt: [no-new-privileges=maybe]",
+			expected: `services.foo.security_opt.0: invalid security option "no-new-privileges=maybe"`,
+		},
+		{
+			service:  "security_opt: [writable-cgroups=yes]",
+			expected: `services.foo.security_opt.0: invalid security option "writable-cgroups=yes", writable-cgroups requires a boolean value`,
+		},
+		{
+			service:  "credential_spec: {file: spec.json, registry: spec}",
+			expected: "services.foo.credential_spec: exactly one of config, file or registry must be set",
+		},
+		{
+			service:  "credential_spec: {config: missing}",
+			expected: `service "foo" credential spec refers to undefined config missing`,
+		},
+	} {
+		_, err := loadNormalizedYAML(t, "services:\n  foo:\n    image: busybox\n    "+tc.service+"\n")
+		assert.Check(t, errdefs.IsInvalidError(err), tc.service)
+		assert.Check(t, is.ErrorContains(err, tc.expected), tc.service)
+	}
+}
+
+func TestLoadLoggingOptions(t *testing.T) {
+	var warnings []string
+	project, err := loadNormalizedYAML(t, `
+services:
+  foo:
+    image: busybox
+    logging:
+      driver: json-file
+      options:
+        max-size: 10m
+        max-file: 3
+        compress: yes
+        syslog-address: udp://127.0.0.1:514
+  bar:
+    image: busybox
+    logging:
+      driver: fluentd
+      options:
+        fluentd-retry-wait: 1.0
+`, func(options *Options) {
+		options.CheckLoggingOptions = true
+		options.Warn = func(message string) {
+			warnings = append(warnings, message)
+		}
+	})
+	assert.NilError(t, err)
+	foo, err := project.GetService("foo")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, foo.Logging.Options, map[string]string{
+		"max-size":       "10m",
+		"max-file":       "3",
+		"compress":       "yes",
+		"syslog-address": "udp://127.0.0.1:514",
+	})
+	bar, err := project.GetService("bar")
+	assert.NilError(t, err)
+	assert.Equal(t, bar.Logging.Options["fluentd-retry-wait"], "1.0")
+	assert.DeepEqual(t, warnings, []string{`service "foo": logging option "syslog-address" is not supported by the json-file driver`})
+
+	// options are rendered as strings
+	b, err := yaml.Marshal(project)
+	assert.NilError(t, err)
+	assert.Check(t, strings.Contains(string(b), `max-file: "3"`))
+	b, err = json.Marshal(project)
+	assert.NilError(t, err)
+	assert.Check(t, strings.Contains(string(b), `"max-file":"3"`))
+}
+
+func TestLoadSkeletonMode(t *testing.T) {
+	yaml := `
+services:
+  web:
+    image: nginx:${TAG:?TAG must be set}
+    env_file: missing.env
+    ports:
+      - ${PORT:?}:80
+    networks: [missing]
+    labels:
+      com.example.user: ${USER}
+`
+	details := types.ConfigDetails{
+		WorkingDir:  "/code",
+		ConfigFiles: []types.ConfigFile{{Filename: "compose.yaml", Content: []byte(yaml)}},
+		Environment: map[string]string{"USER": "jenny"},
+	}
+	_, err := loadCached(details, func(options *Options) {
+		options.Name = "skeleton"
+	})
+	assert.ErrorContains(t, err, "missing a value")
+
+	project, err := loadCached(details, func(options *Options) {
+		options.Name = "skeleton"
+		options.SkeletonMode = true
+	})
+	assert.NilError(t, err)
+	web, err := project.GetService("web")
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal("", web.Image))
+	assert.Check(t, is.Len(web.Ports, 0))
+	assert.Check(t, is.Len(web.Environment, 0))
+	assert.Check(t, is.Equal("jenny", web.Labels["com.example.user"]))
+	assert.Check(t, is.Len(project.LoadWarnings, 4))
+	assert.Check(t, is.Contains(project.LoadWarnings[0], "services.web.image"))
+	assert.Check(t, is.Contains(project.LoadWarnings[1], "services.web.ports.[]"))
+	assert.Check(t, is.Equal("services.web.env_file: missing.env not read", project.LoadWarnings[2]))
+	// the port left empty can't be converted, ports are left unset
+	assert.Check(t, is.Equal("services.web.ports: No port specified: <empty>", project.LoadWarnings[3]))
+}
+
+func TestLoadRestartAndPullPolicy(t *testing.T) {
+	project, err := loadNormalizedYAML(t, `
+services:
+  never:
+    image: foo
+    restart: no
+    pull_policy: missing
+  on-failure:
+    image: foo
+    restart: on-failure:3
+    pull_policy: build
+`)
+	assert.NilError(t, err)
+	never, err := project.GetService("never")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, never.Restart, &types.ServiceRestart{Condition: types.RestartNo})
+	assert.Equal(t, never.PullPolicy, types.PullPolicyIfNotPresent)
+	onFailure, err := project.GetService("on-failure")
+	assert.NilError(t, err)
+	assert.Equal(t, onFailure.Restart.Condition, types.RestartOnFailure)
+	assert.Equal(t, *onFailure.Restart.MaxRetries, uint64(3))
+
+	marshaled, err := yaml.Marshal(project)
+	assert.NilError(t, err)
+	assert.Check(t, is.Contains(string(marshaled), "restart: \"no\"\n"))
+	assert.Check(t, is.Contains(string(marshaled), "restart: on-failure:3\n"))
+	assert.Check(t, is.Contains(string(marshaled), "pull_policy: if_not_present\n"))
+	b, err := json.Marshal(onFailure)
+	assert.NilError(t, err)
+	assert.Check(t, is.Contains(string(b), `"restart":"on-failure:3"`))
+
+	_, err = loadNormalizedYAML(t, `
+services:
+  foo:
+    image: foo
+    restart: sometimes
+`)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, "must be one of no, always, on-failure[:max-retries] or unless-stopped")
+
+	_, err = loadNormalizedYAML(t, `
+services:
+  foo:
+    image: foo
+    restart: yes
+`)
+	assert.ErrorContains(t, err, "invalid restart policy true")
+}
+
+func TestLoadTmpfsAndStorageOpt(t *testing.T) {
+	project, err := loadNormalizedYAML(t, `
+services:
+  foo:
+    image: foo
+    read_only: true
+    tmpfs: /run:size=64m
+    storage_opt:
+      size: 20G
+`)
+	assert.NilError(t, err)
+	foo := project.Services[0]
+	assert.Check(t, foo.ReadOnly)
+	assert.DeepEqual(t, foo.Tmpfs, types.StringList{"/run:size=64m"})
+	assert.DeepEqual(t, foo.StorageOpt, map[string]string{"size": "20G"})
+
+	_, err = loadNormalizedYAML(t, `
+services:
+  foo:
+    image: foo
+    tmpfs:
+      - /run:size=lots
+`)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `service "foo": invalid tmpfs "/run:size=lots"`)
+}
+
+func TestConflictingMountTargets(t *testing.T) {
+	for _, mounts := range []string{
+		`
+    tmpfs: /tmp
+    volumes:
+      - data:/tmp`,
+		`
+    volumes:
+      - data:/data
+      - ./data:/data/`,
+		`
+    tmpfs:
+      - /run:size=1m
+      - /run/`,
+	} {
+		_, err := loadNormalizedYAML(t, `
+services:
+  foo:
+    image: foo`+mounts+`
+volumes:
+  data: {}
+`)
+		assert.Check(t, errdefs.IsInvalidError(err))
+		assert.ErrorContains(t, err, `service "foo" mounts both`)
+	}
+
+	_, err := loadNormalizedYAML(t, `
+services:
+  foo:
+    image: foo
+    tmpfs: /tmp
+    volumes:
+      - data:/data
+      - ./cache:/data/cache
+volumes:
+  data: {}
+`)
+	assert.NilError(t, err)
 }
 
-func TestUnsupportedProperties(t *testing.T) {
-	dict, err := ParseYAML([]byte(`
-services:
-  web:
-    image: web
-    build:
-     context: ./web
-    links:
-      - bar
-    pid: host
-  db:
-    image: db
-    build:
-     context: ./db
-`))
+func TestLoadManyFiles(t *testing.T) {
+	files := manyConfigFiles(12)
+	files[3].Content = []byte("services:\n  service1:\n    image: override\n")
+	files[11].Content = []byte("services:\n  service2:\n    image: last\n")
+	project, err := loadCached(types.ConfigDetails{WorkingDir: "/code", ConfigFiles: files}, func(options *Options) {
+		options.Name = "many"
+		options.SkipConsistencyCheck = true
+	})
 	assert.NilError(t, err)
+	assert.Check(t, is.Len(project.Services, 100))
+	// files are merged in order, whichever is parsed first
+	service1, err := project.GetService("service1")
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal("registry.example.com/team/service1:latest", service1.Image))
+	service2, err := project.GetService("service2")
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal("last", service2.Image))
 
-	configDetails := buildConfigDetails(dict, nil)
+	files[5].Content = []byte("services: [\n")
+	files[8].Content = []byte("- not a mapping\n")
+	_, err = loadCached(types.ConfigDetails{WorkingDir: "/code", ConfigFiles: files}, func(options *Options) {
+		options.Name = "many"
+	})
+	assert.ErrorContains(t, err, "failed to parse compose5.yaml")
+}
 
-	_, err = Load(configDetails)
+func TestLoadRuntimeFields(t *testing.T) {
+	project, err := loadNormalizedYAML(t, `
+services:
+  foo:
+    image: foo
+    tty: false
+    init: true
+    pids_limit: 100
+    oom_score_adj: -500
+    stop_signal: SIGINT
+    stop_grace_period: 1m
+`)
 	assert.NilError(t, err)
+	foo := project.Services[0]
+	assert.DeepEqual(t, foo.Tty, boolPtr(false))
+	assert.DeepEqual(t, foo.Init, boolPtr(true))
+	assert.Check(t, foo.StdinOpen == nil)
+	assert.Equal(t, foo.PidsLimit, int64(100))
+	assert.Equal(t, foo.OomScoreAdj, int64(-500))
+	assert.DeepEqual(t, foo.StopGracePeriod, durationPtr(time.Minute))
+
+	// unset booleans are omitted while explicitly false ones are kept
+	marshaled, err := yaml.Marshal(foo)
+	assert.NilError(t, err)
+	assert.Check(t, is.Contains(string(marshaled), "tty: false\n"))
+	assert.Check(t, !strings.Contains(string(marshaled), "stdin_open"))
+	b, err := json.Marshal(foo)
+	assert.NilError(t, err)
+	assert.Check(t, is.Contains(string(b), `"tty":false`))
+	assert.Check(t, !strings.Contains(string(b), "stdin_open"))
 }
 
-func TestDiscardEnvFileOption(t *testing.T) {
-	dict, err := ParseYAML([]byte(`services:
-  web:
-    image: nginx
-    env_file:
-     - example1.env
-     - example2.env
-`))
-	expectedEnvironmentMap := types.MappingWithEquals{
-		"FOO": strPtr("foo_from_env_file"),
-		"BAZ": strPtr("baz_from_env_file"),
-		"BAR": strPtr("bar_from_env_file_2"), // Original value is overwritten by example2.env
-		"QUX": strPtr("quz_from_env_file_2"),
+func TestResolveProjectName(t *testing.T) {
+	details := types.ConfigDetails{
+		WorkingDir:  "/code/My App.v2",
+		Environment: map[string]string{},
+	}
+	derive := func(name string, imperativelySet bool) *Options {
+		opts := &Options{DeriveProjectName: true, ForbidOsLookup: true}
+		opts.SetProjectName(name, imperativelySet)
+		return opts
 	}
+
+	name, err := ResolveProjectName(derive("", false), details, "")
 	assert.NilError(t, err)
-	configDetails := buildConfigDetails(dict, nil)
+	assert.Equal(t, name, "myappv2")
 
-	// Default behavior keeps the `env_file` entries
-	configWithEnvFiles, err := Load(configDetails)
+	name, err = ResolveProjectName(derive("fallback", false), details, "")
 	assert.NilError(t, err)
-	assert.DeepEqual(t, configWithEnvFiles.Services[0].EnvFile, types.StringList{"example1.env",
-		"example2.env"})
-	assert.DeepEqual(t, configWithEnvFiles.Services[0].Environment, expectedEnvironmentMap)
+	assert.Equal(t, name, "fallback")
 
-	// Custom behavior removes the `env_file` entries
-	configWithoutEnvFiles, err := Load(configDetails, WithDiscardEnvFiles)
+	name, err = ResolveProjectName(derive("fallback", false), details, "declared")
 	assert.NilError(t, err)
-	assert.DeepEqual(t, configWithoutEnvFiles.Services[0].EnvFile, types.StringList(nil))
-	assert.DeepEqual(t, configWithoutEnvFiles.Services[0].Environment, expectedEnvironmentMap)
+	assert.Equal(t, name, "declared")
+
+	details.Environment["COMPOSE_PROJECT_NAME"] = "from-env"
+	name, err = ResolveProjectName(derive("", false), details, "declared")
+	assert.NilError(t, err)
+	assert.Equal(t, name, "from-env")
+
+	name, err = ResolveProjectName(derive("explicit", true), details, "declared")
+	assert.NilError(t, err)
+	assert.Equal(t, name, "explicit")
+
+	// without DeriveProjectName, neither the environment nor the working directory are used
+	name, err = ResolveProjectName(&Options{}, details, "")
+	assert.NilError(t, err)
+	assert.Equal(t, name, "")
+
+	details.Environment["COMPOSE_PROJECT_NAME"] = "From Env"
+	_, err = ResolveProjectName(derive("", false), details, "declared")
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, "invalid COMPOSE_PROJECT_NAME")
 }
 
-func TestBuildProperties(t *testing.T) {
-	dict, err := ParseYAML([]byte(`
+func TestLoadBlkioConfigAndCPUTimes(t *testing.T) {
+	project, err := loadCached(types.ConfigDetails{
+		WorkingDir:  "/code",
+		Environment: map[string]string{"WEIGHT": "300"},
+		ConfigFiles: []types.ConfigFile{{Filename: "compose.yaml", Content: []byte(`
+services:
+  foo:
+    image: foo
+    cpu_period: 100000
+    cpu_quota: 50ms
+    cpu_rt_period: "1s"
+    cpu_rt_runtime: 950ms
+    blkio_config:
+      weight: ${WEIGHT}
+      weight_device:
+        - path: /dev/sda
+          weight: 400
+      device_read_bps:
+        - path: /dev/sda
+          rate: 12mb
+      device_write_iops:
+        - path: /dev/sdb
+          rate: 30
+`)}},
+	}, func(options *Options) {
+		options.SkipNormalization = true
+	})
+	assert.NilError(t, err)
+	foo := project.Services[0]
+	assert.Equal(t, foo.CPUPeriod, types.Microseconds(100000))
+	assert.Equal(t, foo.CPUQuota, types.Microseconds(50000))
+	assert.Equal(t, foo.CPURTPeriod.Duration(), time.Second)
+	assert.Equal(t, foo.CPURTRuntime, types.Microseconds(950000))
+	assert.DeepEqual(t, foo.BlkioConfig, &types.BlkioConfig{
+		Weight:          300,
+		WeightDevice:    []types.WeightDevice{{Path: "/dev/sda", Weight: 400}},
+		DeviceReadBps:   []types.ThrottleDevice{{Path: "/dev/sda", Rate: 12 * 1024 * 1024}},
+		DeviceWriteIOps: []types.ThrottleDevice{{Path: "/dev/sdb", Rate: 30}},
+	})
+
+	_, err = loadYAML(`
+services:
+  foo:
+    image: foo
+    cpu_quota: 50 parsecs
+`)
+	assert.ErrorContains(t, err, `invalid duration "50 parsecs"`)
+}
+
+func TestLoadUnsetVariableProvenance(t *testing.T) {
+	load := func(content string) ([]string, error) {
+		var warnings []string
+		_, err := loadCached(types.ConfigDetails{
+			WorkingDir:  "/code",
+			Environment: map[string]string{},
+			ConfigFiles: []types.ConfigFile{{Filename: "compose.yaml", Content: []byte(content)}},
+		}, func(options *Options) {
+			options.Warn = func(message string) {
+				warnings = append(warnings, message)
+			}
+		})
+		return warnings, err
+	}
+
+	warnings, err := load(`
+services:
+  web:
+    image: myapp:${TAG}
+    labels:
+      tag: ${TAG}
+      user: ${USER_NAME}
+`)
+	assert.NilError(t, err)
+	sort.Strings(warnings)
+	assert.DeepEqual(t, warnings, []string{
+		`The "TAG" variable is not set. Defaulting to a blank string.`,
+		`The "USER_NAME" variable is not set. Defaulting to a blank string.`,
+	})
+
+	_, err = load(`
+services:
+  web:
+    image: myapp
+    deploy:
+      replicas: ${N}
+`)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `services.web.deploy.replicas: cannot convert "" (from unset variable N) to integer`)
+}
+
+func TestLoadLinks(t *testing.T) {
+	var warnings []string
+	load := func(content string) (*types.Project, error) {
+		warnings = nil
+		return loadCached(types.ConfigDetails{
+			WorkingDir:  "/code",
+			ConfigFiles: []types.ConfigFile{{Filename: "compose.yaml", Content: []byte(content)}},
+		}, func(options *Options) {
+			options.Name = "links"
+			options.Warn = func(message string) {
+				warnings = append(warnings, message)
+			}
+		})
+	}
+	project, err := load(`
 services:
   web:
     image: web
-    build: .
     links:
-      - bar
+      - db:database
+      - cache
+    external_links:
+      - legacy_db_1:legacy
   db:
     image: db
-    build:
-     context: ./db
-`))
+  cache:
+    image: redis
+`)
 	assert.NilError(t, err)
-	configDetails := buildConfigDetails(dict, nil)
-	_, err = Load(configDetails)
+	web, err := project.GetService("web")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, web.Links, []types.ServiceLink{{Service: "db", Alias: "database"}, {Service: "cache"}})
+	assert.DeepEqual(t, web.ExternalLinks, []types.ServiceLink{{Service: "legacy_db_1", Alias: "legacy"}})
+	assert.DeepEqual(t, warnings, []string{`service "web": links are deprecated, services reach each other by name on the networks they share`})
+
+	// links are started along with the services linking to them
+	var started []string
+	err = project.WithServices([]string{"web"}, func(service types.ServiceConfig) error {
+		started = append(started, service.Name)
+		return nil
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, started, []string{"cache", "db", "web"})
+
+	marshaled, err := yaml.Marshal(web)
+	assert.NilError(t, err)
+	assert.Check(t, is.Contains(string(marshaled), "\nlinks:\n- db:database\n- cache\n"))
+	assert.Check(t, is.Contains(string(marshaled), "external_links:\n- legacy_db_1:legacy\n"))
+	b, err := json.Marshal(web)
+	assert.NilError(t, err)
+	assert.Check(t, is.Contains(string(b), `"links":["db:database","cache"]`))
+
+	_, err = load(`
+services:
+  web:
+    image: web
+    links:
+      - db
+`)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `compose.yaml:6:9: service "web" links to undefined service db`)
+}
+
+func TestLoadVolumesFrom(t *testing.T) {
+	var warnings []string
+	project, err := loadCached(types.ConfigDetails{
+		WorkingDir: "/code",
+		ConfigFiles: []types.ConfigFile{{Filename: "compose.yaml", Content: []byte(`
+services:
+  app:
+    image: app
+    volumes_from:
+      - data:ro
+      - container:legacy_data
+  data:
+    image: data
+    volumes:
+      - shared:/data
+volumes:
+  shared: {}
+`)}},
+	}, func(options *Options) {
+		options.Name = "volumes-from"
+		options.Warn = func(message string) {
+			warnings = append(warnings, message)
+		}
+	})
+	assert.NilError(t, err)
+	app, err := project.GetService("app")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, app.VolumesFrom, []types.VolumesFromSource{
+		{Kind: types.VolumesFromService, Name: "data", ReadOnly: true},
+		{Kind: types.VolumesFromContainer, Name: "legacy_data"},
+	})
+	assert.DeepEqual(t, app.GetDependencies(), []string{"data"})
+	assert.DeepEqual(t, warnings, []string{`service "app": volumes_from is deprecated, declare the volumes shared by services as named volumes`})
+
+	marshaled, err := yaml.Marshal(app)
+	assert.NilError(t, err)
+	assert.Check(t, is.Contains(string(marshaled), "volumes_from:\n- data:ro\n- container:legacy_data\n"))
+
+	assert.NilError(t, project.ResolveVolumesFrom())
+	app, err = project.GetService("app")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, app.Volumes, []types.ServiceVolumeConfig{
+		{Type: types.VolumeTypeVolume, Source: "shared", Target: "/data", ReadOnly: true},
+	})
+
+	_, err = loadYAML(`
+services:
+  app:
+    image: app
+    volumes_from:
+      - data:rwx
+`)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `invalid volumes_from "data:rwx", mode "rwx" must be ro or rw`)
+}
+
+func TestLoadExposeAndAttach(t *testing.T) {
+	project, err := loadNormalizedYAML(t, `
+services:
+  foo:
+    image: foo
+    attach: false
+    expose:
+      - 3000
+      - "8000-8010"
+      - 9000/udp
+`)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.Services[0].Expose, types.StringOrNumberList{"3000", "8000-8010", "9000/udp"})
+	assert.DeepEqual(t, project.Services[0].Attach, boolPtr(false))
+
+	// models decoded from JSON hold numbers as floats
+	project, err = LoadFromModel(types.ConfigDetails{WorkingDir: "/code"}, map[string]interface{}{
+		"services": map[string]interface{}{
+			"foo": map[string]interface{}{"image": "foo", "expose": []interface{}{float64(3000), float64(65535)}},
+		},
+	}, func(options *Options) {
+		options.Name = "expose"
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.Services[0].Expose, types.StringOrNumberList{"3000", "65535"})
+	assert.Check(t, project.Services[0].Attach == nil)
+
+	_, err = loadNormalizedYAML(t, `
+services:
+  foo:
+    image: foo
+    expose:
+      - "127.0.0.1:3000"
+`)
+	assert.ErrorContains(t, err, `service "foo" exposes "127.0.0.1:3000" with a host part`)
+}
+
+func TestProjectRoundTrip(t *testing.T) {
+	homeDir, err := os.UserHomeDir()
 	assert.NilError(t, err)
+	env := map[string]string{"HOME": homeDir, "QUX": "qux_from_environment"}
+
+	for _, fixture := range []string{
+		"full-example.yml",
+		"testdata/compose-test-anchors.yaml",
+		"testdata/compose-test-extends.yaml",
+		"testdata/compose-test-profiles.yaml",
+		"testdata/compose-test-roundtrip.yaml",
+		"testdata/compose-test-with-version.yaml",
+	} {
+		t.Run(fixture, func(t *testing.T) {
+			content, err := ioutil.ReadFile(fixture)
+			assert.NilError(t, err)
+			workingDir, err := filepath.Abs(filepath.Dir(fixture))
+			assert.NilError(t, err)
+			named := func(options *Options) {
+				options.SetProjectName("roundtrip", true)
+				// the full example links to services it doesn't declare
+				options.SkipConsistencyCheck = true
+			}
+			project, err := loadCached(types.ConfigDetails{
+				WorkingDir:  workingDir,
+				ConfigFiles: []types.ConfigFile{{Filename: filepath.Join(workingDir, filepath.Base(fixture)), Content: content}},
+				Environment: env,
+			}, named)
+			assert.NilError(t, err)
+			project.ApplyProfiles([]string{"debug"})
+
+			details, err := project.ToConfigDetails()
+			assert.NilError(t, err)
+			reloaded, err := loadCached(details, named)
+			assert.NilError(t, err)
+			reloaded.ApplyProfiles([]string{"debug"})
+
+			project.ComposeFiles = nil
+			reloaded.ComposeFiles = nil
+			assert.DeepEqual(t, project, reloaded)
+		})
+	}
 }
 
 func TestDeprecatedProperties(t *testing.T) {
@@ -770,7 +2768,7 @@ services:
 
 	configDetails := buildConfigDetails(dict, nil)
 
-	_, err = Load(configDetails)
+	_, err = loadCached(configDetails)
 	assert.NilError(t, err)
 }
 
@@ -847,6 +2845,10 @@ func uint64Ptr(value uint64) *uint64 {
 	return &value
 }
 
+func boolPtr(value bool) *bool {
+	return &value
+}
+
 func uint32Ptr(value uint32) *uint32 {
 	return &value
 }
@@ -900,6 +2902,72 @@ services:
 	assert.Check(t, is.DeepEqual(expected, config.Services[0].Volumes[0]))
 }
 
+func TestLoadVolumeLongSyntaxOptions(t *testing.T) {
+	config, err := loadYAML(`
+services:
+  web:
+    image: nginx:latest
+    volumes:
+      - type: tmpfs
+        target: /app
+        tmpfs:
+          size: 10000
+          mode: 01777
+      - type: bind
+        source: /data
+        target: /data
+        bind:
+          propagation: rshared
+          create_host_path: true
+          selinux: Z
+      - type: volume
+        source: cache
+        target: /cache
+        volume:
+          nocopy: true
+volumes:
+  cache: {}
+`)
+	assert.NilError(t, err)
+
+	expected := []types.ServiceVolumeConfig{
+		{
+			Target: "/app",
+			Type:   "tmpfs",
+			Tmpfs:  &types.ServiceVolumeTmpfs{Size: int64(10000), Mode: 01777},
+		},
+		{
+			Source: "/data",
+			Target: "/data",
+			Type:   "bind",
+			Bind:   &types.ServiceVolumeBind{Propagation: "rshared", CreateHostPath: true, SELinux: "Z"},
+		},
+		{
+			Source: "cache",
+			Target: "/cache",
+			Type:   "volume",
+			Volume: &types.ServiceVolumeVolume{NoCopy: true},
+		},
+	}
+	assert.Assert(t, is.Len(config.Services, 1))
+	assert.Check(t, is.DeepEqual(expected, config.Services[0].Volumes))
+}
+
+func TestLoadVolumeInvalidSELinux(t *testing.T) {
+	_, err := loadYAML(`
+services:
+  web:
+    image: nginx:latest
+    volumes:
+      - type: bind
+        source: /data
+        target: /data
+        bind:
+          selinux: shared
+`)
+	assert.ErrorContains(t, err, "services.web.volumes.0.bind.selinux must be one of the following")
+}
+
 func TestLoadTmpfsVolumeAdditionalPropertyNotAllowed(t *testing.T) {
 	_, err := loadYAML(`
 services:
@@ -1198,6 +3266,67 @@ services:
 	assert.Check(t, is.DeepEqual(expected, config.Services[0].ExtraHosts))
 }
 
+func TestLoadExtraHostsMultipleIPs(t *testing.T) {
+	config, err := loadYAML(`
+services:
+  web:
+    image: busybox
+    extra_hosts:
+      zulu:
+        - "162.242.195.82"
+        - "[ff02::1]"
+      alpha: "50.31.209.229"
+    build:
+      context: .
+      extra_hosts:
+        - "alpha=50.31.209.229"
+        - "alpha:50.31.209.229"
+`)
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(types.HostsList{
+		"alpha:50.31.209.229",
+		"zulu:162.242.195.82",
+		"zulu:ff02::1",
+	}, config.Services[0].ExtraHosts))
+	assert.Check(t, is.DeepEqual(types.HostsList{"alpha:50.31.209.229"}, config.Services[0].Build.ExtraHosts))
+
+	_, err = loadYAML(`
+services:
+  web:
+    image: busybox
+    extra_hosts:
+      - "zulu:not-an-ip"
+`)
+	assert.ErrorContains(t, err, `"not-an-ip" is not a valid IP address`)
+}
+
+func TestLoadDNSStringOrList(t *testing.T) {
+	config, err := loadYAML(`
+services:
+  scalar:
+    image: busybox
+    dns: 8.8.8.8
+    dns_search: example.com
+    dns_opt: use-vc
+  list:
+    image: busybox
+    dns: [8.8.8.8, 1.1.1.1]
+    dns_search: [example.com, example.org]
+    dns_opt: [use-vc, no-tld-query]
+`)
+	assert.NilError(t, err)
+	scalar, err := config.GetService("scalar")
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(types.StringList{"8.8.8.8"}, scalar.DNS))
+	assert.Check(t, is.DeepEqual(types.StringList{"example.com"}, scalar.DNSSearch))
+	assert.Check(t, is.DeepEqual(types.StringList{"use-vc"}, scalar.DNSOpts))
+	list, err := config.GetService("list")
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(types.StringList{"8.8.8.8", "1.1.1.1"}, list.DNS))
+	assert.Check(t, is.DeepEqual(types.StringList{"example.com", "example.org"}, list.DNSSearch))
+	assert.Check(t, is.DeepEqual(types.StringList{"use-vc", "no-tld-query"}, list.DNSOpts))
+}
+
 func TestLoadVolumesWarnOnDeprecatedExternalNameVersion34(t *testing.T) {
 	buf, cleanup := patchLogrus()
 	defer cleanup()
@@ -1268,6 +3397,88 @@ configs:
 	assert.Check(t, is.Equal("invalid", actual.Services[0].Isolation))
 }
 
+func TestLoadSecretsAndConfigsDrivers(t *testing.T) {
+	var warnings []string
+	project, err := loadCached(buildConfigDetails(map[string]interface{}{
+		"services": map[string]interface{}{"web": map[string]interface{}{"image": "nginx"}},
+		"secrets": map[string]interface{}{
+			"vault": map[string]interface{}{
+				"driver":          "vault",
+				"driver_opts":     map[string]interface{}{"path": "secret/web", "version": 2},
+				"template_driver": "golang",
+			},
+			"legacy": map[string]interface{}{
+				"external": map[string]interface{}{"name": "legacy_name"},
+			},
+		},
+		"configs": map[string]interface{}{
+			"nginx": map[string]interface{}{
+				"driver":          "remote",
+				"driver_opts":     map[string]interface{}{"url": "https://example.com/nginx.conf"},
+				"template_driver": "golang",
+			},
+		},
+	}, nil), func(options *Options) {
+		options.SetProjectName("app", true)
+		options.Warn = func(message string) {
+			warnings = append(warnings, message)
+		}
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.Secrets["vault"], types.SecretConfig{
+		Name:           "app_vault",
+		Driver:         "vault",
+		DriverOpts:     map[string]string{"path": "secret/web", "version": "2"},
+		TemplateDriver: "golang",
+	})
+	assert.DeepEqual(t, project.Configs["nginx"], types.ConfigObjConfig{
+		Name:           "app_nginx",
+		Driver:         "remote",
+		DriverOpts:     map[string]string{"url": "https://example.com/nginx.conf"},
+		TemplateDriver: "golang",
+	})
+	assert.DeepEqual(t, project.Secrets["legacy"], types.SecretConfig{
+		Name:     "legacy_name",
+		External: types.External{External: true},
+	})
+	assert.Check(t, is.Contains(warnings, "secret legacy: secret.external.name is deprecated in favor of secret.name"))
+
+	out, err := yaml.Marshal(project.Secrets["legacy"])
+	assert.NilError(t, err)
+	assert.Equal(t, string(out), "name: legacy_name\nexternal: true\n")
+}
+
+func TestLoadFileObjectExclusiveSources(t *testing.T) {
+	for _, tc := range []struct {
+		section string
+		config  map[string]interface{}
+		err     string
+	}{
+		{
+			section: "secrets",
+			config:  map[string]interface{}{"file": "./secret.txt", "environment": "SECRET"},
+			err:     `secret "data": file and environment are mutually exclusive, only set one of them`,
+		},
+		{
+			section: "secrets",
+			config:  map[string]interface{}{"environment": "SECRET", "external": true},
+			err:     `secret "data": environment and external are mutually exclusive, only set one of them`,
+		},
+		{
+			section: "configs",
+			config:  map[string]interface{}{"file": "./config.txt", "external": true},
+			err:     `config "data": file and external are mutually exclusive, only set one of them`,
+		},
+	} {
+		_, err := loadCached(buildConfigDetails(map[string]interface{}{
+			"services": map[string]interface{}{"web": map[string]interface{}{"image": "nginx"}},
+			tc.section: map[string]interface{}{"data": tc.config},
+		}, nil))
+		assert.Check(t, errdefs.IsInvalidError(err))
+		assert.ErrorContains(t, err, tc.err)
+	}
+}
+
 func TestLoadSecretInvalidExternalNameAndNameCombination(t *testing.T) {
 	_, err := loadYAML(`
 secrets:
@@ -1681,7 +3892,7 @@ func TestLoadWithExtends(t *testing.T) {
 		},
 	}
 
-	actual, err := Load(configDetails)
+	actual, err := loadCached(configDetails)
 	assert.NilError(t, err)
 
 	expServices := types.Services{
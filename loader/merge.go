@@ -17,9 +17,12 @@
 package loader
 
 import (
+	"path"
 	"reflect"
 	"sort"
+	"strings"
 
+	"github.com/compose-spec/compose-go/errdefs"
 	"github.com/compose-spec/compose-go/types"
 	"github.com/imdario/mergo"
 	"github.com/pkg/errors"
@@ -38,6 +41,15 @@ var serviceSpecials = &specials{
 		reflect.TypeOf([]types.ServiceConfigObjConfig{}): mergeSlice(toServiceConfigObjConfigsMap, toSServiceConfigObjConfigsSlice),
 		reflect.TypeOf(&types.UlimitsConfig{}):           mergeUlimitsConfig,
 		reflect.TypeOf(&types.ServiceNetworkConfig{}):    mergeServiceNetworkConfig,
+		reflect.TypeOf(types.SSHConfig{}):                mergeSlice(toSSHConfigMap, toSSHConfigSlice),
+		reflect.TypeOf(types.HostsList{}):                mergeExtraHosts,
+		reflect.TypeOf([]types.ServiceDeviceConfig{}):    mergeSlice(toServiceDeviceConfigsMap, toServiceDeviceConfigsSlice),
+		reflect.TypeOf([]types.ServiceVolumeConfig{}):    mergeServiceVolumes,
+		reflect.TypeOf([]types.WeightDevice{}):           mergeSlice(toWeightDevicesMap, toWeightDevicesSlice),
+		reflect.TypeOf([]types.ThrottleDevice{}):         mergeSlice(toThrottleDevicesMap, toThrottleDevicesSlice),
+		reflect.TypeOf([]types.VolumesFromSource{}):      mergeSlice(toVolumesFromMap, toVolumesFromSlice),
+		reflect.TypeOf(&types.ServiceRestart{}):          mergeServiceRestart,
+		reflect.TypeOf(new(bool)):                        mergeBoolPointer,
 	},
 }
 
@@ -48,9 +60,25 @@ func (s *specials) Transformer(t reflect.Type) func(dst, src reflect.Value) erro
 	return nil
 }
 
-func merge(configs []*types.Config) (*types.Config, error) {
+// merge merges configs in order. tags are the `!reset` and `!override` tags set by each config, if any
+func merge(configs []*types.Config, tags []map[string]string) (*types.Config, error) {
 	base := configs[0]
-	for _, override := range configs[1:] {
+	origins := map[string]string{}
+	recordOrigins(origins, base)
+	for i, override := range configs[1:] {
+		if i+1 < len(tags) {
+			applyMergeTags(base, override, tags[i+1])
+		}
+		if err := checkConflicts(base, override, origins); err != nil {
+			return base, err
+		}
+		recordOrigins(origins, override)
+		if override.Name != "" {
+			base.Name = override.Name
+		}
+		if override.Version != "" {
+			base.Version = override.Version
+		}
 		var err error
 		base.Services, err = mergeServices(base.Services, override.Services)
 		if err != nil {
@@ -76,6 +104,159 @@ func merge(configs []*types.Config) (*types.Config, error) {
 	return base, nil
 }
 
+// applyMergeTags clears the attributes tagged by override from base, so that those are replaced rather than merged.
+// Attributes tagged with `!reset` are also cleared from override
+func applyMergeTags(base, override *types.Config, tags map[string]string) {
+	for _, path := range sortedKeys(tags) {
+		segments := strings.Split(path, ".")
+		clearAttribute(reflect.ValueOf(base).Elem(), segments)
+		if tags[path] == resetTag {
+			clearAttribute(reflect.ValueOf(override).Elem(), segments)
+		}
+	}
+}
+
+// clearAttribute clears the attribute of v at path, made of the attribute names as declared in compose files.
+// Struct fields are reset to their zero value, while map entries and services are removed
+func clearAttribute(v reflect.Value, path []string) {
+	if len(path) == 0 {
+		v.Set(reflect.Zero(v.Type()))
+		return
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			clearAttribute(v.Elem(), path)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if attributeName(v.Type().Field(i)) == path[0] {
+				clearAttribute(v.Field(i), path[1:])
+				return
+			}
+		}
+	case reflect.Slice:
+		// services are the only sequence of the model indexed by name
+		for i := 0; i < v.Len(); i++ {
+			item := v.Index(i)
+			if item.Kind() != reflect.Struct {
+				return
+			}
+			if name := item.FieldByName("Name"); !name.IsValid() || name.String() != path[0] {
+				continue
+			}
+			if len(path) == 1 {
+				v.Set(reflect.AppendSlice(v.Slice(0, i), v.Slice(i+1, v.Len())))
+			} else {
+				clearAttribute(item, path[1:])
+			}
+			return
+		}
+	case reflect.Map:
+		if v.IsNil() || v.Type().Key().Kind() != reflect.String {
+			return
+		}
+		// keys like labels can contain dots, the longest matching one is used
+		for n := len(path); n > 0; n-- {
+			key := reflect.ValueOf(strings.Join(path[:n], ".")).Convert(v.Type().Key())
+			value := v.MapIndex(key)
+			if !value.IsValid() {
+				continue
+			}
+			if n == len(path) {
+				v.SetMapIndex(key, reflect.Value{})
+				return
+			}
+			item := reflect.New(value.Type()).Elem()
+			item.Set(value)
+			clearAttribute(item, path[n:])
+			v.SetMapIndex(key, item)
+			return
+		}
+	}
+}
+
+// attributeName is the name of the compose attribute a struct field is loaded from
+func attributeName(field reflect.StructField) string {
+	if name := strings.Split(field.Tag.Get("mapstructure"), ",")[0]; name != "" {
+		return name
+	}
+	return strings.Split(field.Tag.Get("json"), ",")[0]
+}
+
+// recordOrigins records the file which declared each top-level resource last, indexed by `<section>.<name>`
+func recordOrigins(origins map[string]string, config *types.Config) {
+	for name := range config.Volumes {
+		origins["volumes."+name] = config.Filename
+	}
+	for name := range config.Networks {
+		origins["networks."+name] = config.Filename
+	}
+	for name := range config.Secrets {
+		origins["secrets."+name] = config.Filename
+	}
+	for name := range config.Configs {
+		origins["configs."+name] = config.Filename
+	}
+}
+
+// checkConflicts checks resources declared by both base and override are compatible. Those can't be external in
+// only one of the files, and can't use different drivers. Services aren't checked, as overriding any attribute,
+// like replacing `image` by `build`, is a legitimate use of an override file
+func checkConflicts(base, override *types.Config, origins map[string]string) error {
+	conflict := func(kind, section, name, attribute string, baseValue, overrideValue interface{}) error {
+		return errors.Wrapf(errdefs.ErrInvalid, "%s %q is declared with conflicting %s by %s (%v) and %s (%v)",
+			kind, name, attribute, origins[section+"."+name], baseValue, override.Filename, overrideValue)
+	}
+	for _, name := range sortedKeys(override.Volumes) {
+		b, ok := base.Volumes[name]
+		if !ok {
+			continue
+		}
+		o := override.Volumes[name]
+		if b.External.External != o.External.External {
+			return conflict("volume", "volumes", name, "external", b.External.External, o.External.External)
+		}
+		if b.Driver != "" && o.Driver != "" && b.Driver != o.Driver {
+			return conflict("volume", "volumes", name, "driver", b.Driver, o.Driver)
+		}
+	}
+	for _, name := range sortedKeys(override.Networks) {
+		b, ok := base.Networks[name]
+		if !ok {
+			continue
+		}
+		o := override.Networks[name]
+		if b.External.External != o.External.External {
+			return conflict("network", "networks", name, "external", b.External.External, o.External.External)
+		}
+		if b.Driver != "" && o.Driver != "" && b.Driver != o.Driver {
+			return conflict("network", "networks", name, "driver", b.Driver, o.Driver)
+		}
+	}
+	for _, name := range sortedKeys(override.Secrets) {
+		if b, ok := base.Secrets[name]; ok && b.External.External != override.Secrets[name].External.External {
+			return conflict("secret", "secrets", name, "external", b.External.External, override.Secrets[name].External.External)
+		}
+	}
+	for _, name := range sortedKeys(override.Configs) {
+		if b, ok := base.Configs[name]; ok && b.External.External != override.Configs[name].External.External {
+			return conflict("config", "configs", name, "external", b.External.External, override.Configs[name].External.External)
+		}
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of a map indexed by string, sorted
+func sortedKeys(m interface{}) []string {
+	keys := []string{}
+	for _, k := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, k.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func mergeServices(base, override []types.ServiceConfig) ([]types.ServiceConfig, error) {
 	baseServices := mapByName(base)
 	overrideServices := mapByName(override)
@@ -85,6 +266,13 @@ func mergeServices(base, override []types.ServiceConfig) ([]types.ServiceConfig,
 			if err := mergo.Merge(&baseService, &overrideService, mergo.WithAppendSlice, mergo.WithOverride, mergo.WithTransformers(serviceSpecials)); err != nil {
 				return base, errors.Wrapf(err, "cannot merge service %s", name)
 			}
+			mergeShellCommands(&baseService, &overrideService)
+			mergeScale(&baseService, &overrideService)
+			mergeResources(&baseService, &overrideService)
+			mergeWatch(&baseService, &overrideService)
+			mergeEnvironment(&baseService, &overrideService)
+			mergeCapabilities(&baseService)
+			mergeProfiles(&baseService, &overrideService)
 			baseServices[name] = baseService
 			continue
 		}
@@ -98,6 +286,139 @@ func mergeServices(base, override []types.ServiceConfig) ([]types.ServiceConfig,
 	return services, nil
 }
 
+// mergeShellCommands replaces commands by the overriding ones. mergo would append those and ignore an explicitly
+// empty command, which is expected to clear the base one
+func mergeShellCommands(dst, src *types.ServiceConfig) {
+	if src.Command != nil {
+		dst.Command = src.Command
+	}
+	if src.Entrypoint != nil {
+		dst.Entrypoint = src.Entrypoint
+	}
+}
+
+// mergeScale makes the number of replicas set by the override win over the base one, whichever of `scale` and
+// `deploy.replicas` they use
+func mergeScale(dst, src *types.ServiceConfig) {
+	srcReplicas := src.Deploy != nil && src.Deploy.Replicas != nil
+	if srcReplicas {
+		// mergo ignores an override with 0 replicas
+		dst.Deploy.Replicas = src.Deploy.Replicas
+	}
+	switch {
+	case srcReplicas && src.Scale == 0:
+		dst.Scale = 0
+	case src.Scale != 0 && !srcReplicas && dst.Deploy != nil:
+		dst.Deploy.Replicas = nil
+	}
+}
+
+// mergeResources makes the resources set by the override win over the base ones, whichever of the legacy `cpus`,
+// `mem_limit` and `mem_reservation` attributes and `deploy.resources` they use, like mergeScale does for replicas
+func mergeResources(dst, src *types.ServiceConfig) {
+	var srcLimits, srcReservations types.Resource
+	if src.Deploy != nil && src.Deploy.Resources.Limits != nil {
+		srcLimits = *src.Deploy.Resources.Limits
+	}
+	if src.Deploy != nil && src.Deploy.Resources.Reservations != nil {
+		srcReservations = *src.Deploy.Resources.Reservations
+	}
+	if srcLimits.NanoCPUs != "" && src.CPUS == 0 {
+		dst.CPUS = 0
+	}
+	if srcLimits.MemoryBytes != 0 && src.MemLimit == 0 {
+		dst.MemLimit = 0
+	}
+	if srcReservations.MemoryBytes != 0 && src.MemReservation == 0 {
+		dst.MemReservation = 0
+	}
+	if dst.Deploy == nil {
+		return
+	}
+	if limits := dst.Deploy.Resources.Limits; limits != nil {
+		if src.CPUS != 0 && srcLimits.NanoCPUs == "" {
+			limits.NanoCPUs = ""
+		}
+		if src.MemLimit != 0 && srcLimits.MemoryBytes == 0 {
+			limits.MemoryBytes = 0
+		}
+	}
+	if reservations := dst.Deploy.Resources.Reservations; reservations != nil {
+		if src.MemReservation != 0 && srcReservations.MemoryBytes == 0 {
+			reservations.MemoryBytes = 0
+		}
+	}
+}
+
+// mergeWatch replaces the paths watched by the base service by the overriding ones. Merging triggers one by one
+// would make it impossible for an override to stop watching a path
+func mergeWatch(dst, src *types.ServiceConfig) {
+	if src.Develop != nil && src.Develop.Watch != nil {
+		dst.Develop.Watch = src.Develop.Watch
+	}
+}
+
+// mergeEnvironment applies the values explicitly set by the override to the environment and build args. mergo
+// ignores values set to an empty string, while keys listed without a value must not clear the base one
+func mergeEnvironment(dst, src *types.ServiceConfig) {
+	overrideSet(dst.Environment, src.Environment)
+	if dst.Build != nil && src.Build != nil {
+		overrideSet(dst.Build.Args, src.Build.Args)
+	}
+}
+
+// mergeServiceRestart replaces the restart policy by the overriding one, as merging them would keep the maximum
+// number of retries of a base `on-failure` policy
+func mergeServiceRestart(dst, src reflect.Value) error {
+	if !src.IsNil() {
+		dst.Set(src)
+	}
+	return nil
+}
+
+// mergeBoolPointer makes a boolean explicitly set by the override win over the base one. mergo ignores overriding
+// values set to false
+func mergeBoolPointer(dst, src reflect.Value) error {
+	if !src.IsNil() {
+		dst.Set(src)
+	}
+	return nil
+}
+
+// mergeCapabilities dedupes the capabilities mergo appended from the base and override services
+func mergeCapabilities(dst *types.ServiceConfig) {
+	dst.CapAdd = types.NormalizeCapabilities(dst.CapAdd)
+	dst.CapDrop = types.NormalizeCapabilities(dst.CapDrop)
+}
+
+// mergeProfiles dedupes the profiles mergo appended from the base and override services, keeping an explicitly empty
+// list of profiles, which mergo ignores, as it doesn't tell the same as unset profiles
+func mergeProfiles(dst, src *types.ServiceConfig) {
+	if dst.Profiles == nil {
+		if src.Profiles != nil {
+			dst.Profiles = []string{}
+		}
+		return
+	}
+	seen := map[string]bool{}
+	profiles := []string{}
+	for _, profile := range dst.Profiles {
+		if !seen[profile] {
+			seen[profile] = true
+			profiles = append(profiles, profile)
+		}
+	}
+	dst.Profiles = profiles
+}
+
+func overrideSet(dst, src types.MappingWithEquals) {
+	for k, v := range src {
+		if v != nil {
+			dst[k] = v
+		}
+	}
+}
+
 func toServiceSecretConfigsMap(s interface{}) (map[interface{}]interface{}, error) {
 	secrets, ok := s.([]types.ServiceSecretConfig)
 	if !ok {
@@ -134,6 +455,116 @@ func toServicePortConfigsMap(s interface{}) (map[interface{}]interface{}, error)
 	return m, nil
 }
 
+func toServiceDeviceConfigsMap(s interface{}) (map[interface{}]interface{}, error) {
+	devices, ok := s.([]types.ServiceDeviceConfig)
+	if !ok {
+		return nil, errors.Errorf("not a serviceDeviceConfig slice: %v", s)
+	}
+	m := map[interface{}]interface{}{}
+	for _, device := range devices {
+		m[device.Target] = device
+	}
+	return m, nil
+}
+
+func toServiceDeviceConfigsSlice(dst reflect.Value, m map[interface{}]interface{}) error {
+	s := []types.ServiceDeviceConfig{}
+	for _, v := range m {
+		s = append(s, v.(types.ServiceDeviceConfig))
+	}
+	sort.Slice(s, func(i, j int) bool { return s[i].Target < s[j].Target })
+	dst.Set(reflect.ValueOf(s))
+	return nil
+}
+
+func toWeightDevicesMap(s interface{}) (map[interface{}]interface{}, error) {
+	devices, ok := s.([]types.WeightDevice)
+	if !ok {
+		return nil, errors.Errorf("not a weightDevice slice: %v", s)
+	}
+	m := map[interface{}]interface{}{}
+	for _, device := range devices {
+		m[device.Path] = device
+	}
+	return m, nil
+}
+
+func toWeightDevicesSlice(dst reflect.Value, m map[interface{}]interface{}) error {
+	s := []types.WeightDevice{}
+	for _, v := range m {
+		s = append(s, v.(types.WeightDevice))
+	}
+	sort.Slice(s, func(i, j int) bool { return s[i].Path < s[j].Path })
+	dst.Set(reflect.ValueOf(s))
+	return nil
+}
+
+func toVolumesFromMap(s interface{}) (map[interface{}]interface{}, error) {
+	sources, ok := s.([]types.VolumesFromSource)
+	if !ok {
+		return nil, errors.Errorf("not a volumesFromSource slice: %v", s)
+	}
+	m := map[interface{}]interface{}{}
+	for _, source := range sources {
+		m[source.Kind+":"+source.Name] = source
+	}
+	return m, nil
+}
+
+func toVolumesFromSlice(dst reflect.Value, m map[interface{}]interface{}) error {
+	s := []types.VolumesFromSource{}
+	for _, v := range m {
+		s = append(s, v.(types.VolumesFromSource))
+	}
+	sort.Slice(s, func(i, j int) bool { return s[i].Kind+":"+s[i].Name < s[j].Kind+":"+s[j].Name })
+	dst.Set(reflect.ValueOf(s))
+	return nil
+}
+
+func toThrottleDevicesMap(s interface{}) (map[interface{}]interface{}, error) {
+	devices, ok := s.([]types.ThrottleDevice)
+	if !ok {
+		return nil, errors.Errorf("not a throttleDevice slice: %v", s)
+	}
+	m := map[interface{}]interface{}{}
+	for _, device := range devices {
+		m[device.Path] = device
+	}
+	return m, nil
+}
+
+func toThrottleDevicesSlice(dst reflect.Value, m map[interface{}]interface{}) error {
+	s := []types.ThrottleDevice{}
+	for _, v := range m {
+		s = append(s, v.(types.ThrottleDevice))
+	}
+	sort.Slice(s, func(i, j int) bool { return s[i].Path < s[j].Path })
+	dst.Set(reflect.ValueOf(s))
+	return nil
+}
+
+func toSSHConfigMap(s interface{}) (map[interface{}]interface{}, error) {
+	keys, ok := s.(types.SSHConfig)
+	if !ok {
+		return nil, errors.Errorf("not a sshConfig: %v", s)
+	}
+	m := map[interface{}]interface{}{}
+	for _, key := range keys {
+		m[key.ID] = key
+	}
+	return m, nil
+}
+
+func toSSHConfigSlice(dst reflect.Value, m map[interface{}]interface{}) error {
+	s := types.SSHConfig{}
+	for _, v := range m {
+		s = append(s, v.(types.SSHKey))
+	}
+	sort.Slice(s, func(i, j int) bool { return s[i].ID < s[j].ID })
+	dst.Set(reflect.ValueOf(s))
+	return nil
+}
+
 func toServiceSecretConfigsSlice(dst reflect.Value, m map[interface{}]interface{}) error {
 	s := []types.ServiceSecretConfig{}
 	for _, v := range m {
@@ -159,7 +590,13 @@ func toServicePortConfigsSlice(dst reflect.Value, m map[interface{}]interface{})
 	for _, v := range m {
 		s = append(s, v.(types.ServicePortConfig))
 	}
-	sort.Slice(s, func(i, j int) bool { return s[i].Published < s[j].Published })
+	sort.Slice(s, func(i, j int) bool {
+		if len(s[i].Published) != len(s[j].Published) {
+			// shorter numbers first, so that ports are sorted numerically
+			return len(s[i].Published) < len(s[j].Published)
+		}
+		return s[i].Published < s[j].Published
+	})
 	dst.Set(reflect.ValueOf(s))
 	return nil
 }
@@ -239,10 +676,74 @@ func mergeServiceNetworkConfig(dst, src reflect.Value) error {
 		if ipv6 := src.Elem().FieldByName("Ipv6Address").Interface().(string); ipv6 != "" {
 			dst.Elem().FieldByName("Ipv6Address").SetString(ipv6)
 		}
+		if ips := src.Elem().FieldByName("LinkLocalIPs"); ips.Len() > 0 {
+			dst.Elem().FieldByName("LinkLocalIPs").Set(ips)
+		}
+		if priority := src.Elem().FieldByName("Priority").Int(); priority != 0 {
+			dst.Elem().FieldByName("Priority").SetInt(priority)
+		}
 	}
 	return nil
 }
 
+// mergeExtraHosts unions extra hosts, which can't map a host to distinct IPs in base and override
+func mergeExtraHosts(dst, src reflect.Value) error {
+	base, override := dst.Interface().(types.HostsList), src.Interface().(types.HostsList)
+	if len(override) == 0 {
+		return nil
+	}
+	baseHosts, overrideHosts := base.Hosts(), override.Hosts()
+	for _, host := range sortedKeys(overrideHosts) {
+		ips, ok := baseHosts[host]
+		if ok && !sameValues(ips, overrideHosts[host]) {
+			return errors.Wrapf(errdefs.ErrInvalid, "extra host %q is mapped to conflicting IPs %s and %s", host, strings.Join(ips, ","), strings.Join(overrideHosts[host], ","))
+		}
+	}
+	merged, err := types.NewHostsList(append(append([]string{}, base...), override...))
+	if err != nil {
+		return err
+	}
+	dst.Set(reflect.ValueOf(merged))
+	return nil
+}
+
+// mergeServiceVolumes merges volumes by target, the overriding volumes replacing the base ones mounted to the same
+// path. The order of the base volumes is kept, new volumes being appended
+func mergeServiceVolumes(dst, src reflect.Value) error {
+	base, override := dst.Interface().([]types.ServiceVolumeConfig), src.Interface().([]types.ServiceVolumeConfig)
+	if len(override) == 0 {
+		return nil
+	}
+	merged := append([]types.ServiceVolumeConfig{}, base...)
+	targets := map[string]int{}
+	for i, volume := range merged {
+		targets[path.Clean(volume.Target)] = i
+	}
+	for _, volume := range override {
+		target := path.Clean(volume.Target)
+		if i, ok := targets[target]; ok && volume.Target != "" {
+			merged[i] = volume
+			continue
+		}
+		targets[target] = len(merged)
+		merged = append(merged, volume)
+	}
+	dst.Set(reflect.ValueOf(merged))
+	return nil
+}
+
+// sameValues tells a and b hold the same values, regardless of order or duplicates
+func sameValues(a, b []string) bool {
+	toSet := func(values []string) map[string]bool {
+		set := map[string]bool{}
+		for _, v := range values {
+			set[v] = true
+		}
+		return set
+	}
+	return reflect.DeepEqual(toSet(a), toSet(b))
+}
+
 func getLoggingDriver(v reflect.Value) string {
 	return v.FieldByName("Driver").String()
 }
@@ -255,21 +756,53 @@ func mapByName(services []types.ServiceConfig) map[string]types.ServiceConfig {
 	return m
 }
 
+// mergeLabels merges labels key-wise, override ones winning. Top-level networks and volumes are otherwise replaced
+// as a whole
+func mergeLabels(base, override types.Labels) types.Labels {
+	if len(base) == 0 {
+		return override
+	}
+	labels := types.Labels{}
+	for k, v := range base {
+		labels[k] = v
+	}
+	for k, v := range override {
+		labels[k] = v
+	}
+	return labels
+}
+
 func mergeVolumes(base, override map[string]types.VolumeConfig) (map[string]types.VolumeConfig, error) {
+	for name, o := range override {
+		if b, ok := base[name]; ok {
+			o.Labels = mergeLabels(b.Labels, o.Labels)
+			override[name] = o
+		}
+	}
 	err := mergo.Map(&base, &override, mergo.WithOverride)
 	return base, err
 }
 
 func mergeNetworks(base, override map[string]types.NetworkConfig) (map[string]types.NetworkConfig, error) {
+	for name, o := range override {
+		if b, ok := base[name]; ok {
+			o.Labels = mergeLabels(b.Labels, o.Labels)
+			override[name] = o
+		}
+	}
 	err := mergo.Map(&base, &override, mergo.WithOverride)
 	return base, err
 }
 
+// mergeSecrets replaces the declarations of base by the ones of override with the same name, as a whole, so that a
+// declaration never mixes the sources of several files
 func mergeSecrets(base, override map[string]types.SecretConfig) (map[string]types.SecretConfig, error) {
 	err := mergo.Map(&base, &override, mergo.WithOverride)
 	return base, err
 }
 
+// mergeConfigs replaces the declarations of base by the ones of override with the same name, as a whole, so that a
+// declaration never mixes the sources of several files
 func mergeConfigs(base, override map[string]types.ConfigObjConfig) (map[string]types.ConfigObjConfig, error) {
 	err := mergo.Map(&base, &override, mergo.WithOverride)
 	return base, err
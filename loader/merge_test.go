@@ -18,11 +18,14 @@ package loader
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/imdario/mergo"
 
+	"github.com/compose-spec/compose-go/errdefs"
 	"github.com/compose-spec/compose-go/types"
+	"gopkg.in/yaml.v2"
 	"gotest.tools/v3/assert"
 )
 
@@ -227,7 +230,7 @@ func TestLoadLogging(t *testing.T) {
 }
 
 func loadTestProject(configDetails types.ConfigDetails) (*types.Project, error) {
-	return Load(configDetails, func(options *Options) {
+	return loadCached(configDetails, func(options *Options) {
 		options.SkipNormalization = true
 		options.SkipConsistencyCheck = true
 	})
@@ -251,7 +254,7 @@ func TestLoadMultipleServicePorts(t *testing.T) {
 			expected: []types.ServicePortConfig{
 				{
 					Mode:      "ingress",
-					Published: 8080,
+					Published: "8080",
 					Target:    80,
 					Protocol:  "tcp",
 				},
@@ -272,13 +275,13 @@ func TestLoadMultipleServicePorts(t *testing.T) {
 			expected: []types.ServicePortConfig{
 				{
 					Mode:      "ingress",
-					Published: 8080,
+					Published: "8080",
 					Target:    80,
 					Protocol:  "tcp",
 				},
 				{
 					Mode:      "ingress",
-					Published: 8081,
+					Published: "8081",
 					Target:    80,
 					Protocol:  "tcp",
 				},
@@ -299,7 +302,7 @@ func TestLoadMultipleServicePorts(t *testing.T) {
 			expected: []types.ServicePortConfig{
 				{
 					Mode:      "ingress",
-					Published: 8080,
+					Published: "8080",
 					Target:    81,
 					Protocol:  "tcp",
 				},
@@ -919,12 +922,12 @@ func TestLoadMultipleConfigs(t *testing.T) {
 				Ports: []types.ServicePortConfig{
 					{
 						Target:    81,
-						Published: 8080,
+						Published: "8080",
 					},
 					{
 						Mode:      "ingress",
 						Target:    90,
-						Published: 9090,
+						Published: "9090",
 						Protocol:  "tcp",
 					},
 				},
@@ -941,6 +944,913 @@ func TestLoadMultipleConfigs(t *testing.T) {
 	}, config)
 }
 
+func TestLoadMultipleBuildConfigs(t *testing.T) {
+	base := map[string]interface{}{
+		"services": map[string]interface{}{
+			"foo": map[string]interface{}{
+				"build": map[string]interface{}{
+					"context": ".",
+					"ssh":     []interface{}{"default", "key=/base/key"},
+					"additional_contexts": map[string]interface{}{
+						"base":  "docker-image://alpine",
+						"tools": "./tools",
+					},
+					"secrets": []interface{}{"token"},
+					"tags":    []interface{}{"foo:base"},
+				},
+			},
+		},
+		"secrets": map[string]interface{}{
+			"token": map[string]interface{}{"file": "./token.txt"},
+		},
+	}
+	override := map[string]interface{}{
+		"services": map[string]interface{}{
+			"foo": map[string]interface{}{
+				"build": map[string]interface{}{
+					"ssh": map[string]interface{}{"key": "/override/key"},
+					"additional_contexts": map[string]interface{}{
+						"base": "docker-image://debian",
+					},
+					"secrets": []interface{}{
+						map[string]interface{}{"source": "token", "target": "build_token"},
+					},
+					"no_cache":  true,
+					"platforms": []interface{}{"linux/arm64"},
+				},
+			},
+		},
+	}
+	configDetails := types.ConfigDetails{
+		ConfigFiles: []types.ConfigFile{
+			{Filename: "base.yml", Config: base},
+			{Filename: "override.yml", Config: override},
+		},
+	}
+	config, err := loadTestProject(configDetails)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, &types.BuildConfig{
+		Context: ".",
+		SSH:     types.SSHConfig{{ID: "default"}, {ID: "key", Path: "/override/key"}},
+		AdditionalContexts: types.Mapping{
+			"base":  "docker-image://debian",
+			"tools": "./tools",
+		},
+		NoCache:   true,
+		Secrets:   []types.ServiceSecretConfig{{Source: "token", Target: "build_token"}},
+		Tags:      []string{"foo:base"},
+		Platforms: []string{"linux/arm64"},
+	}, config.Services[0].Build)
+}
+
+func TestLoadMultipleDependsOn(t *testing.T) {
+	base := map[string]interface{}{
+		"services": map[string]interface{}{
+			"foo": map[string]interface{}{
+				"image":      "foo",
+				"depends_on": []interface{}{"db", "cache"},
+			},
+		},
+	}
+	override := map[string]interface{}{
+		"services": map[string]interface{}{
+			"foo": map[string]interface{}{
+				"depends_on": map[string]interface{}{
+					"db": map[string]interface{}{
+						"condition": types.ServiceConditionHealthy,
+						"restart":   true,
+					},
+				},
+			},
+		},
+	}
+	configDetails := types.ConfigDetails{
+		ConfigFiles: []types.ConfigFile{
+			{Filename: "base.yml", Config: base},
+			{Filename: "override.yml", Config: override},
+		},
+	}
+	config, err := loadTestProject(configDetails)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, types.DependsOnConfig{
+		"db":    {Condition: types.ServiceConditionHealthy, Restart: true},
+		"cache": {Condition: types.ServiceConditionStarted},
+	}, config.Services[0].DependsOn)
+}
+
+func TestLoadMultipleBuildUlimits(t *testing.T) {
+	base := map[string]interface{}{
+		"services": map[string]interface{}{
+			"foo": map[string]interface{}{
+				"build": map[string]interface{}{
+					"context": ".",
+					"ulimits": map[string]interface{}{
+						"nofile": map[string]interface{}{"soft": 1024, "hard": 2048},
+						"nproc":  65535,
+					},
+				},
+			},
+		},
+	}
+	override := map[string]interface{}{
+		"services": map[string]interface{}{
+			"foo": map[string]interface{}{
+				"build": map[string]interface{}{
+					"ulimits": map[string]interface{}{
+						"nofile": 4096,
+					},
+				},
+			},
+		},
+	}
+	configDetails := types.ConfigDetails{
+		ConfigFiles: []types.ConfigFile{
+			{Filename: "base.yml", Config: base},
+			{Filename: "override.yml", Config: override},
+		},
+	}
+	project, err := loadTestProject(configDetails)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.Services[0].Build.Ulimits, map[string]*types.UlimitsConfig{
+		"nofile": {Single: 4096},
+		"nproc":  {Single: 65535},
+	})
+}
+
+func TestMergeShellCommand(t *testing.T) {
+	cases := []struct {
+		name     string
+		base     interface{}
+		override interface{}
+		expected types.ShellCommand
+	}{
+		{name: "not_overridden", base: "echo base", override: nil, expected: types.ShellCommand{"echo", "base"}},
+		{name: "replaced", base: []interface{}{"echo", "base"}, override: `echo "hello world"`, expected: types.ShellCommand{"echo", "hello world"}},
+		{name: "cleared_with_list", base: "echo base", override: []interface{}{}, expected: types.ShellCommand{}},
+		{name: "cleared_with_string", base: "echo base", override: "", expected: types.ShellCommand{}},
+		{name: "empty_base", base: nil, override: []interface{}{}, expected: types.ShellCommand{}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			service := func(command interface{}) map[string]interface{} {
+				s := map[string]interface{}{"image": "foo"}
+				if command != nil {
+					s["command"] = command
+					s["entrypoint"] = command
+				}
+				return map[string]interface{}{"services": map[string]interface{}{"foo": s}}
+			}
+			project, err := loadTestProject(types.ConfigDetails{
+				ConfigFiles: []types.ConfigFile{
+					{Filename: "base.yml", Config: service(tc.base)},
+					{Filename: "override.yml", Config: service(tc.override)},
+				},
+			})
+			assert.NilError(t, err)
+			assert.DeepEqual(t, project.Services[0].Command, tc.expected)
+			assert.DeepEqual(t, project.Services[0].Entrypoint, tc.expected)
+		})
+	}
+}
+
+func TestMergeResourceConflicts(t *testing.T) {
+	cases := []struct {
+		name     string
+		section  string
+		base     map[string]interface{}
+		override map[string]interface{}
+		err      string
+	}{
+		{
+			name:     "volume_external_over_local",
+			section:  "volumes",
+			base:     map[string]interface{}{},
+			override: map[string]interface{}{"external": true},
+			err:      `volume "data" is declared with conflicting external by base.yml (false) and override.yml (true)`,
+		},
+		{
+			name:     "volume_different_drivers",
+			section:  "volumes",
+			base:     map[string]interface{}{"driver": "local"},
+			override: map[string]interface{}{"driver": "nfs"},
+			err:      `volume "data" is declared with conflicting driver by base.yml (local) and override.yml (nfs)`,
+		},
+		{
+			name:     "volume_driver_added",
+			section:  "volumes",
+			base:     map[string]interface{}{},
+			override: map[string]interface{}{"driver": "nfs"},
+		},
+		{
+			name:     "network_different_drivers",
+			section:  "networks",
+			base:     map[string]interface{}{"driver": "bridge"},
+			override: map[string]interface{}{"driver": "overlay"},
+			err:      `network "data" is declared with conflicting driver by base.yml (bridge) and override.yml (overlay)`,
+		},
+		{
+			name:     "network_both_external",
+			section:  "networks",
+			base:     map[string]interface{}{"external": true},
+			override: map[string]interface{}{"external": true, "name": "outside"},
+		},
+		{
+			name:     "secret_external_over_file",
+			section:  "secrets",
+			base:     map[string]interface{}{"file": "./secret.txt"},
+			override: map[string]interface{}{"external": true},
+			err:      `secret "data" is declared with conflicting external by base.yml (false) and override.yml (true)`,
+		},
+		{
+			name:     "config_file_replaced",
+			section:  "configs",
+			base:     map[string]interface{}{"file": "./config.txt"},
+			override: map[string]interface{}{"file": "./other.txt"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := func(resource map[string]interface{}) map[string]interface{} {
+				return map[string]interface{}{
+					"services": map[string]interface{}{"foo": map[string]interface{}{"image": "foo"}},
+					tc.section: map[string]interface{}{"data": resource},
+				}
+			}
+			_, err := loadTestProject(types.ConfigDetails{
+				ConfigFiles: []types.ConfigFile{
+					{Filename: "base.yml", Config: config(tc.base)},
+					{Filename: "override.yml", Config: config(tc.override)},
+				},
+			})
+			if tc.err == "" {
+				assert.NilError(t, err)
+				return
+			}
+			assert.Check(t, errdefs.IsInvalidError(err))
+			assert.ErrorContains(t, err, tc.err)
+		})
+	}
+}
+
+func TestMergeConflictReportsDeclaringFile(t *testing.T) {
+	service := map[string]interface{}{"foo": map[string]interface{}{"image": "foo"}}
+	_, err := loadTestProject(types.ConfigDetails{
+		ConfigFiles: []types.ConfigFile{
+			{Filename: "a.yml", Config: map[string]interface{}{
+				"services": service,
+				"volumes":  map[string]interface{}{"data": map[string]interface{}{"driver": "local"}},
+			}},
+			{Filename: "b.yml", Config: map[string]interface{}{"services": service}},
+			{Filename: "c.yml", Config: map[string]interface{}{
+				"services": service,
+				"volumes":  map[string]interface{}{"data": map[string]interface{}{"driver": "nfs"}},
+			}},
+		},
+	})
+	assert.ErrorContains(t, err, `volume "data" is declared with conflicting driver by a.yml (local) and c.yml (nfs)`)
+}
+
+func TestMergeBuildOverImage(t *testing.T) {
+	project, err := loadTestProject(types.ConfigDetails{
+		ConfigFiles: []types.ConfigFile{
+			{Filename: "base.yml", Config: map[string]interface{}{
+				"services": map[string]interface{}{"foo": map[string]interface{}{"image": "foo"}},
+			}},
+			{Filename: "override.yml", Config: map[string]interface{}{
+				"services": map[string]interface{}{"foo": map[string]interface{}{"build": "."}},
+			}},
+		},
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, project.Services[0].Image, "foo")
+	assert.Equal(t, project.Services[0].Build.Context, ".")
+}
+
+func TestMergeScale(t *testing.T) {
+	cases := []struct {
+		name     string
+		base     map[string]interface{}
+		override map[string]interface{}
+		expected int
+	}{
+		{
+			name:     "replicas_over_scale",
+			base:     map[string]interface{}{"scale": 3},
+			override: map[string]interface{}{"deploy": map[string]interface{}{"replicas": 5}},
+			expected: 5,
+		},
+		{
+			name:     "scale_over_replicas",
+			base:     map[string]interface{}{"deploy": map[string]interface{}{"replicas": 5}},
+			override: map[string]interface{}{"scale": 2},
+			expected: 2,
+		},
+		{
+			name:     "replicas_over_replicas",
+			base:     map[string]interface{}{"deploy": map[string]interface{}{"replicas": 5}},
+			override: map[string]interface{}{"deploy": map[string]interface{}{"replicas": 0}},
+			expected: 0,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := func(service map[string]interface{}) map[string]interface{} {
+				service["image"] = "foo"
+				return map[string]interface{}{"services": map[string]interface{}{"foo": service}}
+			}
+			project, err := loadCached(types.ConfigDetails{
+				ConfigFiles: []types.ConfigFile{
+					{Filename: "base.yml", Config: config(tc.base)},
+					{Filename: "override.yml", Config: config(tc.override)},
+				},
+			}, func(options *Options) {
+				options.Warn = func(string) {}
+			})
+			assert.NilError(t, err)
+			assert.Equal(t, project.Services[0].GetScale(), tc.expected)
+			assert.Equal(t, int(*project.Services[0].Deploy.Replicas), tc.expected)
+		})
+	}
+}
+
+func TestMergeResources(t *testing.T) {
+	cases := []struct {
+		name        string
+		base        map[string]interface{}
+		override    map[string]interface{}
+		memory      types.UnitBytes
+		cpus        string
+		reservation types.UnitBytes
+	}{
+		{
+			name: "deploy_over_legacy",
+			base: map[string]interface{}{"mem_limit": "512m", "cpus": 0.5, "mem_reservation": "128m"},
+			override: map[string]interface{}{"deploy": map[string]interface{}{"resources": map[string]interface{}{
+				"limits":       map[string]interface{}{"memory": "1g", "cpus": "2"},
+				"reservations": map[string]interface{}{"memory": "256m"},
+			}}},
+			memory:      1024 * 1024 * 1024,
+			cpus:        "2",
+			reservation: 256 * 1024 * 1024,
+		},
+		{
+			name: "legacy_over_deploy",
+			base: map[string]interface{}{"deploy": map[string]interface{}{"resources": map[string]interface{}{
+				"limits":       map[string]interface{}{"memory": "1g", "cpus": "2"},
+				"reservations": map[string]interface{}{"memory": "256m"},
+			}}},
+			override:    map[string]interface{}{"mem_limit": "512m", "cpus": 0.5, "mem_reservation": "128m"},
+			memory:      512 * 1024 * 1024,
+			cpus:        "0.5",
+			reservation: 128 * 1024 * 1024,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := func(service map[string]interface{}) map[string]interface{} {
+				service["image"] = "foo"
+				return map[string]interface{}{"services": map[string]interface{}{"foo": service}}
+			}
+			project, err := loadCached(types.ConfigDetails{
+				ConfigFiles: []types.ConfigFile{
+					{Filename: "base.yml", Config: config(tc.base)},
+					{Filename: "override.yml", Config: config(tc.override)},
+				},
+			}, func(options *Options) {
+				options.Warn = func(string) {}
+			})
+			assert.NilError(t, err)
+			resources := project.Services[0].Deploy.Resources
+			assert.Equal(t, resources.Limits.MemoryBytes, tc.memory)
+			assert.Equal(t, resources.Limits.NanoCPUs, tc.cpus)
+			assert.Equal(t, resources.Reservations.MemoryBytes, tc.reservation)
+		})
+	}
+}
+
+func TestMergeDevelopWatch(t *testing.T) {
+	project, err := loadTestProject(types.ConfigDetails{
+		WorkingDir: "/code",
+		ConfigFiles: []types.ConfigFile{
+			{Filename: "base.yml", Config: map[string]interface{}{
+				"services": map[string]interface{}{"foo": map[string]interface{}{
+					"image": "foo",
+					"develop": map[string]interface{}{
+						"x-poll": true,
+						"watch": []interface{}{
+							map[string]interface{}{"path": "src", "action": "sync", "target": "/app"},
+							map[string]interface{}{"path": "go.mod", "action": "rebuild"},
+						},
+					},
+				}},
+			}},
+			{Filename: "override.yml", Config: map[string]interface{}{
+				"services": map[string]interface{}{"foo": map[string]interface{}{
+					"develop": map[string]interface{}{
+						"watch": []interface{}{
+							map[string]interface{}{"path": "package.json", "action": "rebuild"},
+						},
+					},
+				}},
+			}},
+		},
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.Services[0].Develop, &types.DevelopConfig{
+		Watch: []types.Trigger{
+			{Path: "/code/package.json", Action: types.WatchActionRebuild},
+		},
+		Extensions: map[string]interface{}{"x-poll": true},
+	})
+}
+
+func TestMergeEnvironmentUnset(t *testing.T) {
+	project, err := loadTestProject(types.ConfigDetails{
+		ConfigFiles: []types.ConfigFile{
+			{Filename: "base.yml", Config: map[string]interface{}{
+				"services": map[string]interface{}{"foo": map[string]interface{}{
+					"image":       "foo",
+					"environment": []interface{}{"FOO=foo", "BAR", "BAZ=baz", "QUX"},
+					"build": map[string]interface{}{
+						"context": ".",
+						"args":    []interface{}{"FOO=foo", "BAR"},
+					},
+				}},
+			}},
+			{Filename: "override.yml", Config: map[string]interface{}{
+				"services": map[string]interface{}{"foo": map[string]interface{}{
+					"environment": []interface{}{"FOO", "BAR=bar", "BAZ="},
+					"build": map[string]interface{}{
+						"args": []interface{}{"FOO", "BAR=bar"},
+					},
+				}},
+			}},
+		},
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.Services[0].Environment, types.MappingWithEquals{
+		"FOO": strPtr("foo"),
+		"BAR": strPtr("bar"),
+		"BAZ": strPtr(""),
+		"QUX": nil,
+	})
+	assert.DeepEqual(t, project.Services[0].Build.Args, types.MappingWithEquals{
+		"FOO": strPtr("foo"),
+		"BAR": strPtr("bar"),
+	})
+}
+
+func TestLoadWithMergeTags(t *testing.T) {
+	project, err := loadCached(types.ConfigDetails{WorkingDir: "/code", ConfigFiles: []types.ConfigFile{
+		{Filename: "compose.yaml", Content: []byte(`
+services:
+  foo:
+    image: foo
+    ports:
+      - "8080:80"
+    environment:
+      A: a
+    labels:
+      com.example.removed: "1"
+      com.example.kept: "1"
+  bar:
+    image: bar
+  baz:
+    image: baz
+    environment:
+      B: b
+`)},
+		{Filename: "compose.override.yaml", Content: []byte(`
+services:
+  foo:
+    ports: !override
+      - "9090:90"
+    environment: !reset {}
+    labels:
+      com.example.removed: !reset null
+  bar: !reset
+  baz: !override
+    build: .
+`)},
+	}})
+	assert.NilError(t, err)
+
+	assert.DeepEqual(t, project.ServiceNames(), []string{"baz", "foo"})
+	foo, err := project.GetService("foo")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, foo.Ports, []types.ServicePortConfig{
+		{Mode: "ingress", Target: 90, Published: "9090", Protocol: "tcp"},
+	})
+	assert.Check(t, len(foo.Environment) == 0)
+	assert.DeepEqual(t, foo.Labels, types.Labels{"com.example.kept": "1"})
+
+	baz, err := project.GetService("baz")
+	assert.NilError(t, err)
+	assert.Check(t, baz.Image == "")
+	assert.Check(t, baz.Build != nil)
+	assert.Check(t, len(baz.Environment) == 0)
+
+	out, err := yaml.Marshal(project)
+	assert.NilError(t, err)
+	assert.Check(t, !strings.Contains(string(out), "!reset") && !strings.Contains(string(out), "!override"))
+}
+
+func TestLoadWithMergeTagsSingleFile(t *testing.T) {
+	var warnings []string
+	project, err := loadCached(types.ConfigDetails{WorkingDir: "/code", ConfigFiles: []types.ConfigFile{
+		{Filename: "compose.yaml", Content: []byte(`
+services:
+  foo:
+    image: foo
+    ports: !override
+      - "8080:80"
+`)},
+	}}, func(options *Options) {
+		options.Warn = func(message string) {
+			warnings = append(warnings, message)
+		}
+	})
+	assert.NilError(t, err)
+	assert.Check(t, len(project.Services[0].Ports) == 1)
+	assert.DeepEqual(t, warnings, []string{"services.foo.ports: `!override` tag has no effect as there is no previous file to merge with"})
+}
+
+func TestMergeLabels(t *testing.T) {
+	project, err := loadTestProject(types.ConfigDetails{WorkingDir: "/code", ConfigFiles: []types.ConfigFile{
+		{Filename: "compose.yaml", Content: []byte(`
+services:
+  foo:
+    image: foo
+    labels:
+      - a=base
+      - b=base
+    annotations:
+      a: base
+networks:
+  default:
+    labels:
+      a: base
+      b: base
+`)},
+		{Filename: "compose.override.yaml", Content: []byte(`
+services:
+  foo:
+    labels:
+      b: override
+      c: override
+    annotations:
+      - b=override
+networks:
+  default:
+    labels:
+      - b=override
+`)},
+	}})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.Services[0].Labels, types.Labels{"a": "base", "b": "override", "c": "override"})
+	assert.DeepEqual(t, project.Services[0].Annotations, types.Labels{"a": "base", "b": "override"})
+	assert.DeepEqual(t, project.Networks["default"].Labels, types.Labels{"a": "base", "b": "override"})
+}
+
+func TestMergeExtraHosts(t *testing.T) {
+	load := func(override string) (*types.Project, error) {
+		return loadTestProject(types.ConfigDetails{WorkingDir: "/code", ConfigFiles: []types.ConfigFile{
+			{Filename: "compose.yaml", Content: []byte(`
+services:
+  foo:
+    image: foo
+    extra_hosts:
+      - "alpha:10.0.0.1"
+      - "beta:10.0.0.2"
+`)},
+			{Filename: "compose.override.yaml", Content: []byte(override)},
+		}})
+	}
+
+	project, err := load(`
+services:
+  foo:
+    extra_hosts:
+      beta: "10.0.0.2"
+      gamma: "10.0.0.3"
+`)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.Services[0].ExtraHosts, types.HostsList{"alpha:10.0.0.1", "beta:10.0.0.2", "gamma:10.0.0.3"})
+
+	_, err = load(`
+services:
+  foo:
+    extra_hosts:
+      - "alpha:10.0.0.9"
+`)
+	assert.ErrorContains(t, err, `extra host "alpha" is mapped to conflicting IPs 10.0.0.1 and 10.0.0.9`)
+	assert.Check(t, errdefs.IsInvalidError(err))
+}
+
+func TestMergeContainerModes(t *testing.T) {
+	project, err := loadTestProject(types.ConfigDetails{WorkingDir: "/code", ConfigFiles: []types.ConfigFile{
+		{Filename: "compose.yaml", Content: []byte(`
+services:
+  foo:
+    image: foo
+    cgroup: host
+    uts: host
+    shm_size: 64m
+`)},
+		{Filename: "compose.override.yaml", Content: []byte(`
+services:
+  foo:
+    cgroup: private
+    shm_size: 1g
+`)},
+	}})
+	assert.NilError(t, err)
+	foo := project.Services[0]
+	assert.Equal(t, foo.Cgroup, types.CgroupPrivate)
+	assert.Equal(t, foo.Uts, "host")
+	assert.Equal(t, foo.ShmSize, types.UnitBytes(1024*1024*1024))
+}
+
+func TestMergeDevices(t *testing.T) {
+	project, err := loadTestProject(types.ConfigDetails{WorkingDir: "/code", ConfigFiles: []types.ConfigFile{
+		{Filename: "compose.yaml", Content: []byte(`
+services:
+  foo:
+    image: foo
+    devices:
+      - /dev/ttyUSB0
+      - /dev/sda:/dev/xvda:rwm
+`)},
+		{Filename: "compose.override.yaml", Content: []byte(`
+services:
+  foo:
+    devices:
+      - source: /dev/sdb
+        target: /dev/xvda
+        permissions: r
+      - /dev/fuse
+`)},
+	}})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.Services[0].Devices, []types.ServiceDeviceConfig{
+		{Source: "/dev/fuse", Target: "/dev/fuse", Permissions: "rwm"},
+		{Source: "/dev/ttyUSB0", Target: "/dev/ttyUSB0", Permissions: "rwm"},
+		{Source: "/dev/sdb", Target: "/dev/xvda", Permissions: "r"},
+	})
+}
+
+func TestMergeRestart(t *testing.T) {
+	project, err := loadTestProject(types.ConfigDetails{WorkingDir: "/code", ConfigFiles: []types.ConfigFile{
+		{Filename: "compose.yaml", Content: []byte(`
+services:
+  foo:
+    image: foo
+    restart: on-failure:3
+  bar:
+    image: bar
+    restart: always
+`)},
+		{Filename: "compose.override.yaml", Content: []byte(`
+services:
+  foo:
+    restart: unless-stopped
+  bar:
+    image: bar:1.0
+`)},
+	}})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.Services[0].Restart, &types.ServiceRestart{Condition: types.RestartAlways})
+	assert.DeepEqual(t, project.Services[1].Restart, &types.ServiceRestart{Condition: types.RestartUnlessStopped})
+}
+
+func TestMergeVolumes(t *testing.T) {
+	project, err := loadTestProject(types.ConfigDetails{WorkingDir: "/code", ConfigFiles: []types.ConfigFile{
+		{Filename: "compose.yaml", Content: []byte(`
+services:
+  foo:
+    image: foo
+    volumes:
+      - data:/data
+      - /var/log:/logs:ro
+`)},
+		{Filename: "compose.override.yaml", Content: []byte(`
+services:
+  foo:
+    volumes:
+      - /host/cache:/cache
+      - other:/data/
+volumes:
+  data: {}
+  other: {}
+`)},
+	}})
+	assert.NilError(t, err)
+	volumes := project.Services[0].Volumes
+	assert.Equal(t, len(volumes), 3)
+	assert.Equal(t, volumes[0].Source, "other")
+	assert.Equal(t, volumes[1].Source, "/var/log")
+	assert.Equal(t, volumes[2].Source, "/host/cache")
+}
+
+func TestMergeDuplicateContainerName(t *testing.T) {
+	_, err := loadCached(types.ConfigDetails{WorkingDir: "/code", ConfigFiles: []types.ConfigFile{
+		{Filename: "compose.yaml", Content: []byte(`
+services:
+  api:
+    image: api
+    container_name: backend
+  worker:
+    image: worker
+`)},
+		{Filename: "compose.override.yaml", Content: []byte(`
+services:
+  worker:
+    container_name: backend
+`)},
+	}}, func(options *Options) {
+		options.Name = "project"
+	})
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `compose.yaml:5:5: services api, worker share the container_name "backend"`)
+}
+
+func TestMergeTriStateBooleans(t *testing.T) {
+	for _, attribute := range []string{"init", "stdin_open", "tty", "oom_kill_disable", "attach"} {
+		field := func(s types.ServiceConfig) *bool {
+			return map[string]*bool{"init": s.Init, "stdin_open": s.StdinOpen, "tty": s.Tty, "oom_kill_disable": s.OomKillDisable, "attach": s.Attach}[attribute]
+		}
+		for _, tc := range []struct {
+			base, override string
+			expected       *bool
+		}{
+			{base: attribute + ": true", override: attribute + ": false", expected: boolPtr(false)},
+			{base: attribute + ": false", override: attribute + ": true", expected: boolPtr(true)},
+			{base: attribute + ": true", override: "image: foo", expected: boolPtr(true)},
+			{base: "user: root", override: "image: foo", expected: nil},
+		} {
+			project, err := loadTestProject(types.ConfigDetails{WorkingDir: "/code", ConfigFiles: []types.ConfigFile{
+				{Filename: "compose.yaml", Content: []byte("services:\n  foo:\n    image: foo\n    " + tc.base + "\n")},
+				{Filename: "compose.override.yaml", Content: []byte("services:\n  foo:\n    " + tc.override + "\n")},
+			}})
+			assert.NilError(t, err)
+			assert.DeepEqual(t, tc.expected, field(project.Services[0]))
+		}
+	}
+}
+
+func TestMergeBlkioConfig(t *testing.T) {
+	project, err := loadTestProject(types.ConfigDetails{WorkingDir: "/code", ConfigFiles: []types.ConfigFile{
+		{Filename: "compose.yaml", Content: []byte(`
+services:
+  foo:
+    image: foo
+    blkio_config:
+      weight: 300
+      weight_device:
+        - {path: /dev/sda, weight: 400}
+        - {path: /dev/sdb, weight: 500}
+      device_read_bps:
+        - {path: /dev/sda, rate: 1kb}
+`)},
+		{Filename: "compose.override.yaml", Content: []byte(`
+services:
+  foo:
+    blkio_config:
+      weight_device:
+        - {path: /dev/sdb, weight: 600}
+      device_read_bps:
+        - {path: /dev/sdc, rate: 2kb}
+`)},
+	}})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.Services[0].BlkioConfig, &types.BlkioConfig{
+		Weight: 300,
+		WeightDevice: []types.WeightDevice{
+			{Path: "/dev/sda", Weight: 400},
+			{Path: "/dev/sdb", Weight: 600},
+		},
+		DeviceReadBps: []types.ThrottleDevice{
+			{Path: "/dev/sda", Rate: 1024},
+			{Path: "/dev/sdc", Rate: 2048},
+		},
+	})
+}
+
+func TestMergeProfiles(t *testing.T) {
+	project, err := loadTestProject(types.ConfigDetails{WorkingDir: "/code", ConfigFiles: []types.ConfigFile{
+		{Filename: "compose.yaml", Content: []byte(`
+services:
+  debug:
+    image: foo
+    profiles: [debug, test]
+  web:
+    image: foo
+  db:
+    image: foo
+    profiles: []
+`)},
+		{Filename: "compose.override.yaml", Content: []byte(`
+services:
+  debug:
+    profiles: [test, tools]
+  web:
+    profiles: []
+  db:
+    image: bar
+`)},
+	}})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.Services[0].Profiles, []string{})
+	assert.DeepEqual(t, project.Services[1].Profiles, []string{"debug", "test", "tools"})
+	assert.DeepEqual(t, project.Services[2].Profiles, []string{})
+	assert.Check(t, project.Services[0].HasProfile(nil))
+	assert.Check(t, project.Services[2].HasProfile(nil))
+}
+
+func TestMergeSecretsReplacedByKey(t *testing.T) {
+	project, err := loadTestProject(types.ConfigDetails{WorkingDir: "/code", ConfigFiles: []types.ConfigFile{
+		{Filename: "compose.yaml", Content: []byte(`
+services:
+  foo:
+    image: foo
+secrets:
+  token:
+    environment: TOKEN
+    labels:
+      a: base
+configs:
+  app:
+    file: ./app.conf
+    template_driver: golang
+`)},
+		{Filename: "compose.override.yaml", Content: []byte(`
+secrets:
+  token:
+    file: ./token.txt
+configs:
+  app:
+    driver: remote
+`)},
+	}})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.Secrets["token"], types.SecretConfig{File: "/code/token.txt"})
+	assert.DeepEqual(t, project.Configs["app"], types.ConfigObjConfig{Driver: "remote"})
+}
+
+func TestMergeBuildArgsResolved(t *testing.T) {
+	project, err := loadTestProject(types.ConfigDetails{
+		Environment: map[string]string{"BUILDKIT_INLINE_CACHE": "1", "VERSION": "2.0"},
+		ConfigFiles: []types.ConfigFile{
+			{Filename: "base.yml", Content: []byte(`
+services:
+  foo:
+    build:
+      context: .
+      args:
+        - BUILDKIT_INLINE_CACHE
+        - VERSION=1.0
+        - TOKEN
+`)},
+			{Filename: "override.yml", Content: []byte(`
+services:
+  foo:
+    build:
+      args:
+        VERSION:
+        REVISION:
+`)},
+		},
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.Services[0].Build.Args, types.MappingWithEquals{
+		"BUILDKIT_INLINE_CACHE": strPtr("1"),
+		"VERSION":               strPtr("2.0"),
+		"TOKEN":                 nil,
+		"REVISION":              nil,
+	})
+}
+
+func TestMergeCapabilities(t *testing.T) {
+	project, err := loadTestProject(types.ConfigDetails{WorkingDir: "/code", ConfigFiles: []types.ConfigFile{
+		{Filename: "compose.yaml", Content: []byte(`
+services:
+  foo:
+    image: foo
+    cap_add: [sys_admin, NET_RAW]
+    cap_drop: [CAP_CHOWN]
+`)},
+		{Filename: "compose.override.yaml", Content: []byte(`
+services:
+  foo:
+    cap_add: [CAP_SYS_ADMIN, cap_sys_ptrace]
+    cap_drop: [chown]
+`)},
+	}})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.Services[0].CapAdd, []string{"SYS_ADMIN", "NET_RAW", "SYS_PTRACE"})
+	assert.DeepEqual(t, project.Services[0].CapDrop, []string{"CHOWN"})
+}
+
 // Issue#972
 func TestLoadMultipleNetworks(t *testing.T) {
 	base := map[string]interface{}{
@@ -985,29 +1895,9 @@ func TestLoadMultipleNetworks(t *testing.T) {
 			{Filename: "override.yml", Config: override},
 		},
 	}
-	config, err := loadTestProject(configDetails)
-	assert.NilError(t, err)
-	assert.DeepEqual(t, &types.Project{
-		Name:       "",
-		WorkingDir: "",
-		Services: []types.ServiceConfig{
-			{
-				Name:        "foo",
-				Image:       "baz",
-				Environment: types.MappingWithEquals{},
-			}},
-		Networks: map[string]types.NetworkConfig{
-			"hostnet": {
-				Name: "host",
-				External: types.External{
-					External: true,
-				},
-			},
-		},
-		Volumes: types.Volumes{},
-		Secrets: types.Secrets{},
-		Configs: types.Configs{},
-	}, config)
+	_, err := loadTestProject(configDetails)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `network "hostnet" is declared with conflicting external by base.yml (false) and override.yml (true)`)
 }
 
 func TestMergeUlimitsConfig(t *testing.T) {
@@ -1066,9 +1956,11 @@ func TestMergeServiceNetworkConfig(t *testing.T) {
 	}
 	override := map[string]*types.ServiceNetworkConfig{
 		"override-aliases": {
-			Aliases:     []string{"110", "111"},
-			Ipv4Address: "127.0.1.1",
-			Ipv6Address: "0:0:0:0:0:0:1:1",
+			Aliases:      []string{"110", "111"},
+			Ipv4Address:  "127.0.1.1",
+			Ipv6Address:  "0:0:0:0:0:0:1:1",
+			LinkLocalIPs: []string{"169.254.1.1"},
+			Priority:     10,
 		},
 		"add": {
 			Aliases:     []string{"310", "311"},
@@ -1083,9 +1975,11 @@ func TestMergeServiceNetworkConfig(t *testing.T) {
 		base,
 		map[string]*types.ServiceNetworkConfig{
 			"override-aliases": {
-				Aliases:     []string{"110", "111"},
-				Ipv4Address: "127.0.1.1",
-				Ipv6Address: "0:0:0:0:0:0:1:1",
+				Aliases:      []string{"110", "111"},
+				Ipv4Address:  "127.0.1.1",
+				Ipv6Address:  "0:0:0:0:0:0:1:1",
+				LinkLocalIPs: []string{"169.254.1.1"},
+				Priority:     10,
 			},
 			"dont-override": {
 				Aliases:     []string{"200", "201"},
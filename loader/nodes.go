@@ -0,0 +1,342 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loader
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/compose-spec/compose-go/types"
+	"github.com/pkg/errors"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// parseNodes parses the YAML documents of source into node trees, skipping empty documents. Nil is returned on
+// syntax errors, as those are reported by the parser building the configuration.
+func parseNodes(source []byte) []*yamlv3.Node {
+	var documents []*yamlv3.Node
+	decoder := yamlv3.NewDecoder(bytes.NewReader(source))
+	for {
+		var document yamlv3.Node
+		if err := decoder.Decode(&document); err != nil {
+			if err == io.EOF {
+				return documents
+			}
+			return nil
+		}
+		if len(document.Content) == 0 || document.Content[0].Tag == "!!null" {
+			continue
+		}
+		documents = append(documents, &document)
+	}
+}
+
+// checkDuplicateKeys reports the first key declared twice in a mapping, as the parser otherwise lets the last one
+// win silently. Keys brought by merge keys (`<<: *anchor`) can be overridden and aren't considered.
+func checkDuplicateKeys(node *yamlv3.Node) error {
+	switch node.Kind {
+	case yamlv3.DocumentNode, yamlv3.SequenceNode:
+		for _, child := range node.Content {
+			if err := checkDuplicateKeys(child); err != nil {
+				return err
+			}
+		}
+	case yamlv3.MappingNode:
+		seen := map[string]int{}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Kind == yamlv3.ScalarNode && key.Tag != "!!merge" {
+				if line, ok := seen[key.Value]; ok {
+					return errors.Errorf("line %d: key %q is already defined at line %d", key.Line, key.Value, line)
+				}
+				seen[key.Value] = key.Line
+			}
+			if err := checkDuplicateKeys(value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// nodePositions indexes the position of all values of a document by their dotted path. Values brought by merge keys
+// are located where the anchored mapping declares them.
+func nodePositions(document *yamlv3.Node) map[string]types.Position {
+	positions := map[string]types.Position{}
+	if len(document.Content) > 0 {
+		collectPositions(document.Content[0], "", positions, map[*yamlv3.Node]bool{})
+	}
+	return positions
+}
+
+func collectPositions(node *yamlv3.Node, path string, positions map[string]types.Position, visiting map[*yamlv3.Node]bool) {
+	if visiting[node] {
+		return
+	}
+	visiting[node] = true
+	defer delete(visiting, node)
+
+	switch node.Kind {
+	case yamlv3.AliasNode:
+		collectPositions(node.Alias, path, positions, visiting)
+	case yamlv3.SequenceNode:
+		for i, item := range node.Content {
+			itemPath := joinPath(path, strconv.Itoa(i))
+			setPosition(positions, itemPath, item)
+			collectPositions(item, itemPath, positions, visiting)
+		}
+	case yamlv3.MappingNode:
+		declared := map[string]bool{}
+		var merged []*yamlv3.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Tag == "!!merge" {
+				merged = append(merged, value)
+				continue
+			}
+			declared[key.Value] = true
+			keyPath := joinPath(path, key.Value)
+			setPosition(positions, keyPath, key)
+			collectPositions(value, keyPath, positions, visiting)
+		}
+		// merges are shallow, and explicit keys take precedence over the merged ones
+		for _, value := range merged {
+			sources := []*yamlv3.Node{value}
+			if value.Kind == yamlv3.SequenceNode {
+				sources = value.Content
+			}
+			for _, source := range sources {
+				if source.Kind == yamlv3.AliasNode {
+					source = source.Alias
+				}
+				if source.Kind != yamlv3.MappingNode || visiting[source] {
+					continue
+				}
+				for i := 0; i+1 < len(source.Content); i += 2 {
+					key, value := source.Content[i], source.Content[i+1]
+					if declared[key.Value] || key.Tag == "!!merge" {
+						continue
+					}
+					declared[key.Value] = true
+					keyPath := joinPath(path, key.Value)
+					setPosition(positions, keyPath, key)
+					collectPositions(value, keyPath, positions, visiting)
+				}
+			}
+		}
+	}
+}
+
+func setPosition(positions map[string]types.Position, path string, node *yamlv3.Node) {
+	if _, ok := positions[path]; !ok {
+		positions[path] = types.Position{Line: node.Line, Column: node.Column}
+	}
+}
+
+func joinPath(path string, element string) string {
+	if path == "" {
+		return element
+	}
+	return path + "." + element
+}
+
+// stringMappings are the attributes of services and top-level resources which are mappings of strings. YAML 1.1
+// resolves unquoted values like `NO`, `on` or `3.10` to booleans and numbers, so those are read as written instead
+var stringMappings = map[string][]string{
+	"services": {"environment", "labels", "annotations", "sysctls", "build.args", "build.labels", "logging.options", "storage_opt"},
+	"networks": {"labels", "driver_opts"},
+	"volumes":  {"labels", "driver_opts"},
+	"secrets":  {"labels"},
+	"configs":  {"labels"},
+}
+
+// preserveStringMappings replaces the string mappings of config, parsed from document, by the values as written
+func preserveStringMappings(config map[string]interface{}, document *yamlv3.Node) {
+	if len(document.Content) == 0 {
+		return
+	}
+	root := document.Content[0]
+	for section, attributes := range stringMappings {
+		entries, ok := config[section].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		sectionNodes := mappingIndex(mappingValue(root, section))
+		for name, entry := range entries {
+			entryNode, ok := sectionNodes[name]
+			if !ok {
+				continue
+			}
+			entryNodes := mappingIndex(entryNode)
+			for _, attribute := range attributes {
+				path := strings.Split(attribute, ".")
+				parent, node := entry, entryNodes[path[0]]
+				for i := 1; i < len(path) && parent != nil; i++ {
+					dict, _ := parent.(map[string]interface{})
+					parent, node = dict[path[i-1]], mappingValue(node, path[i])
+				}
+				last := path[len(path)-1]
+				if dict, ok := parent.(map[string]interface{}); ok {
+					if _, ok := dict[last].(map[string]interface{}); ok {
+						if raw, ok := rawStringMapping(node); ok {
+							dict[last] = raw
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// rawStringMapping returns the entries of a mapping of scalars as written, with null values kept as nil
+func rawStringMapping(node *yamlv3.Node) (map[string]interface{}, bool) {
+	if node == nil || node.Kind != yamlv3.MappingNode {
+		return nil, false
+	}
+	raw := map[string]interface{}{}
+	for _, pair := range mappingPairs(node) {
+		key, value := pair[0], resolveAlias(pair[1])
+		if key.Kind != yamlv3.ScalarNode || value.Kind != yamlv3.ScalarNode {
+			return nil, false
+		}
+		if value.Tag == "!!null" {
+			raw[key.Value] = nil
+			continue
+		}
+		raw[key.Value] = value.Value
+	}
+	return raw, true
+}
+
+// mappingValue returns the value of key in a mapping node, nil if not declared
+func mappingValue(node *yamlv3.Node, key string) *yamlv3.Node {
+	node = resolveAlias(node)
+	if node == nil || node.Kind != yamlv3.MappingNode {
+		return nil
+	}
+	for _, pair := range mappingPairs(node) {
+		if pair[0].Value == key {
+			return resolveAlias(pair[1])
+		}
+	}
+	return nil
+}
+
+// mappingIndex returns the value nodes of a mapping node by key, so that looking up all of its entries doesn't
+// scan the mapping for each of them
+func mappingIndex(node *yamlv3.Node) map[string]*yamlv3.Node {
+	node = resolveAlias(node)
+	if node == nil || node.Kind != yamlv3.MappingNode {
+		return nil
+	}
+	pairs := mappingPairs(node)
+	index := make(map[string]*yamlv3.Node, len(pairs))
+	for _, pair := range pairs {
+		if _, ok := index[pair[0].Value]; !ok {
+			index[pair[0].Value] = resolveAlias(pair[1])
+		}
+	}
+	return index
+}
+
+// mappingPairs returns the key and value nodes of a mapping node, including the ones brought by merge keys which
+// aren't explicitly declared
+func mappingPairs(node *yamlv3.Node) [][2]*yamlv3.Node {
+	var pairs, merged [][2]*yamlv3.Node
+	declared := map[string]bool{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if key.Tag == "!!merge" {
+			sources := []*yamlv3.Node{value}
+			if value.Kind == yamlv3.SequenceNode {
+				sources = value.Content
+			}
+			for _, source := range sources {
+				if source = resolveAlias(source); source != nil && source.Kind == yamlv3.MappingNode && source != node {
+					merged = append(merged, mappingPairs(source)...)
+				}
+			}
+			continue
+		}
+		declared[key.Value] = true
+		pairs = append(pairs, [2]*yamlv3.Node{key, value})
+	}
+	// merges are shallow, and explicit keys take precedence over the merged ones, the first merged mapping winning
+	for _, pair := range merged {
+		if !declared[pair[0].Value] {
+			declared[pair[0].Value] = true
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs
+}
+
+func resolveAlias(node *yamlv3.Node) *yamlv3.Node {
+	for node != nil && node.Kind == yamlv3.AliasNode {
+		node = node.Alias
+	}
+	return node
+}
+
+// Tags set on the values of an override file to control how those are merged with the previous files. `!reset`
+// removes the attribute, `!override` replaces it rather than merging it
+const (
+	resetTag    = "!reset"
+	overrideTag = "!override"
+)
+
+// collectMergeTags indexes the `!reset` and `!override` tags set on the mapping values of a document by their dotted
+// path. Tagged null values only mark the attribute, and are removed from config
+func collectMergeTags(config map[string]interface{}, document *yamlv3.Node) map[string]string {
+	tags := map[string]string{}
+	if len(document.Content) > 0 {
+		collectTags(resolveAlias(document.Content[0]), config, "", tags)
+	}
+	return tags
+}
+
+func collectTags(node *yamlv3.Node, value interface{}, path string, tags map[string]string) {
+	dict, ok := value.(map[string]interface{})
+	if !ok || node == nil || node.Kind != yamlv3.MappingNode {
+		return
+	}
+	for _, pair := range mappingPairs(node) {
+		key, child := pair[0], resolveAlias(pair[1])
+		keyPath := joinPath(path, key.Value)
+		if child.Tag == resetTag || child.Tag == overrideTag {
+			tags[keyPath] = child.Tag
+			if isNullScalar(child) {
+				delete(dict, key.Value)
+				continue
+			}
+		}
+		collectTags(child, dict[key.Value], keyPath, tags)
+	}
+}
+
+func isNullScalar(node *yamlv3.Node) bool {
+	if node.Kind != yamlv3.ScalarNode || node.Style&(yamlv3.SingleQuotedStyle|yamlv3.DoubleQuotedStyle) != 0 {
+		return false
+	}
+	switch node.Value {
+	case "", "~", "null", "Null", "NULL":
+		return true
+	}
+	return false
+}
@@ -17,16 +17,15 @@
 package loader
 
 import (
-	"fmt"
+	"strconv"
 
 	"github.com/compose-spec/compose-go/errdefs"
 	"github.com/compose-spec/compose-go/types"
 	"github.com/pkg/errors"
-	"github.com/sirupsen/logrus"
 )
 
 // normalize compose project by moving deprecated attributes to their canonical position and injecting implicit defaults
-func normalize(project *types.Project) error {
+func normalize(project *types.Project, opts *Options) error {
 	// If none defined, Compose model involves an implicit "default" network
 	if len(project.Networks) == 0 {
 		project.Networks["default"] = types.NetworkConfig{}
@@ -38,26 +37,44 @@ func normalize(project *types.Project) error {
 	}
 
 	for i, s := range project.Services {
-		if len(s.Networks) == 0 {
+		if len(s.Networks) == 0 && s.NetworkMode == "" {
 			// Service without explicit network attachment are implicitly exposed on default network
 			s.Networks = map[string]*types.ServiceNetworkConfig{"default": nil}
+			if _, ok := project.Networks["default"]; !ok {
+				// like for services imported from an included file which declares its own networks
+				project.Networks["default"] = types.NetworkConfig{}
+			}
 		}
 
-		err := relocateLogDriver(s)
+		err := relocateLogDriver(s, opts)
 		if err != nil {
 			return err
 		}
 
-		err = relocateLogOpt(s)
+		err = relocateLogOpt(s, opts)
 		if err != nil {
 			return err
 		}
 
-		err = relocateDockerfile(s)
+		err = relocateDockerfile(s, opts)
 		if err != nil {
 			return err
 		}
 
+		relocateScale(&s, opts)
+
+		if opts.ConvertLegacyResourceFields {
+			relocateResources(&s)
+		}
+
+		if opts.ResolveImageNames {
+			separator := opts.ImageNameSeparator
+			if separator == "" {
+				separator = types.DefaultImageNameSeparator
+			}
+			s.Image = s.ImageNameWithSeparator(project.Name, separator)
+		}
+
 		project.Services[i] = s
 	}
 
@@ -66,34 +83,31 @@ func normalize(project *types.Project) error {
 	return nil
 }
 
-// Resources with no explicit name are actually named by their key in map
+// Resources with no explicit name are actually named by their key in map, qualified by the project name unless
+// external
 func setNameFromKey(project *types.Project) {
+	names := project.NetworkRuntimeNames()
 	for i, n := range project.Networks {
-		if n.Name == "" {
-			n.Name = fmt.Sprintf("%s_%s", project.Name, i)
-			project.Networks[i] = n
-		}
+		n.Name = names[i]
+		project.Networks[i] = n
 	}
 
+	names = project.VolumeRuntimeNames()
 	for i, v := range project.Volumes {
-		if v.Name == "" {
-			v.Name = fmt.Sprintf("%s_%s", project.Name, i)
-			project.Volumes[i] = v
-		}
+		v.Name = names[i]
+		project.Volumes[i] = v
 	}
 
+	names = project.ConfigRuntimeNames()
 	for i, c := range project.Configs {
-		if c.Name == "" {
-			c.Name = fmt.Sprintf("%s_%s", project.Name, i)
-			project.Configs[i] = c
-		}
+		c.Name = names[i]
+		project.Configs[i] = c
 	}
 
+	names = project.SecretRuntimeNames()
 	for i, s := range project.Secrets {
-		if s.Name == "" {
-			s.Name = fmt.Sprintf("%s_%s", project.Name, i)
-			project.Secrets[i] = s
-		}
+		s.Name = names[i]
+		project.Secrets[i] = s
 	}
 }
 
@@ -140,9 +154,9 @@ func relocateExternalName(project *types.Project) error {
 	return nil
 }
 
-func relocateLogOpt(s types.ServiceConfig) error {
+func relocateLogOpt(s types.ServiceConfig, opts *Options) error {
 	if len(s.LogOpt) != 0 {
-		logrus.Warn("`log_opts` is deprecated. Use the `logging` element")
+		opts.warn("`log_opts` is deprecated. Use the `logging` element")
 		if s.Logging == nil {
 			s.Logging = &types.LoggingConfig{}
 		}
@@ -157,9 +171,9 @@ func relocateLogOpt(s types.ServiceConfig) error {
 	return nil
 }
 
-func relocateLogDriver(s types.ServiceConfig) error {
+func relocateLogDriver(s types.ServiceConfig, opts *Options) error {
 	if s.LogDriver != "" {
-		logrus.Warn("`log_driver` is deprecated. Use the `logging` element")
+		opts.warn("`log_driver` is deprecated. Use the `logging` element")
 		if s.Logging == nil {
 			s.Logging = &types.LoggingConfig{}
 		}
@@ -172,9 +186,57 @@ func relocateLogDriver(s types.ServiceConfig) error {
 	return nil
 }
 
-func relocateDockerfile(s types.ServiceConfig) error {
+// relocateScale reconciles the deprecated `scale` with `deploy.replicas`, copying the one set into the other
+func relocateScale(s *types.ServiceConfig, opts *Options) {
+	if s.Scale != 0 {
+		opts.warn("`scale` is deprecated. Use the `deploy.replicas` element")
+		if s.Deploy == nil {
+			s.Deploy = &types.DeployConfig{}
+		}
+		if s.Deploy.Replicas == nil {
+			replicas := uint64(s.Scale)
+			s.Deploy.Replicas = &replicas
+		}
+	}
+	if s.Scale == 0 && s.Deploy != nil && s.Deploy.Replicas != nil {
+		s.Scale = int(*s.Deploy.Replicas)
+	}
+}
+
+// relocateResources copies `cpus`, `mem_limit` and `mem_reservation` into `deploy.resources` when not set there.
+// Distinct values set in both places are reported by the consistency check
+func relocateResources(s *types.ServiceConfig) {
+	if s.CPUS == 0 && s.MemLimit == 0 && s.MemReservation == 0 {
+		return
+	}
+	if s.Deploy == nil {
+		s.Deploy = &types.DeployConfig{}
+	}
+	if s.CPUS != 0 || s.MemLimit != 0 {
+		if s.Deploy.Resources.Limits == nil {
+			s.Deploy.Resources.Limits = &types.Resource{}
+		}
+		limits := s.Deploy.Resources.Limits
+		if s.CPUS != 0 && limits.NanoCPUs == "" {
+			limits.NanoCPUs = strconv.FormatFloat(float64(s.CPUS), 'f', -1, 32)
+		}
+		if s.MemLimit != 0 && limits.MemoryBytes == 0 {
+			limits.MemoryBytes = s.MemLimit
+		}
+	}
+	if s.MemReservation != 0 {
+		if s.Deploy.Resources.Reservations == nil {
+			s.Deploy.Resources.Reservations = &types.Resource{}
+		}
+		if s.Deploy.Resources.Reservations.MemoryBytes == 0 {
+			s.Deploy.Resources.Reservations.MemoryBytes = s.MemReservation
+		}
+	}
+}
+
+func relocateDockerfile(s types.ServiceConfig, opts *Options) error {
 	if s.Dockerfile != "" {
-		logrus.Warn("`dockerfile` is deprecated. Use the `build` element")
+		opts.warn("`dockerfile` is deprecated. Use the `build` element")
 		if s.Build == nil {
 			s.Build = &types.BuildConfig{}
 		}
@@ -51,7 +51,7 @@ func TestNormalizeNetworkNames(t *testing.T) {
 			},
 		},
 	}
-	err := normalize(&project)
+	err := normalize(&project, &Options{})
 	assert.NilError(t, err)
 	assert.DeepEqual(t, expected, project)
 }
@@ -86,7 +86,22 @@ func TestNormalizeVolumes(t *testing.T) {
 			},
 		},
 	}
-	err := normalize(&project)
+	err := normalize(&project, &Options{})
 	assert.NilError(t, err)
 	assert.DeepEqual(t, expected, project)
 }
+
+func TestNormalizeImageNames(t *testing.T) {
+	project := types.Project{
+		Name:     "myproject",
+		Networks: types.Networks{},
+		Services: types.Services{
+			{Name: "web", Build: &types.BuildConfig{Context: "."}},
+			{Name: "db", Image: "postgres"},
+		},
+	}
+	err := normalize(&project, &Options{ResolveImageNames: true, ImageNameSeparator: "_"})
+	assert.NilError(t, err)
+	assert.Equal(t, project.Services[0].Image, "myproject_web")
+	assert.Equal(t, project.Services[1].Image, "postgres")
+}
@@ -0,0 +1,192 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loader
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/compose-spec/compose-go/schema"
+	"github.com/compose-spec/compose-go/types"
+)
+
+// skipService removes the service name from the project being loaded in SkipInvalidServices mode, as it failed to
+// be loaded with err
+func (o *Options) skipService(name string, err error) {
+	if o.skippedServices == nil {
+		o.skippedServices = &[]types.ServiceLoadError{}
+	}
+	for _, skipped := range *o.skippedServices {
+		if skipped.Name == name {
+			return
+		}
+	}
+	*o.skippedServices = append(*o.skippedServices, types.ServiceLoadError{Name: name, Err: err})
+	o.warn(fmt.Sprintf("service %q is skipped as it is invalid: %s", name, err))
+}
+
+// isSkipped tells if the service name has been removed from the project being loaded
+func (o *Options) isSkipped(name string) bool {
+	if o.skippedServices == nil {
+		return false
+	}
+	for _, skipped := range *o.skippedServices {
+		if skipped.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// skipInvalidServiceDicts removes from configDict the services which don't match the schema, so that the rest of
+// the file can be validated
+func skipInvalidServiceDicts(configDict map[string]interface{}, opts *Options) {
+	services, ok := configDict["services"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for _, name := range sortedKeys(services) {
+		err := schema.Validate(map[string]interface{}{
+			"services": map[string]interface{}{name: services[name]},
+		})
+		if err != nil {
+			opts.skipService(name, err)
+			delete(services, name)
+		}
+	}
+}
+
+// checkConsistencySkippingInvalid checks the consistency of project, removing the services failing to be checked
+// until the rest of the project is consistent. Errors which are not about a service are reported as is
+func checkConsistencySkippingInvalid(project *types.Project, sources []types.ConfigFile, opts *Options) error {
+	for {
+		err := checkConsistency(project)
+		if err == nil {
+			return nil
+		}
+		name, ok := offendingService(project, errorPath(err))
+		if !ok {
+			return err
+		}
+		opts.skipService(name, locateError(err, sources))
+		removeSkippedServices(project, opts)
+	}
+}
+
+// offendingService returns the name of the service of project which declares the attribute at path
+func offendingService(project *types.Project, path string) (string, bool) {
+	found := ""
+	for _, s := range append(project.Services, project.DisabledServices...) {
+		prefix := "services." + s.Name
+		if (path == prefix || strings.HasPrefix(path, prefix+".")) && len(s.Name) > len(found) {
+			found = s.Name
+		}
+	}
+	return found, found != ""
+}
+
+// removeSkippedServices removes the skipped services from project, and the references other services make to them
+// with a warning
+func removeSkippedServices(project *types.Project, opts *Options) {
+	keep := func(services types.Services) types.Services {
+		var kept types.Services
+		for _, s := range services {
+			if !opts.isSkipped(s.Name) {
+				kept = append(kept, s)
+			}
+		}
+		return kept
+	}
+	project.Services = keep(project.Services)
+	project.DisabledServices = keep(project.DisabledServices)
+
+	ignored := func(s types.ServiceConfig, attribute, service string) {
+		opts.warn(fmt.Sprintf("service %q: %s refers to skipped service %s, ignored", s.Name, attribute, service))
+	}
+	for i, s := range project.Services {
+		for _, dependency := range sortedKeys(s.DependsOn) {
+			if opts.isSkipped(dependency) {
+				ignored(s, "depends_on", dependency)
+				delete(s.DependsOn, dependency)
+			}
+		}
+
+		var links []types.ServiceLink
+		for _, link := range s.Links {
+			if opts.isSkipped(link.Service) {
+				ignored(s, "links", link.Service)
+				continue
+			}
+			links = append(links, link)
+		}
+		if len(links) != len(s.Links) {
+			s.Links = links
+		}
+
+		var sources []types.VolumesFromSource
+		for _, source := range s.VolumesFrom {
+			if source.Kind == types.VolumesFromService && opts.isSkipped(source.Name) {
+				ignored(s, "volumes_from", source.Name)
+				continue
+			}
+			sources = append(sources, source)
+		}
+		if len(sources) != len(s.VolumesFrom) {
+			s.VolumesFrom = sources
+		}
+
+		networkMode := s.NetworkMode
+		for _, namespace := range []struct {
+			attribute string
+			mode      *string
+		}{
+			{"network_mode", &s.NetworkMode},
+			{"ipc", &s.Ipc},
+			{"pid", &s.Pid},
+		} {
+			service := strings.TrimPrefix(*namespace.mode, types.ServicePrefix)
+			if strings.HasPrefix(*namespace.mode, types.ServicePrefix) && opts.isSkipped(service) {
+				ignored(s, namespace.attribute, service)
+				*namespace.mode = ""
+			}
+		}
+		if networkMode != s.NetworkMode && len(s.Networks) == 0 {
+			// like a service declaring no network, the service is attached to the default network
+			s.Networks = map[string]*types.ServiceNetworkConfig{"default": nil}
+			if project.Networks == nil {
+				project.Networks = types.Networks{}
+			}
+			if _, ok := project.Networks["default"]; !ok {
+				project.Networks["default"] = types.NetworkConfig{}
+			}
+		}
+		project.Services[i] = s
+	}
+}
+
+// loadErrors returns the services skipped while loading a project, by name
+func (o *Options) loadErrors() []types.ServiceLoadError {
+	if o.skippedServices == nil || len(*o.skippedServices) == 0 {
+		return nil
+	}
+	errs := append([]types.ServiceLoadError{}, *o.skippedServices...)
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].Name < errs[j].Name
+	})
+	return errs
+}
@@ -0,0 +1,118 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loader
+
+import (
+	"testing"
+
+	"github.com/compose-spec/compose-go/types"
+	"gotest.tools/v3/assert"
+	is "gotest.tools/v3/assert/cmp"
+)
+
+func loadSkippingInvalid(t *testing.T, content string) (*types.Project, []string) {
+	t.Helper()
+	var warnings []string
+	project, err := loadCached(types.ConfigDetails{
+		WorkingDir:  "/code",
+		ConfigFiles: []types.ConfigFile{{Filename: "compose.yaml", Content: []byte(content)}},
+	}, func(options *Options) {
+		options.SetProjectName("skip", true)
+		options.SkipInvalidServices = true
+		options.Warn = func(message string) {
+			warnings = append(warnings, message)
+		}
+	})
+	assert.NilError(t, err)
+	return project, warnings
+}
+
+const brokenPort = `
+services:
+  api:
+    image: api
+  web:
+    image: nginx
+    ports:
+      - "80:80:80:80"
+  worker:
+    image: worker
+`
+
+func TestSkipInvalidServices(t *testing.T) {
+	_, err := loadCached(types.ConfigDetails{
+		WorkingDir:  "/code",
+		ConfigFiles: []types.ConfigFile{{Filename: "compose.yaml", Content: []byte(brokenPort)}},
+	}, func(options *Options) {
+		options.SetProjectName("skip", true)
+	})
+	assert.ErrorContains(t, err, "ports")
+
+	project, warnings := loadSkippingInvalid(t, brokenPort)
+	assert.DeepEqual(t, project.ServiceNames(), []string{"api", "worker"})
+	assert.Equal(t, len(project.LoadErrors), 1)
+	assert.Equal(t, project.LoadErrors[0].Name, "web")
+	assert.ErrorContains(t, project.LoadErrors[0], `service "web": `)
+	assert.ErrorContains(t, project.LoadErrors[0].Err, "ports")
+	assert.Equal(t, len(warnings), 1)
+	assert.Check(t, is.Contains(warnings[0], `service "web" is skipped as it is invalid`))
+}
+
+func TestSkipInvalidServicesReferences(t *testing.T) {
+	project, warnings := loadSkippingInvalid(t, `
+services:
+  web:
+    image: nginx
+    stop_signal: SIGNOPE
+  api:
+    image: api
+    depends_on:
+      web:
+        condition: service_started
+      db:
+        condition: service_healthy
+    links:
+      - web
+    volumes_from:
+      - web:ro
+  sidecar:
+    image: sidecar
+    network_mode: service:web
+  db:
+    image: postgres
+    cpus: lots
+`)
+	assert.DeepEqual(t, project.ServiceNames(), []string{"api", "sidecar"})
+	assert.Equal(t, len(project.LoadErrors), 2)
+	assert.Equal(t, project.LoadErrors[0].Name, "db")
+	assert.Equal(t, project.LoadErrors[1].Name, "web")
+	assert.ErrorContains(t, project.LoadErrors[1], "invalid stop_signal")
+
+	api, err := project.GetService("api")
+	assert.NilError(t, err)
+	assert.Equal(t, len(api.DependsOn), 0)
+	assert.Equal(t, len(api.Links), 0)
+	assert.Equal(t, len(api.VolumesFrom), 0)
+	sidecar, err := project.GetService("sidecar")
+	assert.NilError(t, err)
+	assert.Equal(t, sidecar.NetworkMode, "")
+	assert.Check(t, is.Contains(sidecar.Networks, "default"))
+
+	assert.Check(t, is.Contains(warnings, `service "api": depends_on refers to skipped service db, ignored`))
+	assert.Check(t, is.Contains(warnings, `service "api": links refers to skipped service web, ignored`))
+	assert.Check(t, is.Contains(warnings, `service "sidecar": network_mode refers to skipped service web, ignored`))
+}
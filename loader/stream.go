@@ -0,0 +1,289 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loader
+
+import (
+	"bytes"
+
+	"github.com/compose-spec/compose-go/types"
+	"github.com/pkg/errors"
+)
+
+// errStreamUnsupported is returned while streaming a compose file which requires the full document to be loaded
+var errStreamUnsupported = errors.New("compose file can't be streamed")
+
+// LoadStream reads a ConfigDetails and returns a fully loaded configuration, like Load does, but parses,
+// interpolates, validates and transforms services one at a time, so that only the raw content and the typed
+// model are kept in memory for the whole document. This is designed for very large generated files.
+//
+// Streaming only applies to a single ConfigFile set with raw Content, using block style for the `services`
+// section and with no service relying on `extends` or on YAML anchors defined after the `services` section.
+// Any other ConfigDetails is transparently loaded using Load.
+func LoadStream(configDetails types.ConfigDetails, options ...func(*Options)) (*types.Project, error) {
+	if len(configDetails.ConfigFiles) != 1 || configDetails.ConfigFiles[0].Content == nil {
+		return Load(configDetails, options...)
+	}
+
+	opts := toOptions(configDetails, options)
+	cfg, err := streamConfig(configDetails.ConfigFiles[0], configDetails, opts)
+	if err == errStreamUnsupported {
+		return Load(configDetails, options...)
+	}
+	if err != nil {
+		return nil, markError(err)
+	}
+	project, err := loadProject([]*types.Config{cfg}, configDetails.ConfigFiles, configDetails, opts)
+	if err != nil {
+		return nil, markError(err)
+	}
+	return project, nil
+}
+
+func streamConfig(file types.ConfigFile, configDetails types.ConfigDetails, opts *Options) (*types.Config, error) {
+	if err := opts.yamlLimits().checkInputSize(file.Content); err != nil {
+		return nil, err
+	}
+	layout, err := splitServices(file.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(layout.services) == 0 {
+		return nil, errStreamUnsupported
+	}
+
+	// all top-level sections but services are loaded the regular way, those are expected to be small
+	configDict := map[string]interface{}{}
+	if len(bytes.TrimSpace(layout.others)) > 0 {
+		configDict, err = parseStreamed(file.Filename, layout.others, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := configDict["include"]; ok {
+		return nil, errStreamUnsupported
+	}
+	if err := prepareStreamedDict(configDict, "", opts); err != nil {
+		return nil, err
+	}
+	cfg, err := loadSections(file.Filename, configDict, configDetails, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	loaded := map[string]bool{}
+	for i, chunk := range layout.services {
+		// release the raw chunk as soon as it has been parsed
+		layout.services[i] = nil
+		var source []byte
+		if layout.anchors != nil {
+			// anchors declared before the services section might be used by services
+			source = append(append(source, layout.anchors...), chunk...)
+		} else {
+			source = append([]byte("services:\n"), chunk...)
+		}
+		dict, err := parseStreamed(file.Filename, source, opts)
+		if err != nil {
+			return nil, err
+		}
+		services, ok := dict["services"].(map[string]interface{})
+		if !ok || len(services) != 1 {
+			return nil, errStreamUnsupported
+		}
+
+		var name string
+		for name = range services {
+		}
+		if loaded[name] {
+			return nil, errStreamUnsupported
+		}
+		loaded[name] = true
+		if service, ok := services[name].(map[string]interface{}); ok {
+			if _, ok := service["extends"]; ok && !opts.SkipExtends {
+				return nil, errStreamUnsupported
+			}
+		}
+
+		wrapper := map[string]interface{}{"services": services}
+		if err := prepareStreamedDict(wrapper, cfg.Version, opts); err != nil {
+			return nil, err
+		}
+		serviceDict, ok := getSection(wrapper, "services")[name].(map[string]interface{})
+		if !ok {
+			// skipped as invalid
+			continue
+		}
+		serviceConfig, err := loadService(name, serviceDict, configDetails.WorkingDir, configDetails.LookupEnv, opts)
+		if err != nil && opts.SkipInvalidServices {
+			opts.skipService(name, err)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if opts.discardEnvFiles {
+			serviceConfig.EnvFile = nil
+		}
+		cfg.Services = append(cfg.Services, *serviceConfig)
+	}
+	return cfg, nil
+}
+
+// parseStreamed parses a part of the content of a compose file, within the limits set by opts
+func parseStreamed(filename string, source []byte, opts *Options) (map[string]interface{}, error) {
+	documents, err := parseConfigFile(types.ConfigFile{Filename: filename, Content: source}, opts.yamlLimits())
+	if err != nil && filename != "" {
+		return nil, errors.Wrapf(err, "failed to parse %s", filename)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(documents) != 1 {
+		return nil, errStreamUnsupported
+	}
+	return documents[0].Config, nil
+}
+
+// prepareStreamedDict applies the same pre-processing to a partial dict as loadConfigDict does to the whole
+// document. version is the `version` declared by the rest of the document, which the services of configDict are
+// checked against
+func prepareStreamedDict(configDict map[string]interface{}, version string, opts *Options) error {
+	if !opts.SkipInterpolation {
+		interpolated, err := interpolateConfig(configDict, opts)
+		if err != nil {
+			return err
+		}
+		for k, v := range interpolated {
+			configDict[k] = v
+		}
+	}
+	if err := checkUnknownKeys(configDict, opts); err != nil {
+		return err
+	}
+	if !opts.SkipValidation {
+		if opts.SkipInvalidServices {
+			skipInvalidServiceDicts(configDict, opts)
+		}
+		if err := validateSchema(configDict, opts); err != nil {
+			return err
+		}
+	}
+	if err := checkSupportedAttributes(configDict, opts); err != nil {
+		return err
+	}
+	if opts.EnforceVersionCompatibility {
+		versioned := configDict
+		if version != "" {
+			versioned = map[string]interface{}{"version": version, "services": configDict["services"]}
+		}
+		if err := checkVersionCompatibility(versioned); err != nil {
+			return err
+		}
+	}
+	groupXFieldsIntoExtensions(configDict)
+	return nil
+}
+
+// streamLayout is a compose file content split into independently parsable parts
+type streamLayout struct {
+	// others is the content without the services section
+	others []byte
+	// anchors is the content preceding the services section, when it might declare YAML anchors
+	anchors []byte
+	// services are the lines declaring each service
+	services [][]byte
+}
+
+// splitServices splits the block style `services` section of a compose file into one chunk per service, based on
+// indentation. errStreamUnsupported is returned for any content this can't be safely applied to.
+func splitServices(content []byte) (*streamLayout, error) {
+	layout := &streamLayout{}
+	var (
+		others      bytes.Buffer
+		inServices  bool
+		indentation = -1
+		current     []byte
+	)
+	flush := func() {
+		if current != nil {
+			layout.services = append(layout.services, current)
+			current = nil
+		}
+	}
+
+	for _, line := range bytes.SplitAfter(content, []byte("\n")) {
+		trimmed := bytes.TrimSpace(line)
+		if bytes.HasPrefix(trimmed, []byte("---")) || bytes.HasPrefix(trimmed, []byte("...")) || bytes.ContainsRune(line, '\t') {
+			return nil, errStreamUnsupported
+		}
+		blank := len(trimmed) == 0 || trimmed[0] == '#'
+		indent := len(line) - len(bytes.TrimLeft(line, " "))
+
+		if !inServices {
+			if !blank && indent == 0 && bytes.HasPrefix(trimmed, []byte("services:")) {
+				rest := bytes.TrimSpace(trimmed[len("services:"):])
+				if len(rest) > 0 && rest[0] != '#' {
+					// flow style or anchored services section
+					return nil, errStreamUnsupported
+				}
+				if layout.services != nil {
+					// duplicated services section
+					return nil, errStreamUnsupported
+				}
+				inServices = true
+				if bytes.ContainsRune(others.Bytes(), '&') {
+					layout.anchors = append(append([]byte{}, others.Bytes()...), "services:\n"...)
+				}
+				layout.services = [][]byte{}
+				continue
+			}
+			others.Write(line)
+			continue
+		}
+
+		switch {
+		case blank:
+			if current != nil {
+				current = append(current, line...)
+			}
+			continue
+		case indent == 0:
+			flush()
+			inServices = false
+			others.Write(line)
+			continue
+		case indentation < 0:
+			indentation = indent
+		}
+
+		switch {
+		case indent == indentation:
+			if trimmed[0] == '-' || trimmed[0] == '?' {
+				return nil, errStreamUnsupported
+			}
+			flush()
+			current = append([]byte{}, line...)
+		case indent > indentation && current != nil:
+			current = append(current, line...)
+		default:
+			return nil, errStreamUnsupported
+		}
+	}
+	flush()
+	layout.others = others.Bytes()
+	return layout, nil
+}
@@ -0,0 +1,325 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loader
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/compose-spec/compose-go/types"
+	"gotest.tools/v3/assert"
+	is "gotest.tools/v3/assert/cmp"
+)
+
+func streamConfigDetails(content []byte, env map[string]string) types.ConfigDetails {
+	workingDir, err := os.Getwd()
+	if err != nil {
+		panic(err)
+	}
+	return types.ConfigDetails{
+		WorkingDir: workingDir,
+		ConfigFiles: []types.ConfigFile{
+			{Filename: "filename.yml", Content: content},
+		},
+		Environment: env,
+	}
+}
+
+func TestLoadStreamFullExample(t *testing.T) {
+	b, err := ioutil.ReadFile("full-example.yml")
+	assert.NilError(t, err)
+
+	homeDir, err := os.UserHomeDir()
+	assert.NilError(t, err)
+	env := map[string]string{"HOME": homeDir, "QUX": "qux_from_environment"}
+	skip := func(options *Options) {
+		options.SkipConsistencyCheck = true
+		options.SkipNormalization = true
+	}
+
+	expected, err := loadCached(streamConfigDetails(b, env), skip)
+	assert.NilError(t, err)
+	actual, err := LoadStream(streamConfigDetails(b, env), skip)
+	assert.NilError(t, err)
+
+	assert.Check(t, is.DeepEqual(serviceSort(expected.Services), serviceSort(actual.Services)))
+	assert.Check(t, is.DeepEqual(expected.Networks, actual.Networks))
+	assert.Check(t, is.DeepEqual(expected.Volumes, actual.Volumes))
+	assert.Check(t, is.DeepEqual(expected.Secrets, actual.Secrets))
+	assert.Check(t, is.DeepEqual(expected.Configs, actual.Configs))
+	assert.Check(t, is.DeepEqual(expected.Extensions, actual.Extensions))
+}
+
+func TestLoadStreamWithAnchors(t *testing.T) {
+	b := []byte(`
+x-common: &common
+  image: busybox
+  privileged: yes
+services:
+  foo:
+    <<: *common
+    read_only: on
+    labels:
+      created: 2001-12-14
+  bar:
+    <<: *common
+    privileged: no
+`)
+	layout, err := splitServices(b)
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(layout.services, 2))
+
+	expected, err := loadCached(streamConfigDetails(b, nil))
+	assert.NilError(t, err)
+	actual, err := LoadStream(streamConfigDetails(b, nil))
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(serviceSort(expected.Services), serviceSort(actual.Services)))
+
+	foo, err := actual.GetService("foo")
+	assert.NilError(t, err)
+	assert.Check(t, foo.Privileged)
+	assert.Check(t, foo.ReadOnly)
+	assert.Check(t, is.Equal(foo.Labels["created"], "2001-12-14"))
+	bar, err := actual.GetService("bar")
+	assert.NilError(t, err)
+	assert.Check(t, !bar.Privileged)
+}
+
+func TestLoadStreamValidationError(t *testing.T) {
+	b := []byte(`
+services:
+  foo:
+    image: busybox
+    ports: "8080:80"
+`)
+	_, err := LoadStream(streamConfigDetails(b, nil))
+	assert.ErrorContains(t, err, "services.foo.ports must be a list")
+}
+
+func TestLoadStreamFallbackOnExtends(t *testing.T) {
+	b := []byte(`
+services:
+  base:
+    image: busybox
+    environment:
+      FOO: bar
+  foo:
+    extends: base
+`)
+	_, err := streamConfig(types.ConfigFile{Content: b}, streamConfigDetails(b, nil), toOptions(streamConfigDetails(b, nil), nil))
+	assert.Equal(t, err, errStreamUnsupported)
+
+	project, err := LoadStream(streamConfigDetails(b, nil))
+	assert.NilError(t, err)
+	foo, err := project.GetService("foo")
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(foo.Image, "busybox"))
+	assert.Check(t, is.Equal(*foo.Environment["FOO"], "bar"))
+}
+
+func TestLoadStreamHonorsOptions(t *testing.T) {
+	b := []byte(`
+version: "3.0"
+services:
+  foo:
+    image: busybox
+  bar:
+    image: busybox
+    ports: "8080:80"
+  baz:
+    image: busybox
+    init: true
+`)
+	details := streamConfigDetails(b, nil)
+	load := func(options ...func(*Options)) (*types.Project, error) {
+		opts := toOptions(details, append([]func(*Options){func(options *Options) {
+			options.Name = "stream"
+			options.Warn = func(string) {}
+		}}, options...))
+		cfg, err := streamConfig(details.ConfigFiles[0], details, opts)
+		if err != nil {
+			return nil, err
+		}
+		return loadProject([]*types.Config{cfg}, details.ConfigFiles, details, opts)
+	}
+
+	_, err := load(func(options *Options) {
+		options.MaxInputSize = 16
+	})
+	assert.ErrorContains(t, err, "exceeding the maximum input size of 16 bytes")
+
+	project, err := load(func(options *Options) {
+		options.SkipInvalidServices = true
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.ServiceNames(), []string{"baz", "foo"})
+	assert.Check(t, is.Len(project.LoadErrors, 1))
+	assert.Check(t, is.Equal(project.LoadErrors[0].Name, "bar"))
+
+	_, err = load(func(options *Options) {
+		options.SkipInvalidServices = true
+		options.EnforceVersionCompatibility = true
+	})
+	assert.ErrorContains(t, err, `services.baz.init requires version 3.7 of the compose file format`)
+
+	// parse errors are reported rather than falling back to Load
+	_, err = load(func(options *Options) {
+		options.MaxNestingDepth = 2
+	})
+	assert.ErrorContains(t, err, "failed to parse filename.yml")
+	assert.Check(t, err != errStreamUnsupported)
+}
+
+func TestLoadStreamReducesPeakHeap(t *testing.T) {
+	if testing.Short() {
+		t.Skip("measures the peak heap of loading a large file")
+	}
+	content := generateServices(3000)
+	peak := func(load func(types.ConfigDetails, ...func(*Options)) (*types.Project, error)) uint64 {
+		return measurePeakHeap(func() {
+			_, err := load(streamConfigDetails(content, nil), func(options *Options) {
+				options.Warn = func(string) {}
+			})
+			assert.NilError(t, err)
+		})
+	}
+	loadPeak, streamPeak := peak(Load), peak(LoadStream)
+	// streaming is expected to reduce the peak heap by at least 40%
+	assert.Check(t, streamPeak*10 <= loadPeak*6, "peak heap of LoadStream is %d bytes, Load's is %d bytes", streamPeak, loadPeak)
+}
+
+func generateServices(count int) []byte {
+	var sb strings.Builder
+	sb.WriteString("services:\n")
+	for i := 0; i < count; i++ {
+		fmt.Fprintf(&sb, `  service%[1]d:
+    image: registry.example.com/team/service%[1]d:${TAG:-latest}
+    command: ["run", "--port", "80%[1]d"]
+    environment:
+      SERVICE_NAME: service%[1]d
+      LOG_LEVEL: debug
+      DATABASE_URL: postgres://db:5432/service%[1]d
+    labels:
+      com.example.team: team%[1]d
+      com.example.description: "generated service number %[1]d"
+    ports:
+      - "%[2]d:80"
+    volumes:
+      - data:/var/lib/service%[1]d
+    healthcheck:
+      test: ["CMD", "curl", "-f", "http://localhost"]
+      interval: 30s
+      retries: 3
+    deploy:
+      resources:
+        limits:
+          memory: 128M
+`, i, 10000+i)
+	}
+	sb.WriteString("volumes:\n  data: {}\n")
+	return []byte(sb.String())
+}
+
+// measurePeakHeap samples the heap while fn runs and returns the highest observed live heap size
+func measurePeakHeap(fn func()) uint64 {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	base := stats.HeapAlloc
+	peak := base
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		var s runtime.MemStats
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond):
+				runtime.ReadMemStats(&s)
+				if s.HeapAlloc > peak {
+					peak = s.HeapAlloc
+				}
+			}
+		}
+	}()
+	fn()
+	close(done)
+	wg.Wait()
+	return peak - base
+}
+
+func benchmarkLoadLarge(b *testing.B, load func(types.ConfigDetails, ...func(*Options)) (*types.Project, error)) {
+	content := generateServices(5000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	var peak uint64
+	for i := 0; i < b.N; i++ {
+		peak += measurePeakHeap(func() {
+			if _, err := load(streamConfigDetails(content, nil)); err != nil {
+				b.Fatal(err)
+			}
+		})
+	}
+	b.ReportMetric(float64(peak)/float64(b.N)/(1<<20), "peak-heap-MB")
+}
+
+func BenchmarkLoadLarge(b *testing.B) {
+	benchmarkLoadLarge(b, Load)
+}
+
+func BenchmarkLoadStreamLarge(b *testing.B) {
+	benchmarkLoadLarge(b, LoadStream)
+}
+
+// manyConfigFiles generates a project split into count files, like the overrides generated for large deployments
+func manyConfigFiles(count int) []types.ConfigFile {
+	files := make([]types.ConfigFile, count)
+	for i := range files {
+		files[i] = types.ConfigFile{Filename: fmt.Sprintf("compose%d.yaml", i), Content: generateServices(100)}
+	}
+	return files
+}
+
+func BenchmarkLoadManyFiles(b *testing.B) {
+	files := manyConfigFiles(30)
+	for _, concurrency := range []int{1, 8} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			defer func(previous int) { maxConcurrentParsing = previous }(maxConcurrentParsing)
+			maxConcurrentParsing = concurrency
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, err := Load(types.ConfigDetails{WorkingDir: "/code", ConfigFiles: files}, func(options *Options) {
+					options.Name = "many"
+					options.Warn = func(string) {}
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loader
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/compose-spec/compose-go/errdefs"
+	"github.com/compose-spec/compose-go/schema"
+	"github.com/pkg/errors"
+)
+
+// resourceDefinitions maps top-level sections to the schema definition of their entries
+var resourceDefinitions = map[string]string{
+	"services": "service",
+	"networks": "network",
+	"volumes":  "volume",
+	"secrets":  "secret",
+	"configs":  "config",
+}
+
+// checkUnknownKeys looks for keys which are neither declared by the schema nor extensions, at the top-level and in
+// services, networks, volumes, secrets and configs. In strict mode the first one is reported as an error, otherwise
+// all of them are reported as warnings
+func checkUnknownKeys(dict map[string]interface{}, opts *Options) error {
+	unknown, err := unknownKeys(dict)
+	if err != nil {
+		return err
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	if opts.Strict {
+		return errors.Wrap(errdefs.ErrInvalid, unknown[0])
+	}
+	for _, message := range unknown {
+		opts.warn(message)
+	}
+	return nil
+}
+
+func unknownKeys(dict map[string]interface{}) ([]string, error) {
+	known, err := schema.Properties("")
+	if err != nil {
+		return nil, err
+	}
+	messages := unknownKeysIn(dict, known, "")
+
+	sections := make([]string, 0, len(resourceDefinitions))
+	for section := range resourceDefinitions {
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+	for _, section := range sections {
+		resources, ok := dict[section].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		known, err := schema.Properties(resourceDefinitions[section])
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, 0, len(resources))
+		for name := range resources {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if resource, ok := resources[name].(map[string]interface{}); ok {
+				messages = append(messages, unknownKeysIn(resource, known, section+"."+name)...)
+			}
+		}
+	}
+	return messages, nil
+}
+
+func unknownKeysIn(dict map[string]interface{}, known []string, path string) []string {
+	keys := make([]string, 0, len(dict))
+	for key := range dict {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var messages []string
+	for _, key := range keys {
+		if strings.HasPrefix(key, "x-") || contains(known, key) {
+			continue
+		}
+		location := "at top-level"
+		if path != "" {
+			location = "in " + path
+		}
+		message := fmt.Sprintf("unknown key %q %s", key, location)
+		if suggestion := suggest(key, known); suggestion != "" {
+			message = fmt.Sprintf("%s, did you mean %q?", message, suggestion)
+		}
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// suggest returns the known key closest to key, if close enough to be a likely typo
+func suggest(key string, known []string) string {
+	best, bestDistance := "", len(key)/3+2
+	for _, candidate := range known {
+		if d := editDistance(key, candidate); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// editDistance computes the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
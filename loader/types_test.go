@@ -41,7 +41,7 @@ func TestMarshallConfig(t *testing.T) {
 	// Make sure the expected still
 	dict, err := ParseYAML([]byte(expected))
 	assert.NilError(t, err)
-	_, err = Load(buildConfigDetails(dict, map[string]string{}), func(options *Options) {
+	_, err = loadCached(buildConfigDetails(dict, map[string]string{}), func(options *Options) {
 		options.SkipNormalization = true
 		options.SkipConsistencyCheck = true
 	})
@@ -63,7 +63,7 @@ func TestJSONMarshallConfig(t *testing.T) {
 
 	dict, err := ParseYAML([]byte(expected))
 	assert.NilError(t, err)
-	_, err = Load(buildConfigDetails(dict, map[string]string{}), func(options *Options) {
+	_, err = loadCached(buildConfigDetails(dict, map[string]string{}), func(options *Options) {
 		options.SkipNormalization = true
 		options.SkipConsistencyCheck = true
 	})
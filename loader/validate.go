@@ -18,6 +18,11 @@ package loader
 
 import (
 	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/compose-spec/compose-go/errdefs"
 	"github.com/compose-spec/compose-go/types"
@@ -26,34 +31,857 @@ import (
 
 // checkConsistency validate a compose model is consistent
 func checkConsistency(project *types.Project) error {
+	for _, s := range append(project.Services, project.DisabledServices...) {
+		if err := checkProfiles(s); err != nil {
+			return err
+		}
+	}
 	for _, s := range project.Services {
 		if s.Build == nil && s.Image == "" {
-			return errors.Wrapf(errdefs.ErrInvalid, "service %q has neither an image nor a build context specified", s.Name)
+			return errorAt("services."+s.Name, errors.Wrapf(errdefs.ErrInvalid, "service %q has neither an image nor a build context specified", s.Name))
+		}
+
+		if s.HealthCheck != nil {
+			if err := s.HealthCheck.Test.Validate(); err != nil {
+				return errorAt("services."+s.Name+".healthcheck.test", errors.Wrapf(err, "service %q", s.Name))
+			}
+		}
+
+		if s.StopSignal != "" && !validSignal(s.StopSignal) {
+			return errorAt("services."+s.Name+".stop_signal", errors.Wrapf(errdefs.ErrInvalid, "service %q has an invalid stop_signal %q, expected a signal name like SIGTERM or number", s.Name, s.StopSignal))
+		}
+		if s.OomScoreAdj < -1000 || s.OomScoreAdj > 1000 {
+			return errorAt("services."+s.Name+".oom_score_adj", errors.Wrapf(errdefs.ErrInvalid, "service %q has an oom_score_adj of %d, out of the [-1000, 1000] range", s.Name, s.OomScoreAdj))
+		}
+		if err := checkBlkioConfig(s); err != nil {
+			return err
+		}
+
+		if s.Scale != 0 && s.Deploy != nil && s.Deploy.Replicas != nil && uint64(s.Scale) != *s.Deploy.Replicas {
+			return errorAt("services."+s.Name+".scale", errors.Wrapf(errdefs.ErrInvalid, "service %q can't set distinct values on 'scale' (%d) and 'deploy.replicas' (%d)", s.Name, s.Scale, *s.Deploy.Replicas))
+		}
+
+		if err := checkEnum("services."+s.Name+".cgroup", s.Cgroup, types.CgroupHost, types.CgroupPrivate); err != nil {
+			return err
+		}
+		if err := checkEnum("services."+s.Name+".uts", s.Uts, "host"); err != nil {
+			return err
+		}
+		if err := checkEnum("services."+s.Name+".isolation", s.Isolation, "default", "process", "hyperv"); err != nil {
+			return err
+		}
+
+		if err := checkResources(s); err != nil {
+			return err
+		}
+
+		if err := checkExpose(s); err != nil {
+			return err
+		}
+		if err := checkDevices(s); err != nil {
+			return err
+		}
+
+		if err := checkSecurityOptions(s); err != nil {
+			return err
+		}
+
+		if spec := s.CredentialSpec; spec != nil {
+			if err := checkCredentialSpec(project, s.Name, spec); err != nil {
+				return err
+			}
+		}
+
+		if err := checkPlatforms(s, project.Environment); err != nil {
+			return err
+		}
+
+		if err := checkNamespaces(project, s); err != nil {
+			return err
 		}
 
-		for network := range s.Networks {
-			if _, ok := project.Networks[network]; !ok {
-				return errors.Wrap(errdefs.ErrInvalid, fmt.Sprintf("service %q refers to undefined network %s", s.Name, network))
+		for i, port := range s.Ports {
+			if err := port.ValidatePublished(); err != nil {
+				return errorAt(fmt.Sprintf("services.%s.ports.%d.published", s.Name, i), errors.Wrapf(err, "service %q", s.Name))
 			}
 		}
-		for _, volume := range s.Volumes {
+
+		if err := checkUlimits(s.Ulimits, "services."+s.Name+".ulimits"); err != nil {
+			return errors.Wrapf(err, "service %q", s.Name)
+		}
+
+		for dependency, config := range s.DependsOn {
+			switch config.Condition {
+			case types.ServiceConditionStarted, types.ServiceConditionHealthy, types.ServiceConditionCompletedSuccessfully:
+			default:
+				return errorAt("services."+s.Name+".depends_on."+dependency, errors.Wrapf(errdefs.ErrInvalid, "service %q depends on %q with unknown condition %q", s.Name, dependency, config.Condition))
+			}
+		}
+
+		if s.Develop != nil {
+			for i, trigger := range s.Develop.Watch {
+				path := fmt.Sprintf("services.%s.develop.watch.%d", s.Name, i)
+				switch trigger.Action {
+				case types.WatchActionSync, types.WatchActionSyncRestart:
+					if trigger.Target == "" {
+						return errorAt(path, errors.Wrapf(errdefs.ErrInvalid, "service %q watches %s with action %s but doesn't set a target", s.Name, trigger.Path, trigger.Action))
+					}
+				case types.WatchActionRebuild:
+				default:
+					return errorAt(path+".action", errors.Wrapf(errdefs.ErrInvalid, "service %q watches %s with unknown action %q", s.Name, trigger.Path, trigger.Action))
+				}
+			}
+		}
+
+		if s.Build != nil {
+			if err := checkUlimits(s.Build.Ulimits, "services."+s.Name+".build.ulimits"); err != nil {
+				return errors.Wrapf(err, "service %q build", s.Name)
+			}
+			for name, context := range s.Build.AdditionalContexts {
+				if context == "" {
+					return errorAt("services."+s.Name+".build.additional_contexts."+name, errors.Wrapf(errdefs.ErrInvalid, "service %q declares additional build context %q with an empty value", s.Name, name))
+				}
+			}
+			for i, secret := range s.Build.Secrets {
+				if _, ok := project.Secrets[secret.Source]; !ok {
+					return errorAt(fmt.Sprintf("services.%s.build.secrets.%d", s.Name, i), errors.Wrap(errdefs.ErrInvalid, fmt.Sprintf("service %q build refers to undefined secret %s", s.Name, secret.Source)))
+				}
+			}
+		}
+
+		for network, config := range s.Networks {
+			definition, ok := project.Networks[network]
+			if !ok {
+				return errorAt("services."+s.Name+".networks."+network, errors.Wrap(errdefs.ErrInvalid, fmt.Sprintf("service %q refers to undefined network %s", s.Name, network)))
+			}
+			if config != nil && config.Ipv4Address != "" && !definition.External.External && !hasSubnet(definition.Ipam) {
+				return errorAt("services."+s.Name+".networks."+network+".ipv4_address", errors.Wrapf(errdefs.ErrInvalid, "service %q uses a static ipv4_address on network %s, which doesn't define an ipam subnet", s.Name, network))
+			}
+		}
+		for i, volume := range s.Volumes {
+			path := fmt.Sprintf("services.%s.volumes.%d", s.Name, i)
 			switch volume.Type {
 			case types.VolumeTypeVolume:
 				if volume.Source != "" { // non anonymous volumes
 					if _, ok := project.Volumes[volume.Source]; !ok {
-						return errors.Wrap(errdefs.ErrInvalid, fmt.Sprintf("service %q refers to undefined volume %s", s.Name, volume.Source))
+						return errorAt(path, errors.Wrap(errdefs.ErrInvalid, fmt.Sprintf("service %q refers to undefined volume %s", s.Name, volume.Source)))
 					}
 				}
+			case types.VolumeTypeBind:
+				if volume.Volume != nil && volume.Volume.NoCopy {
+					return errorAt(path, errors.Wrapf(errdefs.ErrInvalid, "service %q: bind mount %s can't set volume.nocopy", s.Name, volume.Target))
+				}
+			case types.VolumeTypeTmpfs:
+				if volume.Source != "" {
+					return errorAt(path, errors.Wrapf(errdefs.ErrInvalid, "service %q: tmpfs mount %s can't have a source", s.Name, volume.Target))
+				}
 			}
 		}
-		for _, secret := range s.Secrets {
+		if err := checkMountTargets(s); err != nil {
+			return err
+		}
+		for i, secret := range s.Secrets {
 			if _, ok := project.Secrets[secret.Source]; !ok {
-				return errors.Wrap(errdefs.ErrInvalid, fmt.Sprintf("service %q refers to undefined secret %s", s.Name, secret.Source))
+				return errorAt(fmt.Sprintf("services.%s.secrets.%d", s.Name, i), errors.Wrap(errdefs.ErrInvalid, fmt.Sprintf("service %q refers to undefined secret %s", s.Name, secret.Source)))
 			}
 		}
-		for _, config := range s.Configs {
+		for i, config := range s.Configs {
 			if _, ok := project.Configs[config.Source]; !ok {
-				return errors.Wrap(errdefs.ErrInvalid, fmt.Sprintf("service %q refers to undefined config %s", s.Name, config.Source))
+				return errorAt(fmt.Sprintf("services.%s.configs.%d", s.Name, i), errors.Wrap(errdefs.ErrInvalid, fmt.Sprintf("service %q refers to undefined config %s", s.Name, config.Source)))
+			}
+		}
+	}
+	if err := checkVolumesFromCycles(project); err != nil {
+		return err
+	}
+	return checkContainerNames(project)
+}
+
+// signals are the names of the signals containers can be stopped with, without their SIG prefix
+var signals = map[string]bool{
+	"ABRT": true, "ALRM": true, "BUS": true, "CHLD": true, "CLD": true, "CONT": true, "FPE": true, "HUP": true,
+	"ILL": true, "INT": true, "IO": true, "IOT": true, "KILL": true, "PIPE": true, "POLL": true, "PROF": true,
+	"PWR": true, "QUIT": true, "SEGV": true, "STKFLT": true, "STOP": true, "SYS": true, "TERM": true, "TRAP": true,
+	"TSTP": true, "TTIN": true, "TTOU": true, "URG": true, "USR1": true, "USR2": true, "VTALRM": true,
+	"WINCH": true, "XCPU": true, "XFSZ": true,
+}
+
+var realtimeSignalRegexp = regexp.MustCompile(`^RT(MIN|MAX)([+-]\d+)?$`)
+
+// validSignal tells if signal is a signal name, with or without its SIG prefix, or number
+func validSignal(signal string) bool {
+	if n, err := strconv.Atoi(signal); err == nil {
+		return n > 0 && n <= 64
+	}
+	name := strings.TrimPrefix(strings.ToUpper(signal), "SIG")
+	return signals[name] || realtimeSignalRegexp.MatchString(name)
+}
+
+var containerNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]+$`)
+
+// checkContainerNames checks the container names set by services are valid and unique, and only set by services
+// running a single container. All the offending services are reported at once
+func checkContainerNames(project *types.Project) error {
+	var problems []string
+	location := ""
+	report := func(service, problem string) {
+		if location == "" {
+			location = "services." + service + ".container_name"
+		}
+		problems = append(problems, problem)
+	}
+
+	services := map[string][]string{}
+	for _, s := range project.Services {
+		if s.ContainerName == "" {
+			continue
+		}
+		services[s.ContainerName] = append(services[s.ContainerName], s.Name)
+		if !containerNameRegexp.MatchString(s.ContainerName) {
+			report(s.Name, fmt.Sprintf("service %q has an invalid container_name %q, which must match %s", s.Name, s.ContainerName, containerNameRegexp))
+		}
+		if scale := s.GetScale(); scale > 1 {
+			report(s.Name, fmt.Sprintf("service %q can't run %d containers as it sets container_name %q", s.Name, scale, s.ContainerName))
+		}
+	}
+	for _, name := range sortedKeys(services) {
+		if names := services[name]; len(names) > 1 {
+			report(names[0], fmt.Sprintf("services %s share the container_name %q", strings.Join(names, ", "), name))
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return errorAt(location, errors.Wrap(errdefs.ErrInvalid, strings.Join(problems, "; ")))
+}
+
+// checkMountTargets checks the tmpfs mounts of service s are valid, and that no two volumes or tmpfs mounts target the
+// same container path
+func checkMountTargets(s types.ServiceConfig) error {
+	targets := map[string]string{}
+	check := func(target, location string) error {
+		cleaned := path.Clean(target)
+		if previous, ok := targets[cleaned]; ok {
+			return errorAt(location, errors.Wrapf(errdefs.ErrInvalid, "service %q mounts both %s and %s to %s", s.Name, previous, location, cleaned))
+		}
+		targets[cleaned] = location
+		return nil
+	}
+	for i, volume := range s.Volumes {
+		if volume.Target == "" {
+			continue
+		}
+		if err := check(volume.Target, fmt.Sprintf("services.%s.volumes.%d", s.Name, i)); err != nil {
+			return err
+		}
+	}
+	for i, tmpfs := range s.Tmpfs {
+		location := fmt.Sprintf("services.%s.tmpfs.%d", s.Name, i)
+		mount, err := types.ParseTmpfs(tmpfs)
+		if err != nil {
+			return errorAt(location, errors.Wrapf(err, "service %q", s.Name))
+		}
+		if err := check(mount.Target, location); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkUlimits(ulimits map[string]*types.UlimitsConfig, path string) error {
+	names := make([]string, 0, len(ulimits))
+	for name := range ulimits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ulimit := ulimits[name]
+		if ulimit == nil {
+			continue
+		}
+		if err := ulimit.Validate(); err != nil {
+			return errorAt(path+"."+name, errors.Wrapf(err, "ulimit %s", name))
+		}
+	}
+	return nil
+}
+
+// checkPlatforms checks platforms set by a service are valid, and the service platform, or else the default one set
+// by DOCKER_DEFAULT_PLATFORM in environment, is one of its build platforms
+func checkPlatforms(s types.ServiceConfig, environment map[string]string) error {
+	specifier := s.PlatformString(environment)
+	var platform types.Platform
+	if specifier != "" {
+		p, err := types.ParsePlatform(specifier)
+		if err != nil {
+			if s.Platform == "" {
+				return errorAt("services."+s.Name, errors.Wrapf(err, "service %q: %s", s.Name, types.DefaultPlatformEnv))
+			}
+			return errorAt("services."+s.Name+".platform", errors.Wrapf(err, "service %q", s.Name))
+		}
+		platform = p
+	}
+	if s.Build == nil || len(s.Build.Platforms) == 0 {
+		return nil
+	}
+	found := false
+	for i, build := range s.Build.Platforms {
+		p, err := types.ParsePlatform(build)
+		if err != nil {
+			return errorAt(fmt.Sprintf("services.%s.build.platforms.%d", s.Name, i), errors.Wrapf(err, "service %q build", s.Name))
+		}
+		found = found || p.Matches(platform)
+	}
+	switch {
+	case specifier == "" || found:
+		return nil
+	case s.Platform == "":
+		return errorAt("services."+s.Name+".build.platforms", errors.Wrapf(errdefs.ErrInvalid, "service %q: platform %q set by %s should be part of build platforms %q", s.Name, specifier, types.DefaultPlatformEnv, []string(s.Build.Platforms)))
+	}
+	return errorAt("services."+s.Name+".platform", errors.Wrapf(errdefs.ErrInvalid, "service %q: platform %q should be part of build platforms %q", s.Name, s.Platform, []string(s.Build.Platforms)))
+}
+
+// warnReservedLabels warns about labels set with the prefix reserved to Compose implementations, which will
+// overwrite those
+func warnReservedLabels(project *types.Project, opts *Options) {
+	warn := func(kind, name string, labels types.Labels) {
+		for _, label := range sortedKeys(labels) {
+			if strings.HasPrefix(label, types.ReservedLabelPrefix) {
+				opts.warn(fmt.Sprintf("%s %q: label %q uses the reserved prefix %q and will be overwritten", kind, name, label, types.ReservedLabelPrefix))
+			}
+		}
+	}
+	for _, s := range project.Services {
+		warn("service", s.Name, s.Labels)
+	}
+	for _, name := range project.NetworkNames() {
+		warn("network", name, project.Networks[name].Labels)
+	}
+	for _, name := range project.VolumeNames() {
+		warn("volume", name, project.Volumes[name].Labels)
+	}
+	for _, name := range project.SecretNames() {
+		warn("secret", name, project.Secrets[name].Labels)
+	}
+	for _, name := range project.ConfigNames() {
+		warn("config", name, project.Configs[name].Labels)
+	}
+}
+
+// loggingOptions are the options supported by well-known logging drivers
+var loggingOptions = map[string][]string{
+	"json-file": {"compress", "env", "env-regex", "labels", "labels-regex", "max-file", "max-size", "tag"},
+	"local":     {"compress", "max-file", "max-size"},
+	"syslog": {"env", "env-regex", "labels", "labels-regex", "syslog-address", "syslog-facility", "syslog-format",
+		"syslog-tls-ca-cert", "syslog-tls-cert", "syslog-tls-key", "syslog-tls-skip-verify", "tag"},
+}
+
+// warnUnknownLoggingOptions warns about logging options not supported by a well-known driver. Options of other
+// drivers are not checked
+func warnUnknownLoggingOptions(project *types.Project, opts *Options) {
+	for _, s := range project.Services {
+		if s.Logging == nil {
+			continue
+		}
+		supported, ok := loggingOptions[s.Logging.Driver]
+		if !ok {
+			continue
+		}
+		for _, option := range sortedKeys(s.Logging.Options) {
+			if !contains(supported, option) {
+				opts.warn(fmt.Sprintf("service %q: logging option %q is not supported by the %s driver", s.Name, option, s.Logging.Driver))
+			}
+		}
+	}
+}
+
+// warnLegacyLinks warns about the services declaring links, which are legacy as services reach each other by name
+// on the networks they share
+func warnLegacyLinks(project *types.Project, opts *Options) {
+	for _, s := range project.Services {
+		if len(s.Links) > 0 || len(s.ExternalLinks) > 0 {
+			opts.warn(fmt.Sprintf("service %q: links are deprecated, services reach each other by name on the networks they share", s.Name))
+		}
+	}
+}
+
+// checkVolumesFromCycles rejects services taking volumes from each other, directly or through other services
+func checkVolumesFromCycles(project *types.Project) error {
+	sources := map[string][]string{}
+	for _, s := range append(project.Services, project.DisabledServices...) {
+		for _, source := range s.VolumesFrom {
+			if source.Kind == types.VolumesFromService {
+				sources[s.Name] = append(sources[s.Name], source.Name)
+			}
+		}
+	}
+	done := map[string]bool{}
+	var visit func(name string, visiting []string) error
+	visit = func(name string, visiting []string) error {
+		for i, v := range visiting {
+			if v == name {
+				cycle := strings.Join(append(visiting[i:len(visiting):len(visiting)], name), " -> ")
+				return errorAt("services."+name+".volumes_from", errors.Wrapf(errdefs.ErrInvalid, "services take volumes from each other: %s", cycle))
+			}
+		}
+		if done[name] {
+			return nil
+		}
+		for _, source := range sources[name] {
+			if err := visit(source, append(visiting, name)); err != nil {
+				return err
+			}
+		}
+		done[name] = true
+		return nil
+	}
+	for _, name := range sortedKeys(sources) {
+		if err := visit(name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// warnVolumesFrom warns about the services declaring volumes_from, which is discouraged as the volumes shared by
+// services can be declared as named volumes
+func warnVolumesFrom(project *types.Project, opts *Options) {
+	for _, s := range project.Services {
+		if len(s.VolumesFrom) > 0 {
+			opts.warn(fmt.Sprintf("service %q: volumes_from is deprecated, declare the volumes shared by services as named volumes", s.Name))
+		}
+	}
+}
+
+// warnIgnoredCapabilities warns about `cap_drop` set on privileged services, which are granted all capabilities
+func warnIgnoredCapabilities(project *types.Project, opts *Options) {
+	for _, s := range project.Services {
+		if s.Privileged && len(s.CapDrop) > 0 {
+			opts.warn(fmt.Sprintf("service %q: cap_drop is ignored as the service is privileged", s.Name))
+		}
+	}
+}
+
+// warnExternalResources warns about attributes set on external resources, which are not created by Compose and
+// as such can't be configured
+func warnExternalResources(project *types.Project, opts *Options) {
+	warn := func(kind, name string, attributes map[string]bool) {
+		var set []string
+		for attribute, ok := range attributes {
+			if ok {
+				set = append(set, attribute)
+			}
+		}
+		if len(set) > 0 {
+			sort.Strings(set)
+			opts.warn(fmt.Sprintf("%s %q is external, ignoring %s", kind, name, strings.Join(set, ", ")))
+		}
+	}
+	for _, name := range project.NetworkNames() {
+		n := project.Networks[name]
+		if n.External.External {
+			warn("network", name, map[string]bool{
+				"driver":      n.Driver != "",
+				"driver_opts": len(n.DriverOpts) > 0,
+				"ipam":        n.Ipam.Driver != "" || len(n.Ipam.Config) > 0,
+				"internal":    n.Internal,
+				"enable_ipv6": n.EnableIPv6,
+				"attachable":  n.Attachable,
+				"labels":      len(n.Labels) > 0,
+			})
+		}
+	}
+	for _, name := range project.VolumeNames() {
+		v := project.Volumes[name]
+		if v.External.External {
+			warn("volume", name, map[string]bool{
+				"driver":      v.Driver != "",
+				"driver_opts": len(v.DriverOpts) > 0,
+				"labels":      len(v.Labels) > 0,
+			})
+		}
+	}
+	fileObject := func(kind, name string, obj types.FileObjectConfig) {
+		if obj.External.External {
+			warn(kind, name, map[string]bool{
+				"driver":      obj.Driver != "",
+				"driver_opts": len(obj.DriverOpts) > 0,
+				"labels":      len(obj.Labels) > 0,
+			})
+		}
+	}
+	for _, name := range project.SecretNames() {
+		fileObject("secret", name, types.FileObjectConfig(project.Secrets[name]))
+	}
+	for _, name := range project.ConfigNames() {
+		fileObject("config", name, types.FileObjectConfig(project.Configs[name]))
+	}
+}
+
+func hasSubnet(ipam types.IPAMConfig) bool {
+	for _, pool := range ipam.Config {
+		if pool != nil && pool.Subnet != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// SecretSource describes where a secret or config referenced by a service is resolved from, without its value
+type SecretSource struct {
+	// Resource is either "secrets" or "configs"
+	Resource string
+	// Kind is the provenance of the value: "file", "environment", "external" or "driver"
+	Kind string
+	// Reference is the file path, environment variable, external name or driver resolving this value
+	Reference string
+}
+
+func newSecretSource(resource string, name string, config types.FileObjectConfig) SecretSource {
+	source := SecretSource{Resource: resource}
+	switch {
+	case config.External.External:
+		source.Kind = "external"
+		source.Reference = config.Name
+		if config.External.Name != "" {
+			source.Reference = config.External.Name
+		}
+		if source.Reference == "" {
+			source.Reference = name
+		}
+	case config.File != "":
+		source.Kind = "file"
+		source.Reference = config.File
+	case config.Environment != "":
+		source.Kind = "environment"
+		source.Reference = config.Environment
+	case config.Driver != "":
+		source.Kind = "driver"
+		source.Reference = config.Driver
+	}
+	return source
+}
+
+// checkSecretsExistence invokes checker for every secret and config referenced by services
+func checkSecretsExistence(project *types.Project, checker func(name string, source SecretSource) error) error {
+	for _, s := range project.Services {
+		for _, secret := range s.Secrets {
+			source := newSecretSource("secrets", secret.Source, types.FileObjectConfig(project.Secrets[secret.Source]))
+			if err := checker(secret.Source, source); err != nil {
+				return errors.Wrapf(err, "services.%s.secrets.%s", s.Name, secret.Source)
+			}
+		}
+		if s.Build != nil {
+			for _, secret := range s.Build.Secrets {
+				source := newSecretSource("secrets", secret.Source, types.FileObjectConfig(project.Secrets[secret.Source]))
+				if err := checker(secret.Source, source); err != nil {
+					return errors.Wrapf(err, "services.%s.build.secrets.%s", s.Name, secret.Source)
+				}
+			}
+		}
+		for _, config := range s.Configs {
+			source := newSecretSource("configs", config.Source, types.FileObjectConfig(project.Configs[config.Source]))
+			if err := checker(config.Source, source); err != nil {
+				return errors.Wrapf(err, "services.%s.configs.%s", s.Name, config.Source)
+			}
+		}
+	}
+	return nil
+}
+
+// checkNamespaces checks the services and containers referred to by `network_mode`, `ipc` and `pid`, and that a
+// service sharing the network stack of another one doesn't set attributes the engine would reject
+func checkNamespaces(project *types.Project, s types.ServiceConfig) error {
+	namespaces := []struct{ attribute, mode string }{
+		{"network_mode", s.NetworkMode},
+		{"ipc", s.Ipc},
+		{"pid", s.Pid},
+	}
+	for _, namespace := range namespaces {
+		path := "services." + s.Name + "." + namespace.attribute
+		switch {
+		case namespace.mode == types.ContainerPrefix:
+			return errorAt(path, errors.Wrapf(errdefs.ErrInvalid, "service %q sets %s with an empty container name", s.Name, namespace.attribute))
+		case strings.HasPrefix(namespace.mode, types.ServicePrefix):
+			service := strings.TrimPrefix(namespace.mode, types.ServicePrefix)
+			if service == "" {
+				return errorAt(path, errors.Wrapf(errdefs.ErrInvalid, "service %q sets %s with an empty service name", s.Name, namespace.attribute))
+			}
+			if service == s.Name {
+				return errorAt(path, errors.Wrapf(errdefs.ErrInvalid, "service %q can't set %s to itself", s.Name, namespace.attribute))
+			}
+			if _, err := project.GetService(service); err != nil {
+				if _, err := project.GetDisabledService(service); err != nil {
+					return errorAt(path, errors.Wrapf(errdefs.ErrInvalid, "service %q refers to undefined service %s in %s", s.Name, service, namespace.attribute))
+				}
+			}
+		}
+	}
+
+	for i, link := range s.Links {
+		if _, err := project.GetService(link.Service); err != nil {
+			if _, err := project.GetDisabledService(link.Service); err != nil {
+				return errorAt(fmt.Sprintf("services.%s.links.%d", s.Name, i), errors.Wrapf(errdefs.ErrInvalid, "service %q links to undefined service %s", s.Name, link.Service))
+			}
+		}
+	}
+
+	for i, source := range s.VolumesFrom {
+		if source.Kind != types.VolumesFromService {
+			continue
+		}
+		path := fmt.Sprintf("services.%s.volumes_from.%d", s.Name, i)
+		if source.Name == s.Name {
+			return errorAt(path, errors.Wrapf(errdefs.ErrInvalid, "service %q can't take volumes from itself", s.Name))
+		}
+		if _, err := project.GetService(source.Name); err != nil {
+			if _, err := project.GetDisabledService(source.Name); err != nil {
+				return errorAt(path, errors.Wrapf(errdefs.ErrInvalid, "service %q takes volumes from undefined service %s", s.Name, source.Name))
+			}
+		}
+	}
+
+	if s.NetworkMode != "" {
+		if len(s.Networks) > 0 {
+			return errorAt("services."+s.Name+".networks", errors.Wrapf(errdefs.ErrInvalid, "service %q declares networks, which can't be combined with network_mode %s", s.Name, s.NetworkMode))
+		}
+		if _, ok := s.NetworkModeService(); ok && len(s.Links) > 0 {
+			return errorAt("services."+s.Name+".links", errors.Wrapf(errdefs.ErrInvalid, "service %q declares links, which can't be combined with network_mode %s", s.Name, s.NetworkMode))
+		}
+	}
+	return nil
+}
+
+// exposedPorts is the `port[-port][/protocol]` grammar of exposed ports
+var exposedPorts = regexp.MustCompile(`^(\d+)(?:-(\d+))?(?:/(tcp|udp|sctp))?$`)
+
+// checkExpose rejects exposed ports which are not a port or a range of ports, like the ones setting a host part
+// which only makes sense for published ports
+func checkExpose(s types.ServiceConfig) error {
+	for i, expose := range s.Expose {
+		path := fmt.Sprintf("services.%s.expose.%d", s.Name, i)
+		if strings.Contains(expose, ":") {
+			return errorAt(path, errors.Wrapf(errdefs.ErrInvalid, "service %q exposes %q with a host part, use ports to publish a port on the host", s.Name, expose))
+		}
+		matches := exposedPorts.FindStringSubmatch(expose)
+		if matches == nil {
+			return errorAt(path, errors.Wrapf(errdefs.ErrInvalid, "service %q exposes %q, expected a port or a range of ports like 8000-8010, optionally followed by a protocol", s.Name, expose))
+		}
+		start, _ := strconv.Atoi(matches[1])
+		end := start
+		if matches[2] != "" {
+			end, _ = strconv.Atoi(matches[2])
+		}
+		if start < 1 || end > 65535 || start > end {
+			return errorAt(path, errors.Wrapf(errdefs.ErrInvalid, "service %q exposes %q, which is not a valid range of ports", s.Name, expose))
+		}
+	}
+	return nil
+}
+
+var profileNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]+$`)
+
+// checkProfiles rejects profile names which can't be selected from a command line
+func checkProfiles(s types.ServiceConfig) error {
+	for i, profile := range s.Profiles {
+		if !profileNameRegexp.MatchString(profile) {
+			path := fmt.Sprintf("services.%s.profiles.%d", s.Name, i)
+			return errorAt(path, errors.Wrapf(errdefs.ErrInvalid, "%s: invalid profile name %q, must match %s", path, profile, profileNameRegexp))
+		}
+	}
+	return nil
+}
+
+// checkEnum rejects the value set at path if not one of allowed
+func checkEnum(path string, value string, allowed ...string) error {
+	if value == "" {
+		return nil
+	}
+	for _, a := range allowed {
+		if value == a {
+			return nil
+		}
+	}
+	return errorAt(path, errors.Wrapf(errdefs.ErrInvalid, "%s: invalid value %q, must be one of %s", path, value, strings.Join(allowed, ", ")))
+}
+
+// deviceCgroupRule is the `type major:minor mode` grammar of device cgroup rules, the mode being checked by
+// types.ValidDevicePermissions
+var deviceCgroupRule = regexp.MustCompile(`^[abc] (\d+|\*):(\d+|\*) (\w+)$`)
+
+// checkDevices rejects devices with invalid permissions and malformed device cgroup rules
+func checkDevices(s types.ServiceConfig) error {
+	for i, device := range s.Devices {
+		if !types.ValidDevicePermissions(device.Permissions) {
+			path := fmt.Sprintf("services.%s.devices.%d", s.Name, i)
+			return errorAt(path, errors.Wrapf(errdefs.ErrInvalid, "%s: invalid permissions %q for device %s, must be a combination of r, w and m", path, device.Permissions, device.Source))
+		}
+	}
+	for i, rule := range s.DeviceCgroupRules {
+		if m := deviceCgroupRule.FindStringSubmatch(rule); m == nil || !types.ValidDevicePermissions(m[3]) {
+			path := fmt.Sprintf("services.%s.device_cgroup_rules.%d", s.Name, i)
+			return errorAt(path, errors.Wrapf(errdefs.ErrInvalid, "%s: invalid rule %q, must match `type major:minor mode`", path, rule))
+		}
+	}
+	return nil
+}
+
+// securityOptions are the known `security_opt` keys, set as `key=value` or `key:value`, telling if a value is required
+var securityOptions = map[string]bool{
+	"no-new-privileges": false,
+	"writable-cgroups":  false,
+	"seccomp":           true,
+	"apparmor":          true,
+	"label":             true,
+	"systempaths":       true,
+	"credentialspec":    true,
+	"mask":              true,
+	"unmask":            true,
+}
+
+// splitSecurityOption splits a `security_opt` entry into its key and value, telling if a separator is set
+func splitSecurityOption(option string) (string, string, bool) {
+	if sep := strings.IndexAny(option, "=:"); sep >= 0 {
+		return option[:sep], option[sep+1:], true
+	}
+	return option, "", false
+}
+
+// checkSecurityOptions rejects `security_opt` entries with a known key lacking a required value, or setting an
+// invalid boolean. Unknown keys are left to warnUnknownSecurityOptions, as the container runtime may support them
+func checkSecurityOptions(s types.ServiceConfig) error {
+	for i, option := range s.SecurityOpt {
+		key, value, separated := splitSecurityOption(option)
+		valueRequired, known := securityOptions[key]
+		valid := true
+		switch {
+		case !known:
+		case valueRequired:
+			valid = value != ""
+		case separated:
+			// no-new-privileges and writable-cgroups are booleans
+			_, err := strconv.ParseBool(value)
+			valid = err == nil
+		}
+		if !valid {
+			path := fmt.Sprintf("services.%s.security_opt.%d", s.Name, i)
+			return errorAt(path, errors.Wrapf(errdefs.ErrInvalid, "%s: invalid security option %q, %s requires %s", path, option, key, securityOptionValue(valueRequired)))
+		}
+	}
+	return nil
+}
+
+// securityOptionValue describes the value expected by a security option
+func securityOptionValue(valueRequired bool) string {
+	if valueRequired {
+		return "a value"
+	}
+	return "a boolean value, if any"
+}
+
+// warnUnknownSecurityOptions warns about `security_opt` entries which don't match a known key
+func warnUnknownSecurityOptions(project *types.Project, opts *Options) {
+	for _, s := range project.Services {
+		for _, option := range s.SecurityOpt {
+			key, _, _ := splitSecurityOption(option)
+			if _, known := securityOptions[key]; !known {
+				opts.warn(fmt.Sprintf("service %q: unknown security option %q", s.Name, option))
+			}
+		}
+	}
+}
+
+// checkCredentialSpec rejects credential specs setting more or less than one source, or referring to an undefined
+// config
+func checkCredentialSpec(project *types.Project, service string, spec *types.CredentialSpecConfig) error {
+	path := "services." + service + ".credential_spec"
+	sources := 0
+	for _, source := range []string{spec.Config, spec.File, spec.Registry} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return errorAt(path, errors.Wrapf(errdefs.ErrInvalid, "%s: exactly one of config, file or registry must be set", path))
+	}
+	if spec.Config != "" {
+		if _, ok := project.Configs[spec.Config]; !ok {
+			return errorAt(path+".config", errors.Wrapf(errdefs.ErrInvalid, "service %q credential spec refers to undefined config %s", service, spec.Config))
+		}
+	}
+	return nil
+}
+
+// checkResources rejects `cpus`, `mem_limit` and `mem_reservation` set with a value distinct from the one set by
+// `deploy.resources`. Across files the override wins, see mergeResources, so this only applies to values set by the
+// same file
+func checkResources(s types.ServiceConfig) error {
+	if s.Deploy == nil {
+		return nil
+	}
+	if limits := s.Deploy.Resources.Limits; limits != nil {
+		if s.CPUS != 0 && limits.NanoCPUs != "" {
+			cpus, err := strconv.ParseFloat(limits.NanoCPUs, 32)
+			if err == nil && float32(cpus) != s.CPUS {
+				return errorAt("services."+s.Name+".cpus", errors.Wrapf(errdefs.ErrInvalid, "service %q can't set distinct values on 'cpus' (%v) and 'deploy.resources.limits.cpus' (%s)", s.Name, s.CPUS, limits.NanoCPUs))
+			}
+		}
+		if s.MemLimit != 0 && limits.MemoryBytes != 0 && s.MemLimit != limits.MemoryBytes {
+			return errorAt("services."+s.Name+".mem_limit", errors.Wrapf(errdefs.ErrInvalid, "service %q can't set distinct values on 'mem_limit' (%d) and 'deploy.resources.limits.memory' (%d)", s.Name, s.MemLimit, limits.MemoryBytes))
+		}
+	}
+	if reservations := s.Deploy.Resources.Reservations; reservations != nil {
+		if s.MemReservation != 0 && reservations.MemoryBytes != 0 && s.MemReservation != reservations.MemoryBytes {
+			return errorAt("services."+s.Name+".mem_reservation", errors.Wrapf(errdefs.ErrInvalid, "service %q can't set distinct values on 'mem_reservation' (%d) and 'deploy.resources.reservations.memory' (%d)", s.Name, s.MemReservation, reservations.MemoryBytes))
+		}
+	}
+	return nil
+}
+
+// checkBlkioConfig checks the weights of the blkio_config of service are in the [10, 1000] range and its devices are
+// set by absolute paths
+func checkBlkioConfig(service types.ServiceConfig) error {
+	blkio := service.BlkioConfig
+	if blkio == nil {
+		return nil
+	}
+	checkWeight := func(attribute string, weight uint16) error {
+		if weight != 0 && (weight < 10 || weight > 1000) {
+			return errorAt("services."+service.Name+".blkio_config."+attribute, errors.Wrapf(errdefs.ErrInvalid, "service %q has a blkio_config.%s of %d, out of the [10, 1000] range", service.Name, attribute, weight))
+		}
+		return nil
+	}
+	checkPath := func(attribute string, device string) error {
+		if !path.IsAbs(device) {
+			return errorAt("services."+service.Name+".blkio_config."+attribute, errors.Wrapf(errdefs.ErrInvalid, "service %q has a blkio_config.%s device %q which is not an absolute path", service.Name, attribute, device))
+		}
+		return nil
+	}
+	if err := checkWeight("weight", blkio.Weight); err != nil {
+		return err
+	}
+	for _, device := range blkio.WeightDevice {
+		if err := checkPath("weight_device", device.Path); err != nil {
+			return err
+		}
+		if err := checkWeight("weight_device", device.Weight); err != nil {
+			return err
+		}
+	}
+	throttled := []struct {
+		attribute string
+		devices   []types.ThrottleDevice
+	}{
+		{"device_read_bps", blkio.DeviceReadBps},
+		{"device_read_iops", blkio.DeviceReadIOps},
+		{"device_write_bps", blkio.DeviceWriteBps},
+		{"device_write_iops", blkio.DeviceWriteIOps},
+	}
+	for _, throttle := range throttled {
+		for _, device := range throttle.devices {
+			if err := checkPath(throttle.attribute, device.Path); err != nil {
+				return err
 			}
 		}
 	}
@@ -17,9 +17,12 @@
 package loader
 
 import (
+	"fmt"
 	"testing"
 
+	"github.com/compose-spec/compose-go/errdefs"
 	"github.com/compose-spec/compose-go/types"
+	"github.com/pkg/errors"
 	"gotest.tools/v3/assert"
 )
 
@@ -81,3 +84,455 @@ func TestValidateNoBuildNoImage(t *testing.T) {
 	err := checkConsistency(project)
 	assert.Error(t, err, `service "myservice" has neither an image nor a build context specified: invalid compose project`)
 }
+
+func TestValidateSecretExistence(t *testing.T) {
+	dict, err := ParseYAML([]byte(`
+services:
+  foo:
+    image: foo
+    secrets:
+      - from_file
+      - from_env
+      - from_vault
+secrets:
+  from_file:
+    file: ./secret.txt
+  from_env:
+    environment: TOKEN
+  from_vault:
+    external: true
+    name: vault_secret
+`))
+	assert.NilError(t, err)
+
+	sources := map[string]SecretSource{}
+	checker := func(name string, source SecretSource) error {
+		sources[name] = source
+		if source.Kind == "external" {
+			return errors.Errorf("%s not found in vault", source.Reference)
+		}
+		return nil
+	}
+	_, err = loadCached(buildConfigDetails(dict, nil), func(options *Options) {
+		options.SecretExistenceChecker = checker
+	})
+	assert.Error(t, err, "services.foo.secrets.from_vault: vault_secret not found in vault")
+	assert.Equal(t, sources["from_file"].Kind, "file")
+	assert.Equal(t, sources["from_env"], SecretSource{Resource: "secrets", Kind: "environment", Reference: "TOKEN"})
+	assert.Equal(t, sources["from_vault"], SecretSource{Resource: "secrets", Kind: "external", Reference: "vault_secret"})
+}
+
+func TestValidateHealthCheckTest(t *testing.T) {
+	project := &types.Project{
+		Services: types.Services([]types.ServiceConfig{
+			{
+				Name:  "myservice",
+				Image: "my/service",
+				HealthCheck: &types.HealthCheckConfig{
+					Test: types.HealthCheckTest{"SHELL", "true"},
+				},
+			},
+		}),
+	}
+	err := checkConsistency(project)
+	assert.ErrorContains(t, err, `service "myservice": healthcheck test must start with CMD, CMD-SHELL or NONE, got "SHELL"`)
+}
+
+func TestValidateStaticIPv4Address(t *testing.T) {
+	project := &types.Project{
+		Services: types.Services([]types.ServiceConfig{
+			{
+				Name:  "myservice",
+				Image: "my/service",
+				Networks: map[string]*types.ServiceNetworkConfig{
+					"front": {Ipv4Address: "172.28.0.10"},
+				},
+			},
+		}),
+		Networks: types.Networks{
+			"front": types.NetworkConfig{},
+		},
+	}
+	err := checkConsistency(project)
+	assert.ErrorContains(t, err, `service "myservice" uses a static ipv4_address on network front, which doesn't define an ipam subnet`)
+
+	project.Networks["front"] = types.NetworkConfig{
+		Ipam: types.IPAMConfig{
+			Config: []*types.IPAMPool{{Subnet: "172.28.0.0/16"}},
+		},
+	}
+	err = checkConsistency(project)
+	assert.NilError(t, err)
+}
+
+func TestValidateVolumeOptions(t *testing.T) {
+	project := &types.Project{
+		Services: types.Services([]types.ServiceConfig{
+			{
+				Name:  "myservice",
+				Image: "my/service",
+				Volumes: []types.ServiceVolumeConfig{
+					{Type: types.VolumeTypeTmpfs, Source: "data", Target: "/cache"},
+				},
+			},
+		}),
+	}
+	err := checkConsistency(project)
+	assert.ErrorContains(t, err, `service "myservice": tmpfs mount /cache can't have a source`)
+
+	project.Services[0].Volumes = []types.ServiceVolumeConfig{
+		{Type: types.VolumeTypeBind, Source: "/data", Target: "/data", Volume: &types.ServiceVolumeVolume{NoCopy: true}},
+	}
+	err = checkConsistency(project)
+	assert.ErrorContains(t, err, `service "myservice": bind mount /data can't set volume.nocopy`)
+
+	project.Services[0].Volumes = []types.ServiceVolumeConfig{
+		{Type: types.VolumeTypeTmpfs, Target: "/cache", Tmpfs: &types.ServiceVolumeTmpfs{Size: 1024, Mode: 01777}},
+		{Type: types.VolumeTypeBind, Source: "/data", Target: "/data", Bind: &types.ServiceVolumeBind{CreateHostPath: true, SELinux: "z"}},
+	}
+	err = checkConsistency(project)
+	assert.NilError(t, err)
+}
+
+func TestValidateUlimits(t *testing.T) {
+	project := &types.Project{
+		Services: types.Services([]types.ServiceConfig{
+			{
+				Name:  "myservice",
+				Image: "my/service",
+				Ulimits: map[string]*types.UlimitsConfig{
+					"nproc":  {Single: 65535},
+					"nofile": {Soft: 20000, Hard: 10000},
+				},
+			},
+		}),
+	}
+	err := checkConsistency(project)
+	assert.ErrorContains(t, err, `service "myservice": ulimit nofile: soft limit 20000 is greater than hard limit 10000`)
+
+	project.Services[0].Ulimits["nofile"] = &types.UlimitsConfig{Soft: 10000, Hard: 20000}
+	project.Services[0].Build = &types.BuildConfig{
+		Context: ".",
+		Ulimits: map[string]*types.UlimitsConfig{"nofile": {Soft: 2, Hard: 1}},
+	}
+	err = checkConsistency(project)
+	assert.ErrorContains(t, err, `service "myservice" build: ulimit nofile: soft limit 2 is greater than hard limit 1`)
+
+	project.Services[0].Build.Ulimits = nil
+	assert.NilError(t, checkConsistency(project))
+}
+
+func TestValidatePlatform(t *testing.T) {
+	project := &types.Project{
+		Services: types.Services([]types.ServiceConfig{
+			{
+				Name:     "myservice",
+				Image:    "my/service",
+				Platform: "linux/amd64/v2/extra",
+			},
+		}),
+	}
+	err := checkConsistency(project)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `service "myservice": invalid platform "linux/amd64/v2/extra": expected os[/arch[/variant]]`)
+
+	project.Services[0].Platform = "linux/aarch64"
+	project.Services[0].Build = &types.BuildConfig{
+		Context:   ".",
+		Platforms: types.StringList{"linux/amd64", "linux/arm64/v8"},
+	}
+	assert.NilError(t, checkConsistency(project))
+
+	project.Services[0].Platform = "linux/arm/v6"
+	err = checkConsistency(project)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `service "myservice": platform "linux/arm/v6" should be part of build platforms ["linux/amd64" "linux/arm64/v8"]`)
+
+	project.Services[0].Platform = ""
+	project.Services[0].Build.Platforms = append(project.Services[0].Build.Platforms, "linux/amd64/v2/extra")
+	err = checkConsistency(project)
+	assert.ErrorContains(t, err, `service "myservice" build: invalid platform "linux/amd64/v2/extra"`)
+
+	// a single component only constrains the part it sets, whatever the current host
+	project.Services[0].Build.Platforms = types.StringList{"linux/amd64", "linux/arm64/v8"}
+	for _, platform := range []string{"linux", "arm64", "aarch64"} {
+		project.Services[0].Platform = platform
+		assert.NilError(t, checkConsistency(project), platform)
+	}
+	project.Services[0].Platform = "windows"
+	assert.ErrorContains(t, checkConsistency(project), `platform "windows" should be part of build platforms`)
+
+	project.Services[0].Platform = ""
+	project.Environment = map[string]string{types.DefaultPlatformEnv: "linux/arm64"}
+	assert.NilError(t, checkConsistency(project))
+	project.Environment[types.DefaultPlatformEnv] = "linux/s390x"
+	err = checkConsistency(project)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `service "myservice": platform "linux/s390x" set by DOCKER_DEFAULT_PLATFORM should be part of build platforms ["linux/amd64" "linux/arm64/v8"]`)
+	assert.Equal(t, errorPath(err), "services.myservice.build.platforms")
+
+	// the service platform takes precedence over the default one
+	project.Services[0].Platform = "linux/amd64"
+	assert.NilError(t, checkConsistency(project))
+}
+
+func TestValidateScale(t *testing.T) {
+	replicas := uint64(2)
+	project := &types.Project{
+		Services: types.Services([]types.ServiceConfig{
+			{
+				Name:   "myservice",
+				Image:  "my/service",
+				Scale:  3,
+				Deploy: &types.DeployConfig{Replicas: &replicas},
+			},
+		}),
+	}
+	err := checkConsistency(project)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `service "myservice" can't set distinct values on 'scale' (3) and 'deploy.replicas' (2)`)
+
+	project.Services[0].Scale = 2
+	assert.NilError(t, checkConsistency(project))
+}
+
+func TestValidateDevelopWatch(t *testing.T) {
+	project := &types.Project{
+		Services: types.Services([]types.ServiceConfig{
+			{
+				Name:  "myservice",
+				Image: "my/service",
+				Develop: &types.DevelopConfig{
+					Watch: []types.Trigger{
+						{Path: "/src", Action: types.WatchActionRebuild},
+						{Path: "/src", Action: types.WatchActionSync, Target: "/app"},
+					},
+				},
+			},
+		}),
+	}
+	assert.NilError(t, checkConsistency(project))
+
+	project.Services[0].Develop.Watch[1].Target = ""
+	err := checkConsistency(project)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `service "myservice" watches /src with action sync but doesn't set a target`)
+
+	project.Services[0].Develop.Watch[1].Action = "copy"
+	err = checkConsistency(project)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `service "myservice" watches /src with unknown action "copy"`)
+}
+
+func TestValidateNamespaces(t *testing.T) {
+	project := &types.Project{
+		Services: types.Services([]types.ServiceConfig{
+			{
+				Name:        "myservice",
+				Image:       "my/service",
+				NetworkMode: "service:vpn",
+				Ipc:         "container:abc",
+				Pid:         "host",
+				Ports:       []types.ServicePortConfig{{Target: 80}},
+			},
+			{
+				Name:  "vpn",
+				Image: "my/vpn",
+			},
+		}),
+	}
+	assert.NilError(t, checkConsistency(project))
+
+	project.Services[0].Pid = "service:monitor"
+	err := checkConsistency(project)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `service "myservice" refers to undefined service monitor in pid`)
+
+	project.Services[0].Pid = "service:myservice"
+	err = checkConsistency(project)
+	assert.ErrorContains(t, err, `service "myservice" can't set pid to itself`)
+
+	project.Services[0].Pid = ""
+	project.Services[0].Ipc = "container:"
+	err = checkConsistency(project)
+	assert.ErrorContains(t, err, `service "myservice" sets ipc with an empty container name`)
+
+	project.Services[0].Ipc = ""
+	project.Services[0].Links = []types.ServiceLink{{Service: "vpn"}}
+	err = checkConsistency(project)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `service "myservice" declares links, which can't be combined with network_mode service:vpn`)
+
+	project.Services[0].Links = nil
+	project.Services[0].Networks = map[string]*types.ServiceNetworkConfig{"default": nil}
+	err = checkConsistency(project)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `service "myservice" declares networks, which can't be combined with network_mode service:vpn`)
+}
+
+func TestValidateContainerModes(t *testing.T) {
+	project := &types.Project{
+		Services: types.Services([]types.ServiceConfig{
+			{Name: "myservice", Image: "my/service", Cgroup: "private", Uts: "host", Isolation: "hyperv"},
+		}),
+	}
+	assert.NilError(t, checkConsistency(project))
+
+	project.Services[0].Uts = "private"
+	err := checkConsistency(project)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.Equal(t, errorPath(err), "services.myservice.uts")
+	assert.ErrorContains(t, err, `services.myservice.uts: invalid value "private", must be one of host`)
+
+	project.Services[0].Uts = ""
+	project.Services[0].Isolation = "container"
+	err = checkConsistency(project)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.Equal(t, errorPath(err), "services.myservice.isolation")
+	assert.ErrorContains(t, err, `services.myservice.isolation: invalid value "container", must be one of default, process, hyperv`)
+}
+
+func TestValidateContainerNames(t *testing.T) {
+	replicas := uint64(2)
+	project := &types.Project{
+		Services: types.Services([]types.ServiceConfig{
+			{Name: "api", Image: "my/api", ContainerName: "backend"},
+			{Name: "web", Image: "my/web", ContainerName: "_web"},
+			{Name: "worker", Image: "my/worker", ContainerName: "backend", Deploy: &types.DeployConfig{Replicas: &replicas}},
+		}),
+	}
+	err := checkConsistency(project)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `service "web" has an invalid container_name "_web"`)
+	assert.ErrorContains(t, err, `service "worker" can't run 2 containers as it sets container_name "backend"`)
+	assert.ErrorContains(t, err, `services api, worker share the container_name "backend"`)
+
+	project.Services[1].ContainerName = "web.1"
+	project.Services[2].ContainerName = "worker"
+	project.Services[2].Deploy = nil
+	assert.NilError(t, checkConsistency(project))
+}
+
+func TestValidateStopSignalAndOomScoreAdj(t *testing.T) {
+	project := &types.Project{
+		Services: types.Services([]types.ServiceConfig{
+			{Name: "myservice", Image: "my/service", OomScoreAdj: -1000},
+		}),
+	}
+	for _, signal := range []string{"SIGTERM", "sigusr1", "KILL", "9", "SIGRTMIN+3"} {
+		project.Services[0].StopSignal = signal
+		assert.NilError(t, checkConsistency(project), signal)
+	}
+	for _, signal := range []string{"SIGFOO", "0", "65", "TERM!"} {
+		project.Services[0].StopSignal = signal
+		err := checkConsistency(project)
+		assert.Check(t, errdefs.IsInvalidError(err))
+		assert.ErrorContains(t, err, `service "myservice" has an invalid stop_signal`, signal)
+	}
+
+	project.Services[0].StopSignal = ""
+	project.Services[0].OomScoreAdj = 1001
+	err := checkConsistency(project)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `service "myservice" has an oom_score_adj of 1001, out of the [-1000, 1000] range`)
+}
+
+func TestValidateBlkioConfig(t *testing.T) {
+	project := &types.Project{
+		Services: types.Services([]types.ServiceConfig{
+			{Name: "myservice", Image: "my/service", BlkioConfig: &types.BlkioConfig{
+				Weight:        10,
+				WeightDevice:  []types.WeightDevice{{Path: "/dev/sda", Weight: 1000}},
+				DeviceReadBps: []types.ThrottleDevice{{Path: "/dev/sda", Rate: 1024}},
+			}},
+		}),
+	}
+	assert.NilError(t, checkConsistency(project))
+
+	project.Services[0].BlkioConfig.Weight = 5
+	err := checkConsistency(project)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `service "myservice" has a blkio_config.weight of 5, out of the [10, 1000] range`)
+
+	project.Services[0].BlkioConfig.Weight = 0
+	project.Services[0].BlkioConfig.WeightDevice[0].Weight = 1001
+	err = checkConsistency(project)
+	assert.ErrorContains(t, err, `service "myservice" has a blkio_config.weight_device of 1001, out of the [10, 1000] range`)
+
+	project.Services[0].BlkioConfig.WeightDevice = nil
+	project.Services[0].BlkioConfig.DeviceReadBps[0].Path = "dev/sda"
+	err = checkConsistency(project)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `service "myservice" has a blkio_config.device_read_bps device "dev/sda" which is not an absolute path`)
+}
+
+func TestValidateExpose(t *testing.T) {
+	project := &types.Project{
+		Services: types.Services([]types.ServiceConfig{
+			{Name: "myservice", Image: "my/service", Expose: types.StringOrNumberList{"3000", "8000-8010", "9000/udp"}},
+		}),
+	}
+	assert.NilError(t, checkConsistency(project))
+
+	for expose, message := range map[string]string{
+		"127.0.0.1:3000": `service "myservice" exposes "127.0.0.1:3000" with a host part, use ports to publish a port on the host`,
+		"8080:80":        `service "myservice" exposes "8080:80" with a host part`,
+		"http":           `service "myservice" exposes "http", expected a port or a range of ports`,
+		"3000/foo":       `expected a port or a range of ports`,
+		"8010-8000":      `service "myservice" exposes "8010-8000", which is not a valid range of ports`,
+		"70000":          `which is not a valid range of ports`,
+		"0":              `which is not a valid range of ports`,
+	} {
+		project.Services[0].Expose = types.StringOrNumberList{expose}
+		err := checkConsistency(project)
+		assert.Check(t, errdefs.IsInvalidError(err), expose)
+		assert.ErrorContains(t, err, message, expose)
+	}
+}
+
+func TestValidateProfiles(t *testing.T) {
+	project := &types.Project{
+		Services: types.Services([]types.ServiceConfig{
+			{Name: "myservice", Image: "my/service", Profiles: []string{"debug", "test.e2e", "v1_2-rc"}},
+		}),
+	}
+	assert.NilError(t, checkConsistency(project))
+
+	for _, profile := range []string{"", "-debug", "debug tools", "a", "dé"} {
+		project.Services[0].Profiles = []string{"debug", profile}
+		err := checkConsistency(project)
+		assert.Check(t, errdefs.IsInvalidError(err), profile)
+		assert.ErrorContains(t, err, fmt.Sprintf("services.myservice.profiles.1: invalid profile name %q", profile), profile)
+	}
+
+	project.Services[0].Profiles = nil
+	project.DisabledServices = types.Services{{Name: "tools", Image: "my/tools", Profiles: []string{"tools!"}}}
+	assert.ErrorContains(t, checkConsistency(project), `services.tools.profiles.0: invalid profile name "tools!"`)
+}
+
+func TestValidateVolumesFrom(t *testing.T) {
+	project := &types.Project{
+		Services: types.Services([]types.ServiceConfig{
+			{Name: "app", Image: "app", VolumesFrom: []types.VolumesFromSource{
+				{Kind: types.VolumesFromService, Name: "data"},
+				{Kind: types.VolumesFromContainer, Name: "legacy"},
+			}},
+			{Name: "data", Image: "data"},
+		}),
+	}
+	assert.NilError(t, checkConsistency(project))
+
+	project.Services[0].VolumesFrom[0].Name = "missing"
+	err := checkConsistency(project)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `service "app" takes volumes from undefined service missing`)
+
+	project.Services[0].VolumesFrom[0].Name = "app"
+	assert.ErrorContains(t, checkConsistency(project), `service "app" can't take volumes from itself`)
+
+	project.Services[0].VolumesFrom[0].Name = "data"
+	project.Services[1].VolumesFrom = []types.VolumesFromSource{{Kind: types.VolumesFromService, Name: "app"}}
+	err = checkConsistency(project)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, "services take volumes from each other: app -> data -> app")
+}
@@ -0,0 +1,125 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loader
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/compose-spec/compose-go/errdefs"
+	"github.com/pkg/errors"
+)
+
+// attributeVersions are the legacy file format versions which introduced common attributes, by major version. An
+// attribute is not supported by the major versions it has none for, like the ones introduced by the compose
+// specification
+var attributeVersions = map[string]map[int]string{
+	"name":                                {},
+	"configs":                             {3: "3.3"},
+	"secrets":                             {3: "3.1"},
+	"services.*.configs":                  {3: "3.3"},
+	"services.*.cpus":                     {2: "2.2"},
+	"services.*.deploy":                   {3: "3.0"},
+	"services.*.healthcheck.start_period": {2: "2.3", 3: "3.4"},
+	"services.*.init":                     {2: "2.2", 3: "3.7"},
+	"services.*.platform":                 {2: "2.4"},
+	"services.*.profiles":                 {},
+	"services.*.runtime":                  {2: "2.3"},
+	"services.*.secrets":                  {3: "3.1"},
+
+	"services.*.deploy.resources.reservations.devices": {},
+}
+
+// checkVersionCompatibility rejects the attributes of configDict introduced after the legacy file format version
+// set by its top-level `version`, if any
+func checkVersionCompatibility(configDict map[string]interface{}) error {
+	version, ok := configDict["version"].(string)
+	if !ok || version == "" {
+		return nil
+	}
+	major, minor, err := parseFileVersion(version)
+	if err != nil {
+		return errorAt("version", err)
+	}
+	if major != 2 && major != 3 {
+		return errorAt("version", errors.Wrapf(errdefs.ErrInvalid, "version %q is not a legacy compose file format version, which are 2.x and 3.x", version))
+	}
+
+	attributes := make([]string, 0, len(attributeVersions))
+	for attribute := range attributeVersions {
+		attributes = append(attributes, attribute)
+	}
+	sort.Strings(attributes)
+	for _, attribute := range attributes {
+		path, ok := findAttribute(configDict, strings.Split(attribute, "."), nil)
+		if !ok {
+			continue
+		}
+		dotted := strings.Join(path, ".")
+		introduced, ok := attributeVersions[attribute][major]
+		if !ok {
+			return errorAt(dotted, errors.Wrapf(errdefs.ErrInvalid, "%s is not supported by version %q of the compose file format", dotted, version))
+		}
+		introducedMajor, introducedMinor, _ := parseFileVersion(introduced)
+		if introducedMajor == major && introducedMinor > minor {
+			return errorAt(dotted, errors.Wrapf(errdefs.ErrInvalid, "%s requires version %s of the compose file format, the compose file declares version %q", dotted, introduced, version))
+		}
+	}
+	return nil
+}
+
+// parseFileVersion parses a `major[.minor]` file format version
+func parseFileVersion(version string) (int, int, error) {
+	parts := strings.SplitN(version, ".", 2)
+	major, err := strconv.Atoi(parts[0])
+	if err != nil || major < 0 {
+		return 0, 0, errors.Wrapf(errdefs.ErrInvalid, "invalid version %q, expected a version like 3.8", version)
+	}
+	minor := 0
+	if len(parts) == 2 {
+		minor, err = strconv.Atoi(parts[1])
+		if err != nil || minor < 0 {
+			return 0, 0, errors.Wrapf(errdefs.ErrInvalid, "invalid version %q, expected a version like 3.8", version)
+		}
+	}
+	return major, minor, nil
+}
+
+// findAttribute returns the path of the first attribute of dict, by name order, matching glob made of attribute
+// names or `*` to match any
+func findAttribute(dict map[string]interface{}, glob []string, path []string) ([]string, bool) {
+	keys := make([]string, 0, len(dict))
+	for key := range dict {
+		if glob[0] == "*" || glob[0] == key {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		attribute := append(path[:len(path):len(path)], key)
+		if len(glob) == 1 {
+			return attribute, true
+		}
+		if nested, ok := dict[key].(map[string]interface{}); ok {
+			if found, ok := findAttribute(nested, glob[1:], attribute); ok {
+				return found, true
+			}
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,107 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loader
+
+import (
+	"testing"
+
+	"github.com/compose-spec/compose-go/errdefs"
+	"github.com/compose-spec/compose-go/types"
+	"gotest.tools/v3/assert"
+)
+
+func loadVersioned(content string, options ...func(*Options)) (*types.Project, []string, error) {
+	var warnings []string
+	project, err := loadCached(types.ConfigDetails{
+		WorkingDir: "/code",
+		ConfigFiles: []types.ConfigFile{
+			{Filename: "compose.yaml", Content: []byte(content)},
+		},
+	}, append([]func(*Options){func(options *Options) {
+		options.Name = "versioned"
+		options.Warn = func(message string) {
+			warnings = append(warnings, message)
+		}
+	}}, options...)...)
+	return project, warnings, err
+}
+
+func TestLoadVersion(t *testing.T) {
+	project, warnings, err := loadVersioned(`
+version: "3.8"
+services:
+  web:
+    image: nginx
+    init: true
+    profiles: [debug]
+`)
+	assert.NilError(t, err)
+	assert.Equal(t, project.Version, "3.8")
+	assert.DeepEqual(t, warnings, []string{"compose.yaml: `version` is obsolete and ignored, it can be removed"})
+
+	project, warnings, err = loadVersioned("services:\n  web:\n    image: nginx\n")
+	assert.NilError(t, err)
+	assert.Equal(t, project.Version, "")
+	assert.Equal(t, len(warnings), 0)
+
+	project, err = loadCached(types.ConfigDetails{
+		WorkingDir: "/code",
+		ConfigFiles: []types.ConfigFile{
+			{Filename: "compose.yaml", Content: []byte("version: \"2.4\"\nservices:\n  web:\n    image: nginx\n")},
+			{Filename: "compose.override.yaml", Content: []byte("version: \"3.8\"\nservices:\n  web:\n    init: true\n")},
+		},
+	}, func(options *Options) {
+		options.Name = "versioned"
+		options.Warn = func(string) {}
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, project.Version, "3.8")
+}
+
+func TestEnforceVersionCompatibility(t *testing.T) {
+	enforce := func(options *Options) {
+		options.EnforceVersionCompatibility = true
+	}
+	_, _, err := loadVersioned("version: \"3.7\"\nservices:\n  web:\n    image: nginx\n    init: true\n", enforce)
+	assert.NilError(t, err)
+	_, _, err = loadVersioned("version: \"3\"\nservices:\n  web:\n    image: nginx\n    deploy: {replicas: 2}\n", enforce)
+	assert.NilError(t, err)
+	_, _, err = loadVersioned("services:\n  web:\n    image: nginx\n    profiles: [debug]\n", enforce)
+	assert.NilError(t, err)
+
+	for _, tc := range []struct {
+		version string
+		service string
+		message string
+	}{
+		{version: "3.6", service: "init: true", message: `services.web.init requires version 3.7 of the compose file format, the compose file declares version "3.6"`},
+		{version: "2.1", service: "init: true", message: `services.web.init requires version 2.2 of the compose file format`},
+		{version: "3.8", service: "profiles: [debug]", message: `services.web.profiles is not supported by version "3.8" of the compose file format`},
+		{version: "2.4", service: "deploy: {replicas: 2}", message: `services.web.deploy is not supported by version "2.4"`},
+		{version: "3.0", service: "deploy: {resources: {reservations: {devices: [{capabilities: [gpu]}]}}}", message: `services.web.deploy.resources.reservations.devices is not supported`},
+		{version: "latest", message: `invalid version "latest", expected a version like 3.8`},
+		{version: "1", message: `version "1" is not a legacy compose file format version`},
+	} {
+		content := "version: \"" + tc.version + "\"\nservices:\n  web:\n    image: nginx\n    " + tc.service + "\n"
+		_, _, err := loadVersioned(content, enforce)
+		assert.Check(t, errdefs.IsInvalidError(err), content)
+		assert.ErrorContains(t, err, tc.message, content)
+	}
+
+	_, _, err = loadVersioned("version: \"3.9\"\nname: app\nservices:\n  web:\n    image: nginx\n", enforce)
+	assert.ErrorContains(t, err, `name is not supported by version "3.9"`)
+}
@@ -89,10 +89,17 @@ func populateFieldFromBuffer(char rune, buffer []rune, volume *types.ServiceVolu
 		case "rw":
 			volume.ReadOnly = false
 		case "nocopy":
-			volume.Volume = &types.ServiceVolumeVolume{NoCopy: true}
+			if volume.Volume == nil {
+				volume.Volume = &types.ServiceVolumeVolume{}
+			}
+			volume.Volume.NoCopy = true
+		case "consistent", "cached", "delegated":
+			volume.Consistency = option
+		case types.SELinuxShared, types.SELinuxPrivate:
+			bindOptions(volume).SELinux = option
 		default:
 			if isBindOption(option) {
-				volume.Bind = &types.ServiceVolumeBind{Propagation: option}
+				bindOptions(volume).Propagation = option
 			}
 			// ignore unknown options
 		}
@@ -100,6 +107,15 @@ func populateFieldFromBuffer(char rune, buffer []rune, volume *types.ServiceVolu
 	return nil
 }
 
+// bindOptions returns the bind options of a volume, allocating them if needed, so that multiple
+// options in a short syntax spec accumulate
+func bindOptions(volume *types.ServiceVolumeConfig) *types.ServiceVolumeBind {
+	if volume.Bind == nil {
+		volume.Bind = &types.ServiceVolumeBind{}
+	}
+	return volume.Bind
+}
+
 var Propagations = []string{
 	types.PropagationRPrivate,
 	types.PropagationPrivate,
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/compose-spec/compose-go/errdefs"
 	"github.com/compose-spec/compose-go/types"
 	"gotest.tools/v3/assert"
 	is "gotest.tools/v3/assert/cmp"
@@ -120,6 +121,41 @@ func TestParseVolumeWithBindOptionsWindows(t *testing.T) {
 	assert.Check(t, is.DeepEqual(expected, volume))
 }
 
+func TestParseVolumeWithSELinuxOptions(t *testing.T) {
+	volume, err := ParseVolume("./data:/data:ro,z")
+	expected := types.ServiceVolumeConfig{
+		Type:     "bind",
+		Source:   "./data",
+		Target:   "/data",
+		ReadOnly: true,
+		Bind:     &types.ServiceVolumeBind{SELinux: "z"},
+	}
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(expected, volume))
+
+	volume, err = ParseVolume("~/data:/data:Z,rslave")
+	expected = types.ServiceVolumeConfig{
+		Type:   "bind",
+		Source: "~/data",
+		Target: "/data",
+		Bind:   &types.ServiceVolumeBind{SELinux: "Z", Propagation: "rslave"},
+	}
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(expected, volume))
+}
+
+func TestParseVolumeWindowsDriveWithOptions(t *testing.T) {
+	volume, err := ParseVolume("C:\\data:/data:rw,z")
+	expected := types.ServiceVolumeConfig{
+		Type:   "bind",
+		Source: "C:\\data",
+		Target: "/data",
+		Bind:   &types.ServiceVolumeBind{SELinux: "z"},
+	}
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(expected, volume))
+}
+
 func TestParseVolumeWithInvalidVolumeOptions(t *testing.T) {
 	_, err := ParseVolume("name:/target:bogus")
 	assert.NilError(t, err)
@@ -237,3 +273,41 @@ func TestParseVolumeInvalidSections(t *testing.T) {
 	_, err := ParseVolume("/foo::rw")
 	assert.ErrorContains(t, err, "invalid spec")
 }
+
+func TestVolumeShortStringRoundTrip(t *testing.T) {
+	for input, canonical := range map[string]string{
+		"/data":                           "/data",
+		"data:/data":                      "data:/data",
+		"data:/data:rw":                   "data:/data",
+		"data:/data:nocopy,ro":            "data:/data:ro,nocopy",
+		"./src:/src:delegated":            "./src:/src:delegated",
+		"/var/run:/var/run:Z,rslave,ro":   "/var/run:/var/run:ro,Z,rslave",
+		"~/.ssh:/root/.ssh:ro,cached,z":   "~/.ssh:/root/.ssh:ro,cached,z",
+		`C:\Users\me:/home/me`:            `C:\Users\me:/home/me`,
+		`\\.\pipe\docker:\\.\pipe\docker`: `\\.\pipe\docker:\\.\pipe\docker`,
+	} {
+		volume, err := ParseVolume(input)
+		assert.NilError(t, err, input)
+		short, err := volume.ShortString()
+		assert.NilError(t, err, input)
+		assert.Equal(t, short, canonical, input)
+		reparsed, err := ParseVolume(short)
+		assert.NilError(t, err, input)
+		assert.DeepEqual(t, reparsed, volume)
+	}
+}
+
+func TestVolumeShortStringInvalid(t *testing.T) {
+	for _, volume := range []types.ServiceVolumeConfig{
+		{Type: types.VolumeTypeTmpfs, Target: "/tmp", Tmpfs: &types.ServiceVolumeTmpfs{Size: 1024}},
+		{Type: types.VolumeTypeNamedPipe, Source: `\\.\pipe\docker`, Target: `\\.\pipe\docker`},
+		{Type: types.VolumeTypeVolume, Target: "/data", ReadOnly: true},
+		{Type: types.VolumeTypeBind, Source: "data", Target: "/data"},
+		{Type: types.VolumeTypeVolume, Source: "./data", Target: "/data"},
+		{Type: types.VolumeTypeVolume, Source: "data", Target: "/data", Extensions: map[string]interface{}{"x-foo": "bar"}},
+	} {
+		_, err := volume.ShortString()
+		assert.Check(t, errdefs.IsInvalidError(err), "%+v", volume)
+		assert.ErrorContains(t, err, "can't be represented in the short syntax")
+	}
+}
@@ -41,7 +41,7 @@ func withVersionServices(workingDir, homeDir string) []types.ServiceConfig {
 				"front":   nil,
 				"default": nil,
 			},
-			VolumesFrom: []string{"other"},
+			VolumesFrom: []types.VolumesFromSource{{Kind: types.VolumesFromService, Name: "other"}},
 		},
 		{
 			Name: "other",
@@ -212,58 +212,65 @@ var _escData = map[string]*_escFile{
 	"/data/compose-spec.json": {
 		name:    "compose-spec.json",
 		local:   "data/compose-spec.json",
-		size:    25664,
+		size:    28941,
 		modtime: 1518458244,
 		compressed: `
-H4sIAAAAAAAC/+w8S4/juNF3/wpBu7ft13z4sMDMbZFTgCwSYCcBkoZXoKWyzGmK5JCUu72D/u8BRUnW
-gxIpWXZ7Nn0YTFsqklWlYr3Jb6sgCH+U8Q4yFH4Kwp1S/NP9/RfJ6K15esdEep8ItFX3//fw4ePtw8d7
-8+KH8EYPxokeF7OMMwmR5BDf6dHmpTpw0K/Z5gvEqnyGFSke/sWMCX7jEOMtjpHC1bgEZCwwLx58CsLP
-Owgq6C0mEGAZoODfv/z6N/MzgS2mmKYBCrKcKHwbM6oQpiBksEESkgBxTsoV7sKblV6DC8ZBKAwy/BRo
-PgRBuAchzZrmQYMEqQSmaYFe8byD4r/MyIBtA9XAVjZpC3IJyV3wmTEiA8pUgDNOIAOqNO4CvuZYQBKU
-SAS//vO3z4EAzblizpjRLU5zYebShN+FBTavBUFBEEoQexw3CKq/zw/3R3Lva7CbLpGN71Q850gpEPQf
-fVYVr39/RLd//HL7n4fbj3fR7fqnH1uvtWQJ2JrlzSfSmNfrhzXka/nXa70wSpICGJHW2ltEJLRppqCe
-mXhy0VyDvRHN5foWmtvk7BnJM+cXrKDeiBiz/DLfT0IsQLlF1kC9mcTq5Zch2GxjF8EV1BsRbJY/jeBV
-RbQdx/D3l1v9/2sx5+h8ZpYGfgURLZ1nY6dN5wzzs2boACcT4IQdCsztPDMAWp2HNZuCINzkmCRdrjMK
-f9dTPDYeBsG3rrVpzFO8b/0aFor6/QAt9XttJ+FFFUSNL21YwOInENry+I5Awkj6AMsIlipiIkpwrKzj
-CdoAOWmGGMU7iLaCZc5ZtpGhRFonqjS4J+UKiRS8OSt3WSTxHy2+PoaYKkhBhDf12LVtMLwogaIdk+ok
-TmHJCCr9mT7SHfjeBI4N3BXMcY3QAm/+Wq8sCIQb8oRZVOqszk4b2SJj2yNMQOuLSABKog237Z96aiQE
-OvQ3H1aQjX0QgzXBGVYd9naY28IFs+tA5llgBdfCGYPMm7PmGXC6a+/5agvbQSOD/9mQLhEa3k8ttNw2
-vbvxYsQjlCQtikuEmyj2FGAQ5hR/zeGvJYgSOXTnTQTjy0+cCpbziCOhzfS4ctZBbYboUrZ7Ch1uldf3
-Ih1Sc1ytLYh2agIPs2XxJxz+iNsj0aaQ5SL2dTCmGtogCHOc+AOnU4AzlrTxpnm20Xu/B2x1lSbYz4kW
-tL3nmyLVfNMRL5NAiSjKwLlReB7FLKd21XcThBmmOMu1B/bQHcdBxOA1Uv9CL+WvDw+9meQOCZBtD6r8
-AnYHqhj1NWcKTR3EQWCWTB0l1PyBIqcKZzBx5FRuSHArRQEJUIURKZJ9S7lbR+fNsddCz/AjFJBiqcTB
-5c36m8A2MZ77r8m7BDjQREatDOOoTZkVrkwOE0933fv6yZV48LcZk3Wjj5kxImdmHQQZTv/2YzBaqKXH
-Kh8RSYWEgqTYbOWjHSCidodwbZ3k1fLUbmeqTHGx3pGK/rTjVsDtZJTedek0iZyAnBdElzPJxf25hI5h
-ZKbRQa/GLewMjBhXNoROxCeSgES8m4kWyxCmPjYXqBIHzrAxnVfnnwLdR7WmnswGoHssGM0qx8Avo9EY
-/8KZhNOd49pyVtu/9unWXavERIY0stXagxamL0B2Br4obSsulTicmjlspF198luDRtuZVmopu2rV9SQT
-NlHrac4LikhEMH1aXmWdlq0LjS4ug+6zSfep0mtMXbyD+GmEyCZUazSTykcH4gylbiCK22p+wxgBRNtA
-PHbOM5oebQDOzlmH5xE4wtJUQ7o8de/MqMB7ED4uOOPHas3UyoWnl3lnHMsRWS7+IiRc+3tDFwwJMhTr
-zSxASpdcZZCVWcgJQZ0eJEDrzZ7sNnlVRdy9sfIZcY5pFz1LWlODa+jpOJaVlaiXP7EwwVLuv4IAaumY
-aCgpN5R48w+lfKMjI/kEIznX5+/Xl/j+/z1l3Tb257ljtVaNCIsRiTBfihguMBNYHfzyfSPR3Kz4dkYG
-cBSFJgmEWAnwiC7P6ZQxlkVPmJAowRJtOs6kzaLrATJmAiKUfHFnF28/PDz0MoytFCPHybClKexLG1hO
-V4ScIKUDCZcS5Eyoi6T+j+ge4xuzeL8a0EuV+Aw6TwnBw5CMFxAGqnYVAvmGYLmDZMoYwRSLGfEJgq6r
-PjDH/ecC7zGBtMMi2z7lgungcG5iieeERJwRHFsTvTfHzFzLpSPP6CCLrQt7I+B4G1GmIq6dJdpo9Wpt
-0KICzyg5OMkSUCQAXTu5kdZftcraXECMVME/zeWb1XBO0voFZIzIYAKkElX7SIhzbdmG0mMnxSL2Ppdx
-rdjvEHwvdb6XOhcrdcqDjNW8eF2qBNOIcaBOfSAV41EqUAyWGqDVZCZlp3d/GolTiohLtaiMb2cmx5Vy
-K7i88G7kpPqfM0oyEZI9MBoJiryM8Ozik08taYfEBG+g2PrbAZdjXhmomO+mRGS9UBFtYoDRfbIeTrBY
-d2IunWmlAoZKr1RBv5X++7Abre9agK9nWZdyJU+Nfm5b5O06tSu0EksF1O7c2QdtcK9la2qKxC9BUkCh
-1LtldjQCn5ECmJEAsHOsPM5xEZ5RFjM+IAPfC79qy3p+dlW+8nAiqpfVGAZt9FINZaiu8BP86YLj0i7V
-ZxKmGqdRNeiLxDMTT9r9S7AY012v4+eM2md4Jh6E6tQIx07vNEHdJ6KGDvB4Zg71ThJ7u4Pt9tAFKIE7
-nS5VcNR0sUFeZ+OGwhmwXM0NT5C1ydExw6TDZb4SuWpMGTbOZjlErQHZlbTHWtSqlK9T5nz8VKBJ0cfj
-5dQKKA4yu6tx86vQghGyQfHTwgdqOBKIECBYZl4nJBIg6DBLDE3HCcIkFxCh2KNmX34rihUT85fM0EtU
-LVuAOJSA2fQiAeGfujxus9stFlKZpBnj5a+2pXqjmnbOE6TgXXzexWeW+AgwsahcSnSsmaplzs9Oa7Fv
-tkowd2f6pc9Z9hro67aR74V5FugUKAgcRy2pGjCJfVjrKehGL/PQSXADcSWHZi+7d40LWFfkFjoccuzU
-d+nhExW/1sKa8Iwr6XeSE9OEPU/3di/8ZThBMXQc4FM/ilQCYaomtyx2WcgFbEEAjeGk87tnKtJxASj5
-Lur2NlmuAgYdlUW0G2HYqg7nFsqzRnurYaU/FvX1B/TSDG3ps0jdsLQNS1mYYBkLUFCvbDtV55LkcSkO
-n8qMuNNchntEco+6blfO/EV8gnjb1ZjfUp7LdKSmYdjHMwQDt2edR0JixNEGE1xTMaN5MeydznU1/x5P
-f+Fk/rJVq7gjZ1n3ifvlKi4uGI2rX8YEowJbIG/kc/rBqw+/hIoYX75W7+69X7s3NOYoW+zOFu+TCdbc
-xDU4G/mGgjv5asAizOueaHulCvNIIJpOKOumSMEzmlBuRflLhQScXBRbrqLUkU1rAvxqS0wLnqNZIsD0
-4+UbxTXVab0BHfJYl3huaiatvRVKpYZXvRTASH/maI/mG3KqqGt1G8dsBTCgaEMgwnz/sxMWKYXinVdd
-bWJF4gJhQq/xwWrWS6h3qz7Bqr/vSt9deX27orzs1HmhZgE1uxrvsxc8rnq5jKSN3h+zxGf90ykABRkn
-SEE0Qs4FZLnn51tluYT635DlM2rNhXfClchQp1G+IUv9hp2xz+udQlk1+3NqNLpgljvqhxJQg0gNdYt1
-Fi2/zTjlC6qgu59GQp2xI/5nuudygTNQ9m/avFrU8j199Q9HaudsHELK43bhWfeaN0g53oB6TlrG7lk9
-7Wb2ZkVrVZ8/E71LWofMSDW+d9+4RoQeeu1939rd/uau8HYetgNi7jxpWOC1VxbZdgu55Sqx4jbwgTNT
-7dzoSv97/W8AAAD///7BNlpAZAAA
+H4sIAAAAAAAC/+w9W2/rNtLv/hUE27c6l374sEDPW7FPC2yxBdpdYHvgCrQ0ttlQJEtSSdwi/31BXawb
+JVKXODlF/HJO7BlyOBrOndSfG4Tw1zo+QUrwJ4RPxshPd3e/acFvim9vhTreJYoczN3/3X/73c39d3fF
+D1/hrUWmicWLRSqFhkhLiG8tdvGjOUuwP4v9bxCb8jtqWP7l3wsc9JOEmB5oTAyt8BLQsaIy/+ITwj+f
+AFXQB8oAUY0I+u/3P/yz+DOBA+WUHxFBacYMvYkFN4RyUBrtiYYEESlZOcMt3m42CGGphARlKGj8CVk+
+IIQfQelizuKLxhK0UZQf8bb6vkPifwpMJA7INKjVzbWhTENyi34WgmnEhUE0lQxS4MbSruD3jCpIUEkE
++uHfP/2MFFjO5WPGgh/oMVPFWHbht3iDEEIv+YIQwpykMIP2nH3Qolsqkc9rR9yijBvKLPWqYDVoJDgg
+eLZMpYadu4RQHrMscdJClCLnmhRqINUNOISw4PCvA/6EPl++QujP7lpets1fG/93S139cT335q/EnOz3
++GsFlgj81V0hXZZZ+q6YPRIqYlSbNhX2g4E/RvbRLBmjZH6UUAWxEeqcD9ZlQAurMwiuhMmysVjTrgNB
+kiSnh7Afmww5EKahAVlPs9t0puqKUVzJfLa/KZegkRFoD6iUh6QrJxrUI41bT6JUKF/d1c/p7gK23Yw/
+YrtUA4r/6H7G+NfP5OaP729+ub/57ja62X3zdetnhIaeWDE/3nS5UvPCy856k4J5EurBt+YL2ButuZzf
+seb2ch4Fy1LvE6yg3mgxxfTrPD8NsQLjF9kC6s0k1k6/zoILu+NbcAX1Rgsupl+24E21aDeN+NfnG/vv
+Sz7m6HjFKA368kW0dJ6LnS6dM8zPzbhBw4RzYchl+gHGWRtkbVFC45YtwsQYEp9apmcvBAPCW2AJSCbO
+IxMUANbL6eA9AhNyFDGH6GHuM8qSrlS4nAaf24D65n/UdfA5D8VeMfBsnAZ72wdPRPwA6uIvBGAQdZzz
+NKsPZmQPbNEIMYlPEB2USL2jHKJiJdo5UGVhAlduiDpCMGf1KY00/aPF18+YcgNHUHh7wd25kOHZKBKd
+hDZjnGpCuUahWjBSOkdBNBecNWIpX0WUj+TbutUHy4yxYGCtT0ukp2E9x52tqNDodrACZ0AojnohuyQj
+5iBUunSc2h5EpRZYtM0yRlM6OkQF8dJB7o3mMVX9CGjM9rXAm3/tNg4C8J49UFE+y67OHlG2Y4rWmg4r
+IApIEu1lH2Aw2kSoG3UOsLagOuevJ9Bq0kLF+yDmSVED0f49EfPmrHkCejy1rUdlDNygUUH/qxFdEjS8
+n1pkhYXrDRQcExmRJGmtuCS4SWLPLCGccfp7Bv8oQYzKoDtuooRsYa8y8FGJTHpsZQkVSaKAGy+wSFPC
+1/IVp6zWrxgbUdUCQ4gvmc6oSv6NMkRmUSwy7t4IW4RTymmapfgTuu/iSVAxBGHav8hz+de3972R9Iko
+0G3PjGfpftAxy7F+z4QhU5EkKCqSqVjKzEdUNlmawkTMqdzQ4Bd+BQlwQwnLs/JrGd/alHv2Cw4Ma7CC
+I9XGn+UMV4jbzQx/phPUAk901CoFjOqOWX7j5PBzuSPXdzR9CZdQ4iYTGBJQVyJXjDoIMlzr6H4w8Fwt
+fa7yMJE2RBlI8s1WfnUCwszp3PzKJrcZGEgincUxaH3IGDvjnXOaF/fsWEE+mTvW2gSO087t17zpk/Ky
+Gfvbb6JKD640uSpjMDNGKkfSQzqo70g56kIj2w8FxNcOyfcKdJvVWmQqBrxzwHmluEIOywRMzXYghCWo
+lGp9SfaNVosGZGvi7p0UKXalb+esMbVkZjRtOVxEs4iRkGY+sgai4tNMfJESykN8MeBGnaWghUv17vzT
+RYVMi02V4GnlMIYlQRr4z7aUuFxfXDyqyiygyrfadb0VoVJiia3mHvQ8+mGMm4HPxvoQ10pUT81UN8oQ
+IbnJQWfOm3xq69By1t0k12ai3bKcVzYPxyh/0KsHqouyw7gwpmVk/mrCvVR4Cw8oPkH8MLLGJlQLW2gT
+ogJpSo5+IE6NtwpFZewdJzAdP79Egl9H3pg4Hi2kL4ALTp8q+ggqJDITsi5eToxUQoOP2yLeGJHl/H+M
+4V24O3vFSDElsd3MCrT2yVUKaZmqnBDrWyQFVm32ZLfJqyoR08PVT0RKyrvkOXKfFtxCT6exLORFqUi8
+u9nR/fIO4uq1Q2X3aobICyVzStBcSD6jRMPCwlZDxz7+f6Csu3D/NhfXatWIiZiwiMq1FiMVFYqadtKp
+FPOXAbTB8SanPWaET6MkNJfAmHMBAemB1/TJhEijB8pYlFBN9sxbnM4RdCwURCT5zZ90vvn2/r6XeG5l
+niVNhi1Nbl/awHq6IqxKyT4lKIUyV0mG1OTW4U0x+ct2EKnmix9pTlLFnywJMCQItbzNiMpFuZWBWmBF
+cbZnVJ8gmWJ+2ys2Ihbsy8vMzIkdpKKPlMEREu8ml0rYwHJuWtE2rkRSMBo7iwfbOtvb8gfZEzlr+yuH
+x2J30EPEhYmk9bS4KTSL1uUYRb9Z3QfdpCCv+wvOzt6lOnK/TQmqUNqj17Wk5gISkApiYiApH8PWpUfK
+sZ2PSMeEDWZXKmF2Y0KcWbt5ybCtGem4m7bGde46DUVYn3Vs5kV92iSUR0IC9wqBNkJGR0VicBQYnYo3
+Kc979IfR9MgJ85kabYQiR+g9rlI9N0FNKg8zU67G+DfAhIamJpb2hqo5DNdB4UdmvGFav6EdfXm1ihx8
+XqWinCnQlr52XSNYwdYfWxPTVBvgbrPgRtrTXqPI1MgsLC7LochxSmdotS4FxECeU4wu55SCWFJqSkZ5
+9uyxlPgP+9cv/XTLaAAyIwKaEf+4n1yxYa/z7LiIhTwHF3DfJb8uev712VUZ8+E4vBfUDYM2OowmB+g9
+2zAa6r/tQ/vLBQSlRb2cGZhqVkc1ZCgRNuto3ZeEqrEw7GW7CWPZjINUnaLK2OmfJqj/RJV7L+LQVIvd
+e+qRsHnOqAKjKGjn7mqAGdDvs9BtIyyRmbmeOHE2C3pGmHQ4LVQi28LWPD3lEbYmaFfYPl+krUqTecXu
+iZj41PpqSXXTbYccB5y3CJO46ISadOKbHrlQMDWWfdkOnhz3+XMVmR4/TEGReNgirM88rv79pkok9HNN
+Y871aHP85LPg1xHgy7lBr/xeIFcQ35AwEniSd+4ExZwK8rsn/AW4+YVnJRjbk/hh5YM2kijCGDCq06CT
+Ewkwcp6lSO0HHwhlmU34x4GxEU4Fp0ao+VOm5Dmqps1BPGbMfrBQCajwhGNtKG4OVGlTZLKELP9q+1pv
+VMbOZGJDyw/x+RCfOeKjoMgD6bVEp84Vrn5Ce9phi/pRQxp0E8t1z1/2vKJLp8iXwjwH9BE4KBpHLaka
+MIl9WNeIjf7z4csGcoh3cpj2unu3CGIudbSVjgnVZzZ8enih4rda2C48lUaHnfCkPBFP0+O1Kz8ZyUgM
+HQd46UPRRhHKjV4Y72Cp4AAKeAyLzvW+Tv+AlrZs8EVU212yXAUMNq8Q8W6EcRHqKwrlFcI9p9Ifi/r6
+CNvpd80NStuwlNm0mi0fw2Vm1/nKhdfQPZTVKH8y4ZGwLCC1PSXk71IaLN5uNRY2VeA0/SwXDZCVCuw6
+ElKckid7yqiho16Hp2MR985qhzQdVef2aLJk6qpLPLxJPCxr4dZaryokjYuGxoSkAlshhxRy+CGoDb+E
+su0b02Irb0NzSOv9zr+5qSTpave6BB9McOYp3oPjke05+EsJBVhE5aUl2l2ppTJShB8ntFcciYEnMqHt
+gWTPFRGwuCi8Xn20I5vOco7boXqHPt2CYzRrBJthvHyjGKc6qzegQz5fCpbbC5N2wQqlcx9yWAMlGmui
+fENOUV5zarScC9xWfSN75MILW1zyGFQlnliduELI0Gv8cZr1EurDqk+w6h+7MnRXvr9dUTY3e6+XzaFm
+95aE7IWAC4B6FwWMgV5DKEcvIFpDAv5yusLmXZktHo4s5wpi3wsJnGJfQn2I/fV08cemeb+bpnOko16s
+ozVvjN/BSaZNsxOv+xqI/gmdL+/9IRPOQ0w5C4EzGpgPPoYChrVEXzlvvHNn8LJeP8Ci1ws43irga0Ud
+KCWuXmE/EZWEnkzFWhyMtzaEAm7lseNsy8l3b359tFsGurpkgm4Y3AxDzeOdSUszNK4eV7Qxt9+M5IrG
+rkh5pcuEVzjl6Vb8nauU3pK7w1d2hGRS1+NQfz98Ic+yeRd3iJ4eUNABbdRYERPwYodZr7xpLKW+Mvw1
+1zJ2Mfmyl/Y0Wz2qAfovnxkOlCr83qtoEMKEnx0+VsuoFN3r7eJkB6S4/2vXMP9BBXjXC2Ac96LmL2LZ
+jfev1y/+2bxs/jcAdwtnqA1xAAA=
 `,
 	},
 
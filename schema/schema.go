@@ -19,10 +19,14 @@ package schema
 //go:generate esc -o bindata.go -pkg schema -ignore .*\.go -private -modtime=1518458244 data
 
 import (
+	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/compose-spec/compose-go/types"
 	"github.com/xeipuuv/gojsonschema"
 )
 
@@ -55,17 +59,163 @@ func init() {
 	gojsonschema.FormatCheckers.Add("duration", durationFormatChecker{})
 }
 
+var (
+	compileOnce    sync.Once
+	compiledSchema *gojsonschema.Schema
+	compileErr     error
+)
+
+// getSchema returns the compose-spec jsonschema, compiled once for the whole process
+func getSchema() (*gojsonschema.Schema, error) {
+	compileOnce.Do(func() {
+		schemaData, err := _escFSByte(false, "/data/compose-spec.json")
+		if err != nil {
+			compileErr = err
+			return
+		}
+		compiledSchema, compileErr = gojsonschema.NewSchema(gojsonschema.NewStringLoader(string(schemaData)))
+	})
+	return compiledSchema, compileErr
+}
+
+var (
+	parseOnce    sync.Once
+	parsedSchema map[string]interface{}
+	parseErr     error
+)
+
+// Properties returns the sorted names of the properties declared by a definition of the compose-spec jsonschema,
+// or by the top-level object if definition is empty
+func Properties(definition string) ([]string, error) {
+	parseOnce.Do(func() {
+		schemaData, err := _escFSByte(false, "/data/compose-spec.json")
+		if err != nil {
+			parseErr = err
+			return
+		}
+		parseErr = json.Unmarshal(schemaData, &parsedSchema)
+	})
+	if parseErr != nil {
+		return nil, parseErr
+	}
+
+	object := parsedSchema
+	if definition != "" {
+		definitions, _ := parsedSchema["definitions"].(map[string]interface{})
+		var ok bool
+		if object, ok = definitions[definition].(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("unknown schema definition %q", definition)
+		}
+	}
+	properties, _ := object["properties"].(map[string]interface{})
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// extensibleDefinitions are the definitions of the objects which extensions, declared by `x-` keys, are collected by
+// the loader
+var extensibleDefinitions = []string{"service", "network", "volume", "secret", "config"}
+
+// Export returns the compose-spec jsonschema used to validate compose files, completed with the values the loader
+// enforces once the attributes are parsed, like restart and pull policies, so that editors offer the same completions
+// and checks as the loader
+func Export() ([]byte, error) {
+	schemaData, err := _escFSByte(false, "/data/compose-spec.json")
+	if err != nil {
+		return nil, err
+	}
+	var exported map[string]interface{}
+	if err := json.Unmarshal(schemaData, &exported); err != nil {
+		return nil, err
+	}
+
+	service, err := lookupObject(exported, "definitions", "service", "properties")
+	if err != nil {
+		return nil, err
+	}
+	service["restart"] = map[string]interface{}{
+		"type": "string",
+		"anyOf": []interface{}{
+			map[string]interface{}{"enum": []interface{}{
+				string(types.RestartNo), string(types.RestartAlways), string(types.RestartOnFailure), string(types.RestartUnlessStopped),
+			}},
+			map[string]interface{}{"pattern": "^" + string(types.RestartOnFailure) + ":[0-9]+$"},
+		},
+	}
+	service["pull_policy"] = map[string]interface{}{
+		"type": "string",
+		"enum": []interface{}{
+			string(types.PullPolicyAlways), string(types.PullPolicyNever), string(types.PullPolicyIfNotPresent),
+			string(types.PullPolicyMissing), string(types.PullPolicyBuild),
+		},
+	}
+	condition, err := lookupObject(service, "depends_on", "oneOf", 1, "patternProperties", "^[a-zA-Z0-9._-]+$", "properties", "condition")
+	if err != nil {
+		return nil, err
+	}
+	condition["enum"] = []interface{}{
+		types.ServiceConditionStarted, types.ServiceConditionHealthy, types.ServiceConditionCompletedSuccessfully,
+	}
+
+	extensible := []map[string]interface{}{exported}
+	for _, name := range extensibleDefinitions {
+		definition, err := lookupObject(exported, "definitions", name)
+		if err != nil {
+			return nil, err
+		}
+		extensible = append(extensible, definition)
+	}
+	for _, object := range extensible {
+		patterns, ok := object["patternProperties"].(map[string]interface{})
+		if !ok {
+			patterns = map[string]interface{}{}
+			object["patternProperties"] = patterns
+		}
+		if _, ok := patterns["^x-"]; !ok {
+			patterns["^x-"] = map[string]interface{}{}
+		}
+	}
+	return json.MarshalIndent(exported, "", "  ")
+}
+
+// lookupObject returns the object found in node following path, made of property names and array indexes
+func lookupObject(node interface{}, path ...interface{}) (map[string]interface{}, error) {
+	for i, step := range path {
+		switch key := step.(type) {
+		case string:
+			object, _ := node.(map[string]interface{})
+			node = object[key]
+		case int:
+			array, _ := node.([]interface{})
+			if key >= len(array) {
+				node = nil
+				break
+			}
+			node = array[key]
+		}
+		if node == nil {
+			return nil, fmt.Errorf("schema has no %v", path[:i+1])
+		}
+	}
+	object, ok := node.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("schema %v is not an object", path)
+	}
+	return object, nil
+}
+
 // Validate uses the jsonschema to validate the configuration
 func Validate(config map[string]interface{}) error {
-	schemaData, err := _escFSByte(false, "/data/compose-spec.json")
+	compiled, err := getSchema()
 	if err != nil {
 		return err
 	}
 
-	schemaLoader := gojsonschema.NewStringLoader(string(schemaData))
-	dataLoader := gojsonschema.NewGoLoader(config)
-
-	result, err := gojsonschema.Validate(schemaLoader, dataLoader)
+	result, err := compiled.Validate(gojsonschema.NewGoLoader(config))
 	if err != nil {
 		return err
 	}
@@ -128,6 +278,11 @@ type validationError struct {
 	child  gojsonschema.ResultError
 }
 
+// Field returns the dotted path of the invalid value
+func (err validationError) Field() string {
+	return err.parent.Field()
+}
+
 func (err validationError) Error() string {
 	description := getDescription(err)
 	return fmt.Sprintf("%s %s", err.parent.Field(), description)
@@ -17,9 +17,15 @@
 package schema
 
 import (
+	"encoding/json"
+	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/compose-spec/compose-go/types"
+	"github.com/xeipuuv/gojsonschema"
 	"gotest.tools/v3/assert"
+	is "gotest.tools/v3/assert/cmp"
 )
 
 type dict map[string]interface{}
@@ -233,3 +239,80 @@ func TestValidateRollbackConfigWithUpdateConfigFull(t *testing.T) {
 	assert.NilError(t, Validate(config))
 	assert.NilError(t, Validate(config))
 }
+
+func TestProperties(t *testing.T) {
+	properties, err := Properties("")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, properties, []string{"configs", "include", "name", "networks", "secrets", "services", "version", "volumes"})
+
+	properties, err = Properties("service")
+	assert.NilError(t, err)
+	assert.Check(t, is.Contains(properties, "environment"))
+	assert.Check(t, is.Contains(properties, "build"))
+
+	_, err = Properties("helicopter")
+	assert.ErrorContains(t, err, `unknown schema definition "helicopter"`)
+}
+
+func exportedSchema(t *testing.T) map[string]interface{} {
+	t.Helper()
+	data, err := Export()
+	assert.NilError(t, err)
+	var exported map[string]interface{}
+	assert.NilError(t, json.Unmarshal(data, &exported))
+	return exported
+}
+
+func TestExport(t *testing.T) {
+	data, err := Export()
+	assert.NilError(t, err)
+	exported, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(data))
+	assert.NilError(t, err)
+
+	validate := func(service dict) bool {
+		result, err := exported.Validate(gojsonschema.NewGoLoader(dict{"services": dict{"foo": service}}))
+		assert.NilError(t, err)
+		return result.Valid()
+	}
+	assert.Check(t, validate(dict{"image": "busybox", "restart": "unless-stopped"}))
+	assert.Check(t, validate(dict{"image": "busybox", "restart": "on-failure:3"}))
+	assert.Check(t, !validate(dict{"image": "busybox", "restart": "sometimes"}))
+	assert.Check(t, validate(dict{"image": "busybox", "pull_policy": "missing"}))
+	assert.Check(t, !validate(dict{"image": "busybox", "pull_policy": "daily"}))
+	assert.Check(t, validate(dict{"image": "busybox", "depends_on": dict{"db": dict{"condition": "service_healthy"}}}))
+	assert.Check(t, !validate(dict{"image": "busybox", "depends_on": dict{"db": dict{"condition": "service_ready"}}}))
+	assert.Check(t, validate(dict{"image": "busybox", "x-team": "web"}))
+
+	service, err := lookupObject(exportedSchema(t), "definitions", "service")
+	assert.NilError(t, err)
+	assert.Check(t, is.Contains(service["patternProperties"], "^x-"))
+}
+
+// legacyServiceFields are the fields of types.ServiceConfig kept for the legacy file formats, which attributes are
+// rejected by the schema
+var legacyServiceFields = map[string]bool{
+	"Dockerfile":   true,
+	"LogDriver":    true,
+	"LogOpt":       true,
+	"Net":          true,
+	"VolumeDriver": true,
+}
+
+func TestExportCoversServiceConfig(t *testing.T) {
+	properties, err := lookupObject(exportedSchema(t), "definitions", "service", "properties")
+	assert.NilError(t, err)
+
+	serviceConfig := reflect.TypeOf(types.ServiceConfig{})
+	for i := 0; i < serviceConfig.NumField(); i++ {
+		field := serviceConfig.Field(i)
+		tag := field.Tag.Get("yaml")
+		name := strings.Split(tag, ",")[0]
+		if name == "-" || strings.Contains(tag, ",inline") || legacyServiceFields[field.Name] {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		assert.Check(t, is.Contains(properties, name), "ServiceConfig.%s is missing from the schema", field.Name)
+	}
+}
@@ -63,7 +63,11 @@ type SubstituteFunc func(string, Mapping) (string, bool, error)
 
 // SubstituteWith subsitute variables in the string with their values.
 // It accepts additional substitute function.
+// If pattern is nil, the default pattern is used
 func SubstituteWith(template string, mapping Mapping, pattern *regexp.Regexp, subsFuncs ...SubstituteFunc) (string, error) {
+	if pattern == nil {
+		pattern = defaultPattern
+	}
 	var err error
 	result := pattern.ReplaceAllStringFunc(template, func(substring string) string {
 		matches := pattern.FindStringSubmatch(substring)
@@ -149,6 +153,15 @@ func recurseExtract(value interface{}, pattern *regexp.Regexp) map[string]Variab
 	return m
 }
 
+// ExtractStringVariables returns the variables referenced by a single string, in order of appearance
+func ExtractStringVariables(value string, pattern *regexp.Regexp) []Variable {
+	if pattern == nil {
+		pattern = defaultPattern
+	}
+	values, _ := extractVariable(value, pattern)
+	return values
+}
+
 type Variable struct {
 	Name         string
 	DefaultValue string
@@ -298,3 +298,13 @@ func TestExtractVariables(t *testing.T) {
 		})
 	}
 }
+
+func TestExtractStringVariables(t *testing.T) {
+	variables := ExtractStringVariables("${REGISTRY:-docker.io}/image:$TAG/$${ESCAPED}/${TOKEN?required}", nil)
+	assert.DeepEqual(t, variables, []Variable{
+		{Name: "REGISTRY", DefaultValue: "docker.io"},
+		{Name: "TAG"},
+		{Name: "TOKEN", Required: true},
+	})
+	assert.Check(t, is.Len(ExtractStringVariables("no variable", nil), 0))
+}
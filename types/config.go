@@ -18,6 +18,10 @@ package types
 
 import (
 	"encoding/json"
+	"runtime"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
 )
 
 // ConfigDetails are the details about a group of ConfigFiles
@@ -26,23 +30,58 @@ type ConfigDetails struct {
 	WorkingDir  string
 	ConfigFiles []ConfigFile
 	Environment map[string]string
+	// CaseInsensitive makes LookupEnv match variable names regardless of their case when none matches exactly, as
+	// Windows does. It is always the case on Windows
+	CaseInsensitive bool
 }
 
 // LookupEnv provides a lookup function for environment variables
 func (cd ConfigDetails) LookupEnv(key string) (string, bool) {
 	v, ok := cd.Environment[key]
+	if ok || !(cd.CaseInsensitive || runtime.GOOS == "windows") {
+		return v, ok
+	}
+	// on Windows the process environment may set `Path` while `${PATH}` is referenced, the first name in
+	// lexicographic order wins when several ones only differ by case
+	match := ""
+	for name, value := range cd.Environment {
+		if strings.EqualFold(name, key) && (!ok || name < match) {
+			match, v, ok = name, value, true
+		}
+	}
 	return v, ok
 }
 
 // ConfigFile is a filename and the contents of the file as a Dict
 type ConfigFile struct {
+	// Filename is the name of the yaml configuration file
 	Filename string
-	Config   map[string]interface{}
+	// Content is the raw yaml content. Will be parsed by the loader if Config is not set
+	Content []byte
+	// Config is a parsed yaml configuration
+	Config map[string]interface{}
+	// Positions of the values in Config, indexed by their dotted path like `services.web.ports.0`. Set by the loader
+	// when parsing Content, used to report where an invalid value is declared
+	Positions map[string]Position
+	// MergeTags are the `!reset` and `!override` YAML tags set on values of Config, indexed by their dotted path. Set
+	// by the loader when parsing Content, used to merge Config with the previous files
+	MergeTags map[string]string
+	// Node is the YAML document node of Content, keeping its comments, ordering and styles for tooling editing
+	// compose files. Set by the loader when parsing Content, loaded when neither Content nor Config are set
+	Node *yamlv3.Node
+}
+
+// Position is a location in a configuration file
+type Position struct {
+	Line   int
+	Column int
 }
 
 // Config is a full compose file configuration and model
 type Config struct {
 	Filename   string                 `yaml:"-" json:"-"`
+	Name       string                 `yaml:"name,omitempty" json:"name,omitempty"`
+	Version    string                 `yaml:"version,omitempty" json:"version,omitempty"`
 	Services   Services               `json:"services"`
 	Networks   Networks               `yaml:",omitempty" json:"networks,omitempty"`
 	Volumes    Volumes                `yaml:",omitempty" json:"volumes,omitempty"`
@@ -51,6 +90,14 @@ type Config struct {
 	Extensions map[string]interface{} `yaml:",inline" json:"-"`
 }
 
+// IncludeConfig is an entry of the `include` section, a compose application to be included with its own project
+// directory and env files
+type IncludeConfig struct {
+	Path             StringList `yaml:"path,omitempty" json:"path,omitempty"`
+	ProjectDirectory string     `mapstructure:"project_directory" yaml:"project_directory,omitempty" json:"project_directory,omitempty"`
+	EnvFile          StringList `mapstructure:"env_file" yaml:"env_file,omitempty" json:"env_file,omitempty"`
+}
+
 // Volumes is a map of VolumeConfig
 type Volumes map[string]VolumeConfig
 
@@ -69,6 +116,9 @@ func (c Config) MarshalJSON() ([]byte, error) {
 		"services": c.Services,
 	}
 
+	if c.Version != "" {
+		m["version"] = c.Version
+	}
 	if len(c.Networks) > 0 {
 		m["networks"] = c.Networks
 	}
@@ -17,8 +17,13 @@
 package types
 
 import (
+	"encoding/json"
+	"runtime"
+	"strings"
 	"testing"
 
+	"github.com/compose-spec/compose-go/errdefs"
+	"gopkg.in/yaml.v2"
 	"gotest.tools/v3/assert"
 )
 
@@ -53,3 +58,616 @@ func Test_WithServices(t *testing.T) {
 	assert.NilError(t, err)
 	assert.DeepEqual(t, order, []string{"service_2", "service_3", "service_1"})
 }
+
+func Test_WithServicesNamespaceDependencies(t *testing.T) {
+	p := Project{
+		Services: append(Services{},
+			ServiceConfig{
+				Name:        "app",
+				NetworkMode: "service:vpn",
+				Pid:         "service:monitor",
+			}, ServiceConfig{
+				Name: "monitor",
+				Ipc:  "service:vpn",
+			}, ServiceConfig{
+				Name: "vpn",
+			}),
+	}
+	order := []string{}
+	fn := func(service ServiceConfig) error {
+		order = append(order, service.Name)
+		return nil
+	}
+
+	err := p.WithServices([]string{"app"}, fn)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, order, []string{"vpn", "monitor", "app"})
+}
+
+func makeProfilesProject() Project {
+	return Project{
+		Services: append(Services{},
+			ServiceConfig{
+				Name: "service_1",
+			}, ServiceConfig{
+				Name:     "service_2",
+				Profiles: []string{"foo"},
+				DependsOn: map[string]ServiceDependency{
+					"service_3": {
+						Condition: ServiceConditionStarted,
+					},
+				},
+			}, ServiceConfig{
+				Name:     "service_3",
+				Profiles: []string{"bar"},
+			}),
+	}
+}
+
+func TestProjectProfiles(t *testing.T) {
+	p := makeProfilesProject()
+	assert.DeepEqual(t, p.Profiles(), []string{"bar", "foo"})
+
+	p.ApplyProfiles([]string{"foo"})
+	p.Services[0].Profiles = []string{}
+	p.Services = append(p.Services, ServiceConfig{Name: "tools", Profiles: []string{"foo", "debug"}})
+	assert.DeepEqual(t, p.Profiles(), []string{"bar", "debug", "foo"})
+
+	assert.DeepEqual(t, Project{}.Profiles(), []string{})
+}
+
+func Test_ApplyProfiles(t *testing.T) {
+	p := makeProfilesProject()
+	p.ApplyProfiles([]string{"foo"})
+	assert.DeepEqual(t, p.ServiceNames(), []string{"service_1", "service_2"})
+	assert.Equal(t, len(p.DisabledServices), 1)
+	assert.Equal(t, p.DisabledServices[0].Name, "service_3")
+
+	p.ApplyProfiles([]string{"bar"})
+	assert.DeepEqual(t, p.ServiceNames(), []string{"service_1", "service_3"})
+	assert.Equal(t, len(p.DisabledServices), 1)
+	assert.Equal(t, p.DisabledServices[0].Name, "service_2")
+
+	p.ApplyProfiles([]string{"*"})
+	assert.DeepEqual(t, p.ServiceNames(), []string{"service_1", "service_2", "service_3"})
+	assert.Equal(t, len(p.DisabledServices), 0)
+}
+
+func Test_EnableServices(t *testing.T) {
+	p := makeProfilesProject()
+	p.ApplyProfiles(nil)
+	assert.DeepEqual(t, p.ServiceNames(), []string{"service_1"})
+
+	err := p.EnableServices("service_2")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, p.ServiceNames(), []string{"service_1", "service_2", "service_3"})
+	assert.Equal(t, len(p.DisabledServices), 0)
+}
+
+func Test_EnableServicesMissingDependency(t *testing.T) {
+	p := makeProfilesProject()
+	p.Services[1].DependsOn["service_4"] = ServiceDependency{Condition: ServiceConditionStarted}
+	p.ApplyProfiles(nil)
+
+	err := p.EnableServices("service_2")
+	assert.Check(t, errdefs.IsNotFoundError(err))
+	assert.ErrorContains(t, err, `service "service_2" depends on undefined service "service_4"`)
+	// service_3, which service_2 depends on as well, is left disabled
+	assert.DeepEqual(t, p.ServiceNames(), []string{"service_1"})
+	assert.Equal(t, len(p.DisabledServices), 2)
+
+	err = p.EnableServices("service_3", "unknown")
+	assert.Check(t, errdefs.IsNotFoundError(err))
+	assert.DeepEqual(t, p.ServiceNames(), []string{"service_1"})
+	assert.Equal(t, len(p.DisabledServices), 2)
+}
+
+func Test_LabelsForService(t *testing.T) {
+	p := Project{
+		Name:         "myproject",
+		WorkingDir:   "/work",
+		ComposeFiles: []string{"/work/compose.yaml", "/work/compose.override.yaml"},
+		Services:     Services{hashedService()},
+	}
+	hash, err := hashedService().ConfigHash()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, p.LabelsForService("web"), map[string]string{
+		ProjectLabel:     "myproject",
+		ServiceLabel:     "web",
+		ConfigHashLabel:  hash,
+		WorkingDirLabel:  "/work",
+		ConfigFilesLabel: "/work/compose.yaml,/work/compose.override.yaml",
+	})
+
+	labels := p.LabelsForService("unknown")
+	_, ok := labels[ConfigHashLabel]
+	assert.Check(t, !ok)
+	assert.Equal(t, labels[ServiceLabel], "unknown")
+}
+
+func makeResourcesProject() Project {
+	return Project{
+		Services: Services{
+			{
+				Name:      "web",
+				Links:     []ServiceLink{{Service: "api", Alias: "backend"}},
+				Networks:  map[string]*ServiceNetworkConfig{"front": nil},
+				DependsOn: map[string]ServiceDependency{"cache": {Condition: ServiceConditionStarted}},
+			},
+			{
+				Name:     "api",
+				Networks: map[string]*ServiceNetworkConfig{"back": nil},
+				Secrets:  []ServiceSecretConfig{{Source: "token"}},
+				Volumes:  []ServiceVolumeConfig{{Type: VolumeTypeVolume, Source: "data", Target: "/data"}},
+			},
+			{
+				Name:        "cache",
+				NetworkMode: "service:api",
+				Configs:     []ServiceConfigObjConfig{{Source: "cache_conf"}},
+			},
+			{
+				Name:     "admin",
+				Networks: map[string]*ServiceNetworkConfig{"admin": nil},
+				Volumes:  []ServiceVolumeConfig{{Type: VolumeTypeVolume, Source: "logs", Target: "/logs"}},
+				Build:    &BuildConfig{Secrets: []ServiceSecretConfig{{Source: "admin_token"}}},
+			},
+		},
+		Networks: Networks{"front": {}, "back": {}, "admin": {}},
+		Volumes:  Volumes{"data": {}, "logs": {}},
+		Secrets:  Secrets{"token": {}, "admin_token": {}},
+		Configs:  Configs{"cache_conf": {}, "unused": {}},
+	}
+}
+
+func Test_ForServices(t *testing.T) {
+	p := makeResourcesProject()
+	err := p.ForServices([]string{"web"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, p.ServiceNames(), []string{"api", "cache", "web"})
+	assert.DeepEqual(t, p.NetworkNames(), []string{"back", "front"})
+	assert.DeepEqual(t, p.VolumeNames(), []string{"data"})
+	assert.DeepEqual(t, p.SecretNames(), []string{"token"})
+	assert.DeepEqual(t, p.ConfigNames(), []string{"cache_conf"})
+
+	p = makeResourcesProject()
+	err = p.ForServices([]string{"admin"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, p.ServiceNames(), []string{"admin"})
+	assert.DeepEqual(t, p.SecretNames(), []string{"admin_token"})
+
+	p = makeResourcesProject()
+	err = p.ForServices(nil)
+	assert.NilError(t, err)
+	assert.Equal(t, len(p.Services), 4)
+	assert.Equal(t, len(p.Configs), 2)
+}
+
+func Test_UnusedResources(t *testing.T) {
+	p := makeResourcesProject()
+	p.Networks["outside"] = NetworkConfig{External: External{External: true}}
+	p.Volumes["backup"] = VolumeConfig{}
+	p.Services = p.Services[:1]
+	assert.DeepEqual(t, p.CheckUnusedResources(), []string{
+		"configs.cache_conf",
+		"configs.unused",
+		"networks.admin",
+		"networks.back",
+		"secrets.admin_token",
+		"secrets.token",
+		"volumes.backup",
+		"volumes.data",
+		"volumes.logs",
+	})
+	assert.Equal(t, len(p.Volumes), 3)
+
+	p.WithoutUnnecessaryResources()
+	assert.DeepEqual(t, p.NetworkNames(), []string{"front", "outside"})
+	assert.Equal(t, len(p.Volumes), 0)
+	assert.Equal(t, len(p.Secrets), 0)
+	assert.Equal(t, len(p.Configs), 0)
+	assert.Equal(t, len(p.CheckUnusedResources()), 0)
+}
+
+func Test_PublishedPorts(t *testing.T) {
+	p := Project{
+		Services: Services{
+			{
+				Name: "web",
+				Ports: []ServicePortConfig{
+					{Target: 80, Published: "8080", Protocol: "tcp"},
+					{Target: 81},
+					{Target: 82, Published: "0"},
+				},
+			},
+			{
+				Name: "dns",
+				Ports: []ServicePortConfig{
+					{Target: 53, Published: "53", Protocol: "udp", HostIP: "127.0.0.1"},
+					{Target: 8000, Published: "8000-8010"},
+				},
+			},
+		},
+	}
+	assert.DeepEqual(t, p.PublishedPorts(), []PublishedPort{
+		{Service: "dns", HostIP: "127.0.0.1", Published: "53", Protocol: "udp"},
+		{Service: "dns", Published: "8000-8010", Protocol: "tcp"},
+		{Service: "web", Published: "8080", Protocol: "tcp"},
+	})
+}
+
+func Test_ForServicesErrors(t *testing.T) {
+	p := makeResourcesProject()
+	err := p.ForServices([]string{"unknown"})
+	assert.Check(t, errdefs.IsNotFoundError(err))
+	assert.ErrorContains(t, err, "no such service: unknown")
+	assert.Equal(t, len(p.Services), 4)
+
+	p.Services[0].DependsOn["missing"] = ServiceDependency{Condition: ServiceConditionStarted}
+	err = p.ForServices([]string{"web"})
+	assert.Check(t, errdefs.IsNotFoundError(err))
+	assert.ErrorContains(t, err, `service "web" depends on undefined service "missing"`)
+
+	p = makeProfilesProject()
+	p.ApplyProfiles([]string{"foo"})
+	err = p.ForServices([]string{"service_2"})
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `service "service_2" depends on service "service_3", which is disabled: enable profile bar`)
+
+	p.ApplyProfiles(nil)
+	err = p.ForServices([]string{"service_2"})
+	assert.ErrorContains(t, err, `service "service_2" is disabled: enable profile foo`)
+}
+
+func Test_DeepCopy(t *testing.T) {
+	replicas := uint64(2)
+	original := &Project{
+		Name: "test",
+		Services: Services{
+			{
+				Name:        "foo",
+				Image:       "foo",
+				Build:       &BuildConfig{Context: ".", Args: NewMappingWithEquals([]string{"A=a"})},
+				Environment: NewMappingWithEquals([]string{"FOO=foo"}),
+				HealthCheck: &HealthCheckConfig{Test: HealthCheckTest{"CMD", "true"}},
+				Deploy: &DeployConfig{
+					Replicas:  &replicas,
+					Resources: Resources{Limits: &Resource{MemoryBytes: 1024}},
+				},
+				Extensions: map[string]interface{}{"x-foo": map[string]interface{}{"bar": []interface{}{"baz"}}},
+			},
+		},
+		Networks:   Networks{"default": NetworkConfig{Labels: Labels{"a": "b"}}},
+		Extensions: map[string]interface{}{"x-project": map[string]interface{}{"a": "b"}},
+	}
+	before, err := yaml.Marshal(original)
+	assert.NilError(t, err)
+
+	copied := original.DeepCopy()
+	assert.DeepEqual(t, original, copied)
+
+	service := &copied.Services[0]
+	*service.Build.Args["A"] = "changed"
+	*service.Environment["FOO"] = "changed"
+	service.HealthCheck.Test[1] = "false"
+	*service.Deploy.Replicas = 3
+	service.Deploy.Resources.Limits.MemoryBytes = 2048
+	service.Extensions["x-foo"].(map[string]interface{})["bar"].([]interface{})[0] = "changed"
+	copied.Networks["default"].Labels["a"] = "changed"
+	copied.Extensions["x-project"].(map[string]interface{})["a"] = "changed"
+
+	after, err := yaml.Marshal(original)
+	assert.NilError(t, err)
+	assert.Equal(t, string(before), string(after))
+
+	mutated, err := yaml.Marshal(copied)
+	assert.NilError(t, err)
+	diff := []string{}
+	beforeLines, mutatedLines := strings.Split(string(before), "\n"), strings.Split(string(mutated), "\n")
+	assert.Equal(t, len(beforeLines), len(mutatedLines))
+	for i := range beforeLines {
+		if beforeLines[i] != mutatedLines[i] {
+			diff = append(diff, strings.TrimSpace(mutatedLines[i]))
+		}
+	}
+	assert.DeepEqual(t, diff, []string{
+		"A: changed",
+		"replicas: 3",
+		"memory: \"2048\"",
+		"FOO: changed",
+		"- \"false\"",
+		"- changed",
+		"a: changed",
+		"a: changed",
+	})
+
+	err = original.WithServices(nil, func(s ServiceConfig) error {
+		*s.Environment["FOO"] = "changed"
+		return nil
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, *original.Services[0].Environment["FOO"], "foo")
+}
+
+func Test_Diff(t *testing.T) {
+	foo := "foo"
+	base := &Project{
+		Services: Services{
+			{
+				Name:        "web",
+				Image:       "nginx:1.24",
+				Environment: MappingWithEquals{"FOO": &foo, "BAR": &foo},
+				Ports:       []ServicePortConfig{{Target: 80, Published: "8080"}},
+				Volumes:     []ServiceVolumeConfig{},
+				Extensions:  map[string]interface{}{"x-foo": "foo"},
+			},
+			{Name: "db", Image: "postgres"},
+			{Name: "cache", Image: "redis"},
+		},
+	}
+	bar := "bar"
+	other := base.DeepCopy()
+	web := &other.Services[0]
+	web.Image = "nginx:1.25"
+	web.Environment["FOO"] = &bar
+	web.Ports[0].Published = "9090"
+	web.Volumes = nil
+	web.Extensions["x-foo"] = "bar"
+	other.Services = append(other.Services[:2], ServiceConfig{Name: "queue", Image: "rabbitmq"})
+
+	diff := base.Diff(other)
+	assert.DeepEqual(t, diff, ProjectDiff{
+		AddedServices:   []string{"queue"},
+		RemovedServices: []string{"cache"},
+		ChangedServices: map[string][]string{
+			"web": {"environment.FOO", "image", "ports[0].published"},
+		},
+	})
+	b, err := json.Marshal(diff)
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), `{"added_services":["queue"],"removed_services":["cache"],"changed_services":{"web":["environment.FOO","image","ports[0].published"]}}`)
+
+	diff = base.Diff(other, func(options *DiffOptions) {
+		options.IncludeExtensions = true
+	})
+	assert.DeepEqual(t, diff.ChangedServices["web"], []string{"environment.FOO", "image", "ports[0].published", "x-foo"})
+
+	assert.DeepEqual(t, base.Diff(base.DeepCopy()), ProjectDiff{})
+}
+
+func Test_AddService(t *testing.T) {
+	p := Project{
+		Services:         Services{{Name: "web"}},
+		DisabledServices: Services{{Name: "debug"}},
+	}
+	assert.NilError(t, p.AddService(ServiceConfig{Name: "db"}))
+	assert.Equal(t, p.Services[0].Name, "db")
+
+	for _, name := range []string{"web", "debug"} {
+		err := p.AddService(ServiceConfig{Name: name})
+		assert.Check(t, errdefs.IsInvalidError(err))
+		assert.ErrorContains(t, err, `service "`+name+`" is already declared`)
+	}
+	assert.Check(t, errdefs.IsInvalidError(p.AddService(ServiceConfig{})))
+
+	p.SetService("web", ServiceConfig{Image: "nginx"})
+	p.SetService("debug", ServiceConfig{Image: "busybox"})
+	p.SetService("cache", ServiceConfig{Image: "redis"})
+	assert.Equal(t, len(p.Services), 3)
+	assert.Equal(t, p.Services[0].Name, "cache")
+	web, err := p.GetService("web")
+	assert.NilError(t, err)
+	assert.Equal(t, web.Image, "nginx")
+	debug, err := p.GetDisabledService("debug")
+	assert.NilError(t, err)
+	assert.Equal(t, debug.Image, "busybox")
+
+	_, err = p.GetService("debug")
+	assert.Check(t, errdefs.IsNotFoundError(err))
+	_, err = p.GetDisabledService("web")
+	assert.Check(t, errdefs.IsNotFoundError(err))
+}
+
+func Test_MarshalDuplicateServices(t *testing.T) {
+	p := Project{Services: Services{{Name: "web", Image: "nginx"}, {Name: "web", Image: "httpd"}}}
+	_, err := yaml.Marshal(p)
+	assert.ErrorContains(t, err, `service "web" is declared more than once`)
+	_, err = json.Marshal(p)
+	assert.ErrorContains(t, err, `service "web" is declared more than once`)
+}
+
+func Test_MarshalYAMLWithOptions(t *testing.T) {
+	password, url := "hunter2", "postgres://db"
+	p := &Project{
+		Services: Services{{
+			Name:  "web",
+			Image: "web",
+			Environment: MappingWithEquals{
+				"DB_PASSWORD": &password,
+				"DB_URL":      &url,
+				"DB_CERT":     &url,
+				"API_TOKEN":   nil,
+			},
+			Labels: Labels{"com.example.api-key": "abc", "com.example.team": "web"},
+			Build: &BuildConfig{
+				Context: ".",
+				Args:    MappingWithEquals{"NPM_TOKEN": &password, "VERSION": &url},
+			},
+			Extensions: map[string]interface{}{
+				"x-deploy": map[string]interface{}{"secret": "s3cr3t", "region": "eu"},
+			},
+		}},
+		Secrets: Secrets{"cert": SecretConfig{Environment: "DB_CERT"}},
+	}
+
+	b, err := p.MarshalYAMLWithOptions(MarshalOptions{})
+	assert.NilError(t, err)
+	assert.Check(t, strings.Contains(string(b), "hunter2"))
+
+	b, err = p.MarshalYAMLWithOptions(MarshalOptions{RedactSecrets: true})
+	assert.NilError(t, err)
+	var rendered struct {
+		Services map[string]map[string]interface{}
+	}
+	assert.NilError(t, yaml.Unmarshal(b, &rendered))
+	web := rendered.Services["web"]
+	assert.DeepEqual(t, web["environment"], map[interface{}]interface{}{
+		"DB_PASSWORD": RedactedValue,
+		"DB_URL":      url,
+		"DB_CERT":     RedactedValue,
+		"API_TOKEN":   nil,
+	})
+	assert.DeepEqual(t, web["labels"], map[interface{}]interface{}{
+		"com.example.api-key": RedactedValue,
+		"com.example.team":    "web",
+	})
+	assert.DeepEqual(t, web["build"].(map[interface{}]interface{})["args"], map[interface{}]interface{}{
+		"NPM_TOKEN": RedactedValue,
+		"VERSION":   url,
+	})
+	assert.DeepEqual(t, web["x-deploy"], map[interface{}]interface{}{"secret": RedactedValue, "region": "eu"})
+
+	// the project is left unchanged
+	assert.Equal(t, *p.Services[0].Environment["DB_PASSWORD"], "hunter2")
+	assert.Equal(t, p.Services[0].Extensions["x-deploy"].(map[string]interface{})["secret"], "s3cr3t")
+
+	b, err = p.MarshalYAMLWithOptions(MarshalOptions{RedactSecrets: true, SecretPatterns: []string{"*_URL"}})
+	assert.NilError(t, err)
+	assert.Check(t, strings.Contains(string(b), "hunter2"))
+	assert.Check(t, !strings.Contains(string(b), "DB_URL: "+url))
+}
+
+func Test_ServicesWithBuildAndCapabilities(t *testing.T) {
+	gpu := func(capabilities ...string) *DeployConfig {
+		return &DeployConfig{Resources: Resources{Reservations: &Resource{
+			Devices: []DeviceRequest{{Capabilities: capabilities}},
+		}}}
+	}
+	p := Project{
+		Services: Services{
+			{Name: "web", Build: &BuildConfig{Context: "."}},
+			{Name: "db", Image: "postgres"},
+			{Name: "train", Deploy: gpu("gpu", "utility")},
+			{Name: "infer", Build: &BuildConfig{Context: "infer"}, Deploy: gpu("tpu")},
+		},
+	}
+	assert.DeepEqual(t, p.ServicesWithBuild(), []string{"infer", "web"})
+	gpus, tpus := p.ServicesWithCapabilities()
+	assert.DeepEqual(t, gpus, []string{"train"})
+	assert.DeepEqual(t, tpus, []string{"infer"})
+}
+
+func Test_ResolveImages(t *testing.T) {
+	p := Project{
+		Name: "myproject",
+		Services: Services{
+			{Name: "web", Build: &BuildConfig{Context: "."}},
+			{Name: "api", Build: &BuildConfig{Context: "api"}, Image: "example/api:1.0"},
+			{Name: "db", Image: "postgres"},
+		},
+	}
+	assert.Equal(t, p.Services[0].ImageName(p.Name), "myproject-web")
+	assert.Equal(t, p.Services[0].ImageNameWithSeparator(p.Name, "_"), "myproject_web")
+	assert.Equal(t, p.Services[1].ImageName(p.Name), "example/api:1.0")
+	assert.Equal(t, ServiceConfig{Name: "cache"}.ImageName(p.Name), "")
+
+	p.ResolveImages("registry.example.com/")
+	assert.Equal(t, p.Services[0].Image, "registry.example.com/myproject-web")
+	assert.Equal(t, p.Services[1].Image, "example/api:1.0")
+	assert.Equal(t, p.Services[2].Image, "postgres")
+
+	p.Services[0].Image = ""
+	p.ResolveImagesWithSeparator("", "_")
+	assert.Equal(t, p.Services[0].Image, "myproject_web")
+	assert.Equal(t, p.Services[1].Image, "example/api:1.0")
+}
+
+func TestLookupEnvCaseInsensitive(t *testing.T) {
+	details := ConfigDetails{Environment: map[string]string{"Path": `C:\Windows`, "PATHEXT": ".EXE", "pathext": ".COM"}}
+	if runtime.GOOS != "windows" {
+		_, ok := details.LookupEnv("PATH")
+		assert.Check(t, !ok)
+	}
+
+	details.CaseInsensitive = true
+	value, ok := details.LookupEnv("PATH")
+	assert.Check(t, ok)
+	assert.Equal(t, value, `C:\Windows`)
+	value, _ = details.LookupEnv("pathext")
+	assert.Equal(t, value, ".COM")
+	value, _ = details.LookupEnv("PathExt")
+	assert.Equal(t, value, ".EXE")
+	_, ok = details.LookupEnv("HOME")
+	assert.Check(t, !ok)
+}
+
+func TestMarshalYAMLPreserveVersion(t *testing.T) {
+	p := &Project{
+		Name:     "legacy",
+		Version:  "3.8",
+		Services: Services{{Name: "web", Image: "nginx"}},
+	}
+	b, err := p.MarshalYAMLWithOptions(MarshalOptions{})
+	assert.NilError(t, err)
+	assert.Check(t, !strings.Contains(string(b), "version"))
+
+	b, err = p.MarshalYAMLWithOptions(MarshalOptions{PreserveVersion: true, RedactSecrets: true})
+	assert.NilError(t, err)
+	assert.Check(t, strings.HasPrefix(string(b), "version: \"3.8\"\nname: legacy\n"), string(b))
+
+	p.Version = ""
+	b, err = p.MarshalYAMLWithOptions(MarshalOptions{PreserveVersion: true})
+	assert.NilError(t, err)
+	assert.Check(t, !strings.Contains(string(b), "version"))
+}
+
+func TestResolveVolumesFrom(t *testing.T) {
+	p := Project{
+		Services: Services{
+			{Name: "app", VolumesFrom: []VolumesFromSource{
+				{Kind: VolumesFromService, Name: "data", ReadOnly: true},
+				{Kind: VolumesFromContainer, Name: "legacy"},
+			}, Volumes: []ServiceVolumeConfig{
+				{Type: VolumeTypeBind, Source: "/src", Target: "/config"},
+			}},
+			{Name: "data", VolumesFrom: []VolumesFromSource{{Kind: VolumesFromService, Name: "base"}}, Volumes: []ServiceVolumeConfig{
+				{Type: VolumeTypeVolume, Source: "shared", Target: "/data"},
+				{Type: VolumeTypeVolume, Target: "/anonymous"},
+				{Type: VolumeTypeTmpfs, Target: "/tmp"},
+				{Type: VolumeTypeBind, Source: "/other", Target: "/config"},
+			}},
+			{Name: "base", Volumes: []ServiceVolumeConfig{
+				{Type: VolumeTypeBind, Source: "/logs", Target: "/logs", Bind: &ServiceVolumeBind{CreateHostPath: true}},
+			}},
+		},
+	}
+	assert.NilError(t, p.ResolveVolumesFrom())
+
+	app, err := p.GetService("app")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, app.Volumes, []ServiceVolumeConfig{
+		{Type: VolumeTypeBind, Source: "/src", Target: "/config"},
+		{Type: VolumeTypeVolume, Source: "shared", Target: "/data", ReadOnly: true},
+		{Type: VolumeTypeBind, Source: "/logs", Target: "/logs", ReadOnly: true, Bind: &ServiceVolumeBind{CreateHostPath: true}},
+	})
+	assert.DeepEqual(t, app.VolumesFrom, []VolumesFromSource{{Kind: VolumesFromContainer, Name: "legacy"}})
+
+	data, err := p.GetService("data")
+	assert.NilError(t, err)
+	assert.Equal(t, len(data.Volumes), 5)
+	assert.Equal(t, data.Volumes[4].ReadOnly, false)
+	assert.Check(t, data.Volumes[4].Bind != p.Services[2].Volumes[0].Bind)
+	assert.Check(t, data.VolumesFrom == nil)
+
+	p = Project{
+		Services: Services{
+			{Name: "a", VolumesFrom: []VolumesFromSource{{Kind: VolumesFromService, Name: "b"}}},
+			{Name: "b", VolumesFrom: []VolumesFromSource{{Kind: VolumesFromService, Name: "a"}}},
+		},
+	}
+	err = p.ResolveVolumesFrom()
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, "services take volumes from each other: a -> b -> a")
+
+	p.Services[1].VolumesFrom = []VolumesFromSource{{Kind: VolumesFromService, Name: "missing"}}
+	assert.ErrorContains(t, p.ResolveVolumesFrom(), `service "b" takes volumes from undefined service missing`)
+}
@@ -0,0 +1,156 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package types
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/compose-spec/compose-go/errdefs"
+	"github.com/pkg/errors"
+)
+
+// DefaultPlatformEnv is the environment variable setting the platform of services which don't declare one
+const DefaultPlatformEnv = "DOCKER_DEFAULT_PLATFORM"
+
+// Platform is a target platform, as `os[/arch[/variant]]`
+type Platform struct {
+	OS           string
+	Architecture string
+	Variant      string
+}
+
+// String returns the `os[/arch[/variant]]` form of the platform
+func (p Platform) String() string {
+	s := p.OS
+	if p.Architecture != "" {
+		s += "/" + p.Architecture
+	}
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// Matches tells if the platforms are the same, a component left empty by one of them matching any value
+func (p Platform) Matches(other Platform) bool {
+	matches := func(a, b string) bool {
+		return a == "" || b == "" || a == b
+	}
+	return matches(p.OS, other.OS) && matches(p.Architecture, other.Architecture) && matches(p.Variant, other.Variant)
+}
+
+var platformComponent = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+var knownOS = map[string]bool{
+	"aix": true, "android": true, "darwin": true, "dragonfly": true, "freebsd": true, "hurd": true,
+	"illumos": true, "ios": true, "js": true, "linux": true, "nacl": true, "netbsd": true, "openbsd": true,
+	"plan9": true, "solaris": true, "windows": true, "zos": true,
+}
+
+var knownArch = map[string]bool{
+	"386": true, "amd64": true, "amd64p32": true, "arm": true, "armbe": true, "arm64": true, "arm64be": true,
+	"loong64": true, "mips": true, "mipsle": true, "mips64": true, "mips64le": true, "mips64p32": true,
+	"mips64p32le": true, "ppc": true, "ppc64": true, "ppc64le": true, "riscv": true, "riscv64": true,
+	"s390": true, "s390x": true, "sparc": true, "sparc64": true, "wasm": true,
+}
+
+// ParsePlatform parses a platform specifier, as `os[/arch[/variant]]`, and normalizes it following the rules
+// used by containerd, so that equivalent specifiers like `linux/aarch64` and `linux/arm64` compare equal.
+// A specifier made of a single component can either be an operating system or an architecture, the missing part is
+// then left empty rather than taken from the current host, so that platforms compare the same wherever the compose
+// file is loaded
+func ParsePlatform(specifier string) (Platform, error) {
+	parts := strings.Split(specifier, "/")
+	for _, part := range parts {
+		if !platformComponent.MatchString(part) {
+			return Platform{}, errors.Wrapf(errdefs.ErrInvalid, "invalid platform %q: %q must match %s", specifier, part, platformComponent)
+		}
+	}
+
+	var p Platform
+	switch len(parts) {
+	case 1:
+		component := normalizeOS(parts[0])
+		if knownOS[component] {
+			p = Platform{OS: component}
+			break
+		}
+		arch, variant := normalizeArch(component, "")
+		if !knownArch[arch] {
+			return Platform{}, errors.Wrapf(errdefs.ErrInvalid, "invalid platform %q: unknown operating system or architecture", specifier)
+		}
+		p = Platform{Architecture: arch, Variant: variant}
+	case 2:
+		arch, variant := normalizeArch(parts[1], "")
+		p = Platform{OS: normalizeOS(parts[0]), Architecture: arch, Variant: variant}
+	case 3:
+		arch, variant := normalizeArch(parts[1], parts[2])
+		p = Platform{OS: normalizeOS(parts[0]), Architecture: arch, Variant: variant}
+	default:
+		return Platform{}, errors.Wrapf(errdefs.ErrInvalid, "invalid platform %q: expected os[/arch[/variant]]", specifier)
+	}
+	return p, nil
+}
+
+func normalizeOS(os string) string {
+	os = strings.ToLower(os)
+	if os == "macos" {
+		return "darwin"
+	}
+	return os
+}
+
+func normalizeArch(arch, variant string) (string, string) {
+	arch, variant = strings.ToLower(arch), strings.ToLower(variant)
+	switch arch {
+	case "i386":
+		return "386", ""
+	case "x86_64", "x86-64", "amd64":
+		if variant == "v1" {
+			variant = ""
+		}
+		return "amd64", variant
+	case "aarch64", "arm64":
+		if variant == "8" || variant == "v8" {
+			variant = ""
+		}
+		return "arm64", variant
+	case "armhf":
+		return "arm", "v7"
+	case "armel":
+		return "arm", "v6"
+	case "arm":
+		switch variant {
+		case "", "7":
+			variant = "v7"
+		case "5", "6", "8":
+			variant = "v" + variant
+		}
+		return "arm", variant
+	}
+	return arch, variant
+}
+
+// PlatformString returns the platform to run the service on: the one set by the service, or the default set by
+// DOCKER_DEFAULT_PLATFORM in environment, if any
+func (s ServiceConfig) PlatformString(environment map[string]string) string {
+	if s.Platform != "" {
+		return s.Platform
+	}
+	return environment[DefaultPlatformEnv]
+}
@@ -17,23 +17,91 @@
 package types
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"sort"
+	"strings"
+
+	"github.com/compose-spec/compose-go/errdefs"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
 )
 
 // Project is the result of loading a set of compose files
 type Project struct {
-	Name         string
-	WorkingDir   string
-	Services     Services               `json:"services"`
-	Networks     Networks               `yaml:",omitempty" json:"networks,omitempty"`
-	Volumes      Volumes                `yaml:",omitempty" json:"volumes,omitempty"`
-	Secrets      Secrets                `yaml:",omitempty" json:"secrets,omitempty"`
-	Configs      Configs                `yaml:",omitempty" json:"configs,omitempty"`
-	Extensions   map[string]interface{} `yaml:",inline" json:"-"`
-	ComposeFiles []string               `yaml:",omitempty" json:"composefiles,omitempty"`
+	Name string
+	// Version is the informational top-level `version` of the compose files, if any. It is only rendered by
+	// MarshalYAMLWithOptions with MarshalOptions.PreserveVersion
+	Version    string `yaml:"-" json:"-"`
+	WorkingDir string
+	Services   Services `json:"services"`
+	// DisabledServices track services which have been disabled as they don't match the selected profiles
+	DisabledServices Services               `yaml:"-" json:"-"`
+	Networks         Networks               `yaml:",omitempty" json:"networks,omitempty"`
+	Volumes          Volumes                `yaml:",omitempty" json:"volumes,omitempty"`
+	Secrets          Secrets                `yaml:",omitempty" json:"secrets,omitempty"`
+	Configs          Configs                `yaml:",omitempty" json:"configs,omitempty"`
+	Extensions       map[string]interface{} `yaml:",inline" json:"-"`
+	ComposeFiles     []string               `yaml:",omitempty" json:"composefiles,omitempty"`
+	// LoadWarnings lists the attributes which couldn't be resolved when loaded in skeleton mode
+	LoadWarnings []string `yaml:"-" json:"-"`
+	// LoadErrors lists the services which have been removed from the project as they are invalid, when loaded with
+	// SkipInvalidServices
+	LoadErrors []ServiceLoadError `yaml:"-" json:"-"`
+	// Environment is the environment the project has been loaded with
+	Environment map[string]string `yaml:"-" json:"-"`
+}
+
+// ServiceLoadError is the error which made a service be removed from the project it is declared by
+type ServiceLoadError struct {
+	Name string
+	Err  error
+}
+
+func (e ServiceLoadError) Error() string {
+	return fmt.Sprintf("service %q: %s", e.Name, e.Err)
+}
+
+// Unwrap returns the error the service failed to load with
+func (e ServiceLoadError) Unwrap() error {
+	return e.Err
+}
+
+const (
+	// ProjectLabel allow to track resource related to a compose project
+	ProjectLabel = "com.docker.compose.project"
+	// ServiceLabel allow to track resource related to a compose service
+	ServiceLabel = "com.docker.compose.service"
+	// ConfigHashLabel stores configuration hash for a compose service
+	ConfigHashLabel = "com.docker.compose.config-hash"
+	// WorkingDirLabel stores absolute path to compose project working directory
+	WorkingDirLabel = "com.docker.compose.project.working_dir"
+	// ConfigFilesLabel stores absolute path to compose project configuration files
+	ConfigFilesLabel = "com.docker.compose.project.config_files"
+	// ReservedLabelPrefix is the prefix of the labels set by Compose implementations, which overwrite user-set ones
+	ReservedLabelPrefix = "com.docker.compose."
+)
+
+// LabelsForService returns the standard labels to be set on resources created for a service of this project.
+// The config hash label is only set for a service declared by the project
+func (p Project) LabelsForService(name string) map[string]string {
+	labels := map[string]string{
+		ProjectLabel:     p.Name,
+		ServiceLabel:     name,
+		WorkingDirLabel:  p.WorkingDir,
+		ConfigFilesLabel: strings.Join(p.ComposeFiles, ","),
+	}
+	service, err := p.GetService(name)
+	if err != nil {
+		return labels
+	}
+	if hash, err := service.ConfigHash(); err == nil {
+		labels[ConfigHashLabel] = hash
+	}
+	return labels
 }
 
 // ServiceNames return names for all services in this Compose config
@@ -46,6 +114,140 @@ func (p Project) ServiceNames() []string {
 	return names
 }
 
+// ServicesWithBuild returns the names of the services which have a build section, sorted
+func (p Project) ServicesWithBuild() []string {
+	names := []string{}
+	for _, s := range p.Services {
+		if s.Build != nil {
+			names = append(names, s.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ServicesWithCapabilities returns the names of the services reserving devices with the `gpu` and `tpu`
+// capabilities, sorted
+func (p Project) ServicesWithCapabilities() (gpu []string, tpu []string) {
+	gpu, tpu = []string{}, []string{}
+	for _, s := range p.Services {
+		if s.Deploy == nil || s.Deploy.Resources.Reservations == nil {
+			continue
+		}
+		var hasGPU, hasTPU bool
+		for _, device := range s.Deploy.Resources.Reservations.Devices {
+			for _, capability := range device.Capabilities {
+				hasGPU = hasGPU || capability == "gpu"
+				hasTPU = hasTPU || capability == "tpu"
+			}
+		}
+		if hasGPU {
+			gpu = append(gpu, s.Name)
+		}
+		if hasTPU {
+			tpu = append(tpu, s.Name)
+		}
+	}
+	sort.Strings(gpu)
+	sort.Strings(tpu)
+	return gpu, tpu
+}
+
+// ResolveImages sets the image of the services which build one without setting it to its default name, see
+// ServiceConfig.ImageName, prefixed by defaultRegistry if set. See ResolveImagesWithSeparator to use another separator
+func (p *Project) ResolveImages(defaultRegistry string) {
+	p.ResolveImagesWithSeparator(defaultRegistry, DefaultImageNameSeparator)
+}
+
+// ResolveImagesWithSeparator sets the image of the services which build one without setting it to its default name,
+// the project and service names joined by separator, prefixed by defaultRegistry if set. It resolves the names the
+// loader does when loaded with the same ImageNameSeparator
+func (p *Project) ResolveImagesWithSeparator(defaultRegistry, separator string) {
+	for i, s := range p.Services {
+		if s.Image != "" || s.Build == nil {
+			continue
+		}
+		image := s.ImageNameWithSeparator(p.Name, separator)
+		if defaultRegistry != "" {
+			image = strings.TrimSuffix(defaultRegistry, "/") + "/" + image
+		}
+		p.Services[i].Image = image
+	}
+}
+
+// ResolveVolumesFrom expands the sources of `volumes_from` which are services into the volumes those services mount,
+// including the ones they take from their own sources, so that the volumes shared between services are explicit.
+// The volumes a service mounts on the same target take precedence, and tmpfs mounts and anonymous volumes, which
+// can't be shared by declaring them, are skipped. Sources which are containers are kept. An error is returned when
+// services take volumes from each other
+func (p *Project) ResolveVolumesFrom() error {
+	resolved := map[string][]ServiceVolumeConfig{}
+	for _, s := range p.Services {
+		if _, err := p.volumesWithSources(s.Name, resolved, nil); err != nil {
+			return err
+		}
+	}
+	for i, s := range p.Services {
+		p.Services[i].Volumes = resolved[s.Name]
+		var containers []VolumesFromSource
+		for _, source := range s.VolumesFrom {
+			if source.Kind == VolumesFromContainer {
+				containers = append(containers, source)
+			}
+		}
+		p.Services[i].VolumesFrom = containers
+	}
+	return nil
+}
+
+// volumesWithSources returns the volumes of a service, followed by the ones it takes from the services it declares
+// as `volumes_from` sources. visiting are the services which volumes are being resolved, used to detect cycles
+func (p *Project) volumesWithSources(name string, resolved map[string][]ServiceVolumeConfig, visiting []string) ([]ServiceVolumeConfig, error) {
+	if volumes, ok := resolved[name]; ok {
+		return volumes, nil
+	}
+	for i, v := range visiting {
+		if v == name {
+			return nil, errors.Wrapf(errdefs.ErrInvalid, "services take volumes from each other: %s -> %s", strings.Join(visiting[i:], " -> "), name)
+		}
+	}
+	service, err := p.GetService(name)
+	if err != nil {
+		if service, err = p.GetDisabledService(name); err != nil {
+			return nil, errors.Wrapf(errdefs.ErrInvalid, "service %q takes volumes from undefined service %s", visiting[len(visiting)-1], name)
+		}
+	}
+
+	var volumes []ServiceVolumeConfig
+	volumes = append(volumes, service.Volumes...)
+	targets := map[string]bool{}
+	for _, volume := range volumes {
+		targets[volume.Target] = true
+	}
+	for _, source := range service.VolumesFrom {
+		if source.Kind != VolumesFromService {
+			continue
+		}
+		shared, err := p.volumesWithSources(source.Name, resolved, append(visiting, name))
+		if err != nil {
+			return nil, err
+		}
+		for _, volume := range shared {
+			if volume.Type == VolumeTypeTmpfs || (volume.Type == VolumeTypeVolume && volume.Source == "") || targets[volume.Target] {
+				continue
+			}
+			targets[volume.Target] = true
+			volume = deepCopy(reflect.ValueOf(volume)).Interface().(ServiceVolumeConfig)
+			if source.ReadOnly {
+				volume.ReadOnly = true
+			}
+			volumes = append(volumes, volume)
+		}
+	}
+	resolved[name] = volumes
+	return volumes, nil
+}
+
 // VolumeNames return names for all volumes in this Compose config
 func (p Project) VolumeNames() []string {
 	names := []string{}
@@ -86,6 +288,55 @@ func (p Project) ConfigNames() []string {
 	return names
 }
 
+// VolumeRuntimeNames returns the actual names of volumes, indexed by key in this Compose config
+func (p Project) VolumeRuntimeNames() map[string]string {
+	names := map[string]string{}
+	for k, v := range p.Volumes {
+		names[k] = p.runtimeName(k, v.Name, v.External.External)
+	}
+	return names
+}
+
+// NetworkRuntimeNames returns the actual names of networks, indexed by key in this Compose config
+func (p Project) NetworkRuntimeNames() map[string]string {
+	names := map[string]string{}
+	for k, n := range p.Networks {
+		names[k] = p.runtimeName(k, n.Name, n.External.External)
+	}
+	return names
+}
+
+// SecretRuntimeNames returns the actual names of secrets, indexed by key in this Compose config
+func (p Project) SecretRuntimeNames() map[string]string {
+	names := map[string]string{}
+	for k, s := range p.Secrets {
+		names[k] = p.runtimeName(k, s.Name, s.External.External)
+	}
+	return names
+}
+
+// ConfigRuntimeNames returns the actual names of configs, indexed by key in this Compose config
+func (p Project) ConfigRuntimeNames() map[string]string {
+	names := map[string]string{}
+	for k, c := range p.Configs {
+		names[k] = p.runtimeName(k, c.Name, c.External.External)
+	}
+	return names
+}
+
+// runtimeName returns the actual name of a resource: its explicit name if set, its key if external, or the key
+// qualified by the project name
+func (p Project) runtimeName(key string, name string, external bool) string {
+	switch {
+	case name != "":
+		return name
+	case external:
+		return key
+	default:
+		return fmt.Sprintf("%s_%s", p.Name, key)
+	}
+}
+
 // GetServices retrieve services by names, or return all services if no name specified
 func (p Project) GetServices(names []string) (Services, error) {
 	if len(names) == 0 {
@@ -109,12 +360,295 @@ func (p Project) GetService(name string) (ServiceConfig, error) {
 			return s, nil
 		}
 	}
-	return ServiceConfig{}, fmt.Errorf("no such service: %s", name)
+	return ServiceConfig{}, errors.Wrapf(errdefs.ErrNotFound, "no such service: %s", name)
+}
+
+// AddService adds service to the project, keeping services sorted by name. Adding a service with the name of an
+// enabled or disabled service of the project is an error
+func (p *Project) AddService(service ServiceConfig) error {
+	if service.Name == "" {
+		return errors.Wrap(errdefs.ErrInvalid, "service has no name")
+	}
+	if p.Services.index(service.Name) >= 0 || p.DisabledServices.index(service.Name) >= 0 {
+		return errors.Wrapf(errdefs.ErrInvalid, "service %q is already declared", service.Name)
+	}
+	p.Services = append(p.Services, service)
+	p.Services.Sort()
+	return nil
+}
+
+// SetService sets the configuration of the service named name, replacing the one of the enabled or disabled service
+// with this name, or adding it to the enabled services
+func (p *Project) SetService(name string, service ServiceConfig) {
+	service.Name = name
+	if i := p.DisabledServices.index(name); i >= 0 {
+		p.DisabledServices[i] = service
+		return
+	}
+	if i := p.Services.index(name); i >= 0 {
+		p.Services[i] = service
+		return
+	}
+	p.Services = append(p.Services, service)
+	p.Services.Sort()
+}
+
+// GetDisabledService retrieve a specific disabled service by name
+func (p Project) GetDisabledService(name string) (ServiceConfig, error) {
+	for _, s := range p.DisabledServices {
+		if s.Name == name {
+			return s, nil
+		}
+	}
+	return ServiceConfig{}, errors.Wrapf(errdefs.ErrNotFound, "no such disabled service: %s", name)
+}
+
+// Profiles returns the sorted names of all the profiles declared by services, including the disabled ones
+func (p Project) Profiles() []string {
+	seen := map[string]bool{}
+	profiles := []string{}
+	for _, service := range append(p.Services, p.DisabledServices...) {
+		for _, profile := range service.Profiles {
+			if !seen[profile] {
+				seen[profile] = true
+				profiles = append(profiles, profile)
+			}
+		}
+	}
+	sort.Strings(profiles)
+	return profiles
+}
+
+// ApplyProfiles partitions all services, including the ones previously disabled, into Services enabled by the
+// selected profiles and DisabledServices
+func (p *Project) ApplyProfiles(profiles []string) {
+	var enabled, disabled Services
+	for _, service := range append(p.Services, p.DisabledServices...) {
+		if service.HasProfile(profiles) {
+			enabled = append(enabled, service)
+		} else {
+			disabled = append(disabled, service)
+		}
+	}
+	enabled.Sort()
+	disabled.Sort()
+	p.Services = enabled
+	p.DisabledServices = disabled
+}
+
+// EnableServices moves the selected services from DisabledServices back into Services, as well as all the services
+// they transitively depend on. The project is left unchanged if an error is returned
+func (p *Project) EnableServices(names ...string) error {
+	selected := map[string]bool{}
+	for _, name := range names {
+		if err := p.collectEnabledServices(name, "", selected); err != nil {
+			return err
+		}
+	}
+
+	var disabled Services
+	for _, service := range p.DisabledServices {
+		if selected[service.Name] {
+			p.Services = append(p.Services, service)
+			continue
+		}
+		disabled = append(disabled, service)
+	}
+	p.DisabledServices = disabled
+	p.Services.Sort()
+	return nil
+}
+
+// collectEnabledServices adds to selected the service name, enabled or disabled, and the services it transitively
+// depends on
+func (p *Project) collectEnabledServices(name string, requiredBy string, selected map[string]bool) error {
+	if selected[name] {
+		return nil
+	}
+	service, err := p.GetService(name)
+	if err != nil {
+		service, err = p.GetDisabledService(name)
+	}
+	if err != nil {
+		if requiredBy != "" {
+			return errors.Wrapf(errdefs.ErrNotFound, "service %q depends on undefined service %q", requiredBy, name)
+		}
+		return errors.Wrapf(errdefs.ErrNotFound, "no such service: %s", name)
+	}
+	selected[name] = true
+
+	for _, dependency := range service.GetDependencies() {
+		if err := p.collectEnabledServices(dependency, name, selected); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ForServices reduces the project, in place, to the selected services and the services they transitively depend on
+// through depends_on, links or network_mode, then removes the networks, volumes, secrets and configs none of those
+// use, but external ones. The project is left unchanged if no service is selected, or if an error is returned.
+func (p *Project) ForServices(names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	selected := map[string]bool{}
+	for _, name := range names {
+		if err := p.collectServices(name, "", selected); err != nil {
+			return err
+		}
+	}
+
+	var services Services
+	for _, service := range p.Services {
+		if selected[service.Name] {
+			services = append(services, service)
+		}
+	}
+	p.Services = services
+	p.WithoutUnnecessaryResources()
+	return nil
+}
+
+func (p *Project) collectServices(name string, requiredBy string, selected map[string]bool) error {
+	if selected[name] {
+		return nil
+	}
+	service, err := p.GetService(name)
+	if err != nil {
+		if disabled, err := p.GetDisabledService(name); err == nil {
+			if requiredBy != "" {
+				return errors.Wrapf(errdefs.ErrInvalid, "service %q depends on service %q, which is disabled: enable profile %s",
+					requiredBy, name, strings.Join(disabled.Profiles, " or "))
+			}
+			return errors.Wrapf(errdefs.ErrInvalid, "service %q is disabled: enable profile %s", name,
+				strings.Join(disabled.Profiles, " or "))
+		}
+		if requiredBy != "" {
+			return errors.Wrapf(errdefs.ErrNotFound, "service %q depends on undefined service %q", requiredBy, name)
+		}
+		return errors.Wrapf(errdefs.ErrNotFound, "no such service: %s", name)
+	}
+	selected[name] = true
+
+	for _, dependency := range service.GetDependencies() {
+		if err := p.collectServices(dependency, name, selected); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WithoutUnnecessaryResources removes, in place, the networks, volumes, secrets and configs not used by any
+// service. External resources are kept, as those are managed out of the project
+func (p *Project) WithoutUnnecessaryResources() {
+	for _, resource := range p.CheckUnusedResources() {
+		parts := strings.SplitN(resource, ".", 2)
+		switch parts[0] {
+		case "networks":
+			delete(p.Networks, parts[1])
+		case "volumes":
+			delete(p.Volumes, parts[1])
+		case "secrets":
+			delete(p.Secrets, parts[1])
+		case "configs":
+			delete(p.Configs, parts[1])
+		}
+	}
+}
+
+// CheckUnusedResources returns the networks, volumes, secrets and configs not used by any service, as sorted
+// `<section>.<name>` strings, without removing them. External resources are not reported
+func (p *Project) CheckUnusedResources() []string {
+	used := p.usedResources()
+	unused := set{}
+	for name, network := range p.Networks {
+		if !used.has("networks."+name) && !network.External.External {
+			unused.append("networks." + name)
+		}
+	}
+	for name, volume := range p.Volumes {
+		if !used.has("volumes."+name) && !volume.External.External {
+			unused.append("volumes." + name)
+		}
+	}
+	for name, secret := range p.Secrets {
+		if !used.has("secrets."+name) && !secret.External.External {
+			unused.append("secrets." + name)
+		}
+	}
+	for name, config := range p.Configs {
+		if !used.has("configs."+name) && !config.External.External {
+			unused.append("configs." + name)
+		}
+	}
+	return unused.toSlice()
+}
+
+// usedResources collects the resources used by services, as `<section>.<name>` strings
+func (p *Project) usedResources() set {
+	used := set{}
+	for _, service := range p.Services {
+		for name := range service.Networks {
+			used.append("networks." + name)
+		}
+		for _, volume := range service.Volumes {
+			if volume.Type == VolumeTypeVolume && volume.Source != "" {
+				used.append("volumes." + volume.Source)
+			}
+		}
+		for _, secret := range service.Secrets {
+			used.append("secrets." + secret.Source)
+		}
+		if service.Build != nil {
+			for _, secret := range service.Build.Secrets {
+				used.append("secrets." + secret.Source)
+			}
+		}
+		for _, config := range service.Configs {
+			used.append("configs." + config.Source)
+		}
+	}
+	return used
+}
+
+// PublishedPort is a host port bound by a service, or a range of host ports one is picked from
+type PublishedPort struct {
+	Service   string
+	HostIP    string
+	Published string
+	Protocol  string
+}
+
+// PublishedPorts returns the host ports bound by services, sorted by service, so that conflicts can be detected
+// before containers are created. Ports picked by the engine are not reported
+func (p Project) PublishedPorts() []PublishedPort {
+	ports := []PublishedPort{}
+	for _, service := range p.Services {
+		for _, port := range service.Ports {
+			if port.IsEphemeral() {
+				continue
+			}
+			protocol := port.Protocol
+			if protocol == "" {
+				protocol = "tcp"
+			}
+			ports = append(ports, PublishedPort{
+				Service:   service.Name,
+				HostIP:    port.HostIP,
+				Published: port.Published,
+				Protocol:  protocol,
+			})
+		}
+	}
+	sort.SliceStable(ports, func(i, j int) bool { return ports[i].Service < ports[j].Service })
+	return ports
 }
 
 type ServiceFunc func(service ServiceConfig) error
 
-// WithServices run ServiceFunc on each service and dependencies in dependency order
+// WithServices run ServiceFunc on each service and dependencies in dependency order. ServiceFunc is passed a deep
+// copy of each service, which can be modified without affecting the project
 func (p Project) WithServices(names []string, fn ServiceFunc) error {
 	return p.withServices(names, fn, map[string]bool{})
 }
@@ -135,7 +669,7 @@ func (p Project) withServices(names []string, fn ServiceFunc, done map[string]bo
 				return err
 			}
 		}
-		if err := fn(service); err != nil {
+		if err := fn(*service.DeepCopy()); err != nil {
 			return err
 		}
 		done[service.Name] = true
@@ -143,6 +677,15 @@ func (p Project) withServices(names []string, fn ServiceFunc, done map[string]bo
 	return nil
 }
 
+// DeepCopy returns a copy of the project sharing no map, slice or pointer with it, so that either can be modified
+// without affecting the other
+func (p *Project) DeepCopy() *Project {
+	if p == nil {
+		return nil
+	}
+	return deepCopy(reflect.ValueOf(p)).Interface().(*Project)
+}
+
 // RelativePath resolve a relative path based project's working directory
 func (p *Project) RelativePath(path string) string {
 	if path[0] == '~' {
@@ -154,3 +697,328 @@ func (p *Project) RelativePath(path string) string {
 	}
 	return filepath.Join(p.WorkingDir, path)
 }
+
+// ProjectDiff is the difference between the services of two projects
+type ProjectDiff struct {
+	// AddedServices are the services only declared by the other project, sorted by name
+	AddedServices []string `json:"added_services,omitempty"`
+	// RemovedServices are the services only declared by the project, sorted by name
+	RemovedServices []string `json:"removed_services,omitempty"`
+	// ChangedServices are the sorted paths of the attributes changed by the other project, like `image`,
+	// `environment.FOO` or `ports[0].published`, indexed by service name
+	ChangedServices map[string][]string `json:"changed_services,omitempty"`
+}
+
+// DiffOptions configures how projects are compared by Diff
+type DiffOptions struct {
+	// IncludeExtensions compares the `x-` extensions of services, which are ignored by default
+	IncludeExtensions bool
+}
+
+// Diff compares the services of the project with the ones of other. Services are compared in their canonical JSON
+// form, in which unset and empty values are equal
+func (p *Project) Diff(other *Project, options ...func(*DiffOptions)) ProjectDiff {
+	opts := DiffOptions{}
+	for _, option := range options {
+		option(&opts)
+	}
+	diff := ProjectDiff{}
+	for _, service := range other.Services {
+		if _, err := p.GetService(service.Name); err != nil {
+			diff.AddedServices = append(diff.AddedServices, service.Name)
+		}
+	}
+	for _, service := range p.Services {
+		otherService, err := other.GetService(service.Name)
+		if err != nil {
+			diff.RemovedServices = append(diff.RemovedServices, service.Name)
+			continue
+		}
+		var changed []string
+		diffValues(canonicalService(service, opts), canonicalService(otherService, opts), "", &changed)
+		if len(changed) > 0 {
+			if diff.ChangedServices == nil {
+				diff.ChangedServices = map[string][]string{}
+			}
+			sort.Strings(changed)
+			diff.ChangedServices[service.Name] = changed
+		}
+	}
+	sort.Strings(diff.AddedServices)
+	sort.Strings(diff.RemovedServices)
+	return diff
+}
+
+// canonicalService returns the JSON representation of a service as generic maps and slices
+func canonicalService(service ServiceConfig, opts DiffOptions) interface{} {
+	var canonical map[string]interface{}
+	if b, err := json.Marshal(service); err == nil {
+		_ = json.Unmarshal(b, &canonical)
+	}
+	if opts.IncludeExtensions && len(service.Extensions) > 0 {
+		var extensions map[string]interface{}
+		if b, err := json.Marshal(service.Extensions); err == nil && json.Unmarshal(b, &extensions) == nil {
+			for k, v := range extensions {
+				canonical[k] = v
+			}
+		}
+	}
+	return canonical
+}
+
+// diffValues appends to changed the paths of the values which differ between a and b
+func diffValues(a, b interface{}, path string, changed *[]string) {
+	if isEmptyValue(a) && isEmptyValue(b) {
+		return
+	}
+	aMap, aIsMap := a.(map[string]interface{})
+	bMap, bIsMap := b.(map[string]interface{})
+	aList, aIsList := a.([]interface{})
+	bList, bIsList := b.([]interface{})
+	switch {
+	case aIsMap && (bIsMap || isEmptyValue(b)), bIsMap && isEmptyValue(a):
+		keys := map[string]bool{}
+		for k := range aMap {
+			keys[k] = true
+		}
+		for k := range bMap {
+			keys[k] = true
+		}
+		for k := range keys {
+			key := k
+			if path != "" {
+				key = path + "." + k
+			}
+			diffValues(aMap[k], bMap[k], key, changed)
+		}
+	case aIsList && (bIsList || isEmptyValue(b)), bIsList && isEmptyValue(a):
+		for i := 0; i < len(aList) || i < len(bList); i++ {
+			var aItem, bItem interface{}
+			if i < len(aList) {
+				aItem = aList[i]
+			}
+			if i < len(bList) {
+				bItem = bList[i]
+			}
+			diffValues(aItem, bItem, fmt.Sprintf("%s[%d]", path, i), changed)
+		}
+	case !reflect.DeepEqual(a, b):
+		*changed = append(*changed, path)
+	}
+}
+
+func isEmptyValue(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case map[string]interface{}:
+		return len(v) == 0
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// RedactedValue replaces the values redacted by MarshalYAMLWithOptions
+const RedactedValue = "******"
+
+// DefaultSecretPatterns are the patterns of the keys which values are redacted, unless MarshalOptions sets some
+var DefaultSecretPatterns = []string{"*PASSWORD*", "*TOKEN*", "*SECRET*", "*KEY*"}
+
+// MarshalOptions configures how MarshalYAMLWithOptions renders a project
+type MarshalOptions struct {
+	// RedactSecrets replaces by RedactedValue the values of environment variables, labels, build args and
+	// extensions which key matches one of SecretPatterns, as well as the environment variables top-level secrets
+	// are read from. Keys are kept
+	RedactSecrets bool
+	// SecretPatterns are patterns matched against keys case-insensitively, `*` matching any sequence of characters.
+	// DefaultSecretPatterns are used if nil
+	SecretPatterns []string
+	// PreserveVersion renders the top-level `version` of the project, which is omitted by default
+	PreserveVersion bool
+}
+
+// MarshalYAMLWithOptions renders the project as YAML. The project itself is not modified
+func (p *Project) MarshalYAMLWithOptions(opts MarshalOptions) ([]byte, error) {
+	rendered := p
+	if opts.RedactSecrets {
+		rendered = p.redacted(opts.SecretPatterns)
+	}
+	out, err := yaml.Marshal(rendered)
+	if err != nil || !opts.PreserveVersion || p.Version == "" {
+		return out, err
+	}
+	// the version is rendered first, as legacy compose files declare it
+	version, err := yaml.Marshal(map[string]string{"version": p.Version})
+	if err != nil {
+		return nil, err
+	}
+	return append(version, out...), nil
+}
+
+// ToConfigDetails renders the project as a single in-memory compose file, with the working directory and environment
+// of the project, to be loaded again the way `config` output is. Values of the project have already been
+// interpolated, so `$` characters are escaped in the rendered file. DisabledServices are rendered along with Services,
+// the loaded project declaring them all until profiles are applied again
+func (p *Project) ToConfigDetails() (ConfigDetails, error) {
+	rendered := *p
+	rendered.ComposeFiles = nil
+	rendered.Services = append(append(Services{}, p.Services...), p.DisabledServices...)
+	rendered.Services.Sort()
+	rendered.DisabledServices = nil
+	out, err := rendered.MarshalYAMLWithOptions(MarshalOptions{PreserveVersion: true})
+	if err != nil {
+		return ConfigDetails{}, err
+	}
+	var config yaml.MapSlice
+	if err := yaml.Unmarshal(out, &config); err != nil {
+		return ConfigDetails{}, err
+	}
+	// the working directory is not an attribute of compose files
+	for i, item := range config {
+		if item.Key == "workingdir" {
+			config = append(config[:i], config[i+1:]...)
+			break
+		}
+	}
+	content, err := yaml.Marshal(escapeDollars(config))
+	if err != nil {
+		return ConfigDetails{}, err
+	}
+	return ConfigDetails{
+		Version:     p.Version,
+		WorkingDir:  p.WorkingDir,
+		ConfigFiles: []ConfigFile{{Filename: filepath.Join(p.WorkingDir, "compose.yaml"), Content: content}},
+		Environment: p.Environment,
+	}, nil
+}
+
+// escapeDollars escapes the `$` characters of the strings of value, so that they are not interpolated again
+func escapeDollars(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return strings.ReplaceAll(v, "$", "$$")
+	case yaml.MapSlice:
+		for i := range v {
+			v[i].Value = escapeDollars(v[i].Value)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = escapeDollars(v[i])
+		}
+	}
+	return value
+}
+
+// redacted returns a copy of the project which values matching patterns, DefaultSecretPatterns if nil, are redacted
+func (p *Project) redacted(patterns []string) *Project {
+	if patterns == nil {
+		patterns = DefaultSecretPatterns
+	}
+	sources := map[string]bool{}
+	for _, secret := range p.Secrets {
+		if secret.Environment != "" {
+			sources[secret.Environment] = true
+		}
+	}
+	redact := func(key string) bool {
+		if sources[key] {
+			return true
+		}
+		for _, pattern := range patterns {
+			if matchPattern(strings.ToUpper(pattern), strings.ToUpper(key)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	redacted := p.DeepCopy()
+	for i := range redacted.Services {
+		redactService(&redacted.Services[i], redact)
+	}
+	for i := range redacted.DisabledServices {
+		redactService(&redacted.DisabledServices[i], redact)
+	}
+	redactExtensions(redacted.Extensions, redact)
+	return redacted
+}
+
+func redactService(service *ServiceConfig, redact func(string) bool) {
+	redactMapping(service.Environment, redact)
+	redactLabels(service.Labels, redact)
+	redactLabels(service.Annotations, redact)
+	if service.Build != nil {
+		redactMapping(service.Build.Args, redact)
+		redactLabels(service.Build.Labels, redact)
+	}
+	redactExtensions(service.Extensions, redact)
+}
+
+func redactMapping(mapping MappingWithEquals, redact func(string) bool) {
+	for key, value := range mapping {
+		if value != nil && redact(key) {
+			redacted := RedactedValue
+			mapping[key] = &redacted
+		}
+	}
+}
+
+func redactLabels(labels Labels, redact func(string) bool) {
+	for key := range labels {
+		if redact(key) {
+			labels[key] = RedactedValue
+		}
+	}
+}
+
+// redactExtensions redacts the values of extensions, and of the mappings they are made of, set with a secret key
+func redactExtensions(extensions map[string]interface{}, redact func(string) bool) {
+	for key, value := range extensions {
+		if redact(key) {
+			extensions[key] = RedactedValue
+			continue
+		}
+		redactValue(value, redact)
+	}
+}
+
+func redactValue(value interface{}, redact func(string) bool) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		redactExtensions(value, redact)
+	case map[interface{}]interface{}:
+		for key, v := range value {
+			if name, ok := key.(string); ok && redact(name) {
+				value[key] = RedactedValue
+				continue
+			}
+			redactValue(v, redact)
+		}
+	case []interface{}:
+		for _, v := range value {
+			redactValue(v, redact)
+		}
+	}
+}
+
+// matchPattern tells if s matches pattern, in which `*` matches any sequence of characters
+func matchPattern(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	last := len(parts) - 1
+	for _, part := range parts[1:last] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	if last == 0 {
+		return s == ""
+	}
+	return strings.HasSuffix(s, parts[last])
+}
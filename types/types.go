@@ -17,13 +17,23 @@
 package types
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"net"
+	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
+	"github.com/compose-spec/compose-go/errdefs"
 	"github.com/docker/go-connections/nat"
+	units "github.com/docker/go-units"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
 )
 
 // Duration is a thin wrapper around time.Duration with improved JSON marshalling
@@ -69,11 +79,29 @@ type Services []ServiceConfig
 func (s Services) MarshalYAML() (interface{}, error) {
 	services := map[string]ServiceConfig{}
 	for _, service := range s {
+		if _, ok := services[service.Name]; ok {
+			return nil, errors.Wrapf(errdefs.ErrInvalid, "service %q is declared more than once", service.Name)
+		}
 		services[service.Name] = service
 	}
 	return services, nil
 }
 
+// Sort sorts services by name, so that they are iterated over in the same order whatever the way they were loaded
+func (s Services) Sort() {
+	sort.SliceStable(s, func(i, j int) bool { return s[i].Name < s[j].Name })
+}
+
+// index returns the position of the service named name, or -1
+func (s Services) index(name string) int {
+	for i, service := range s {
+		if service.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
 // MarshalJSON makes Services implement json.Marshaler
 func (s Services) MarshalJSON() ([]byte, error) {
 	data, err := s.MarshalYAML()
@@ -87,123 +115,565 @@ func (s Services) MarshalJSON() ([]byte, error) {
 type ServiceConfig struct {
 	Name string `yaml:"-" json:"-"`
 
-	Build           *BuildConfig                     `yaml:",omitempty" json:"build,omitempty"`
-	BlkioConfig     string                           `yaml:",omitempty" json:"blkio_config,omitempty"`
-	CapAdd          []string                         `mapstructure:"cap_add" yaml:"cap_add,omitempty" json:"cap_add,omitempty"`
-	CapDrop         []string                         `mapstructure:"cap_drop" yaml:"cap_drop,omitempty" json:"cap_drop,omitempty"`
-	CgroupParent    string                           `mapstructure:"cgroup_parent" yaml:"cgroup_parent,omitempty" json:"cgroup_parent,omitempty"`
-	CPUCount        int64                            `mapstructure:"cpu_count" yaml:"cpu_count,omitempty" json:"cpu_count,omitempty"`
-	CPUPercent      float32                          `mapstructure:"cpu_percent" yaml:"cpu_percent,omitempty" json:"cpu_percent,omitempty"`
-	CPUPeriod       int64                            `mapstructure:"cpu_period" yaml:"cpu_period,omitempty" json:"cpu_period,omitempty"`
-	CPUQuota        int64                            `mapstructure:"cpu_quota" yaml:"cpu_quota,omitempty" json:"cpu_quota,omitempty"`
-	CPURTPeriod     int64                            `mapstructure:"cpu_rt_period" yaml:"cpu_rt_period,omitempty" json:"cpu_rt_period,omitempty"`
-	CPURTRuntime    int64                            `mapstructure:"cpu_rt_runtime" yaml:"cpu_rt_runtime,omitempty" json:"cpu_rt_runtime,omitempty"`
-	CPUS            float32                          `mapstructure:"cpus" yaml:"cpus,omitempty" json:"cpus,omitempty"`
-	CPUSet          string                           `mapstructure:"cpuset" yaml:"cpuset,omitempty" json:"cpuset,omitempty"`
-	CPUShares       int64                            `mapstructure:"cpu_shares" yaml:"cpu_shares,omitempty" json:"cpu_shares,omitempty"`
-	Command         ShellCommand                     `yaml:",omitempty" json:"command,omitempty"`
-	Configs         []ServiceConfigObjConfig         `yaml:",omitempty" json:"configs,omitempty"`
-	ContainerName   string                           `mapstructure:"container_name" yaml:"container_name,omitempty" json:"container_name,omitempty"`
-	CredentialSpec  *CredentialSpecConfig            `mapstructure:"credential_spec" yaml:"credential_spec,omitempty" json:"credential_spec,omitempty"`
-	DependsOn       DependsOnConfig                  `mapstructure:"depends_on" yaml:"depends_on,omitempty" json:"depends_on,omitempty"`
-	Deploy          *DeployConfig                    `yaml:",omitempty" json:"deploy,omitempty"`
-	Devices         []string                         `yaml:",omitempty" json:"devices,omitempty"`
-	DNS             StringList                       `yaml:",omitempty" json:"dns,omitempty"`
-	DNSOpts         []string                         `mapstructure:"dns_opt" yaml:"dns_opt,omitempty" json:"dns_opt,omitempty"`
-	DNSSearch       StringList                       `mapstructure:"dns_search" yaml:"dns_search,omitempty" json:"dns_search,omitempty"`
-	Dockerfile      string                           `yaml:"dockerfile,omitempty" json:"dockerfile,omitempty"`
-	DomainName      string                           `mapstructure:"domainname" yaml:"domainname,omitempty" json:"domainname,omitempty"`
-	Entrypoint      ShellCommand                     `yaml:",omitempty" json:"entrypoint,omitempty"`
-	Environment     MappingWithEquals                `yaml:",omitempty" json:"environment,omitempty"`
-	EnvFile         StringList                       `mapstructure:"env_file" yaml:"env_file,omitempty" json:"env_file,omitempty"`
-	Expose          StringOrNumberList               `yaml:",omitempty" json:"expose,omitempty"`
-	Extends         ExtendsConfig                    `yaml:"extends,omitempty" json:"extends,omitempty"`
-	ExternalLinks   []string                         `mapstructure:"external_links" yaml:"external_links,omitempty" json:"external_links,omitempty"`
-	ExtraHosts      HostsList                        `mapstructure:"extra_hosts" yaml:"extra_hosts,omitempty" json:"extra_hosts,omitempty"`
-	GroupAdd        []string                         `mapstructure:"group_app" yaml:"group_add,omitempty" json:"group_add,omitempty"`
-	Hostname        string                           `yaml:",omitempty" json:"hostname,omitempty"`
-	HealthCheck     *HealthCheckConfig               `yaml:",omitempty" json:"healthcheck,omitempty"`
-	Image           string                           `yaml:",omitempty" json:"image,omitempty"`
-	Init            *bool                            `yaml:",omitempty" json:"init,omitempty"`
-	Ipc             string                           `yaml:",omitempty" json:"ipc,omitempty"`
-	Isolation       string                           `mapstructure:"isolation" yaml:"isolation,omitempty" json:"isolation,omitempty"`
-	Labels          Labels                           `yaml:",omitempty" json:"labels,omitempty"`
-	Links           []string                         `yaml:",omitempty" json:"links,omitempty"`
-	Logging         *LoggingConfig                   `yaml:",omitempty" json:"logging,omitempty"`
-	LogDriver       string                           `mapstructure:"log_driver" yaml:"log_driver,omitempty" json:"log_driver,omitempty"`
-	LogOpt          map[string]string                `mapstructure:"log_opt" yaml:"log_opt,omitempty" json:"log_opt,omitempty"`
-	MemLimit        UnitBytes                        `mapstructure:"mem_limit" yaml:"mem_limit,omitempty" json:"mem_limit,omitempty"`
-	MemReservation  UnitBytes                        `mapstructure:"mem_reservation" yaml:"mem_reservation,omitempty" json:"mem_reservation,omitempty"`
-	MemSwapLimit    UnitBytes                        `mapstructure:"memswap_limit" yaml:"memswap_limit,omitempty" json:"memswap_limit,omitempty"`
-	MemSwappiness   UnitBytes                        `mapstructure:"mem_swappiness" yaml:"mem_swappiness,omitempty" json:"mem_swappiness,omitempty"`
-	MacAddress      string                           `mapstructure:"mac_address" yaml:"mac_address,omitempty" json:"mac_address,omitempty"`
-	Net             string                           `yaml:"net,omitempty" json:"net,omitempty"`
-	NetworkMode     string                           `mapstructure:"network_mode" yaml:"network_mode,omitempty" json:"network_mode,omitempty"`
-	Networks        map[string]*ServiceNetworkConfig `yaml:",omitempty" json:"networks,omitempty"`
-	OomKillDisable  bool                             `mapstructure:"oom_kill_disable" yaml:"oom_kill_disable,omitempty" json:"oom_kill_disable,omitempty"`
-	OomScoreAdj     int64                            `mapstructure:"oom_score_adj" yaml:"oom_score_adj,omitempty" json:"oom_score_adj,omitempty"`
-	Pid             string                           `yaml:",omitempty" json:"pid,omitempty"`
-	PidLimit        int64                            `mapstructure:"pid_limit" yaml:"pid_limit,omitempty" json:"pid_limit,omitempty"`
-	Platform        string                           `yaml:",omitempty" json:"platform,omitempty"`
-	Ports           []ServicePortConfig              `yaml:",omitempty" json:"ports,omitempty"`
-	Privileged      bool                             `yaml:",omitempty" json:"privileged,omitempty"`
-	PullPolicy      string                           `yaml:",omitempty" json:"pull_policy,omitempty"`
-	ReadOnly        bool                             `mapstructure:"read_only" yaml:"read_only,omitempty" json:"read_only,omitempty"`
-	Restart         string                           `yaml:",omitempty" json:"restart,omitempty"`
-	Runtime         string                           `yaml:",omitempty" json:"runtime,omitempty"`
-	Scale           int                              `yaml:",omitempty" json:"scale,omitempty"`
-	Secrets         []ServiceSecretConfig            `yaml:",omitempty" json:"secrets,omitempty"`
-	SecurityOpt     []string                         `mapstructure:"security_opt" yaml:"security_opt,omitempty" json:"security_opt,omitempty"`
-	ShmSize         string                           `mapstructure:"shm_size" yaml:"shm_size,omitempty" json:"shm_size,omitempty"`
-	StdinOpen       bool                             `mapstructure:"stdin_open" yaml:"stdin_open,omitempty" json:"stdin_open,omitempty"`
-	StopGracePeriod *Duration                        `mapstructure:"stop_grace_period" yaml:"stop_grace_period,omitempty" json:"stop_grace_period,omitempty"`
-	StopSignal      string                           `mapstructure:"stop_signal" yaml:"stop_signal,omitempty" json:"stop_signal,omitempty"`
-	Sysctls         Mapping                          `yaml:",omitempty" json:"sysctls,omitempty"`
-	Tmpfs           StringList                       `yaml:",omitempty" json:"tmpfs,omitempty"`
-	Tty             bool                             `mapstructure:"tty" yaml:"tty,omitempty" json:"tty,omitempty"`
-	Ulimits         map[string]*UlimitsConfig        `yaml:",omitempty" json:"ulimits,omitempty"`
-	User            string                           `yaml:",omitempty" json:"user,omitempty"`
-	UserNSMode      string                           `mapstructure:"userns_mode" yaml:"userns_mode,omitempty" json:"userns_mode,omitempty"`
-	Uts             string                           `yaml:"uts,omitempty" json:"uts,omitempty"`
-	VolumeDriver    string                           `mapstructure:"volume_driver" yaml:"volume_driver,omitempty" json:"volume_driver,omitempty"`
-	Volumes         []ServiceVolumeConfig            `yaml:",omitempty" json:"volumes,omitempty"`
-	VolumesFrom     []string                         `mapstructure:"volumes_from" yaml:"volumes_from,omitempty" json:"volumes_from,omitempty"`
-	WorkingDir      string                           `mapstructure:"working_dir" yaml:"working_dir,omitempty" json:"working_dir,omitempty"`
+	Annotations       Labels                           `yaml:",omitempty" json:"annotations,omitempty"`
+	Attach            *bool                            `yaml:"attach,omitempty" json:"attach,omitempty"`
+	Build             *BuildConfig                     `yaml:",omitempty" json:"build,omitempty"`
+	BlkioConfig       *BlkioConfig                     `mapstructure:"blkio_config" yaml:"blkio_config,omitempty" json:"blkio_config,omitempty"`
+	CapAdd            []string                         `mapstructure:"cap_add" yaml:"cap_add,omitempty" json:"cap_add,omitempty"`
+	CapDrop           []string                         `mapstructure:"cap_drop" yaml:"cap_drop,omitempty" json:"cap_drop,omitempty"`
+	Cgroup            string                           `yaml:"cgroup,omitempty" json:"cgroup,omitempty"`
+	CgroupParent      string                           `mapstructure:"cgroup_parent" yaml:"cgroup_parent,omitempty" json:"cgroup_parent,omitempty"`
+	CPUCount          int64                            `mapstructure:"cpu_count" yaml:"cpu_count,omitempty" json:"cpu_count,omitempty"`
+	CPUPercent        float32                          `mapstructure:"cpu_percent" yaml:"cpu_percent,omitempty" json:"cpu_percent,omitempty"`
+	CPUPeriod         Microseconds                     `mapstructure:"cpu_period" yaml:"cpu_period,omitempty" json:"cpu_period,omitempty"`
+	CPUQuota          Microseconds                     `mapstructure:"cpu_quota" yaml:"cpu_quota,omitempty" json:"cpu_quota,omitempty"`
+	CPURTPeriod       Microseconds                     `mapstructure:"cpu_rt_period" yaml:"cpu_rt_period,omitempty" json:"cpu_rt_period,omitempty"`
+	CPURTRuntime      Microseconds                     `mapstructure:"cpu_rt_runtime" yaml:"cpu_rt_runtime,omitempty" json:"cpu_rt_runtime,omitempty"`
+	CPUS              float32                          `mapstructure:"cpus" yaml:"cpus,omitempty" json:"cpus,omitempty"`
+	CPUSet            string                           `mapstructure:"cpuset" yaml:"cpuset,omitempty" json:"cpuset,omitempty"`
+	CPUShares         int64                            `mapstructure:"cpu_shares" yaml:"cpu_shares,omitempty" json:"cpu_shares,omitempty"`
+	Command           ShellCommand                     `yaml:",omitempty" json:"command,omitzero"`
+	Configs           []ServiceConfigObjConfig         `yaml:",omitempty" json:"configs,omitempty"`
+	ContainerName     string                           `mapstructure:"container_name" yaml:"container_name,omitempty" json:"container_name,omitempty"`
+	CredentialSpec    *CredentialSpecConfig            `mapstructure:"credential_spec" yaml:"credential_spec,omitempty" json:"credential_spec,omitempty"`
+	DependsOn         DependsOnConfig                  `mapstructure:"depends_on" yaml:"depends_on,omitempty" json:"depends_on,omitempty"`
+	Deploy            *DeployConfig                    `yaml:",omitempty" json:"deploy,omitempty"`
+	Develop           *DevelopConfig                   `yaml:",omitempty" json:"develop,omitempty"`
+	DeviceCgroupRules []string                         `mapstructure:"device_cgroup_rules" yaml:"device_cgroup_rules,omitempty" json:"device_cgroup_rules,omitempty"`
+	Devices           []ServiceDeviceConfig            `yaml:",omitempty" json:"devices,omitempty"`
+	DNS               StringList                       `yaml:",omitempty" json:"dns,omitempty"`
+	DNSOpts           StringList                       `mapstructure:"dns_opt" yaml:"dns_opt,omitempty" json:"dns_opt,omitempty"`
+	DNSSearch         StringList                       `mapstructure:"dns_search" yaml:"dns_search,omitempty" json:"dns_search,omitempty"`
+	Dockerfile        string                           `yaml:"dockerfile,omitempty" json:"dockerfile,omitempty"`
+	DomainName        string                           `mapstructure:"domainname" yaml:"domainname,omitempty" json:"domainname,omitempty"`
+	Entrypoint        ShellCommand                     `yaml:",omitempty" json:"entrypoint,omitzero"`
+	Environment       MappingWithEquals                `yaml:",omitempty" json:"environment,omitempty"`
+	EnvFile           StringList                       `mapstructure:"env_file" yaml:"env_file,omitempty" json:"env_file,omitempty"`
+	Expose            StringOrNumberList               `yaml:",omitempty" json:"expose,omitempty"`
+	Extends           ExtendsConfig                    `yaml:"extends,omitempty" json:"extends,omitempty"`
+	ExternalLinks     []ServiceLink                    `mapstructure:"external_links" yaml:"external_links,omitempty" json:"external_links,omitempty"`
+	ExtraHosts        HostsList                        `mapstructure:"extra_hosts" yaml:"extra_hosts,omitempty" json:"extra_hosts,omitempty"`
+	GroupAdd          StringOrNumberList               `mapstructure:"group_add" yaml:"group_add,omitempty" json:"group_add,omitempty"`
+	Hostname          string                           `yaml:",omitempty" json:"hostname,omitempty"`
+	HealthCheck       *HealthCheckConfig               `yaml:",omitempty" json:"healthcheck,omitempty"`
+	Image             string                           `yaml:",omitempty" json:"image,omitempty"`
+	Init              *bool                            `yaml:",omitempty" json:"init,omitempty"`
+	Ipc               string                           `yaml:",omitempty" json:"ipc,omitempty"`
+	Isolation         string                           `mapstructure:"isolation" yaml:"isolation,omitempty" json:"isolation,omitempty"`
+	Labels            Labels                           `yaml:",omitempty" json:"labels,omitempty"`
+	Links             []ServiceLink                    `yaml:",omitempty" json:"links,omitempty"`
+	Logging           *LoggingConfig                   `yaml:",omitempty" json:"logging,omitempty"`
+	LogDriver         string                           `mapstructure:"log_driver" yaml:"log_driver,omitempty" json:"log_driver,omitempty"`
+	LogOpt            map[string]string                `mapstructure:"log_opt" yaml:"log_opt,omitempty" json:"log_opt,omitempty"`
+	MemLimit          UnitBytes                        `mapstructure:"mem_limit" yaml:"mem_limit,omitempty" json:"mem_limit,omitempty"`
+	MemReservation    UnitBytes                        `mapstructure:"mem_reservation" yaml:"mem_reservation,omitempty" json:"mem_reservation,omitempty"`
+	MemSwapLimit      UnitBytes                        `mapstructure:"memswap_limit" yaml:"memswap_limit,omitempty" json:"memswap_limit,omitempty"`
+	MemSwappiness     UnitBytes                        `mapstructure:"mem_swappiness" yaml:"mem_swappiness,omitempty" json:"mem_swappiness,omitempty"`
+	MacAddress        string                           `mapstructure:"mac_address" yaml:"mac_address,omitempty" json:"mac_address,omitempty"`
+	Net               string                           `yaml:"net,omitempty" json:"net,omitempty"`
+	NetworkMode       string                           `mapstructure:"network_mode" yaml:"network_mode,omitempty" json:"network_mode,omitempty"`
+	Networks          map[string]*ServiceNetworkConfig `yaml:",omitempty" json:"networks,omitempty"`
+	OomKillDisable    *bool                            `mapstructure:"oom_kill_disable" yaml:"oom_kill_disable,omitempty" json:"oom_kill_disable,omitempty"`
+	OomScoreAdj       int64                            `mapstructure:"oom_score_adj" yaml:"oom_score_adj,omitempty" json:"oom_score_adj,omitempty"`
+	Pid               string                           `yaml:",omitempty" json:"pid,omitempty"`
+	PidsLimit         int64                            `mapstructure:"pids_limit" yaml:"pids_limit,omitempty" json:"pids_limit,omitempty"`
+	Platform          string                           `yaml:",omitempty" json:"platform,omitempty"`
+	Ports             []ServicePortConfig              `yaml:",omitempty" json:"ports,omitempty"`
+	Privileged        bool                             `yaml:",omitempty" json:"privileged,omitempty"`
+	Profiles          []string                         `yaml:",omitempty" json:"profiles,omitempty"`
+	PullPolicy        PullPolicy                       `mapstructure:"pull_policy" yaml:"pull_policy,omitempty" json:"pull_policy,omitempty"`
+	ReadOnly          bool                             `mapstructure:"read_only" yaml:"read_only,omitempty" json:"read_only,omitempty"`
+	Restart           *ServiceRestart                  `yaml:",omitempty" json:"restart,omitempty"`
+	Runtime           string                           `yaml:",omitempty" json:"runtime,omitempty"`
+	Scale             int                              `yaml:",omitempty" json:"scale,omitempty"`
+	Secrets           []ServiceSecretConfig            `yaml:",omitempty" json:"secrets,omitempty"`
+	SecurityOpt       []string                         `mapstructure:"security_opt" yaml:"security_opt,omitempty" json:"security_opt,omitempty"`
+	ShmSize           UnitBytes                        `mapstructure:"shm_size" yaml:"shm_size,omitempty" json:"shm_size,omitempty"`
+	StdinOpen         *bool                            `mapstructure:"stdin_open" yaml:"stdin_open,omitempty" json:"stdin_open,omitempty"`
+	StopGracePeriod   *Duration                        `mapstructure:"stop_grace_period" yaml:"stop_grace_period,omitempty" json:"stop_grace_period,omitempty"`
+	StopSignal        string                           `mapstructure:"stop_signal" yaml:"stop_signal,omitempty" json:"stop_signal,omitempty"`
+	StorageOpt        map[string]string                `mapstructure:"storage_opt" yaml:"storage_opt,omitempty" json:"storage_opt,omitempty"`
+	Sysctls           Mapping                          `yaml:",omitempty" json:"sysctls,omitempty"`
+	Tmpfs             StringList                       `yaml:",omitempty" json:"tmpfs,omitempty"`
+	Tty               *bool                            `mapstructure:"tty" yaml:"tty,omitempty" json:"tty,omitempty"`
+	Ulimits           map[string]*UlimitsConfig        `yaml:",omitempty" json:"ulimits,omitempty"`
+	User              string                           `yaml:",omitempty" json:"user,omitempty"`
+	UserNSMode        string                           `mapstructure:"userns_mode" yaml:"userns_mode,omitempty" json:"userns_mode,omitempty"`
+	Uts               string                           `yaml:"uts,omitempty" json:"uts,omitempty"`
+	VolumeDriver      string                           `mapstructure:"volume_driver" yaml:"volume_driver,omitempty" json:"volume_driver,omitempty"`
+	Volumes           []ServiceVolumeConfig            `yaml:",omitempty" json:"volumes,omitempty"`
+	VolumesFrom       []VolumesFromSource              `mapstructure:"volumes_from" yaml:"volumes_from,omitempty" json:"volumes_from,omitempty"`
+	WorkingDir        string                           `mapstructure:"working_dir" yaml:"working_dir,omitempty" json:"working_dir,omitempty"`
 
 	Extensions map[string]interface{} `yaml:",inline" json:"-"`
 }
 
+// PullPolicy tells when the image of a service is pulled
+type PullPolicy string
+
 const (
 	//PullPolicyAlways always pull images
-	PullPolicyAlways = "always"
+	PullPolicyAlways PullPolicy = "always"
 	//PullPolicyNever never pull images
-	PullPolicyNever = "never"
+	PullPolicyNever PullPolicy = "never"
 	//PullPolicyIfNotPresent pull missing images
-	PullPolicyIfNotPresent = "if_not_present"
+	PullPolicyIfNotPresent PullPolicy = "if_not_present"
+	//PullPolicyMissing is a synonym of PullPolicyIfNotPresent, which ParsePullPolicy normalizes to
+	PullPolicyMissing PullPolicy = "missing"
 	//PullPolicyBuild force building images
-	PullPolicyBuild = "build"
+	PullPolicyBuild PullPolicy = "build"
+)
+
+// ParsePullPolicy parses a pull policy, normalizing synonyms so that policies can be compared
+func ParsePullPolicy(policy string) (PullPolicy, error) {
+	switch p := PullPolicy(policy); p {
+	case PullPolicyAlways, PullPolicyNever, PullPolicyIfNotPresent, PullPolicyBuild:
+		return p, nil
+	case PullPolicyMissing:
+		return PullPolicyIfNotPresent, nil
+	}
+	return "", errors.Wrapf(errdefs.ErrInvalid, "invalid pull policy %q, must be one of %s, %s, %s, %s or %s", policy,
+		PullPolicyAlways, PullPolicyNever, PullPolicyIfNotPresent, PullPolicyMissing, PullPolicyBuild)
+}
+
+// RestartCondition tells when the containers of a service are restarted
+type RestartCondition string
+
+const (
+	// RestartNo never restarts containers
+	RestartNo RestartCondition = "no"
+	// RestartAlways always restarts containers which stopped
+	RestartAlways RestartCondition = "always"
+	// RestartOnFailure restarts containers which exited with a non-zero code
+	RestartOnFailure RestartCondition = "on-failure"
+	// RestartUnlessStopped always restarts containers which haven't been explicitly stopped
+	RestartUnlessStopped RestartCondition = "unless-stopped"
+)
+
+// ServiceRestart is the restart policy of a service, written as `condition` or `on-failure:max-retries`
+type ServiceRestart struct {
+	Condition RestartCondition
+	// MaxRetries limits the number of restarts on failure, if set
+	MaxRetries *uint64 `mapstructure:"max_retries"`
+}
+
+// ParseRestart parses a restart policy in the `condition` or `on-failure:max-retries` syntax
+func ParseRestart(spec string) (ServiceRestart, error) {
+	invalid := errors.Wrapf(errdefs.ErrInvalid, "invalid restart policy %q, must be one of %s, %s, %s[:max-retries] or %s", spec,
+		RestartNo, RestartAlways, RestartOnFailure, RestartUnlessStopped)
+	condition, retries, hasRetries := spec, "", false
+	if i := strings.Index(spec, ":"); i >= 0 {
+		condition, retries, hasRetries = spec[:i], spec[i+1:], true
+	}
+	restart := ServiceRestart{Condition: RestartCondition(condition)}
+	switch restart.Condition {
+	case RestartNo, RestartAlways, RestartUnlessStopped:
+		if hasRetries {
+			return restart, invalid
+		}
+	case RestartOnFailure:
+		if hasRetries {
+			max, err := strconv.ParseUint(retries, 10, 64)
+			if err != nil {
+				return restart, invalid
+			}
+			restart.MaxRetries = &max
+		}
+	default:
+		return restart, invalid
+	}
+	return restart, nil
+}
+
+// String returns the restart policy in the `condition` or `on-failure:max-retries` syntax
+func (r ServiceRestart) String() string {
+	if r.MaxRetries != nil {
+		return fmt.Sprintf("%s:%d", r.Condition, *r.MaxRetries)
+	}
+	return string(r.Condition)
+}
+
+// MarshalYAML makes ServiceRestart implement yaml.Marshaller
+func (r ServiceRestart) MarshalYAML() (interface{}, error) {
+	return r.String(), nil
+}
+
+// MarshalJSON makes ServiceRestart implement json.Marshaler
+func (r ServiceRestart) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+// ServiceLink is a legacy link to a service, or to a container for external links, written as `service` or
+// `service:alias`
+type ServiceLink struct {
+	Service string
+	// Alias is the hostname the service is reached by, if set
+	Alias string
+}
+
+// ParseServiceLink parses a link in the `service` or `service:alias` syntax
+func ParseServiceLink(spec string) (ServiceLink, error) {
+	service, alias := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		service, alias = spec[:i], spec[i+1:]
+		if alias == "" {
+			return ServiceLink{}, errors.Wrapf(errdefs.ErrInvalid, "invalid link %q, alias is empty", spec)
+		}
+	}
+	if service == "" {
+		return ServiceLink{}, errors.Wrapf(errdefs.ErrInvalid, "invalid link %q, service is empty", spec)
+	}
+	return ServiceLink{Service: service, Alias: alias}, nil
+}
+
+// String returns the link in the `service` or `service:alias` syntax
+func (l ServiceLink) String() string {
+	if l.Alias != "" {
+		return l.Service + ":" + l.Alias
+	}
+	return l.Service
+}
+
+// MarshalYAML makes ServiceLink implement yaml.Marshaller
+func (l ServiceLink) MarshalYAML() (interface{}, error) {
+	return l.String(), nil
+}
+
+// MarshalJSON makes ServiceLink implement json.Marshaler
+func (l ServiceLink) MarshalJSON() ([]byte, error) {
+	return json.Marshal(l.String())
+}
+
+const (
+	// VolumesFromService is the kind of the sources of `volumes_from` which are services
+	VolumesFromService = "service"
+	// VolumesFromContainer is the kind of the sources of `volumes_from` which are containers, written with the
+	// `container:` prefix
+	VolumesFromContainer = "container"
 )
 
-// GetDependencies retrieve all services this service depends on
+// VolumesFromSource is a source of the volumes a service mounts with `volumes_from`, written as `service[:mode]` or
+// `container:name[:mode]` where mode is `ro` or `rw`
+type VolumesFromSource struct {
+	// Kind is VolumesFromService or VolumesFromContainer
+	Kind string
+	Name string
+	// ReadOnly mounts the volumes read-only, otherwise they are mounted with the mode set by the source
+	ReadOnly bool
+}
+
+// ParseVolumesFrom parses a source of `volumes_from`
+func ParseVolumesFrom(spec string) (VolumesFromSource, error) {
+	source := VolumesFromSource{Kind: VolumesFromService, Name: spec}
+	if name, ok := containerReference(spec); ok {
+		source.Kind, source.Name = VolumesFromContainer, name
+	}
+	if i := strings.LastIndex(source.Name, ":"); i >= 0 {
+		switch mode := source.Name[i+1:]; mode {
+		case "ro":
+			source.ReadOnly = true
+		case "rw":
+		default:
+			return VolumesFromSource{}, errors.Wrapf(errdefs.ErrInvalid, "invalid volumes_from %q, mode %q must be ro or rw", spec, mode)
+		}
+		source.Name = source.Name[:i]
+	}
+	if source.Name == "" {
+		return VolumesFromSource{}, errors.Wrapf(errdefs.ErrInvalid, "invalid volumes_from %q, %s name is empty", spec, source.Kind)
+	}
+	return source, nil
+}
+
+// String returns the source in the `service[:ro]` or `container:name[:ro]` syntax
+func (v VolumesFromSource) String() string {
+	spec := v.Name
+	if v.Kind == VolumesFromContainer {
+		spec = ContainerPrefix + spec
+	}
+	if v.ReadOnly {
+		spec += ":ro"
+	}
+	return spec
+}
+
+// MarshalYAML makes VolumesFromSource implement yaml.Marshaller
+func (v VolumesFromSource) MarshalYAML() (interface{}, error) {
+	return v.String(), nil
+}
+
+// MarshalJSON makes VolumesFromSource implement json.Marshaler
+func (v VolumesFromSource) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.String())
+}
+
+const (
+	// CgroupHost runs the service containers in the host cgroup namespace
+	CgroupHost = "host"
+	// CgroupPrivate runs the service containers in their own private cgroup namespace
+	CgroupPrivate = "private"
+)
+
+// HasProfile returns true if the service is enabled by the selected profiles.
+// A service without profiles is always enabled, and the "*" profile enables all services
+func (s ServiceConfig) HasProfile(profiles []string) bool {
+	if len(s.Profiles) == 0 {
+		return true
+	}
+	for _, p := range profiles {
+		if p == "*" {
+			return true
+		}
+		for _, sp := range s.Profiles {
+			if sp == p {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NetworksByPriority returns the names of the networks the service is connected to, sorted by descending priority
+// then by name
+func (s ServiceConfig) NetworksByPriority() []string {
+	names := make([]string, 0, len(s.Networks))
+	for name := range s.Networks {
+		names = append(names, name)
+	}
+	priority := func(name string) int {
+		if config := s.Networks[name]; config != nil {
+			return config.Priority
+		}
+		return 0
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if pi, pj := priority(names[i]), priority(names[j]); pi != pj {
+			return pi > pj
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// ConfigHash computes a digest of the service configuration, so that changes can be detected. The digest is a
+// sha256 of the canonical JSON form of the service, with sorted keys and including extensions
+func (s ServiceConfig) ConfigHash() (string, error) {
+	b, err := canonicalJSON(s)
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256(b)
+	return hex.EncodeToString(digest[:]), nil
+}
+
+// canonicalJSON renders a value as JSON with sorted keys. The value is converted through its YAML form as, unlike
+// the JSON one, it includes extensions
+func canonicalJSON(v interface{}) ([]byte, error) {
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	if err := yaml.Unmarshal(b, &generic); err != nil {
+		return nil, err
+	}
+	generic, err = toStringKeys(generic)
+	if err != nil {
+		return nil, err
+	}
+	// encoding/json sorts map keys
+	return json.Marshal(generic)
+}
+
+func toStringKeys(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		dict := make(map[string]interface{}, len(v))
+		for key, entry := range v {
+			converted, err := toStringKeys(entry)
+			if err != nil {
+				return nil, err
+			}
+			dict[fmt.Sprint(key)] = converted
+		}
+		return dict, nil
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, entry := range v {
+			converted, err := toStringKeys(entry)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = converted
+		}
+		return list, nil
+	default:
+		return value, nil
+	}
+}
+
+// DefaultImageNameSeparator separates the project and service names in the default name of the image a service
+// builds
+const DefaultImageNameSeparator = "-"
+
+// ImageName returns the image of the service, defaulting to `<project>-<service>` for a service building one. See
+// ImageNameWithSeparator to use another separator, like the `_` of the legacy docker-compose
+func (s ServiceConfig) ImageName(projectName string) string {
+	return s.ImageNameWithSeparator(projectName, DefaultImageNameSeparator)
+}
+
+// ImageNameWithSeparator returns the image of the service, defaulting to the project and service names joined by
+// separator for a service building one
+func (s ServiceConfig) ImageNameWithSeparator(projectName, separator string) string {
+	if s.Image != "" || s.Build == nil {
+		return s.Image
+	}
+	return strings.ToLower(projectName + separator + s.Name)
+}
+
+// GetScale returns the number of containers to run for the service, set by `deploy.replicas` or the deprecated
+// `scale`, defaulting to 1
+func (s ServiceConfig) GetScale() int {
+	if s.Deploy != nil && s.Deploy.Replicas != nil {
+		return int(*s.Deploy.Replicas)
+	}
+	if s.Scale != 0 {
+		return s.Scale
+	}
+	return 1
+}
+
+// DeepCopy returns a copy of the service sharing no map, slice or pointer with it, so that either can be modified
+// without affecting the other
+func (s *ServiceConfig) DeepCopy() *ServiceConfig {
+	if s == nil {
+		return nil
+	}
+	return deepCopy(reflect.ValueOf(s)).Interface().(*ServiceConfig)
+}
+
+// deepCopy recursively copies the maps, slices, pointers and interfaces of v. Unexported struct fields are copied
+// as is
+func deepCopy(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(deepCopy(v.Elem()))
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(deepCopy(v.Elem()))
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(iter.Key(), deepCopy(iter.Value()))
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i)))
+		}
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if field := c.Field(i); field.CanSet() {
+				field.Set(deepCopy(v.Field(i)))
+			}
+		}
+		return c
+	}
+	return v
+}
+
+// GetDependencies retrieve all services this service depends on, sorted by name
 func (s ServiceConfig) GetDependencies() []string {
 	dependencies := make(set)
 	for dependency := range s.DependsOn {
 		dependencies.append(dependency)
 	}
 	for _, link := range s.Links {
-		parts := strings.Split(link, ":")
-		if len(parts) == 2 {
-			dependencies.append(parts[0])
-		} else {
-			dependencies.append(link)
+		dependencies.append(link.Service)
+	}
+	for _, source := range s.VolumesFrom {
+		if source.Kind == VolumesFromService {
+			dependencies.append(source.Name)
 		}
 	}
-	if strings.HasPrefix(s.NetworkMode, "service:") {
-		dependencies.append(s.NetworkMode[8:])
+	for _, mode := range []string{s.NetworkMode, s.Ipc, s.Pid} {
+		if service, ok := serviceReference(mode); ok {
+			dependencies.append(service)
+		}
 	}
 	return dependencies.toSlice()
 }
 
+const (
+	// ServicePrefix is the prefix of `network_mode`, `ipc` and `pid` values referring to another service
+	ServicePrefix = "service:"
+	// ContainerPrefix is the prefix of `network_mode`, `ipc` and `pid` values referring to a container
+	ContainerPrefix = "container:"
+)
+
+// NetworkModeService returns the service which network stack is shared by `network_mode: service:<name>`
+func (s ServiceConfig) NetworkModeService() (string, bool) {
+	return serviceReference(s.NetworkMode)
+}
+
+// NetworkModeContainer returns the container which network stack is shared by `network_mode: container:<name>`
+func (s ServiceConfig) NetworkModeContainer() (string, bool) {
+	return containerReference(s.NetworkMode)
+}
+
+// IpcService returns the service which IPC namespace is shared by `ipc: service:<name>`
+func (s ServiceConfig) IpcService() (string, bool) {
+	return serviceReference(s.Ipc)
+}
+
+// IpcContainer returns the container which IPC namespace is shared by `ipc: container:<name>`
+func (s ServiceConfig) IpcContainer() (string, bool) {
+	return containerReference(s.Ipc)
+}
+
+// PidService returns the service which PID namespace is shared by `pid: service:<name>`
+func (s ServiceConfig) PidService() (string, bool) {
+	return serviceReference(s.Pid)
+}
+
+// PidContainer returns the container which PID namespace is shared by `pid: container:<name>`
+func (s ServiceConfig) PidContainer() (string, bool) {
+	return containerReference(s.Pid)
+}
+
+func serviceReference(mode string) (string, bool) {
+	if !strings.HasPrefix(mode, ServicePrefix) {
+		return "", false
+	}
+	return mode[len(ServicePrefix):], true
+}
+
+func containerReference(mode string) (string, bool) {
+	if !strings.HasPrefix(mode, ContainerPrefix) {
+		return "", false
+	}
+	return mode[len(ContainerPrefix):], true
+}
+
 type set map[string]struct{}
 
 func (s set) append(strings ...string) {
@@ -212,33 +682,85 @@ func (s set) append(strings ...string) {
 	}
 }
 
+func (s set) has(str string) bool {
+	_, ok := s[str]
+	return ok
+}
+
 func (s set) toSlice() []string {
 	slice := make([]string, 0, len(s))
 	for v := range s {
 		slice = append(slice, v)
 	}
+	sort.Strings(slice)
 	return slice
 }
 
 // BuildConfig is a type for build
 // using the same format at libcompose: https://github.com/docker/libcompose/blob/master/yaml/build.go#L12
 type BuildConfig struct {
-	Context    string            `yaml:",omitempty" json:"context,omitempty"`
-	Dockerfile string            `yaml:",omitempty" json:"dockerfile,omitempty"`
-	Args       MappingWithEquals `yaml:",omitempty" json:"args,omitempty"`
-	Labels     Labels            `yaml:",omitempty" json:"labels,omitempty"`
-	CacheFrom  StringList        `mapstructure:"cache_from" yaml:"cache_from,omitempty" json:"cache_from,omitempty"`
-	ExtraHosts HostsList         `mapstructure:"extra_hosts" yaml:"extra_hosts,omitempty" json:"extra_hosts,omitempty"`
-	Isolation  string            `yaml:",omitempty" json:"isolation,omitempty"`
-	Network    string            `yaml:",omitempty" json:"network,omitempty"`
-	Target     string            `yaml:",omitempty" json:"target,omitempty"`
+	Context            string                    `yaml:",omitempty" json:"context,omitempty"`
+	Dockerfile         string                    `yaml:",omitempty" json:"dockerfile,omitempty"`
+	Args               MappingWithEquals         `yaml:",omitempty" json:"args,omitempty"`
+	SSH                SSHConfig                 `yaml:"ssh,omitempty" json:"ssh,omitempty"`
+	Labels             Labels                    `yaml:",omitempty" json:"labels,omitempty"`
+	CacheFrom          StringList                `mapstructure:"cache_from" yaml:"cache_from,omitempty" json:"cache_from,omitempty"`
+	CacheTo            StringList                `mapstructure:"cache_to" yaml:"cache_to,omitempty" json:"cache_to,omitempty"`
+	NoCache            bool                      `mapstructure:"no_cache" yaml:"no_cache,omitempty" json:"no_cache,omitempty"`
+	AdditionalContexts Mapping                   `mapstructure:"additional_contexts" yaml:"additional_contexts,omitempty" json:"additional_contexts,omitempty"`
+	Pull               bool                      `yaml:",omitempty" json:"pull,omitempty"`
+	ExtraHosts         HostsList                 `mapstructure:"extra_hosts" yaml:"extra_hosts,omitempty" json:"extra_hosts,omitempty"`
+	Isolation          string                    `yaml:",omitempty" json:"isolation,omitempty"`
+	Network            string                    `yaml:",omitempty" json:"network,omitempty"`
+	ShmSize            UnitBytes                 `mapstructure:"shm_size" yaml:"shm_size,omitempty" json:"shm_size,omitempty"`
+	Target             string                    `yaml:",omitempty" json:"target,omitempty"`
+	Secrets            []ServiceSecretConfig     `yaml:",omitempty" json:"secrets,omitempty"`
+	Tags               StringList                `yaml:",omitempty" json:"tags,omitempty"`
+	Platforms          StringList                `yaml:",omitempty" json:"platforms,omitempty"`
+	Ulimits            map[string]*UlimitsConfig `yaml:",omitempty" json:"ulimits,omitempty"`
 
 	Extensions map[string]interface{} `yaml:",inline" json:"-"`
 }
 
-// ShellCommand is a string or list of string args
+// SSHKey is a SSH agent socket or key made available to the build, by id
+type SSHKey struct {
+	ID   string
+	Path string
+}
+
+// SSHConfig is a list of SSH keys
+type SSHConfig []SSHKey
+
+// String returns the `id=path` representation of a SSH key, or just the id when no path is set
+func (s SSHKey) String() string {
+	if s.Path == "" {
+		return s.ID
+	}
+	return fmt.Sprintf("%s=%s", s.ID, s.Path)
+}
+
+// MarshalYAML makes SSHKey implement yaml.Marshaller
+func (s SSHKey) MarshalYAML() (interface{}, error) {
+	return s.String(), nil
+}
+
+// MarshalJSON makes SSHKey implement json.Marshaller
+func (s SSHKey) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// ShellCommand is a string or list of string args.
+//
+// A nil ShellCommand means the command is not set, while an explicitly empty one (`[]` or `""`) is preserved so
+// that it can override a base value, like the image's CMD or ENTRYPOINT. When marshaled to YAML a nil command is
+// omitted and an empty one is serialized as `[]`, the same goes for JSON as ServiceConfig uses `omitzero`.
 type ShellCommand []string
 
+// IsZero makes ShellCommand implement yaml.IsZeroer, and tells `omitzero` JSON fields to only omit a nil command
+func (s ShellCommand) IsZero() bool {
+	return s == nil
+}
+
 // StringList is a type for fields that can be a string or list of strings
 type StringList []string
 
@@ -260,10 +782,43 @@ func (e MappingWithEquals) OverrideBy(other MappingWithEquals) MappingWithEquals
 	return e
 }
 
+// NewMappingWithEquals builds a MappingWithEquals from `key=value` strings. Keys without `=` are left unset
+func NewMappingWithEquals(values []string) MappingWithEquals {
+	mapping := MappingWithEquals{}
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) == 1 {
+			mapping[parts[0]] = nil
+			continue
+		}
+		mapping[parts[0]] = &parts[1]
+	}
+	return mapping
+}
+
+// AsEqualsList returns the mapping as `key=value` strings sorted by key, unset keys being rendered as `key`, which
+// is the list syntax of environment variables
+func (e MappingWithEquals) AsEqualsList() []string {
+	keys := make([]string, 0, len(e))
+	for k := range e {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	values := make([]string, 0, len(e))
+	for _, k := range keys {
+		if v := e[k]; v != nil {
+			values = append(values, k+"="+*v)
+			continue
+		}
+		values = append(values, k)
+	}
+	return values
+}
+
 // Resolve update a MappingWithEquals for keys without value (`key`, but not `key=`)
 func (e MappingWithEquals) Resolve(lookupFn func(string) (string, bool)) MappingWithEquals {
 	for k, v := range e {
-		if v == nil || *v == "" {
+		if v == nil {
 			if value, ok := lookupFn(k); ok {
 				e[k] = &value
 			}
@@ -288,9 +843,11 @@ func (e MappingWithEquals) RemoveEmpty() MappingWithEquals {
 // mapped value is set to an empty string `""`.
 type Mapping map[string]string
 
-// Labels is a mapping type for labels
+// Labels is a mapping type for labels, which can be declared either as a `key: value` mapping or as a list of
+// `key=value` strings. Labels are always marshalled as a mapping, sorted by key
 type Labels map[string]string
 
+// Add sets the value of a label, allocating l if nil, and returns l
 func (l Labels) Add(key, value string) Labels {
 	if l == nil {
 		l = Labels{}
@@ -299,13 +856,131 @@ func (l Labels) Add(key, value string) Labels {
 	return l
 }
 
+// AsList returns the labels as `key=value` strings, sorted by key
+func (l Labels) AsList() []string {
+	keys := make([]string, 0, len(l))
+	for k := range l {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	list := make([]string, 0, len(l))
+	for _, k := range keys {
+		list = append(list, k+"="+l[k])
+	}
+	return list
+}
+
+func (l *Labels) decodeList(list []string) {
+	labels := Labels{}
+	for _, item := range list {
+		k, v := item, ""
+		if i := strings.Index(item, "="); i >= 0 {
+			k, v = item[:i], item[i+1:]
+		}
+		labels[k] = v
+	}
+	*l = labels
+}
+
+// UnmarshalYAML makes Labels implement yaml.Unmarshaler, accepting both the mapping and list forms
+func (l *Labels) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var list []string
+	if err := unmarshal(&list); err == nil {
+		l.decodeList(list)
+		return nil
+	}
+	var m map[string]string
+	if err := unmarshal(&m); err != nil {
+		return err
+	}
+	*l = m
+	return nil
+}
+
+// UnmarshalJSON makes Labels implement json.Unmarshaler, accepting both the mapping and list forms
+func (l *Labels) UnmarshalJSON(data []byte) error {
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		l.decodeList(list)
+		return nil
+	}
+	var m map[string]string
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	*l = m
+	return nil
+}
+
 // MappingWithColon is a mapping type that can be converted from a list of
 // 'key: value' strings
 type MappingWithColon map[string]string
 
-// HostsList is a list of colon-separated host-ip mappings
+// HostsList is a list of `host:ip` mappings, in the format expected by the engine. A host can be mapped to multiple
+// IPs with distinct entries
 type HostsList []string
 
+// HostGateway is the special IP value resolved by the engine to the IP of the host
+const HostGateway = "host-gateway"
+
+// NewHostsList parses `host:ip` or `host=ip` mappings, where IPv6 addresses can be enclosed in brackets like
+// `host:[::1]`, into a HostsList. Exact duplicates are removed
+func NewHostsList(hosts []string) (HostsList, error) {
+	list := HostsList{}
+	seen := map[string]bool{}
+	for _, entry := range hosts {
+		host, ip, err := parseExtraHost(entry)
+		if err != nil {
+			return nil, err
+		}
+		if mapping := host + ":" + ip; !seen[mapping] {
+			seen[mapping] = true
+			list = append(list, mapping)
+		}
+	}
+	return list, nil
+}
+
+func parseExtraHost(entry string) (string, string, error) {
+	sep := strings.IndexAny(entry, "=:")
+	if sep <= 0 {
+		return "", "", errors.Wrapf(errdefs.ErrInvalid, "invalid extra host %q: expected host:ip", entry)
+	}
+	host, ip := entry[:sep], entry[sep+1:]
+	if strings.HasPrefix(ip, "[") && strings.HasSuffix(ip, "]") {
+		ip = ip[1 : len(ip)-1]
+	}
+	if ip != HostGateway && net.ParseIP(ip) == nil {
+		return "", "", errors.Wrapf(errdefs.ErrInvalid, "invalid extra host %q: %q is not a valid IP address", entry, ip)
+	}
+	return host, ip, nil
+}
+
+// Hosts returns the IPs mapped to each host
+func (h HostsList) Hosts() map[string][]string {
+	hosts := map[string][]string{}
+	for _, entry := range h {
+		host, ip, err := parseExtraHost(entry)
+		if err != nil {
+			continue
+		}
+		hosts[host] = append(hosts[host], ip)
+	}
+	return hosts
+}
+
+// AsList returns the mappings in the canonical `host:ip` format, IPv6 addresses not being enclosed in brackets
+func (h HostsList) AsList() []string {
+	list := make([]string, 0, len(h))
+	for _, entry := range h {
+		if host, ip, err := parseExtraHost(entry); err == nil {
+			entry = host + ":" + ip
+		}
+		list = append(list, entry)
+	}
+	return list
+}
+
 // LoggingConfig the logging configuration for a service
 type LoggingConfig struct {
 	Driver  string            `yaml:",omitempty" json:"driver,omitempty"`
@@ -314,6 +989,33 @@ type LoggingConfig struct {
 	Extensions map[string]interface{} `yaml:",inline" json:"-"`
 }
 
+// DevelopConfig the development configuration for a service, used by tools watching the sources of a service
+type DevelopConfig struct {
+	Watch []Trigger `yaml:",omitempty" json:"watch,omitempty"`
+
+	Extensions map[string]interface{} `yaml:",inline" json:"-"`
+}
+
+// WatchAction is the action taken when a watched path is updated
+type WatchAction string
+
+const (
+	// WatchActionSync synchronizes the updated files into the service containers
+	WatchActionSync WatchAction = "sync"
+	// WatchActionRebuild rebuilds the service image and recreates its containers
+	WatchActionRebuild WatchAction = "rebuild"
+	// WatchActionSyncRestart synchronizes the updated files into the service containers, then restarts those
+	WatchActionSyncRestart WatchAction = "sync+restart"
+)
+
+// Trigger is a path to watch, and the action to take when it is updated
+type Trigger struct {
+	Path   string      `yaml:",omitempty" json:"path,omitempty"`
+	Action WatchAction `yaml:",omitempty" json:"action,omitempty"`
+	Target string      `yaml:",omitempty" json:"target,omitempty"`
+	Ignore []string    `yaml:",omitempty" json:"ignore,omitempty"`
+}
+
 // DeployConfig the deployment configuration for a service
 type DeployConfig struct {
 	Mode           string         `yaml:",omitempty" json:"mode,omitempty"`
@@ -342,8 +1044,74 @@ type HealthCheckConfig struct {
 }
 
 // HealthCheckTest is the command run to test the health of a service
+// The first element is the form marker: CMD, CMD-SHELL or NONE
 type HealthCheckTest []string
 
+const (
+	// HealthCheckTestCmd runs the test command as argv
+	HealthCheckTestCmd = "CMD"
+	// HealthCheckTestShell runs the test command with the container's default shell
+	HealthCheckTestShell = "CMD-SHELL"
+	// HealthCheckTestNone disables the healthcheck
+	HealthCheckTestNone = "NONE"
+)
+
+// NewShellTest creates a HealthCheckTest running cmd with the container's default shell
+func NewShellTest(cmd string) HealthCheckTest {
+	return HealthCheckTest{HealthCheckTestShell, cmd}
+}
+
+// NewCmdTest creates a HealthCheckTest running argv
+func NewCmdTest(argv ...string) HealthCheckTest {
+	return append(HealthCheckTest{HealthCheckTestCmd}, argv...)
+}
+
+// IsShellForm returns true if the test command is run with the container's default shell
+func (t HealthCheckTest) IsShellForm() bool {
+	return len(t) > 0 && t[0] == HealthCheckTestShell
+}
+
+// Command returns the test command, without the form marker
+func (t HealthCheckTest) Command() []string {
+	if len(t) < 2 {
+		return nil
+	}
+	return t[1:]
+}
+
+// ShellCommand returns the command run by the shell, if the test uses the shell form
+func (t HealthCheckTest) ShellCommand() (string, bool) {
+	if !t.IsShellForm() {
+		return "", false
+	}
+	return strings.Join(t.Command(), " "), true
+}
+
+// Validate checks the test command has a valid form marker and payload
+func (t HealthCheckTest) Validate() error {
+	if len(t) == 0 {
+		return nil
+	}
+	switch t[0] {
+	case HealthCheckTestNone:
+		if len(t) > 1 {
+			return errors.Wrapf(errdefs.ErrInvalid, "healthcheck test %s doesn't accept a command", HealthCheckTestNone)
+		}
+	case HealthCheckTestShell:
+		if len(t) != 2 || strings.TrimSpace(t[1]) == "" {
+			return errors.Wrapf(errdefs.ErrInvalid, "healthcheck test %s requires a single non-empty command", HealthCheckTestShell)
+		}
+	case HealthCheckTestCmd:
+		if len(t) < 2 || t[1] == "" {
+			return errors.Wrapf(errdefs.ErrInvalid, "healthcheck test %s requires a non-empty command", HealthCheckTestCmd)
+		}
+	default:
+		return errors.Wrapf(errdefs.ErrInvalid, "healthcheck test must start with %s, %s or %s, got %q",
+			HealthCheckTestCmd, HealthCheckTestShell, HealthCheckTestNone, t[0])
+	}
+	return nil
+}
+
 // UpdateConfig the service update configuration
 type UpdateConfig struct {
 	Parallelism     *uint64  `yaml:",omitempty" json:"parallelism,omitempty"`
@@ -414,6 +1182,14 @@ func (u UnitBytes) MarshalJSON() ([]byte, error) {
 	return []byte(fmt.Sprintf(`"%d"`, u)), nil
 }
 
+// Microseconds is a duration expressed in microseconds, set either as an integer or as a duration string like `10ms`
+type Microseconds int64
+
+// Duration returns m as a time.Duration
+func (m Microseconds) Duration() time.Duration {
+	return time.Duration(m) * time.Microsecond
+}
+
 // RestartPolicy the service restart policy
 type RestartPolicy struct {
 	Condition   string    `yaml:",omitempty" json:"condition,omitempty"`
@@ -442,24 +1218,161 @@ type PlacementPreferences struct {
 
 // ServiceNetworkConfig is the network configuration for a service
 type ServiceNetworkConfig struct {
-	Aliases     []string `yaml:",omitempty" json:"aliases,omitempty"`
-	Ipv4Address string   `mapstructure:"ipv4_address" yaml:"ipv4_address,omitempty" json:"ipv4_address,omitempty"`
-	Ipv6Address string   `mapstructure:"ipv6_address" yaml:"ipv6_address,omitempty" json:"ipv6_address,omitempty"`
+	Priority     int      `yaml:",omitempty" json:"priority,omitempty"`
+	Aliases      []string `yaml:",omitempty" json:"aliases,omitempty"`
+	Ipv4Address  string   `mapstructure:"ipv4_address" yaml:"ipv4_address,omitempty" json:"ipv4_address,omitempty"`
+	Ipv6Address  string   `mapstructure:"ipv6_address" yaml:"ipv6_address,omitempty" json:"ipv6_address,omitempty"`
+	LinkLocalIPs []string `mapstructure:"link_local_ips" yaml:"link_local_ips,omitempty" json:"link_local_ips,omitempty"`
+
+	Extensions map[string]interface{} `yaml:",inline" json:"-"`
+}
+
+// ServiceDeviceConfig is a host device exposed to the service containers
+type ServiceDeviceConfig struct {
+	Source      string `yaml:"source,omitempty" json:"source,omitempty"`
+	Target      string `yaml:"target,omitempty" json:"target,omitempty"`
+	Permissions string `yaml:"permissions,omitempty" json:"permissions,omitempty"`
 
 	Extensions map[string]interface{} `yaml:",inline" json:"-"`
 }
 
+// DefaultDevicePermissions are the cgroup permissions granted on a device which doesn't set any
+const DefaultDevicePermissions = "rwm"
+
+// ParseDevice parses a device in the short `source[:target][:permissions]` syntax
+func ParseDevice(spec string) (ServiceDeviceConfig, error) {
+	device := ServiceDeviceConfig{Permissions: DefaultDevicePermissions}
+	parts := strings.Split(spec, ":")
+	switch len(parts) {
+	case 1:
+		device.Source = parts[0]
+	case 2:
+		device.Source = parts[0]
+		if ValidDevicePermissions(parts[1]) {
+			device.Permissions = parts[1]
+		} else {
+			device.Target = parts[1]
+		}
+	case 3:
+		device.Source, device.Target, device.Permissions = parts[0], parts[1], parts[2]
+	default:
+		return device, errors.Errorf("invalid device specification: %s", spec)
+	}
+	if device.Source == "" {
+		return device, errors.Errorf("invalid device specification: %s", spec)
+	}
+	if device.Target == "" {
+		device.Target = device.Source
+	}
+	return device, nil
+}
+
+// ValidDevicePermissions tells if permissions is a combination of `r` (read), `w` (write) and `m` (mknod)
+func ValidDevicePermissions(permissions string) bool {
+	if permissions == "" || len(permissions) > 3 {
+		return false
+	}
+	seen := map[rune]bool{}
+	for _, c := range permissions {
+		if (c != 'r' && c != 'w' && c != 'm') || seen[c] {
+			return false
+		}
+		seen[c] = true
+	}
+	return true
+}
+
 // ServicePortConfig is the port configuration for a service
 type ServicePortConfig struct {
-	Mode      string `yaml:",omitempty" json:"mode,omitempty"`
-	HostIP    string `yaml:"-" json:"-"`
-	Target    uint32 `yaml:",omitempty" json:"target,omitempty"`
-	Published uint32 `yaml:",omitempty" json:"published,omitempty"`
+	Mode   string `yaml:",omitempty" json:"mode,omitempty"`
+	HostIP string `mapstructure:"host_ip" yaml:"host_ip,omitempty" json:"host_ip,omitempty"`
+	Target uint32 `yaml:",omitempty" json:"target,omitempty"`
+	// Published is the host port, or a range of host ports (`start-end`) one is picked from. The host port is
+	// picked by the engine when empty or set to "0"
+	Published string `yaml:",omitempty" json:"published,omitempty"`
 	Protocol  string `yaml:",omitempty" json:"protocol,omitempty"`
 
 	Extensions map[string]interface{} `yaml:",inline" json:"-"`
 }
 
+// marshaledPort is ServicePortConfig as marshaled, with a published port rendered as a number unless it is a range,
+// so that the marshaled model and the configuration hash are the same as with a numeric published port
+type marshaledPort struct {
+	Mode      string      `yaml:",omitempty" json:"mode,omitempty"`
+	HostIP    string      `yaml:"host_ip,omitempty" json:"host_ip,omitempty"`
+	Target    uint32      `yaml:",omitempty" json:"target,omitempty"`
+	Published interface{} `yaml:",omitempty" json:"published,omitempty"`
+	Protocol  string      `yaml:",omitempty" json:"protocol,omitempty"`
+
+	Extensions map[string]interface{} `yaml:",inline" json:"-"`
+}
+
+func (p ServicePortConfig) marshaled() marshaledPort {
+	m := marshaledPort{
+		Mode:       p.Mode,
+		HostIP:     p.HostIP,
+		Target:     p.Target,
+		Protocol:   p.Protocol,
+		Extensions: p.Extensions,
+	}
+	if port, err := strconv.ParseUint(p.Published, 10, 16); err == nil {
+		if port != 0 {
+			m.Published = port
+		}
+	} else if p.Published != "" {
+		m.Published = p.Published
+	}
+	return m
+}
+
+// MarshalYAML makes ServicePortConfig implement yaml.Marshaller
+func (p ServicePortConfig) MarshalYAML() (interface{}, error) {
+	return p.marshaled(), nil
+}
+
+// MarshalJSON makes ServicePortConfig implement json.Marshaler
+func (p ServicePortConfig) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.marshaled())
+}
+
+// IsEphemeral returns true if the host port is picked by the engine
+func (p ServicePortConfig) IsEphemeral() bool {
+	return p.Published == "" || p.Published == "0"
+}
+
+// String returns the port in the short syntax, `[host_ip:][published:]target[/protocol]`, the tcp protocol being
+// omitted. Parsing the result with ParsePortConfig gives the port back, but for its mode and extensions
+func (p ServicePortConfig) String() string {
+	var sb strings.Builder
+	if p.HostIP != "" {
+		if strings.Contains(p.HostIP, ":") {
+			sb.WriteString("[" + p.HostIP + "]:")
+		} else {
+			sb.WriteString(p.HostIP + ":")
+		}
+	}
+	if p.Published != "" || p.HostIP != "" {
+		sb.WriteString(p.Published + ":")
+	}
+	sb.WriteString(strconv.FormatUint(uint64(p.Target), 10))
+	if p.Protocol != "" && p.Protocol != "tcp" {
+		sb.WriteString("/" + p.Protocol)
+	}
+	return sb.String()
+}
+
+// ValidatePublished checks the published port is empty, a port number or a range of port numbers
+func (p ServicePortConfig) ValidatePublished() error {
+	if p.Published == "" {
+		return nil
+	}
+	start, end, err := nat.ParsePortRange(p.Published)
+	if err != nil || start > end {
+		return errors.Wrapf(errdefs.ErrInvalid, "invalid published port %q", p.Published)
+	}
+	return nil
+}
+
 // ParsePortConfig parse short syntax for service port configuration
 func ParsePortConfig(value string) ([]ServicePortConfig, error) {
 	var portConfigs []ServicePortConfig
@@ -494,15 +1407,18 @@ func convertPortToPortConfig(port nat.Port, portBindings map[nat.Port][]nat.Port
 			return nil, fmt.Errorf("invalid hostport binding (%s) for port (%s)", binding.HostPort, port.Port())
 		}
 
-		for i := startHostPort; i <= endHostPort; i++ {
-			portConfigs = append(portConfigs, ServicePortConfig{
-				HostIP:    binding.HostIP,
-				Protocol:  strings.ToLower(port.Proto()),
-				Target:    uint32(port.Int()),
-				Published: uint32(i),
-				Mode:      "ingress",
-			})
+		if err == nil && startHostPort > endHostPort {
+			return nil, fmt.Errorf("invalid hostport binding (%s) for port (%s)", binding.HostPort, port.Port())
 		}
+
+		// a range of host ports bound to a single container port is kept as is, the engine picks one of those
+		portConfigs = append(portConfigs, ServicePortConfig{
+			HostIP:    binding.HostIP,
+			Protocol:  strings.ToLower(port.Proto()),
+			Target:    uint32(port.Int()),
+			Published: binding.HostPort,
+			Mode:      "ingress",
+		})
 	}
 	return portConfigs, nil
 }
@@ -532,9 +1448,77 @@ const (
 	VolumeTypeNamedPipe = "npipe"
 )
 
+// ShortString returns the volume in the short syntax, `[source:]target[:options]`, with the options in a canonical
+// order. An error is returned when some attributes of the volume can't be represented in the short syntax, like
+// tmpfs mounts, anonymous volumes with options or extensions. Short syntax bind mounts create their missing host
+// path, create_host_path is not represented
+func (v ServiceVolumeConfig) ShortString() (string, error) {
+	invalid := func(reason string) (string, error) {
+		return "", errors.Wrapf(errdefs.ErrInvalid, "volume %q can't be represented in the short syntax: %s", v.Target, reason)
+	}
+	switch {
+	case v.Type != VolumeTypeBind && v.Type != VolumeTypeVolume:
+		return invalid(fmt.Sprintf("type %s", v.Type))
+	case v.Target == "":
+		return invalid("no target")
+	case v.Tmpfs != nil:
+		return invalid("tmpfs options are set")
+	case len(v.Extensions) > 0 || v.Bind != nil && len(v.Bind.Extensions) > 0 || v.Volume != nil && len(v.Volume.Extensions) > 0:
+		return invalid("extensions are set")
+	case v.Type == VolumeTypeBind && !isHostPath(v.Source):
+		return invalid(fmt.Sprintf("bind source %q is not a path", v.Source))
+	case v.Type == VolumeTypeVolume && v.Source != "" && isHostPath(v.Source):
+		return invalid(fmt.Sprintf("volume source %q is a path", v.Source))
+	}
+
+	var options []string
+	if v.ReadOnly {
+		options = append(options, "ro")
+	}
+	if v.Consistency != "" {
+		options = append(options, v.Consistency)
+	}
+	if v.Bind != nil {
+		if v.Bind.SELinux != "" {
+			options = append(options, v.Bind.SELinux)
+		}
+		if v.Bind.Propagation != "" {
+			options = append(options, v.Bind.Propagation)
+		}
+	}
+	if v.Volume != nil && v.Volume.NoCopy {
+		options = append(options, "nocopy")
+	}
+
+	if v.Source == "" {
+		if len(options) > 0 {
+			return invalid("anonymous volumes have no options")
+		}
+		return v.Target, nil
+	}
+	spec := v.Source + ":" + v.Target
+	if len(options) > 0 {
+		spec += ":" + strings.Join(options, ",")
+	}
+	return spec, nil
+}
+
+// isHostPath tells if the source of a short syntax volume is a host path, which makes it a bind mount
+func isHostPath(source string) bool {
+	switch {
+	case source == "":
+		return false
+	case strings.ContainsAny(source[:1], "./~"), strings.HasPrefix(source, `\\`):
+		return true
+	}
+	return len(source) > 1 && source[1] == ':' && unicode.IsLetter(rune(source[0]))
+}
+
 // ServiceVolumeBind are options for a service volume of type bind
 type ServiceVolumeBind struct {
-	Propagation string `yaml:",omitempty" json:"propagation,omitempty"`
+	SELinux        string `mapstructure:"selinux" yaml:"selinux,omitempty" json:"selinux,omitempty"`
+	Propagation    string `yaml:",omitempty" json:"propagation,omitempty"`
+	CreateHostPath bool   `mapstructure:"create_host_path" yaml:"create_host_path,omitempty" json:"create_host_path,omitempty"`
 
 	Extensions map[string]interface{} `yaml:",inline" json:"-"`
 }
@@ -555,6 +1539,14 @@ const (
 	PropagationSlave string = "slave"
 )
 
+// SELinux represents the SELinux re-labeling of a mount.
+const (
+	// SELinuxShared share the volume content with other containers
+	SELinuxShared string = "z"
+	// SELinuxPrivate label the volume content as private to the container
+	SELinuxPrivate string = "Z"
+)
+
 // ServiceVolumeVolume are options for a service volume of type volume
 type ServiceVolumeVolume struct {
 	NoCopy bool `mapstructure:"nocopy" yaml:"nocopy,omitempty" json:"nocopy,omitempty"`
@@ -562,9 +1554,46 @@ type ServiceVolumeVolume struct {
 	Extensions map[string]interface{} `yaml:",inline" json:"-"`
 }
 
+// TmpfsMount is a tmpfs mount declared by the `tmpfs` attribute of a service, as `target[:options]`
+type TmpfsMount struct {
+	Target string
+	// Size is the size limit set by the `size` option, if any
+	Size UnitBytes
+	// Options are the mount options as written but for `size`, like `mode=1777` or `noexec`
+	Options []string
+}
+
+// ParseTmpfs parses a tmpfs mount in the `target[:options]` syntax, options being comma separated
+func ParseTmpfs(spec string) (TmpfsMount, error) {
+	target, options := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		target, options = spec[:i], spec[i+1:]
+	}
+	mount := TmpfsMount{Target: target}
+	if target == "" {
+		return mount, errors.Wrapf(errdefs.ErrInvalid, "invalid tmpfs %q: a target is required", spec)
+	}
+	if options == "" {
+		return mount, nil
+	}
+	for _, option := range strings.Split(options, ",") {
+		if size := strings.TrimPrefix(option, "size="); size != option {
+			bytes, err := units.RAMInBytes(size)
+			if err != nil {
+				return mount, errors.Wrapf(errdefs.ErrInvalid, "invalid tmpfs %q: %s", spec, err)
+			}
+			mount.Size = UnitBytes(bytes)
+			continue
+		}
+		mount.Options = append(mount.Options, option)
+	}
+	return mount, nil
+}
+
 // ServiceVolumeTmpfs are options for a service volume of type tmpfs
 type ServiceVolumeTmpfs struct {
-	Size int64 `yaml:",omitempty" json:"size,omitempty"`
+	Size int64  `yaml:",omitempty" json:"size,omitempty"`
+	Mode uint32 `yaml:",omitempty" json:"mode,omitempty"`
 
 	Extensions map[string]interface{} `yaml:",inline" json:"-"`
 }
@@ -586,6 +1615,28 @@ type ServiceConfigObjConfig FileReferenceConfig
 // ServiceSecretConfig is the secret configuration for a service
 type ServiceSecretConfig FileReferenceConfig
 
+// BlkioConfig the block IO configuration
+type BlkioConfig struct {
+	Weight          uint16           `yaml:",omitempty" json:"weight,omitempty"`
+	WeightDevice    []WeightDevice   `mapstructure:"weight_device" yaml:"weight_device,omitempty" json:"weight_device,omitempty"`
+	DeviceReadBps   []ThrottleDevice `mapstructure:"device_read_bps" yaml:"device_read_bps,omitempty" json:"device_read_bps,omitempty"`
+	DeviceReadIOps  []ThrottleDevice `mapstructure:"device_read_iops" yaml:"device_read_iops,omitempty" json:"device_read_iops,omitempty"`
+	DeviceWriteBps  []ThrottleDevice `mapstructure:"device_write_bps" yaml:"device_write_bps,omitempty" json:"device_write_bps,omitempty"`
+	DeviceWriteIOps []ThrottleDevice `mapstructure:"device_write_iops" yaml:"device_write_iops,omitempty" json:"device_write_iops,omitempty"`
+}
+
+// WeightDevice is the relative weight of the block IO to a device
+type WeightDevice struct {
+	Path   string `yaml:",omitempty" json:"path,omitempty"`
+	Weight uint16 `yaml:",omitempty" json:"weight,omitempty"`
+}
+
+// ThrottleDevice is the limit of the rate of block IO to a device, in bytes or operations per second
+type ThrottleDevice struct {
+	Path string    `yaml:",omitempty" json:"path,omitempty"`
+	Rate UnitBytes `yaml:",omitempty" json:"rate,omitempty"`
+}
+
 // UlimitsConfig the ulimit configuration
 type UlimitsConfig struct {
 	Single int `yaml:",omitempty" json:"single,omitempty"`
@@ -612,6 +1663,47 @@ func (u *UlimitsConfig) MarshalJSON() ([]byte, error) {
 	return json.Marshal(*u)
 }
 
+// UnmarshalYAML makes UlimitsConfig implement yaml.Unmarshaler, accepting both the integer and soft/hard forms
+func (u *UlimitsConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var single int
+	if err := unmarshal(&single); err == nil {
+		*u = UlimitsConfig{Single: single}
+		return nil
+	}
+	// Use a type without methods to avoid re-entering this method
+	type limits UlimitsConfig
+	var l limits
+	if err := unmarshal(&l); err != nil {
+		return err
+	}
+	*u = UlimitsConfig(l)
+	return nil
+}
+
+// UnmarshalJSON makes UlimitsConfig implement json.Unmarshaler, accepting both the integer and soft/hard forms
+func (u *UlimitsConfig) UnmarshalJSON(data []byte) error {
+	var single int
+	if err := json.Unmarshal(data, &single); err == nil {
+		*u = UlimitsConfig{Single: single}
+		return nil
+	}
+	type limits UlimitsConfig
+	var l limits
+	if err := json.Unmarshal(data, &l); err != nil {
+		return err
+	}
+	*u = UlimitsConfig(l)
+	return nil
+}
+
+// Validate checks the soft limit doesn't exceed the hard one
+func (u UlimitsConfig) Validate() error {
+	if u.Single == 0 && u.Soft > u.Hard {
+		return errors.Wrapf(errdefs.ErrInvalid, "soft limit %d is greater than hard limit %d", u.Soft, u.Hard)
+	}
+	return nil
+}
+
 // NetworkConfig for a network
 type NetworkConfig struct {
 	Name       string                 `yaml:",omitempty" json:"name,omitempty"`
@@ -620,6 +1712,7 @@ type NetworkConfig struct {
 	Ipam       IPAMConfig             `yaml:",omitempty" json:"ipam,omitempty"`
 	External   External               `yaml:",omitempty" json:"external,omitempty"`
 	Internal   bool                   `yaml:",omitempty" json:"internal,omitempty"`
+	EnableIPv6 bool                   `mapstructure:"enable_ipv6" yaml:"enable_ipv6,omitempty" json:"enable_ipv6,omitempty"`
 	Attachable bool                   `yaml:",omitempty" json:"attachable,omitempty"`
 	Labels     Labels                 `yaml:",omitempty" json:"labels,omitempty"`
 	Extensions map[string]interface{} `yaml:",inline" json:"-"`
@@ -676,6 +1769,29 @@ func (e External) MarshalJSON() ([]byte, error) {
 	return []byte(fmt.Sprintf(`{"name": %q}`, e.Name)), nil
 }
 
+// NormalizeCapability returns the canonical form of a Linux capability name, uppercase and without the optional
+// `CAP_` prefix, so that `sys_admin` and `CAP_SYS_ADMIN` compare equal
+func NormalizeCapability(capability string) string {
+	return strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(capability)), "CAP_")
+}
+
+// NormalizeCapabilities returns the canonical form of capabilities, without duplicates, in order of first occurrence
+func NormalizeCapabilities(capabilities []string) []string {
+	if capabilities == nil {
+		return nil
+	}
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, capability := range capabilities {
+		capability = NormalizeCapability(capability)
+		if !seen[capability] {
+			seen[capability] = true
+			normalized = append(normalized, capability)
+		}
+	}
+	return normalized
+}
+
 // CredentialSpecConfig for credential spec on Windows
 type CredentialSpecConfig struct {
 	Config     string                 `yaml:",omitempty" json:"config,omitempty"` // Config was added in API v1.40
@@ -688,6 +1804,7 @@ type CredentialSpecConfig struct {
 type FileObjectConfig struct {
 	Name           string                 `yaml:",omitempty" json:"name,omitempty"`
 	File           string                 `yaml:",omitempty" json:"file,omitempty"`
+	Environment    string                 `yaml:",omitempty" json:"environment,omitempty"`
 	External       External               `yaml:",omitempty" json:"external,omitempty"`
 	Labels         Labels                 `yaml:",omitempty" json:"labels,omitempty"`
 	Driver         string                 `yaml:",omitempty" json:"driver,omitempty"`
@@ -704,12 +1821,20 @@ const (
 	// TypeServiceConditionHealthy is the type for waiting until a service has
 	// started.
 	ServiceConditionStarted = "service_started"
+
+	// ServiceConditionCompletedSuccessfully is the type for waiting until a
+	// service has completed successfully (exit code 0).
+	ServiceConditionCompletedSuccessfully = "service_completed_successfully"
 )
 
+// DependsOnConfig is the services a service depends on, by name
 type DependsOnConfig map[string]ServiceDependency
 
+// ServiceDependency is the condition to wait for on a service dependency, and whether the dependent service has to
+// be restarted when the dependency is updated
 type ServiceDependency struct {
 	Condition  string                 `yaml:",omitempty" json:"condition,omitempty"`
+	Restart    bool                   `yaml:",omitempty" json:"restart,omitempty"`
 	Extensions map[string]interface{} `yaml:",inline" json:"-"`
 }
 
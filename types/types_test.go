@@ -17,8 +17,12 @@
 package types
 
 import (
+	"encoding/json"
+	"strings"
 	"testing"
 
+	"github.com/compose-spec/compose-go/errdefs"
+	"gopkg.in/yaml.v2"
 	"gotest.tools/v3/assert"
 	is "gotest.tools/v3/assert/cmp"
 )
@@ -45,7 +49,7 @@ func TestParsePortConfig(t *testing.T) {
 				{
 					Protocol:  "tcp",
 					Target:    8080,
-					Published: 80,
+					Published: "80",
 					Mode:      "ingress",
 				},
 			},
@@ -56,7 +60,7 @@ func TestParsePortConfig(t *testing.T) {
 				{
 					Protocol:  "tcp",
 					Target:    80,
-					Published: 8080,
+					Published: "8080",
 					Mode:      "ingress",
 				},
 			},
@@ -67,7 +71,7 @@ func TestParsePortConfig(t *testing.T) {
 				{
 					Protocol:  "udp",
 					Target:    8080,
-					Published: 80,
+					Published: "80",
 					Mode:      "ingress",
 				},
 			},
@@ -78,13 +82,13 @@ func TestParsePortConfig(t *testing.T) {
 				{
 					Protocol:  "tcp",
 					Target:    8080,
-					Published: 80,
+					Published: "80",
 					Mode:      "ingress",
 				},
 				{
 					Protocol:  "tcp",
 					Target:    8081,
-					Published: 81,
+					Published: "81",
 					Mode:      "ingress",
 				},
 			},
@@ -95,19 +99,19 @@ func TestParsePortConfig(t *testing.T) {
 				{
 					Protocol:  "udp",
 					Target:    8080,
-					Published: 80,
+					Published: "80",
 					Mode:      "ingress",
 				},
 				{
 					Protocol:  "udp",
 					Target:    8081,
-					Published: 81,
+					Published: "81",
 					Mode:      "ingress",
 				},
 				{
 					Protocol:  "udp",
 					Target:    8082,
-					Published: 82,
+					Published: "82",
 					Mode:      "ingress",
 				},
 			},
@@ -118,19 +122,7 @@ func TestParsePortConfig(t *testing.T) {
 				{
 					Protocol:  "udp",
 					Target:    8080,
-					Published: 80,
-					Mode:      "ingress",
-				},
-				{
-					Protocol:  "udp",
-					Target:    8080,
-					Published: 81,
-					Mode:      "ingress",
-				},
-				{
-					Protocol:  "udp",
-					Target:    8080,
-					Published: 82,
+					Published: "80-82",
 					Mode:      "ingress",
 				},
 			},
@@ -141,7 +133,7 @@ func TestParsePortConfig(t *testing.T) {
 				{
 					Protocol:  "tcp",
 					Target:    8080,
-					Published: 80,
+					Published: "80",
 					Mode:      "ingress",
 				},
 			},
@@ -173,7 +165,7 @@ func TestParsePortConfig(t *testing.T) {
 					HostIP:    "1.1.1.1",
 					Protocol:  "tcp",
 					Target:    80,
-					Published: 80,
+					Published: "80",
 					Mode:      "ingress",
 				},
 			},
@@ -214,3 +206,527 @@ func TestSet(t *testing.T) {
 	s.append("two")
 	assert.Equal(t, len(s.toSlice()), 3)
 }
+
+func TestGetDependencies(t *testing.T) {
+	s := ServiceConfig{
+		DependsOn: DependsOnConfig{
+			"db":    {Condition: ServiceConditionHealthy},
+			"cache": {Condition: ServiceConditionStarted},
+		},
+		Links:       []ServiceLink{{Service: "search", Alias: "elastic"}, {Service: "auth"}},
+		NetworkMode: "service:vpn",
+	}
+	assert.DeepEqual(t, s.GetDependencies(), []string{"auth", "cache", "db", "search", "vpn"})
+
+	s = ServiceConfig{Ipc: "service:shm", Pid: "service:monitor", NetworkMode: "host"}
+	assert.DeepEqual(t, s.GetDependencies(), []string{"monitor", "shm"})
+}
+
+func TestNamespaceReferences(t *testing.T) {
+	s := ServiceConfig{NetworkMode: "service:vpn", Ipc: "container:abc", Pid: "host"}
+	service, ok := s.NetworkModeService()
+	assert.Check(t, ok)
+	assert.Equal(t, service, "vpn")
+	_, ok = s.NetworkModeContainer()
+	assert.Check(t, !ok)
+
+	container, ok := s.IpcContainer()
+	assert.Check(t, ok)
+	assert.Equal(t, container, "abc")
+	_, ok = s.IpcService()
+	assert.Check(t, !ok)
+
+	_, ok = s.PidService()
+	assert.Check(t, !ok)
+	_, ok = s.PidContainer()
+	assert.Check(t, !ok)
+}
+
+func TestHealthCheckTestForms(t *testing.T) {
+	shell := NewShellTest("curl -f http://localhost")
+	assert.DeepEqual(t, shell, HealthCheckTest{"CMD-SHELL", "curl -f http://localhost"})
+	assert.Check(t, shell.IsShellForm())
+	cmd, ok := shell.ShellCommand()
+	assert.Check(t, ok)
+	assert.Equal(t, cmd, "curl -f http://localhost")
+	assert.DeepEqual(t, shell.Command(), []string{"curl -f http://localhost"})
+	assert.NilError(t, shell.Validate())
+
+	argv := NewCmdTest("curl", "-f", "http://localhost")
+	assert.DeepEqual(t, argv, HealthCheckTest{"CMD", "curl", "-f", "http://localhost"})
+	assert.Check(t, !argv.IsShellForm())
+	_, ok = argv.ShellCommand()
+	assert.Check(t, !ok)
+	assert.DeepEqual(t, argv.Command(), []string{"curl", "-f", "http://localhost"})
+	assert.NilError(t, argv.Validate())
+
+	none := HealthCheckTest{"NONE"}
+	assert.Check(t, none.Command() == nil)
+	assert.NilError(t, none.Validate())
+}
+
+func TestHealthCheckTestValidate(t *testing.T) {
+	for _, test := range []struct {
+		test     HealthCheckTest
+		expected string
+	}{
+		{test: HealthCheckTest{"curl", "-f"}, expected: `healthcheck test must start with CMD, CMD-SHELL or NONE, got "curl"`},
+		{test: HealthCheckTest{"CMD"}, expected: "healthcheck test CMD requires a non-empty command"},
+		{test: NewShellTest(" "), expected: "healthcheck test CMD-SHELL requires a single non-empty command"},
+		{test: HealthCheckTest{"CMD-SHELL", "echo", "ok"}, expected: "healthcheck test CMD-SHELL requires a single non-empty command"},
+		{test: HealthCheckTest{"NONE", "true"}, expected: "healthcheck test NONE doesn't accept a command"},
+	} {
+		err := test.test.Validate()
+		assert.Check(t, errdefs.IsInvalidError(err))
+		assert.ErrorContains(t, err, test.expected)
+	}
+}
+
+func TestNetworksByPriority(t *testing.T) {
+	s := ServiceConfig{
+		Networks: map[string]*ServiceNetworkConfig{
+			"default":  nil,
+			"backend":  {Priority: 10},
+			"frontend": {Priority: 100},
+			"admin":    {Priority: 10},
+		},
+	}
+	assert.DeepEqual(t, s.NetworksByPriority(), []string{"frontend", "admin", "backend", "default"})
+}
+
+func hashedService() ServiceConfig {
+	foo := "foo"
+	return ServiceConfig{
+		Name:        "web",
+		Image:       "nginx:1.21",
+		Command:     ShellCommand{"nginx", "-g", "daemon off;"},
+		Environment: MappingWithEquals{"FOO": &foo, "BAR": nil, "ZOT": &foo},
+		Labels:      Labels{"com.example.b": "b", "com.example.a": "a", "com.example.c": "c"},
+		Ports:       []ServicePortConfig{{Target: 80, Published: "8080", Protocol: "tcp", Mode: "ingress"}},
+		Networks: map[string]*ServiceNetworkConfig{
+			"front": {Aliases: []string{"www"}},
+			"back":  nil,
+		},
+		Extensions: map[string]interface{}{
+			"x-zot": map[string]interface{}{"b": 2, "a": []interface{}{"x", "y"}},
+			"x-bar": true,
+		},
+	}
+}
+
+func TestServiceConfigHash(t *testing.T) {
+	hash, err := hashedService().ConfigHash()
+	assert.NilError(t, err)
+	// this golden value must not change, implementations rely on it to detect configuration drift
+	assert.Equal(t, hash, "984503cad2b77199105f5d80632713d5b3832f3b42fbce642dc195086bce0ae0")
+
+	for i := 0; i < 20; i++ {
+		again, err := hashedService().ConfigHash()
+		assert.NilError(t, err)
+		assert.Equal(t, again, hash)
+	}
+
+	changed := hashedService()
+	changed.Extensions["x-bar"] = false
+	other, err := changed.ConfigHash()
+	assert.NilError(t, err)
+	assert.Check(t, other != hash)
+}
+
+func TestUlimitsConfigRoundTrip(t *testing.T) {
+	ulimits := map[string]*UlimitsConfig{
+		"nproc":  {Single: 65535},
+		"nofile": {Soft: 20000, Hard: 40000},
+	}
+
+	b, err := yaml.Marshal(ulimits)
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), "nofile:\n  soft: 20000\n  hard: 40000\nnproc: 65535\n")
+	var fromYAML map[string]*UlimitsConfig
+	assert.NilError(t, yaml.Unmarshal(b, &fromYAML))
+	assert.DeepEqual(t, fromYAML, ulimits)
+
+	b, err = json.Marshal(ulimits)
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), `{"nofile":{"soft":20000,"hard":40000},"nproc":65535}`)
+	var fromJSON map[string]*UlimitsConfig
+	assert.NilError(t, json.Unmarshal(b, &fromJSON))
+	assert.DeepEqual(t, fromJSON, ulimits)
+}
+
+func TestMarshalShellCommand(t *testing.T) {
+	type wrapper struct {
+		Command ShellCommand `yaml:",omitempty" json:"command"`
+	}
+	for _, tc := range []struct {
+		command      ShellCommand
+		expectedYAML string
+		expectedJSON string
+	}{
+		{command: nil, expectedYAML: "{}\n", expectedJSON: `{}`},
+		{command: ShellCommand{}, expectedYAML: "command: []\n", expectedJSON: `{"command":[],"entrypoint":[]}`},
+		{command: ShellCommand{"echo", "hello world"}, expectedYAML: "command:\n- echo\n- hello world\n", expectedJSON: `{"command":["echo","hello world"],"entrypoint":["echo","hello world"]}`},
+	} {
+		b, err := yaml.Marshal(wrapper{Command: tc.command})
+		assert.NilError(t, err)
+		assert.Equal(t, string(b), tc.expectedYAML)
+		b, err = json.Marshal(ServiceConfig{Command: tc.command, Entrypoint: tc.command})
+		assert.NilError(t, err)
+		assert.Equal(t, string(b), tc.expectedJSON)
+	}
+}
+
+func TestParsePlatform(t *testing.T) {
+	for specifier, expected := range map[string]Platform{
+		"linux":          {OS: "linux"},
+		"Linux/x86_64":   {OS: "linux", Architecture: "amd64"},
+		"linux/amd64/v1": {OS: "linux", Architecture: "amd64"},
+		"linux/aarch64":  {OS: "linux", Architecture: "arm64"},
+		"linux/arm64/v8": {OS: "linux", Architecture: "arm64"},
+		"linux/arm":      {OS: "linux", Architecture: "arm", Variant: "v7"},
+		"linux/armhf":    {OS: "linux", Architecture: "arm", Variant: "v7"},
+		"linux/arm/6":    {OS: "linux", Architecture: "arm", Variant: "v6"},
+		"macos/arm64":    {OS: "darwin", Architecture: "arm64"},
+		"i386":           {Architecture: "386"},
+	} {
+		p, err := ParsePlatform(specifier)
+		assert.NilError(t, err, specifier)
+		assert.Equal(t, p, expected, specifier)
+	}
+
+	for _, specifier := range []string{"", "linux/", "linux/amd64/v2/extra", "linux/amd 64", "foo"} {
+		_, err := ParsePlatform(specifier)
+		assert.Check(t, errdefs.IsInvalidError(err), specifier)
+	}
+	assert.Equal(t, Platform{OS: "linux", Architecture: "arm", Variant: "v7"}.String(), "linux/arm/v7")
+
+	assert.Check(t, Platform{OS: "linux"}.Matches(Platform{OS: "linux", Architecture: "amd64"}))
+	assert.Check(t, Platform{Architecture: "arm64"}.Matches(Platform{OS: "linux", Architecture: "arm64"}))
+	assert.Check(t, !Platform{OS: "linux", Architecture: "arm64"}.Matches(Platform{OS: "linux", Architecture: "amd64"}))
+}
+
+func TestPlatformString(t *testing.T) {
+	env := map[string]string{DefaultPlatformEnv: "linux/arm64"}
+	assert.Equal(t, ServiceConfig{Platform: "linux/amd64"}.PlatformString(env), "linux/amd64")
+	assert.Equal(t, ServiceConfig{}.PlatformString(env), "linux/arm64")
+	assert.Equal(t, ServiceConfig{}.PlatformString(nil), "")
+}
+
+func TestRuntimeNames(t *testing.T) {
+	p := Project{
+		Name: "myproject",
+		Networks: Networks{
+			"front":   NetworkConfig{},
+			"back":    NetworkConfig{Name: "my_back"},
+			"outside": NetworkConfig{External: External{External: true}},
+		},
+		Volumes: Volumes{
+			"data":   VolumeConfig{},
+			"shared": VolumeConfig{Name: "shared_data", External: External{External: true}},
+		},
+		Secrets: Secrets{"token": SecretConfig{External: External{External: true}}},
+		Configs: Configs{"settings": ConfigObjConfig{}},
+	}
+	assert.DeepEqual(t, p.NetworkRuntimeNames(), map[string]string{"front": "myproject_front", "back": "my_back", "outside": "outside"})
+	assert.DeepEqual(t, p.VolumeRuntimeNames(), map[string]string{"data": "myproject_data", "shared": "shared_data"})
+	assert.DeepEqual(t, p.SecretRuntimeNames(), map[string]string{"token": "token"})
+	assert.DeepEqual(t, p.ConfigRuntimeNames(), map[string]string{"settings": "myproject_settings"})
+}
+
+func TestGetScale(t *testing.T) {
+	zero := uint64(0)
+	assert.Equal(t, ServiceConfig{}.GetScale(), 1)
+	assert.Equal(t, ServiceConfig{Scale: 3}.GetScale(), 3)
+	assert.Equal(t, ServiceConfig{Scale: 3, Deploy: &DeployConfig{Replicas: &zero}}.GetScale(), 0)
+}
+
+func TestMappingWithEqualsUnset(t *testing.T) {
+	mapping := NewMappingWithEquals([]string{"FOO=foo", "BAR=", "BAZ", "QUX=a=b"})
+	foo, empty, qux := "foo", "", "a=b"
+	assert.DeepEqual(t, mapping, MappingWithEquals{"FOO": &foo, "BAR": &empty, "BAZ": nil, "QUX": &qux})
+	assert.DeepEqual(t, mapping.AsEqualsList(), []string{"BAR=", "BAZ", "FOO=foo", "QUX=a=b"})
+
+	mapping.Resolve(func(key string) (string, bool) {
+		return "from_" + key, true
+	})
+	assert.Equal(t, *mapping["BAR"], "")
+	assert.Equal(t, *mapping["BAZ"], "from_BAZ")
+
+	unset := MappingWithEquals{"FOO": nil, "BAR": &empty}
+	b, err := yaml.Marshal(unset)
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), "BAR: \"\"\nFOO: null\n")
+	b, err = json.Marshal(unset)
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), `{"BAR":"","FOO":null}`)
+}
+
+func TestServicePortConfigString(t *testing.T) {
+	testCases := []struct {
+		port     ServicePortConfig
+		expected string
+	}{
+		{port: ServicePortConfig{Target: 80}, expected: "80"},
+		{port: ServicePortConfig{Target: 80, Published: "8080", Protocol: "tcp"}, expected: "8080:80"},
+		{port: ServicePortConfig{Target: 53, Published: "5353", Protocol: "udp"}, expected: "5353:53/udp"},
+		{port: ServicePortConfig{Target: 80, Published: "8080-8090"}, expected: "8080-8090:80"},
+		{port: ServicePortConfig{Target: 80, HostIP: "127.0.0.1"}, expected: "127.0.0.1::80"},
+		{port: ServicePortConfig{Target: 80, HostIP: "::1", Published: "8080"}, expected: "[::1]:8080:80"},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.port.String(), tc.expected)
+		if tc.port.HostIP == "" || !strings.Contains(tc.port.HostIP, ":") {
+			parsed, err := ParsePortConfig(tc.expected)
+			assert.NilError(t, err)
+			assert.Equal(t, parsed[0].Published, tc.port.Published)
+		}
+	}
+}
+
+func TestServicePortConfigPublished(t *testing.T) {
+	for _, published := range []string{"", "0", "8080", "8080-8090"} {
+		assert.NilError(t, ServicePortConfig{Published: published}.ValidatePublished(), published)
+	}
+	for _, published := range []string{"http", "8090-8080", "99999", "-1"} {
+		err := ServicePortConfig{Published: published}.ValidatePublished()
+		assert.Check(t, errdefs.IsInvalidError(err), published)
+	}
+	assert.Check(t, ServicePortConfig{}.IsEphemeral())
+	assert.Check(t, ServicePortConfig{Published: "0"}.IsEphemeral())
+	assert.Check(t, !ServicePortConfig{Published: "8080-8090"}.IsEphemeral())
+
+	ports := []ServicePortConfig{
+		{Target: 80, Published: "8080-8090", Protocol: "tcp"},
+		{Target: 81, Published: "8081", Protocol: "tcp"},
+		{Target: 82, Protocol: "tcp"},
+	}
+	b, err := yaml.Marshal(ports)
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), `- target: 80
+  published: 8080-8090
+  protocol: tcp
+- target: 81
+  published: 8081
+  protocol: tcp
+- target: 82
+  protocol: tcp
+`)
+	b, err = json.Marshal(ports)
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), `[{"target":80,"published":"8080-8090","protocol":"tcp"},{"target":81,"published":8081,"protocol":"tcp"},{"target":82,"protocol":"tcp"}]`)
+}
+
+func TestLabels(t *testing.T) {
+	var fromList, fromMap Labels
+	assert.NilError(t, yaml.Unmarshal([]byte(`["b=2", "a=1=1", "c"]`), &fromList))
+	assert.NilError(t, yaml.Unmarshal([]byte(`{b: "2", a: "1=1", c: ""}`), &fromMap))
+	expected := Labels{"a": "1=1", "b": "2", "c": ""}
+	assert.DeepEqual(t, fromList, expected)
+	assert.DeepEqual(t, fromMap, expected)
+
+	fromList, fromMap = nil, nil
+	assert.NilError(t, json.Unmarshal([]byte(`["b=2", "a=1=1", "c"]`), &fromList))
+	assert.NilError(t, json.Unmarshal([]byte(`{"b": "2", "a": "1=1", "c": ""}`), &fromMap))
+	assert.DeepEqual(t, fromList, expected)
+	assert.DeepEqual(t, fromMap, expected)
+
+	assert.DeepEqual(t, expected.AsList(), []string{"a=1=1", "b=2", "c="})
+	assert.DeepEqual(t, Labels(nil).Add("a", "1"), Labels{"a": "1"})
+
+	b, err := yaml.Marshal(fromList)
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), "a: 1=1\nb: \"2\"\nc: \"\"\n")
+	b, err = json.Marshal(fromList)
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), `{"a":"1=1","b":"2","c":""}`)
+}
+
+func TestParseDevice(t *testing.T) {
+	for spec, expected := range map[string]ServiceDeviceConfig{
+		"/dev/ttyUSB0":                  {Source: "/dev/ttyUSB0", Target: "/dev/ttyUSB0", Permissions: "rwm"},
+		"/dev/ttyUSB0:/dev/ttyS0":       {Source: "/dev/ttyUSB0", Target: "/dev/ttyS0", Permissions: "rwm"},
+		"/dev/ttyUSB0:r":                {Source: "/dev/ttyUSB0", Target: "/dev/ttyUSB0", Permissions: "r"},
+		"/dev/ttyUSB0:/dev/ttyS0:rw":    {Source: "/dev/ttyUSB0", Target: "/dev/ttyS0", Permissions: "rw"},
+		"/dev/ttyUSB0:/dev/ttyUSB0:rwm": {Source: "/dev/ttyUSB0", Target: "/dev/ttyUSB0", Permissions: "rwm"},
+	} {
+		device, err := ParseDevice(spec)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, device, expected)
+	}
+
+	for _, invalid := range []string{"", ":/dev/ttyS0", "/dev/a:/dev/b:rw:m"} {
+		_, err := ParseDevice(invalid)
+		assert.ErrorContains(t, err, "invalid device specification", invalid)
+	}
+	assert.Check(t, !ValidDevicePermissions("rr"))
+	assert.Check(t, !ValidDevicePermissions("rx"))
+}
+
+func TestNormalizeCapabilities(t *testing.T) {
+	assert.DeepEqual(t, NormalizeCapabilities([]string{"sys_admin", "CAP_SYS_ADMIN", " net_raw", "ALL", "Cap_Net_Raw"}),
+		[]string{"SYS_ADMIN", "NET_RAW", "ALL"})
+	assert.Check(t, NormalizeCapabilities(nil) == nil)
+}
+
+func TestParseRestart(t *testing.T) {
+	three := uint64(3)
+	for spec, expected := range map[string]ServiceRestart{
+		"no":             {Condition: RestartNo},
+		"always":         {Condition: RestartAlways},
+		"unless-stopped": {Condition: RestartUnlessStopped},
+		"on-failure":     {Condition: RestartOnFailure},
+		"on-failure:3":   {Condition: RestartOnFailure, MaxRetries: &three},
+	} {
+		restart, err := ParseRestart(spec)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, restart, expected)
+		assert.Equal(t, restart.String(), spec)
+	}
+
+	for _, invalid := range []string{"", "false", "always:3", "on-failure:", "on-failure:-1"} {
+		_, err := ParseRestart(invalid)
+		assert.Check(t, errdefs.IsInvalidError(err))
+		assert.ErrorContains(t, err, "must be one of no, always, on-failure[:max-retries] or unless-stopped", invalid)
+	}
+}
+
+func TestParseServiceLink(t *testing.T) {
+	for spec, expected := range map[string]ServiceLink{
+		"db":          {Service: "db"},
+		"db:database": {Service: "db", Alias: "database"},
+	} {
+		link, err := ParseServiceLink(spec)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, link, expected)
+		assert.Equal(t, link.String(), spec)
+	}
+
+	for _, invalid := range []string{"", ":database", "db:"} {
+		_, err := ParseServiceLink(invalid)
+		assert.Check(t, errdefs.IsInvalidError(err), invalid)
+	}
+}
+
+func TestParseVolumesFrom(t *testing.T) {
+	for spec, expected := range map[string]VolumesFromSource{
+		"data":              {Kind: VolumesFromService, Name: "data"},
+		"data:ro":           {Kind: VolumesFromService, Name: "data", ReadOnly: true},
+		"container:legacy":  {Kind: VolumesFromContainer, Name: "legacy"},
+		"container:data:ro": {Kind: VolumesFromContainer, Name: "data", ReadOnly: true},
+	} {
+		source, err := ParseVolumesFrom(spec)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, source, expected)
+		assert.Equal(t, source.String(), spec)
+	}
+
+	source, err := ParseVolumesFrom("data:rw")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, source, VolumesFromSource{Kind: VolumesFromService, Name: "data"})
+
+	for _, invalid := range []string{"", ":ro", "container:", "container::rw", "data:rwx"} {
+		_, err := ParseVolumesFrom(invalid)
+		assert.Check(t, errdefs.IsInvalidError(err), invalid)
+	}
+}
+
+func TestPortStringRoundTrip(t *testing.T) {
+	for input, canonical := range map[string]string{
+		"80":                   "80",
+		"80/tcp":               "80",
+		"8080:80":              "8080:80",
+		"8080:80/udp":          "8080:80/udp",
+		"127.0.0.1:8080:80":    "127.0.0.1:8080:80",
+		"127.0.0.1::80/sctp":   "127.0.0.1::80/sctp",
+		"[::1]:8080:80":        "[::1]:8080:80",
+		"8000-8001:8000-8001":  "",
+		"0.0.0.0:9090-9091:80": "0.0.0.0:9090-9091:80",
+	} {
+		ports, err := ParsePortConfig(input)
+		assert.NilError(t, err, input)
+		for _, port := range ports {
+			if canonical != "" {
+				assert.Equal(t, port.String(), canonical, input)
+			}
+			reparsed, err := ParsePortConfig(port.String())
+			assert.NilError(t, err, input)
+			assert.DeepEqual(t, reparsed, []ServicePortConfig{port})
+		}
+	}
+}
+
+func TestEnvironmentAndLabelsAsList(t *testing.T) {
+	environment := NewMappingWithEquals([]string{"B=2", "A-B=3", "A=1", "UNSET", "EMPTY="})
+	assert.DeepEqual(t, environment.AsEqualsList(), []string{"A=1", "A-B=3", "B=2", "EMPTY=", "UNSET"})
+	assert.DeepEqual(t, NewMappingWithEquals(environment.AsEqualsList()), environment)
+
+	labels := Labels{"b": "2", "a-b": "3", "a": "1=1"}
+	assert.DeepEqual(t, labels.AsList(), []string{"a=1=1", "a-b=3", "b=2"})
+	var fromList Labels
+	assert.NilError(t, yaml.Unmarshal([]byte("[b=2, a-b=3, a=1=1]"), &fromList))
+	assert.DeepEqual(t, fromList.AsList(), labels.AsList())
+}
+
+func TestParsePullPolicy(t *testing.T) {
+	for policy, expected := range map[string]PullPolicy{
+		"always":         PullPolicyAlways,
+		"never":          PullPolicyNever,
+		"if_not_present": PullPolicyIfNotPresent,
+		"missing":        PullPolicyIfNotPresent,
+		"build":          PullPolicyBuild,
+	} {
+		p, err := ParsePullPolicy(policy)
+		assert.NilError(t, err)
+		assert.Equal(t, p, expected)
+	}
+	_, err := ParsePullPolicy("sometimes")
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, "must be one of always, never, if_not_present, missing or build")
+}
+
+func TestParseTmpfs(t *testing.T) {
+	for spec, expected := range map[string]TmpfsMount{
+		"/run":                             {Target: "/run"},
+		"/run:size=64m":                    {Target: "/run", Size: 64 * 1024 * 1024},
+		"/run:rw,noexec,size=1k,mode=1777": {Target: "/run", Size: 1024, Options: []string{"rw", "noexec", "mode=1777"}},
+	} {
+		mount, err := ParseTmpfs(spec)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, mount, expected)
+	}
+
+	for _, invalid := range []string{"", ":size=1m", "/run:size=lots"} {
+		_, err := ParseTmpfs(invalid)
+		assert.Check(t, errdefs.IsInvalidError(err), invalid)
+	}
+}
+
+func TestNewHostsList(t *testing.T) {
+	hosts, err := NewHostsList([]string{
+		"alpha:50.31.209.229",
+		"alpha=50.31.209.230",
+		"beta:[::1]",
+		"beta:ff02::1",
+		"gamma:host-gateway",
+		"alpha:50.31.209.229",
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, hosts, HostsList{
+		"alpha:50.31.209.229",
+		"alpha:50.31.209.230",
+		"beta:::1",
+		"beta:ff02::1",
+		"gamma:host-gateway",
+	})
+	assert.DeepEqual(t, HostsList{"beta:[::1]", "alpha:50.31.209.229"}.AsList(), []string{"beta:::1", "alpha:50.31.209.229"})
+	assert.DeepEqual(t, hosts.Hosts(), map[string][]string{
+		"alpha": {"50.31.209.229", "50.31.209.230"},
+		"beta":  {"::1", "ff02::1"},
+		"gamma": {"host-gateway"},
+	})
+
+	for _, invalid := range []string{"alpha", ":50.31.209.229", "alpha:localhost", "alpha:[::1"} {
+		_, err := NewHostsList([]string{invalid})
+		assert.Check(t, errdefs.IsInvalidError(err), invalid)
+	}
+}